@@ -3,8 +3,10 @@ package api
 import (
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/audit"
 	"github.com/macrat/lauth/config"
 	"github.com/macrat/lauth/errors"
 	"github.com/macrat/lauth/ldap"
@@ -13,25 +15,151 @@ import (
 )
 
 type LauthAPI struct {
-	Connector    ldap.Connector
-	Config       *config.Config
-	TokenManager token.Manager
+	Connector      ldap.Connector
+	Failover       *ldap.FailoverConnector
+	Config         *config.Config
+	TokenManager   token.Manager
+	TenantManagers map[string]token.Manager
+	Nonces         *NonceStore
+	Codes          *CodeStore
+	Sessions       *SessionStore
+	Maintenance    *Maintenance
+	Readiness      *Readiness
+	Audit          *audit.Logger
+	Live           *LiveConfig
+}
+
+// current returns LauthAPI that uses the latest config in Live.
+// It is the api itself if Live is nil or not changed.
+func (api *LauthAPI) current() *LauthAPI {
+	conf := api.Live.Load()
+	if conf == nil || conf == api.Config {
+		return api
+	}
+
+	copied := *api
+	copied.Config = conf
+	return &copied
+}
+
+// forHost returns LauthAPI for the request that came to the host.
+// It is the api itself unless host-based issuer is enabled by IssuerHosts, or the config is replaced through Live.
+// TokenManager is replaced by TenantManagers[host] if the host has its own keys, where host is in lower case.
+func (api *LauthAPI) forHost(host string) (*LauthAPI, *errors.Error) {
+	api = api.current()
+
+	if len(api.Config.IssuerHosts) == 0 {
+		return api, nil
+	}
+
+	issuer, ok := api.Config.IssuerFor(host)
+	if !ok {
+		return nil, &errors.Error{
+			Reason:      errors.InvalidRequest,
+			Description: "this host is not allowed",
+		}
+	}
+
+	conf := *api.Config
+	conf.Issuer = issuer
+
+	tokenManager := api.TokenManager
+	if m, ok := api.TenantManagers[issuer.Host]; ok {
+		tokenManager = m
+	}
+
+	copied := *api
+	copied.Config = &conf
+	copied.TokenManager = tokenManager
+	return &copied, nil
+}
+
+func (api *LauthAPI) handle(handler func(*LauthAPI, *gin.Context)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		hostAPI, err := api.forHost(c.Request.Host)
+		if err != nil {
+			report := metrics.StartLogging(c)
+			defer report.Close()
+
+			report.SetError(err)
+			errors.SendJSON(c, err)
+			return
+		}
+
+		handler(hostAPI, c)
+	}
+}
+
+// tokenRequestID returns the request ID to include in tokens as rid claim.
+// It is empty unless RequestIDClaim is enabled.
+func (api *LauthAPI) tokenRequestID(c *gin.Context) string {
+	if !api.Config.RequestIDClaim {
+		return ""
+	}
+	return metrics.RequestID(c)
+}
+
+// authentication returns how the user was authenticated, to be stored in code and tokens.
+//
+// ACR and AMR are empty unless AuthContextClaims is enabled.
+// But ACR is always set for the client that requires acr, because tokens for it are issued only if it is satisfied.
+func (api *LauthAPI) authentication(clientID string, authTime time.Time, acr string) token.Authentication {
+	if !api.Config.AuthContextClaims {
+		if api.Config.Clients[clientID].RequireACR != "" {
+			return token.Authentication{Time: authTime, ACR: acr}
+		}
+		return token.Authentication{Time: authTime}
+	}
+	return token.Authentication{
+		Time: authTime,
+		ACR:  acr,
+		AMR:  []string{config.AMR_PASSWORD},
+	}
+}
+
+// authzError sets the issuer to the error of the authorization endpoint if StrictOIDC is enabled, as RFC 9207 says.
+func (api *LauthAPI) authzError(e *errors.Error) *errors.Error {
+	if api.Config.StrictOIDC {
+		e.Issuer = api.Config.Issuer.String()
+	}
+	return e
+}
+
+// setIDTokenClaims sets claims of ID token that don't come from the user attributes.
+func (api *LauthAPI) setIDTokenClaims(c *gin.Context, clientID string, claims map[string]interface{}) {
+	if rid := api.tokenRequestID(c); rid != "" {
+		claims["rid"] = rid
+	}
+
+	client := api.Config.Clients[clientID]
+
+	// ID token of lauth always has single audience that is the authorized party, so azp is optional in the spec.
+	// But some clients expect it, so it is set if the client wants.
+	if client.IncludeAzp {
+		claims["azp"] = clientID
+	}
 }
 
 func (api *LauthAPI) SetRoutes(r gin.IRoutes) {
 	endpoints := api.Config.EndpointPaths()
 
-	r.GET(endpoints.OpenIDConfiguration, api.GetConfiguration)
-	r.GET(endpoints.Authz, api.GetAuthz)
-	r.POST(endpoints.Authz, api.PostAuthz)
-	r.POST(endpoints.Token, api.PostToken)
-	r.OPTIONS(endpoints.Token, api.OptionsToken)
-	r.GET(endpoints.Userinfo, api.GetUserInfo)
-	r.POST(endpoints.Userinfo, api.PostUserInfo)
-	r.OPTIONS(endpoints.Userinfo, api.OptionsUserInfo)
-	r.GET(endpoints.Jwks, api.GetCerts)
-	r.GET(endpoints.Logout, api.Logout)
-	r.POST(endpoints.Logout, api.Logout)
+	r.GET(endpoints.OpenIDConfiguration, api.handle((*LauthAPI).GetConfiguration))
+	r.GET(endpoints.Authz, api.handle(unlessMaintenance(true, (*LauthAPI).GetAuthz)))
+	r.POST(endpoints.Authz, api.handle(unlessMaintenance(true, (*LauthAPI).PostAuthz)))
+	r.POST(endpoints.Token, api.handle(unlessMaintenance(false, (*LauthAPI).PostToken)))
+	r.OPTIONS(endpoints.Token, api.handle((*LauthAPI).OptionsToken))
+	r.GET(endpoints.Userinfo, api.handle(unlessMaintenance(false, (*LauthAPI).GetUserInfo)))
+	r.POST(endpoints.Userinfo, api.handle(unlessMaintenance(false, (*LauthAPI).PostUserInfo)))
+	r.OPTIONS(endpoints.Userinfo, api.handle((*LauthAPI).OptionsUserInfo))
+	r.GET(endpoints.Jwks, api.handle((*LauthAPI).GetCerts))
+	r.GET(endpoints.Logout, api.handle((*LauthAPI).Logout))
+	r.POST(endpoints.Logout, api.handle((*LauthAPI).Logout))
+	r.POST(endpoints.Introspection, api.handle(unlessMaintenance(false, (*LauthAPI).PostIntrospect)))
+	r.POST(endpoints.Revocation, api.handle(unlessMaintenance(false, (*LauthAPI).PostRevoke)))
+
+	if api.Config.DebugTokenPath != "" {
+		r.POST(api.Config.DebugTokenPath, api.handle((*LauthAPI).PostDebugToken))
+	}
 }
 
 func (api *LauthAPI) SetErrorRoutes(r *gin.Engine) {
@@ -46,13 +174,25 @@ func (api *LauthAPI) SetErrorRoutes(r *gin.Engine) {
 			Description: fmt.Sprintf("%s method is not supported in this page", c.Request.Method),
 		}
 
+		allows := map[string]string{
+			endpoints.OpenIDConfiguration: "GET",
+			endpoints.Authz:               "GET, POST",
+			endpoints.Token:               "POST, OPTIONS",
+			endpoints.Userinfo:            "GET, POST, OPTIONS",
+			endpoints.Jwks:                "GET",
+			endpoints.Introspection:       "POST",
+			endpoints.Revocation:          "POST",
+		}
+
 		switch c.Request.URL.Path {
 		case endpoints.Authz:
 			report.SetError(methodNotAllowed)
+			c.Header("Allow", allows[c.Request.URL.Path])
 			errors.SendHTML(c, methodNotAllowed)
-		case endpoints.OpenIDConfiguration, endpoints.Token, endpoints.Userinfo, endpoints.Jwks:
+		case endpoints.OpenIDConfiguration, endpoints.Token, endpoints.Userinfo, endpoints.Jwks, endpoints.Introspection, endpoints.Revocation:
 			report.SetError(methodNotAllowed)
-			c.JSON(http.StatusMethodNotAllowed, methodNotAllowed)
+			c.Header("Allow", allows[c.Request.URL.Path])
+			errors.SendJSON(c, methodNotAllowed)
 		default:
 			notFound := &errors.Error{
 				Reason:      errors.PageNotFound,
@@ -64,13 +204,45 @@ func (api *LauthAPI) SetErrorRoutes(r *gin.Engine) {
 	})
 }
 
+// notModified sets Last-Modified header, and responds 304 if the client's copy is not older than modified.
+// It returns true if the response has been sent.
+func notModified(c *gin.Context, modified time.Time) bool {
+	modified = modified.UTC().Truncate(time.Second)
+	c.Header("Last-Modified", modified.Format(http.TimeFormat))
+
+	since, err := http.ParseTime(c.GetHeader("If-Modified-Since"))
+	if err != nil || modified.After(since) {
+		return false
+	}
+
+	c.Status(http.StatusNotModified)
+	return true
+}
+
+// modifiedAt returns the last time that the discovery document or the published keys changed.
+// It is the later of when the keys changed and when the config was reloaded.
+func (api *LauthAPI) modifiedAt() time.Time {
+	modified := api.TokenManager.ModifiedAt()
+	if loaded := api.Live.LoadedAt(); loaded.After(modified) {
+		modified = loaded
+	}
+	return modified
+}
+
 func (api *LauthAPI) GetConfiguration(c *gin.Context) {
 	report := metrics.StartLogging(c)
 	defer report.Close()
 
 	c.Header("Access-Control-Allow-Origin", "*")
 
-	c.IndentedJSON(200, api.Config.OpenIDConfiguration())
+	if notModified(c, api.modifiedAt()) {
+		return
+	}
+
+	conf := api.Config.OpenIDConfiguration()
+	conf.IDTokenSigningAlgValuesSupported = api.TokenManager.SigningAlgorithms()
+
+	c.IndentedJSON(200, conf)
 }
 
 func (api *LauthAPI) GetCerts(c *gin.Context) {
@@ -79,6 +251,10 @@ func (api *LauthAPI) GetCerts(c *gin.Context) {
 
 	c.Header("Access-Control-Allow-Origin", "*")
 
+	if notModified(c, api.modifiedAt()) {
+		return
+	}
+
 	keys, err := api.TokenManager.JWKs(api.Config.Issuer.Hostname())
 	if err != nil {
 		e := &errors.Error{
@@ -1,14 +1,28 @@
 package api_test
 
 import (
+	"bytes"
 	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/macrat/lauth/api"
+	"github.com/macrat/lauth/audit"
+	"github.com/macrat/lauth/config"
 	"github.com/macrat/lauth/testutil"
+	"github.com/macrat/lauth/token"
 	"github.com/rs/zerolog"
 )
 
@@ -40,6 +54,16 @@ func TestErrorRoutes(t *testing.T) {
 		t.Errorf("expected status code 405 but got %d", resp.Code)
 	} else if resp.Header().Get("Content-Type") != "application/json; charset=utf-8" {
 		t.Errorf("unexpected content-type: %s", resp.Header().Get("Content-Type"))
+	} else if resp.Header().Get("Allow") != "POST, OPTIONS" {
+		t.Errorf("unexpected allow header: %s", resp.Header().Get("Allow"))
+	}
+
+	req, _ = http.NewRequest("PUT", "/userinfo", nil)
+	resp = env.DoRequest(req)
+	if resp.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected status code 405 but got %d", resp.Code)
+	} else if resp.Header().Get("Allow") != "GET, POST, OPTIONS" {
+		t.Errorf("unexpected allow header: %s", resp.Header().Get("Allow"))
 	}
 }
 
@@ -66,7 +90,7 @@ func TestOpenIDConfiguration(t *testing.T) {
 func TestGetCerts(t *testing.T) {
 	env := testutil.NewAPITestEnvironment(t)
 
-	token, err := env.API.TokenManager.CreateAccessToken(env.API.Config.Issuer, "someone", "something", "profile", time.Now(), 5*time.Minute)
+	token, err := env.API.TokenManager.CreateAccessToken(env.API.Config.Issuer, "someone", "something", "profile", "", token.Authentication{Time: time.Now()}, 5*time.Minute)
 	if err != nil {
 		t.Fatalf("failed to generate test token: %s", err)
 	}
@@ -82,3 +106,774 @@ func TestGetCerts(t *testing.T) {
 		t.Errorf("failed verify signature using jwks key: %s", err)
 	}
 }
+
+func TestSigningAlgorithms(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	if err := env.API.TokenManager.Rotate(ecKey, time.Hour); err != nil {
+		t.Fatalf("failed to rotate key: %s", err)
+	}
+
+	token, err := env.API.TokenManager.CreateAccessToken(env.API.Config.Issuer, "someone", "something", "profile", "", token.Authentication{Time: time.Now()}, 5*time.Minute)
+	if err != nil {
+		t.Fatalf("failed to generate test token: %s", err)
+	}
+
+	resp := env.Get("/.well-known/openid-configuration", "", nil)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", resp.Code)
+	}
+	var conf config.OpenIDConfiguration
+	if err := json.Unmarshal(resp.Body.Bytes(), &conf); err != nil {
+		t.Fatalf("failed to parse discovery: %s", err)
+	}
+	if !reflect.DeepEqual(conf.IDTokenSigningAlgValuesSupported, []string{"ES256", "RS256"}) {
+		t.Errorf("unexpected id_token_signing_alg_values_supported: %v", conf.IDTokenSigningAlgValuesSupported)
+	}
+
+	stop := env.Start(t)
+	defer stop()
+
+	jwks := oidc.NewRemoteKeySet(context.TODO(), env.API.Config.OpenIDConfiguration().JwksEndpoint)
+	if _, err := jwks.VerifySignature(context.TODO(), token); err != nil {
+		t.Errorf("failed verify ES256 signature using jwks key: %s", err)
+	}
+}
+
+func TestDiscovery_LDAPUnavailable(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Connector = testutil.UnavailableLDAP{}
+
+	for _, path := range []string{"/.well-known/openid-configuration", "/certs"} {
+		if resp := env.Get(path, "", nil); resp.Code != http.StatusOK {
+			t.Errorf("%s: expected status code 200 even if LDAP is unavailable but got %d", path, resp.Code)
+		}
+	}
+}
+
+func TestHostBasedIssuer(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.IssuerHosts = []string{"a.example.com", "b.example.com:8000"}
+
+	doRequest := func(method, rawURL string, body url.Values) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, rawURL, strings.NewReader(body.Encode()))
+		req.RemoteAddr = "[::1]:54321"
+		if body != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		return env.DoRequest(req)
+	}
+
+	t.Run("discovery", func(t *testing.T) {
+		for _, host := range []string{"a.example.com", "b.example.com:8000"} {
+			resp := doRequest("GET", "http://"+host+"/.well-known/openid-configuration", nil)
+			if resp.Code != http.StatusOK {
+				t.Fatalf("%s: unexpected status code: %d", host, resp.Code)
+			}
+
+			var conf config.OpenIDConfiguration
+			if err := json.Unmarshal(resp.Body.Bytes(), &conf); err != nil {
+				t.Fatalf("%s: failed to unmarshal response: %s", host, err)
+			}
+			if conf.Issuer != "http://"+host {
+				t.Errorf("%s: unexpected issuer: %s", host, conf.Issuer)
+			}
+			if conf.TokenEndpoint != "http://"+host+"/token" {
+				t.Errorf("%s: unexpected token endpoint: %s", host, conf.TokenEndpoint)
+			}
+		}
+	})
+
+	t.Run("not allowed host", func(t *testing.T) {
+		resp := doRequest("GET", "http://c.example.com/.well-known/openid-configuration", nil)
+		if resp.Code != http.StatusBadRequest {
+			t.Errorf("unexpected status code: %d", resp.Code)
+		}
+	})
+
+	issuer := &config.URL{Scheme: "http", Host: "a.example.com"}
+	makeCode := func() string {
+		code, err := env.API.TokenManager.CreateCode(
+			issuer,
+			"macrat",
+			"some_client_id",
+			"http://some-client.example.com/callback",
+			"openid",
+			"",
+			token.Authentication{Time: time.Now()},
+			time.Minute,
+		)
+		if err != nil {
+			t.Fatalf("failed to generate code: %s", err)
+		}
+		return code
+	}
+	tokenRequest := func(code string) url.Values {
+		return url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"client_id":     {"some_client_id"},
+			"client_secret": {"secret for some-client"},
+			"redirect_uri":  {"http://some-client.example.com/callback"},
+		}
+	}
+
+	t.Run("token", func(t *testing.T) {
+		resp := doRequest("POST", "http://a.example.com/token", tokenRequest(makeCode()))
+		if resp.Code != http.StatusOK {
+			t.Fatalf("unexpected status code: %d: %s", resp.Code, resp.Body.String())
+		}
+
+		var body api.PostTokenResponse
+		if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+			t.Fatalf("failed to unmarshal response: %s", err)
+		}
+
+		idToken, err := env.API.TokenManager.ParseIDToken(body.IDToken)
+		if err != nil {
+			t.Fatalf("failed to parse id_token: %s", err)
+		}
+		if idToken.Issuer != "http://a.example.com" {
+			t.Errorf("unexpected issuer of id_token: %s", idToken.Issuer)
+		}
+
+		accessToken, err := env.API.TokenManager.ParseAccessToken(body.AccessToken)
+		if err != nil {
+			t.Fatalf("failed to parse access_token: %s", err)
+		}
+		if err := accessToken.Validate(issuer); err != nil {
+			t.Errorf("failed to validate access_token: %s", err)
+		}
+	})
+
+	t.Run("token of another host", func(t *testing.T) {
+		resp := doRequest("POST", "http://b.example.com:8000/token", tokenRequest(makeCode()))
+		if resp.Code != http.StatusBadRequest {
+			t.Errorf("unexpected status code: %d", resp.Code)
+		}
+	})
+}
+
+func TestHostBasedIssuer_TenantKeys(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.IssuerHosts = []string{"a.example.com", "b.example.com"}
+
+	managers := make(map[string]token.Manager)
+	for _, host := range env.API.Config.IssuerHosts {
+		m, err := testutil.MakeTokenManager()
+		if err != nil {
+			t.Fatalf("failed to make token manager: %s", err)
+		}
+		managers[host] = m
+	}
+	env.API.TenantManagers = managers
+
+	doRequest := func(method, rawURL string, body url.Values) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, rawURL, strings.NewReader(body.Encode()))
+		req.RemoteAddr = "[::1]:54321"
+		if body != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		return env.DoRequest(req)
+	}
+
+	kids := make(map[string]string)
+	for _, host := range env.API.Config.IssuerHosts {
+		resp := doRequest("GET", "http://"+host+"/certs", nil)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("%s: unexpected status code: %d", host, resp.Code)
+		}
+
+		var jwks struct {
+			Keys []token.JWK `json:"keys"`
+		}
+		if err := json.Unmarshal(resp.Body.Bytes(), &jwks); err != nil {
+			t.Fatalf("%s: failed to unmarshal JWKs: %s", host, err)
+		}
+		for _, k := range jwks.Keys {
+			if other, ok := kids[k.KeyID]; ok {
+				t.Errorf("%s: key %s is shared with %s", host, k.KeyID, other)
+			}
+			kids[k.KeyID] = host
+		}
+	}
+
+	issuer := &config.URL{Scheme: "http", Host: "a.example.com"}
+	code, err := managers["a.example.com"].CreateCode(
+		issuer,
+		"macrat",
+		"some_client_id",
+		"http://some-client.example.com/callback",
+		"openid",
+		"",
+		token.Authentication{Time: time.Now()},
+		time.Minute,
+	)
+	if err != nil {
+		t.Fatalf("failed to generate code: %s", err)
+	}
+
+	resp := doRequest("POST", "http://a.example.com/token", url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"client_id":     {"some_client_id"},
+		"client_secret": {"secret for some-client"},
+		"redirect_uri":  {"http://some-client.example.com/callback"},
+	})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d: %s", resp.Code, resp.Body.String())
+	}
+
+	var body api.PostTokenResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to unmarshal response: %s", err)
+	}
+
+	if _, err := managers["a.example.com"].ParseIDToken(body.IDToken); err != nil {
+		t.Errorf("failed to parse id_token by the key of its own tenant: %s", err)
+	}
+	if _, err := managers["b.example.com"].ParseIDToken(body.IDToken); err == nil {
+		t.Errorf("id_token should not be verifiable by the key of another tenant")
+	}
+	if _, err := env.API.TokenManager.ParseIDToken(body.IDToken); err == nil {
+		t.Errorf("id_token should not be verifiable by the default key")
+	}
+
+	req, _ := http.NewRequest("GET", "http://b.example.com/userinfo", nil)
+	req.Header.Set("Authorization", "Bearer "+body.AccessToken)
+	if resp = env.DoRequest(req); resp.Code != http.StatusUnauthorized {
+		t.Errorf("access_token should be rejected by another tenant but got status code %d", resp.Code)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	requestToken := func(t *testing.T, requestID string) (*httptest.ResponseRecorder, api.PostTokenResponse) {
+		code, err := env.API.TokenManager.CreateCode(
+			env.API.Config.Issuer,
+			"macrat",
+			"some_client_id",
+			"http://some-client.example.com/callback",
+			"openid",
+			"",
+			token.Authentication{Time: time.Now()},
+			env.API.Config.Expire.Code.Duration(),
+		)
+		if err != nil {
+			t.Fatalf("failed to generate test code: %s", err)
+		}
+
+		req := httptest.NewRequest("POST", "/token", strings.NewReader(url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"client_id":     {"some_client_id"},
+			"client_secret": {"secret for some-client"},
+			"redirect_uri":  {"http://some-client.example.com/callback"},
+		}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if requestID != "" {
+			req.Header.Set("X-Request-ID", requestID)
+		}
+		resp := env.DoRequest(req)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("unexpected status code: %d: %s", resp.Code, resp.Body.String())
+		}
+
+		var body api.PostTokenResponse
+		if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+			t.Fatalf("failed to unmarshal response: %s", err)
+		}
+		return resp, body
+	}
+
+	t.Run("header", func(t *testing.T) {
+		resp, _ := requestToken(t, "abc-123")
+		if rid := resp.Header().Get("X-Request-ID"); rid != "abc-123" {
+			t.Errorf("unexpected X-Request-ID: %#v", rid)
+		}
+
+		for _, invalid := range []string{"", "has space", strings.Repeat("a", 129)} {
+			resp, _ := requestToken(t, invalid)
+			if rid := resp.Header().Get("X-Request-ID"); rid == "" || rid == invalid {
+				t.Errorf("%#v: request ID should be generated but got %#v", invalid, rid)
+			}
+		}
+	})
+
+	t.Run("claim disabled", func(t *testing.T) {
+		env.API.Config.RequestIDClaim = false
+
+		_, body := requestToken(t, "abc-123")
+
+		accessToken, err := env.API.TokenManager.ParseAccessToken(body.AccessToken)
+		if err != nil {
+			t.Fatalf("failed to parse access_token: %s", err)
+		}
+		if accessToken.RequestID != "" {
+			t.Errorf("rid should be absent but got %#v", accessToken.RequestID)
+		}
+
+		idToken, err := env.API.TokenManager.ParseIDToken(body.IDToken)
+		if err != nil {
+			t.Fatalf("failed to parse id_token: %s", err)
+		}
+		if rid, ok := idToken.ExtraClaims["rid"]; ok {
+			t.Errorf("rid should be absent but got %#v", rid)
+		}
+	})
+
+	t.Run("claim enabled", func(t *testing.T) {
+		env.API.Config.RequestIDClaim = true
+
+		_, body := requestToken(t, "abc-123")
+
+		accessToken, err := env.API.TokenManager.ParseAccessToken(body.AccessToken)
+		if err != nil {
+			t.Fatalf("failed to parse access_token: %s", err)
+		}
+		if accessToken.RequestID != "abc-123" {
+			t.Errorf("unexpected rid in access_token: %#v", accessToken.RequestID)
+		}
+
+		idToken, err := env.API.TokenManager.ParseIDToken(body.IDToken)
+		if err != nil {
+			t.Fatalf("failed to parse id_token: %s", err)
+		}
+		if rid := idToken.ExtraClaims["rid"]; rid != "abc-123" {
+			t.Errorf("unexpected rid in id_token: %#v", rid)
+		}
+	})
+}
+
+func TestAuditEvents(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	ssoToken, err := env.API.TokenManager.CreateSSOToken(
+		env.API.Config.Issuer,
+		"macrat",
+		"",
+		token.AuthorizedParties{"some_client_id"},
+		time.Now(),
+		time.Now().Add(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("failed to create sso token: %s", err)
+	}
+	ssoCookie := &http.Cookie{Name: api.SSO_TOKEN_COOKIE, Value: ssoToken}
+
+	requestObject := func(t *testing.T) string {
+		request, err := env.API.TokenManager.CreateRequestObject(
+			env.API.Config.Issuer,
+			"::1",
+			token.RequestObjectClaims{
+				ClientID:     "implicit_client_id",
+				RedirectURI:  "http://implicit-client.example.com/callback",
+				ResponseType: "id_token",
+				Scope:        "openid",
+				Nonce:        "this-is-nonce",
+			},
+			time.Now().Add(10*time.Minute),
+		)
+		if err != nil {
+			t.Fatalf("failed to make request object: %s", err)
+		}
+		return request
+	}
+
+	accessToken := func(t *testing.T, clientID string) string {
+		token, err := env.API.TokenManager.CreateAccessToken(
+			env.API.Config.Issuer,
+			"macrat",
+			clientID,
+			"openid",
+			"",
+			token.Authentication{Time: time.Now()},
+			10*time.Minute,
+		)
+		if err != nil {
+			t.Fatalf("failed to create access_token: %s", err)
+		}
+		return token
+	}
+
+	postForm := func(path string, values url.Values, cookie *http.Cookie) *http.Request {
+		req, _ := http.NewRequest("POST", path, strings.NewReader(values.Encode()))
+		req.RemoteAddr = "[::1]:54321"
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		return req
+	}
+
+	tests := []struct {
+		Name    string
+		Request func(t *testing.T) *http.Request
+		Event   audit.Event
+	}{
+		{
+			Name: "login",
+			Request: func(t *testing.T) *http.Request {
+				return postForm("/authz", url.Values{
+					"request":  {requestObject(t)},
+					"username": {"macrat"},
+					"password": {"foobar"},
+				}, nil)
+			},
+			Event: audit.Event{Action: audit.Login, Result: audit.RESULT_SUCCESS, Subject: "macrat", ClientID: "implicit_client_id", Scope: "openid"},
+		},
+		{
+			Name: "login failure",
+			Request: func(t *testing.T) *http.Request {
+				return postForm("/authz", url.Values{
+					"request":  {requestObject(t)},
+					"username": {"macrat"},
+					"password": {"invalid"},
+				}, nil)
+			},
+			Event: audit.Event{Action: audit.Login, Result: audit.RESULT_FAILURE, Subject: "macrat", ClientID: "implicit_client_id", Scope: "openid", Error: "invalid_request"},
+		},
+		{
+			Name: "sso login",
+			Request: func(t *testing.T) *http.Request {
+				req, _ := http.NewRequest("GET", "/authz?"+url.Values{
+					"client_id":     {"some_client_id"},
+					"redirect_uri":  {"http://some-client.example.com/callback"},
+					"response_type": {"code"},
+					"scope":         {"openid"},
+				}.Encode(), nil)
+				req.AddCookie(ssoCookie)
+				return req
+			},
+			Event: audit.Event{Action: audit.SSOLogin, Result: audit.RESULT_SUCCESS, Subject: "macrat", ClientID: "some_client_id", Scope: "openid"},
+		},
+		{
+			Name: "consent",
+			Request: func(t *testing.T) *http.Request {
+				return postForm("/authz", url.Values{
+					"request": {requestObject(t)},
+				}, ssoCookie)
+			},
+			Event: audit.Event{Action: audit.Consent, Result: audit.RESULT_SUCCESS, Subject: "macrat", ClientID: "implicit_client_id", Scope: "openid"},
+		},
+		{
+			Name: "token",
+			Request: func(t *testing.T) *http.Request {
+				code, err := env.API.TokenManager.CreateCode(
+					env.API.Config.Issuer,
+					"macrat",
+					"some_client_id",
+					"http://some-client.example.com/callback",
+					"openid",
+					"",
+					token.Authentication{Time: time.Now()},
+					env.API.Config.Expire.Code.Duration(),
+				)
+				if err != nil {
+					t.Fatalf("failed to create code: %s", err)
+				}
+				return postForm("/token", url.Values{
+					"grant_type":    {"authorization_code"},
+					"code":          {code},
+					"client_id":     {"some_client_id"},
+					"client_secret": {"secret for some-client"},
+					"redirect_uri":  {"http://some-client.example.com/callback"},
+				}, nil)
+			},
+			Event: audit.Event{Action: audit.Token, Result: audit.RESULT_SUCCESS, Subject: "macrat", ClientID: "some_client_id", Scope: "openid"},
+		},
+		{
+			Name: "logout",
+			Request: func(t *testing.T) *http.Request {
+				idToken, err := env.API.TokenManager.CreateIDToken(
+					env.API.Config.Issuer,
+					"macrat",
+					"some_client_id",
+					"",
+					"",
+					"",
+					nil,
+					token.Authentication{Time: time.Now()},
+					10*time.Minute,
+				)
+				if err != nil {
+					t.Fatalf("failed to create id_token: %s", err)
+				}
+				req, _ := http.NewRequest("GET", "/logout?"+url.Values{"id_token_hint": {idToken}}.Encode(), nil)
+				req.AddCookie(ssoCookie)
+				return req
+			},
+			Event: audit.Event{Action: audit.Logout, Result: audit.RESULT_SUCCESS, Subject: "macrat", ClientID: "some_client_id"},
+		},
+		{
+			Name: "revoke",
+			Request: func(t *testing.T) *http.Request {
+				return postForm("/revoke", url.Values{
+					"client_id":     {"some_client_id"},
+					"client_secret": {"secret for some-client"},
+					"token":         {accessToken(t, "some_client_id")},
+				}, nil)
+			},
+			Event: audit.Event{Action: audit.Revoke, Result: audit.RESULT_SUCCESS, Subject: "macrat", ClientID: "some_client_id"},
+		},
+		{
+			Name: "revoke failure",
+			Request: func(t *testing.T) *http.Request {
+				return postForm("/revoke", url.Values{
+					"client_id":     {"some_client_id"},
+					"client_secret": {"secret for some-client"},
+					"token":         {accessToken(t, "implicit_client_id")},
+				}, nil)
+			},
+			Event: audit.Event{Action: audit.Revoke, Result: audit.RESULT_FAILURE, Subject: "macrat", ClientID: "some_client_id", Error: "unauthorized_client"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			buf := new(bytes.Buffer)
+			env.API.Audit = audit.NewLogger(buf, audit.FORMAT_JSON, nil)
+
+			env.DoRequest(tt.Request(t))
+
+			var event audit.Event
+			if err := json.Unmarshal(buf.Bytes(), &event); err != nil {
+				t.Fatalf("failed to parse audit event %q: %s", buf.String(), err)
+			}
+			if event.Time.IsZero() {
+				t.Errorf("time of event is not set")
+			}
+			event.Time = time.Time{}
+			event.RemoteAddr = ""
+			event.RequestID = ""
+
+			if !reflect.DeepEqual(event, tt.Event) {
+				t.Errorf("unexpected event\nexpected: %#v\n but got: %#v", tt.Event, event)
+			}
+		})
+	}
+}
+
+func TestIfModifiedSince(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	conditionalGet := func(path, since string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		if since != "" {
+			req.Header.Set("If-Modified-Since", since)
+		}
+		return env.DoRequest(req)
+	}
+
+	for _, path := range []string{"/.well-known/openid-configuration", "/certs"} {
+		resp := conditionalGet(path, "")
+		if resp.Code != http.StatusOK {
+			t.Fatalf("%s: unexpected status code: %d", path, resp.Code)
+		}
+		lastModified := resp.Header().Get("Last-Modified")
+		if _, err := http.ParseTime(lastModified); err != nil {
+			t.Fatalf("%s: invalid Last-Modified header: %#v", path, lastModified)
+		}
+
+		if resp := conditionalGet(path, lastModified); resp.Code != http.StatusNotModified {
+			t.Errorf("%s: expected not modified but got status code %d", path, resp.Code)
+		} else if resp.Body.Len() != 0 {
+			t.Errorf("%s: not modified response should not have body", path)
+		}
+
+		if resp := conditionalGet(path, "Mon, 02 Jan 2006 15:04:05 GMT"); resp.Code != http.StatusOK {
+			t.Errorf("%s: expected modified since old date but got status code %d", path, resp.Code)
+		}
+	}
+
+	lastModified := conditionalGet("/certs", "").Header().Get("Last-Modified")
+
+	// Last-Modified has resolution of seconds.
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+
+	newKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("failed to generate new key: %s", err)
+	}
+	if err := env.API.TokenManager.Rotate(newKey, 0); err != nil {
+		t.Fatalf("failed to rotate key: %s", err)
+	}
+
+	for _, path := range []string{"/.well-known/openid-configuration", "/certs"} {
+		resp := conditionalGet(path, lastModified)
+		if resp.Code != http.StatusOK {
+			t.Errorf("%s: expected modified after reload but got status code %d", path, resp.Code)
+		}
+		if resp.Header().Get("Last-Modified") == lastModified {
+			t.Errorf("%s: Last-Modified should be updated after reload", path)
+		}
+	}
+
+	env.API.Live = api.NewLiveConfig(env.API.Config)
+	lastModified = conditionalGet("/.well-known/openid-configuration", "").Header().Get("Last-Modified")
+
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+
+	next := *env.API.Config
+	env.API.Live.Store(&next)
+
+	for _, path := range []string{"/.well-known/openid-configuration", "/certs"} {
+		resp := conditionalGet(path, lastModified)
+		if resp.Code != http.StatusOK {
+			t.Errorf("%s: expected modified after reloading config but got status code %d", path, resp.Code)
+		}
+		if resp.Header().Get("Last-Modified") == lastModified {
+			t.Errorf("%s: Last-Modified should be updated after reloading config", path)
+		}
+	}
+}
+
+func TestIfModifiedSince_HostBasedIssuer(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.IssuerHosts = []string{"a.example.com"}
+	env.API.Live = api.NewLiveConfig(env.API.Config)
+
+	conditionalGet := func(path, since string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "http://a.example.com"+path, nil)
+		if since != "" {
+			req.Header.Set("If-Modified-Since", since)
+		}
+		return env.DoRequest(req)
+	}
+
+	lastModified := conditionalGet("/.well-known/openid-configuration", "").Header().Get("Last-Modified")
+	if _, err := http.ParseTime(lastModified); err != nil {
+		t.Fatalf("invalid Last-Modified header: %#v", lastModified)
+	}
+
+	// Last-Modified has resolution of seconds.
+	time.Sleep(time.Until(time.Now().Truncate(time.Second).Add(time.Second)))
+
+	next := *env.API.Config
+	env.API.Live.Store(&next)
+
+	for _, path := range []string{"/.well-known/openid-configuration", "/certs"} {
+		resp := conditionalGet(path, lastModified)
+		if resp.Code != http.StatusOK {
+			t.Errorf("%s: expected modified after reloading config but got status code %d", path, resp.Code)
+		}
+		if resp.Header().Get("Last-Modified") == lastModified {
+			t.Errorf("%s: Last-Modified should be updated after reloading config", path)
+		}
+	}
+}
+
+func TestAuthContextClaims(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.AuthContextClaims = true
+
+	authTime := time.Now().Add(-time.Minute)
+
+	ssoToken, err := env.API.TokenManager.CreateSSOToken(
+		env.API.Config.Issuer,
+		"macrat",
+		"",
+		token.AuthorizedParties{"some_client_id"},
+		authTime,
+		time.Now().Add(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("failed to create SSO token: %s", err)
+	}
+
+	req, _ := http.NewRequest("GET", "/authz?"+url.Values{
+		"client_id":     {"some_client_id"},
+		"redirect_uri":  {"http://some-client.example.com/callback"},
+		"response_type": {"code"},
+		"scope":         {"openid profile"},
+	}.Encode(), nil)
+	req.AddCookie(&http.Cookie{Name: api.SSO_TOKEN_COOKIE, Value: ssoToken})
+	resp := env.DoRequest(req)
+	if resp.Code != http.StatusFound {
+		t.Fatalf("unexpected status code of authz: %d", resp.Code)
+	}
+	location, _ := url.Parse(resp.Header().Get("Location"))
+
+	resp = env.Post("/token", "", url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {location.Query().Get("code")},
+		"client_id":     {"some_client_id"},
+		"client_secret": {"secret for some-client"},
+		"redirect_uri":  {"http://some-client.example.com/callback"},
+	})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("unexpected status code of token: %d: %s", resp.Code, resp.Body)
+	}
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+		IDToken     string `json:"id_token"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &tokens); err != nil {
+		t.Fatalf("failed to parse token response: %s", err)
+	}
+
+	idToken, err := env.API.TokenManager.ParseIDToken(tokens.IDToken)
+	if err != nil {
+		t.Fatalf("failed to parse id_token: %s", err)
+	}
+
+	resp = env.Get("/userinfo", "Bearer "+tokens.AccessToken, nil)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("unexpected status code of userinfo: %d", resp.Code)
+	}
+	var userinfo struct {
+		AuthTime int64    `json:"auth_time"`
+		ACR      string   `json:"acr"`
+		AMR      []string `json:"amr"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &userinfo); err != nil {
+		t.Fatalf("failed to parse userinfo: %s", err)
+	}
+
+	resp = env.Post("/introspect", "", url.Values{
+		"client_id":     {"some_client_id"},
+		"client_secret": {"secret for some-client"},
+		"token":         {tokens.AccessToken},
+	})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("unexpected status code of introspect: %d", resp.Code)
+	}
+	var introspect api.PostIntrospectResponse
+	if err := json.Unmarshal(resp.Body.Bytes(), &introspect); err != nil {
+		t.Fatalf("failed to parse introspection: %s", err)
+	}
+
+	surfaces := []struct {
+		Name     string
+		AuthTime int64
+		ACR      string
+		AMR      []string
+	}{
+		{"id_token", idToken.AuthTime, idToken.ACR, idToken.AMR},
+		{"userinfo", userinfo.AuthTime, userinfo.ACR, userinfo.AMR},
+		{"introspect", introspect.AuthTime, introspect.ACR, introspect.AMR},
+	}
+	for _, s := range surfaces {
+		if s.AuthTime != authTime.Unix() {
+			t.Errorf("%s: unexpected auth_time: expected %d but got %d", s.Name, authTime.Unix(), s.AuthTime)
+		}
+		if s.ACR != config.ACR_SSO {
+			t.Errorf("%s: unexpected acr: %#v", s.Name, s.ACR)
+		}
+		if !reflect.DeepEqual(s.AMR, []string{config.AMR_PASSWORD}) {
+			t.Errorf("%s: unexpected amr: %#v", s.Name, s.AMR)
+		}
+	}
+
+	env.API.Config.AuthContextClaims = false
+
+	resp = env.Get("/userinfo", "Bearer "+tokens.AccessToken, nil)
+	if strings.Contains(resp.Body.String(), `"acr"`) || strings.Contains(resp.Body.String(), `"auth_time"`) {
+		t.Errorf("userinfo should not include auth context if disabled: %s", resp.Body)
+	}
+}
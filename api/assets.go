@@ -0,0 +1,91 @@
+package api
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/errors"
+	"github.com/macrat/lauth/metrics"
+)
+
+const (
+	ASSETS_CACHE_CONTROL = "public, max-age=3600"
+)
+
+// isSafeAssetName reports whether the name can be served as an asset.
+// Names that include "..", backslash, NUL, or hidden files are rejected even if the cleaned path is inside of the assets directory.
+func isSafeAssetName(name string) bool {
+	if strings.ContainsAny(name, "\\\x00") {
+		return false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") {
+			return false
+		}
+	}
+	return true
+}
+
+func sendAssetNotFound(c *gin.Context, report *metrics.LogContext) {
+	notFound := &errors.Error{
+		Reason:      errors.PageNotFound,
+		Description: "requested page is not found",
+	}
+	report.SetError(notFound)
+	errors.SendHTML(c, notFound)
+}
+
+func (api *LauthAPI) serveAsset(c *gin.Context, name string) {
+	report := metrics.StartLogging(c)
+	defer report.Close()
+
+	if !isSafeAssetName(name) {
+		sendAssetNotFound(c, report)
+		return
+	}
+
+	f, err := http.Dir(api.Config.Templates.AssetsDir).Open(path.Clean("/" + name))
+	if err != nil {
+		sendAssetNotFound(c, report)
+		return
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil || !stat.Mode().IsRegular() {
+		sendAssetNotFound(c, report)
+		return
+	}
+
+	c.Header("Cache-Control", ASSETS_CACHE_CONTROL)
+	c.Header("X-Content-Type-Options", "nosniff")
+	http.ServeContent(c.Writer, c.Request, stat.Name(), stat.ModTime(), f)
+}
+
+func (api *LauthAPI) GetAsset(c *gin.Context) {
+	api.serveAsset(c, c.Param("filepath"))
+}
+
+func (api *LauthAPI) GetFavicon(c *gin.Context) {
+	api.serveAsset(c, "/favicon.ico")
+}
+
+// SetAssetRoutes registers endpoints for static files that used by the custom templates.
+// Nothing will be registered if Templates.AssetsDir is empty.
+// favicon.ico is also served on the root if the assets directory has it.
+func (api *LauthAPI) SetAssetRoutes(r gin.IRoutes) {
+	conf := api.Config.Templates
+	if conf.AssetsDir == "" {
+		return
+	}
+
+	r.GET(path.Join(api.Config.Issuer.Path, conf.AssetsPath, "*filepath"), api.GetAsset)
+
+	if stat, err := os.Stat(filepath.Join(conf.AssetsDir, "favicon.ico")); err == nil && stat.Mode().IsRegular() {
+		r.GET("/favicon.ico", api.GetFavicon)
+	}
+}
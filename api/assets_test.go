@@ -0,0 +1,99 @@
+package api_test
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/macrat/lauth/testutil"
+)
+
+func TestGetAsset(t *testing.T) {
+	root := t.TempDir()
+	assets := filepath.Join(root, "assets")
+
+	files := map[string]string{
+		filepath.Join(root, "secret.txt"):                "secret",
+		filepath.Join(assets, "style.css"):               "body { color: red; }",
+		filepath.Join(assets, "images", "logo.svg"):      "<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>",
+		filepath.Join(assets, "favicon.ico"):             "\x00\x00\x01\x00",
+		filepath.Join(assets, ".hidden"):                 "hidden",
+		filepath.Join(assets, "images", ".htpasswd"):     "hidden",
+		filepath.Join(assets, "images", "empty", "x.js"): "",
+	}
+	for name, content := range files {
+		if err := os.MkdirAll(filepath.Dir(name), 0700); err != nil {
+			t.Fatalf("failed to make directory: %s", err)
+		}
+		if err := os.WriteFile(name, []byte(content), 0600); err != nil {
+			t.Fatalf("failed to write file: %s", err)
+		}
+	}
+
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.Templates.AssetsDir = assets
+	env.API.Config.Templates.AssetsPath = "/login/assets"
+	env.API.SetAssetRoutes(env.App)
+
+	tests := []struct {
+		Path        string
+		Code        int
+		ContentType string
+		Body        string
+	}{
+		{"/login/assets/style.css", http.StatusOK, "text/css; charset=utf-8", "body { color: red; }"},
+		{"/login/assets/images/logo.svg", http.StatusOK, "image/svg+xml", "<svg xmlns=\"http://www.w3.org/2000/svg\"></svg>"},
+		{"/favicon.ico", http.StatusOK, "", "\x00\x00\x01\x00"},
+		{"/login/assets/not-found.css", http.StatusNotFound, "", ""},
+		{"/login/assets/", http.StatusNotFound, "", ""},
+		{"/login/assets/images", http.StatusNotFound, "", ""},
+		{"/login/assets/.hidden", http.StatusNotFound, "", ""},
+		{"/login/assets/images/.htpasswd", http.StatusNotFound, "", ""},
+		{"/login/assets/../secret.txt", http.StatusNotFound, "", ""},
+		{"/login/assets/images/../../secret.txt", http.StatusNotFound, "", ""},
+		{"/login/assets/%2e%2e/secret.txt", http.StatusNotFound, "", ""},
+		{"/login/assets/..%2fsecret.txt", http.StatusNotFound, "", ""},
+		{"/login/assets/..%5csecret.txt", http.StatusNotFound, "", ""},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", tt.Path, nil)
+		if err != nil {
+			t.Fatalf("%s: failed to make request: %s", tt.Path, err)
+		}
+		resp := env.DoRequest(req)
+
+		if resp.Code != tt.Code {
+			t.Errorf("%s: unexpected status code: %d", tt.Path, resp.Code)
+			continue
+		}
+		if tt.Code != http.StatusOK {
+			continue
+		}
+
+		// Type of .ico depends on the mime database of the system.
+		if ct := resp.Header().Get("Content-Type"); tt.ContentType != "" && ct != tt.ContentType {
+			t.Errorf("%s: unexpected content type: %s", tt.Path, ct)
+		}
+		if cc := resp.Header().Get("Cache-Control"); cc != "public, max-age=3600" {
+			t.Errorf("%s: unexpected cache control: %s", tt.Path, cc)
+		}
+		if resp.Header().Get("Last-Modified") == "" {
+			t.Errorf("%s: Last-Modified header is missing", tt.Path)
+		}
+		if body := resp.Body.String(); body != tt.Body {
+			t.Errorf("%s: unexpected body: %#v", tt.Path, body)
+		}
+	}
+}
+
+func TestGetAsset_Disabled(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.SetAssetRoutes(env.App)
+
+	req, _ := http.NewRequest("GET", "/favicon.ico", nil)
+	if resp := env.DoRequest(req); resp.Code != http.StatusNotFound {
+		t.Errorf("unexpected status code: %d", resp.Code)
+	}
+}
@@ -5,24 +5,32 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/audit"
+	"github.com/macrat/lauth/config"
 	"github.com/macrat/lauth/errors"
 	"github.com/macrat/lauth/metrics"
 	"github.com/macrat/lauth/token"
+	"github.com/rs/zerolog/log"
 )
 
 type AuthzRequest struct {
-	ResponseType string `form:"response_type" json:"response_type" xml:"response_type"`
-	ClientID     string `form:"client_id"     json:"client_id"     xml:"client_id"`
-	RedirectURI  string `form:"redirect_uri"  json:"redirect_uri"  xml:"redirect_uri"`
-	Scope        string `form:"scope"         json:"scope"         xml:"scope"`
-	State        string `form:"state"         json:"state"         xml:"state"`
-	Nonce        string `form:"nonce"         json:"nonce"         xml:"nonce"`
-	MaxAge       int64  `form:"max_age"       json:"max_age"       xml:"max_age"`
-	Prompt       string `form:"prompt"        json:"prompt"        xml:"prompt"`
+	ResponseType        string `form:"response_type"         json:"response_type"         xml:"response_type"`
+	ResponseMode        string `form:"response_mode"         json:"response_mode"         xml:"response_mode"`
+	ClientID            string `form:"client_id"             json:"client_id"             xml:"client_id"`
+	RedirectURI         string `form:"redirect_uri"          json:"redirect_uri"          xml:"redirect_uri"`
+	Scope               string `form:"scope"                 json:"scope"                 xml:"scope"`
+	State               string `form:"state"                 json:"state"                 xml:"state"`
+	Nonce               string `form:"nonce"                 json:"nonce"                 xml:"nonce"`
+	MaxAge              int64  `form:"max_age"               json:"max_age"               xml:"max_age"`
+	Prompt              string `form:"prompt"                json:"prompt"                xml:"prompt"`
+	CodeChallenge       string `form:"code_challenge"        json:"code_challenge"        xml:"code_challenge"`
+	CodeChallengeMethod string `form:"code_challenge_method" json:"code_challenge_method" xml:"code_challenge_method"`
+	Claims              string `form:"claims"                json:"claims"                xml:"claims"`
 
 	// use only GET method
 	LoginHint  string `form:"login_hint"  json:"login_hint"  xml:"login_hint"`
@@ -33,8 +41,28 @@ type AuthzRequest struct {
 	User     string `form:"username" json:"username" xml:"username"`
 	Password string `form:"password" json:"password" xml:"password"`
 
-	RequestExpiresAt int64  `form:"-" json:"-" xml:"-"`
-	RequestSubject   string `form:"-" json:"-" xml:"-"`
+	RequestExpiresAt int64                `form:"-" json:"-" xml:"-"`
+	RequestSubject   string               `form:"-" json:"-" xml:"-"`
+	HasState         bool                 `form:"-" json:"-" xml:"-"`
+	ClaimsRequest    *token.ClaimsRequest `form:"-" json:"-" xml:"-"`
+}
+
+// hasState reports whether the client sent state, even if it is empty.
+func (req *AuthzRequest) hasState() bool {
+	return req.HasState || req.State != ""
+}
+
+// responseMode returns the response mode to send the authorization response.
+// It is the default mode for the response type if response_mode is not requested or not supported.
+func (req *AuthzRequest) responseMode() string {
+	switch req.ResponseMode {
+	case "query", "fragment", "form_post":
+		return req.ResponseMode
+	}
+	if rt := ParseStringSet(req.ResponseType).String(); rt == "code" || rt == "" {
+		return "query"
+	}
+	return "fragment"
 }
 
 func (req *AuthzRequest) makeRedirectError(err error, reason errors.Reason, description string) *errors.Error {
@@ -44,7 +72,9 @@ func (req *AuthzRequest) makeRedirectError(err error, reason errors.Reason, desc
 		Err:          err,
 		RedirectURI:  redirectURI,
 		ResponseType: req.ResponseType,
+		ResponseMode: req.responseMode(),
 		State:        req.State,
+		HasState:     req.hasState(),
 		Reason:       reason,
 		Description:  description,
 	}
@@ -55,6 +85,7 @@ func (req *AuthzRequest) makeNonRedirectError(err error, reason errors.Reason, d
 		Err:          err,
 		ResponseType: req.ResponseType,
 		State:        req.State,
+		HasState:     req.hasState(),
 		Reason:       reason,
 		Description:  description,
 	}
@@ -63,12 +94,18 @@ func (req *AuthzRequest) makeNonRedirectError(err error, reason errors.Reason, d
 func (req *AuthzRequest) RequestObjectClaims() token.RequestObjectClaims {
 	return token.RequestObjectClaims{
 		ResponseType: req.ResponseType,
+		ResponseMode: req.ResponseMode,
 		ClientID:     req.ClientID,
 		RedirectURI:  req.RedirectURI,
 		Scope:        req.Scope,
 		State:        req.State,
+		HasState:     req.hasState(),
 		Nonce:        req.Nonce,
 		MaxAge:       req.MaxAge,
+		Claims:       req.ClaimsRequest,
+
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
 	}
 }
 
@@ -126,7 +163,7 @@ func (req *GetAuthzRequestUnmarshaller) processRequestObject(api *LauthAPI) *err
 	if c, ok := api.Config.Clients[req.ClientID]; ok {
 		signKey = c.RequestKey
 	}
-	claims, err := api.TokenManager.ParseRequestObject(request, signKey)
+	claims, err := api.TokenManager.ParseRequestObject(request, req.ClientID, signKey)
 	if err != nil {
 		return req.GetRequest().makeNonRedirectError(
 			err,
@@ -144,6 +181,13 @@ func (req *GetAuthzRequestUnmarshaller) processRequestObject(api *LauthAPI) *err
 			"failed to decode or validation request object",
 		)
 	}
+	if api.Config.StrictOIDC && (len(claims.Audience) != 1 || claims.Audience[0] != api.Config.Issuer.String()) {
+		return req.GetRequest().makeNonRedirectError(
+			token.UnexpectedAudienceError,
+			errorReason,
+			"audience of request object must be exactly the issuer",
+		)
+	}
 
 	var mismatches []string
 
@@ -151,6 +195,14 @@ func (req *GetAuthzRequestUnmarshaller) processRequestObject(api *LauthAPI) *err
 		mismatches = append(mismatches, "response_type")
 	}
 
+	if claims.ResponseMode != "" {
+		if req.ResponseMode != "" && claims.ResponseMode != req.ResponseMode {
+			mismatches = append(mismatches, "response_mode")
+		} else {
+			req.ResponseMode = claims.ResponseMode
+		}
+	}
+
 	if claims.ClientID != "" && claims.ClientID != req.ClientID {
 		mismatches = append(mismatches, "client_id")
 	}
@@ -211,6 +263,30 @@ func (req *GetAuthzRequestUnmarshaller) processRequestObject(api *LauthAPI) *err
 		}
 	}
 
+	if claims.CodeChallenge != "" {
+		if req.CodeChallenge != "" && claims.CodeChallenge != req.CodeChallenge {
+			mismatches = append(mismatches, "code_challenge")
+		} else {
+			req.CodeChallenge = claims.CodeChallenge
+		}
+	}
+
+	if claims.CodeChallengeMethod != "" {
+		if req.CodeChallengeMethod != "" && claims.CodeChallengeMethod != req.CodeChallengeMethod {
+			mismatches = append(mismatches, "code_challenge_method")
+		} else {
+			req.CodeChallengeMethod = claims.CodeChallengeMethod
+		}
+	}
+
+	if claims.Claims != nil {
+		if requested, err := token.ParseClaimsRequest(req.Claims, api.Config.MaxClaimsRequestSize, api.Config.MaxClaimsRequestMembers); err == nil && requested != nil && !requested.Equal(claims.Claims) {
+			mismatches = append(mismatches, "claims")
+		} else {
+			req.ClaimsRequest = claims.Claims
+		}
+	}
+
 	if len(mismatches) == 0 {
 		return nil
 	}
@@ -222,6 +298,18 @@ func (req *GetAuthzRequestUnmarshaller) processRequestObject(api *LauthAPI) *err
 	)
 }
 
+// claimsRequestErrorDescription makes the error_description for the claims parameter that failed to parse or exceeded the limits.
+func (api *LauthAPI) claimsRequestErrorDescription(err error) string {
+	switch err {
+	case token.ClaimsRequestTooLargeError:
+		return fmt.Sprintf("claims is too large; up to %d bytes are allowed", api.Config.MaxClaimsRequestSize)
+	case token.TooManyClaimsRequestedError:
+		return fmt.Sprintf("too many claims are requested; up to %d claims are allowed", api.Config.MaxClaimsRequestMembers)
+	default:
+		return "claims is invalid format"
+	}
+}
+
 func (req *GetAuthzRequestUnmarshaller) validate(api *LauthAPI) *errors.Error {
 	if req.RedirectURI == "" {
 		return req.GetRequest().makeNonRedirectError(nil, errors.InvalidRequest, "redirect_uri is required")
@@ -242,7 +330,7 @@ func (req *GetAuthzRequestUnmarshaller) validate(api *LauthAPI) *errors.Error {
 			errors.InvalidClient,
 			"client_id is not registered",
 		)
-	} else if !client.RedirectURI.Match(req.RedirectURI) {
+	} else if !client.AllowRedirectURI(req.RedirectURI, api.Config.StrictRedirectURI) {
 		return req.GetRequest().makeNonRedirectError(
 			nil,
 			errors.UnauthorizedClient,
@@ -258,11 +346,27 @@ func (req *GetAuthzRequestUnmarshaller) validate(api *LauthAPI) *errors.Error {
 		)
 	}
 
+	if requested, err := token.ParseClaimsRequest(req.Claims, api.Config.MaxClaimsRequestSize, api.Config.MaxClaimsRequestMembers); err != nil {
+		return req.GetRequest().makeRedirectError(
+			err,
+			errors.InvalidRequest,
+			api.claimsRequestErrorDescription(err),
+		)
+	} else if req.ClaimsRequest == nil {
+		req.ClaimsRequest = requested
+	} else if err := req.ClaimsRequest.CheckLimits(api.Config.MaxClaimsRequestSize, api.Config.MaxClaimsRequestMembers); err != nil {
+		return req.GetRequest().makeRedirectError(
+			err,
+			errors.InvalidRequest,
+			api.claimsRequestErrorDescription(err),
+		)
+	}
+
 	rt := ParseStringSet(req.ResponseType)
 	if rt.String() == "" {
 		return req.GetRequest().makeRedirectError(
 			nil,
-			errors.UnsupportedResponseType,
+			errors.InvalidRequest,
 			"response_type is required",
 		)
 	}
@@ -273,6 +377,13 @@ func (req *GetAuthzRequestUnmarshaller) validate(api *LauthAPI) *errors.Error {
 			err.Error(),
 		)
 	}
+	if api.Config.StrictOIDC && !StringSet(api.Config.ResponseTypesSupported()).hasEquivalentSet(rt) {
+		return req.GetRequest().makeRedirectError(
+			nil,
+			errors.UnsupportedResponseType,
+			fmt.Sprintf("%s is not a response_type of OpenID Connect", req.ResponseType),
+		)
+	}
 	if !api.Config.Clients[req.ClientID].AllowImplicitFlow && rt.String() != "code" {
 		return req.GetRequest().makeRedirectError(
 			nil,
@@ -281,14 +392,135 @@ func (req *GetAuthzRequestUnmarshaller) validate(api *LauthAPI) *errors.Error {
 		)
 	}
 
+	if req.ResponseMode != "" && req.ResponseMode != "query" && req.ResponseMode != "fragment" && req.ResponseMode != "form_post" {
+		return req.GetRequest().makeRedirectError(
+			nil,
+			errors.InvalidRequest,
+			fmt.Sprintf("response_mode \"%s\" is not supported", req.ResponseMode),
+		)
+	}
+	if req.ResponseMode == "query" && rt.String() != "code" {
+		return req.GetRequest().makeRedirectError(
+			nil,
+			errors.InvalidRequest,
+			"query response_mode can't use in the implicit/hybrid flow",
+		)
+	}
+	if !api.Config.Clients[req.ClientID].AllowResponseMode(req.GetRequest().responseMode()) {
+		return req.GetRequest().makeRedirectError(
+			nil,
+			errors.UnauthorizedClient,
+			fmt.Sprintf("%s response_mode is not allowed for this client", req.GetRequest().responseMode()),
+		)
+	}
+
+	if acr := api.Config.Clients[req.ClientID].RequireACR; acr != "" && !StringSet(config.SupportedACRValues).Has(acr) {
+		return req.GetRequest().makeRedirectError(
+			nil,
+			errors.UnmetAuthentication,
+			fmt.Sprintf("this client requires acr %s but it can't be satisfied", acr),
+		)
+	}
+
+	// prompt=none can't be combined with any other value, even with unknown or duplicated ones.
 	prompt := ParseStringSet(req.Prompt)
-	if prompt.Has("none") && (prompt.Has("login") || prompt.Has("select_account") || prompt.Has("consent")) {
+	if prompt.Has("none") && len(*prompt) > 1 {
+		return req.GetRequest().makeRedirectError(
+			nil,
+			errors.InvalidRequest,
+			"prompt=none can't use same time with other values",
+		)
+	}
+
+	req.Scope = api.claimsScope(req.ClientID, rt, ParseStringSet(req.Scope), req.ClaimsRequest).String()
+
+	if max := api.Config.MaxScopes; max > 0 {
+		var requested StringSet
+		for _, s := range ParseStringSet(req.Scope).List() {
+			requested.Add(s)
+		}
+		if len(requested) > max {
+			return req.GetRequest().makeRedirectError(
+				nil,
+				errors.InvalidScope,
+				fmt.Sprintf("too many scopes are requested; up to %d scopes are allowed", max),
+			)
+		}
+	}
+
+	if api.Config.StrictOIDC {
+		if scope := ParseStringSet(req.Scope); scope.String() == "" {
+			return req.GetRequest().makeRedirectError(
+				nil,
+				errors.InvalidRequest,
+				"scope is required",
+			)
+		} else if !scope.Has("openid") {
+			return req.GetRequest().makeRedirectError(
+				nil,
+				errors.InvalidScope,
+				"openid scope is required in OpenID Connect",
+			)
+		}
+	}
+
+	if client := api.Config.Clients[req.ClientID]; client.RejectDisallowedScopes {
+		for _, s := range ParseStringSet(req.Scope).List() {
+			if !client.AllowScope(s) {
+				return req.GetRequest().makeRedirectError(
+					nil,
+					errors.InvalidScope,
+					fmt.Sprintf("%s scope is not allowed for this client", s),
+				)
+			}
+		}
+	}
+	req.Scope = api.clientScope(req.ClientID, ParseStringSet(req.Scope)).String()
+
+	if rt.String() != "code" && len(api.Config.ImplicitScopes) > 0 {
+		allowed := StringSet(api.Config.ImplicitScopes)
+		for _, s := range ParseStringSet(req.Scope).List() {
+			if s != "openid" && !allowed.Has(s) {
+				return req.GetRequest().makeRedirectError(
+					nil,
+					errors.InvalidScope,
+					fmt.Sprintf("%s scope can't request in the implicit/hybrid flow", s),
+				)
+			}
+		}
+	}
+
+	if api.Config.Clients[req.ClientID].IsPublic() && rt.Has("code") && (req.CodeChallenge == "" || req.CodeChallengeMethod != config.CODE_CHALLENGE_METHOD_S256) {
+		return req.GetRequest().makeRedirectError(
+			nil,
+			errors.InvalidRequest,
+			"code_challenge with S256 method is required for public client",
+		)
+	}
+
+	if req.CodeChallengeMethod != "" && req.CodeChallenge == "" {
 		return req.GetRequest().makeRedirectError(
 			nil,
 			errors.InvalidRequest,
-			"prompt=none can't use same time with login, select_account, or consent",
+			"code_challenge is required when use code_challenge_method",
 		)
 	}
+	if req.CodeChallenge != "" {
+		if req.CodeChallengeMethod != "" && !StringSet(config.SupportedCodeChallengeMethods).Has(req.CodeChallengeMethod) {
+			return req.GetRequest().makeRedirectError(
+				nil,
+				errors.InvalidRequest,
+				fmt.Sprintf("unsupported code_challenge_method: %s", req.CodeChallengeMethod),
+			)
+		}
+		if !token.IsValidCodeVerifier(req.CodeChallenge) {
+			return req.GetRequest().makeRedirectError(
+				nil,
+				errors.InvalidRequest,
+				"code_challenge is invalid format",
+			)
+		}
+	}
 
 	if rt.Has("id_token") && req.Nonce == "" {
 		return req.GetRequest().makeRedirectError(
@@ -297,10 +529,43 @@ func (req *GetAuthzRequestUnmarshaller) validate(api *LauthAPI) *errors.Error {
 			"nonce is required in the implicit/hybrid flow of OpenID Connect",
 		)
 	}
+	if rt.Has("id_token") && !ParseStringSet(req.Scope).Has("openid") {
+		return req.GetRequest().makeRedirectError(
+			nil,
+			errors.InvalidRequest,
+			"openid scope is required when use id_token response type",
+		)
+	}
+	if api.Config.StrictScope {
+		if err := validateScopeForResponseType(rt, ParseStringSet(req.Scope)); err != nil {
+			return req.GetRequest().makeRedirectError(
+				nil,
+				errors.InvalidScope,
+				err.Error(),
+			)
+		}
+	}
 
 	return nil
 }
 
+// validateScopeForResponseType checks that the scope makes sense with the response_type.
+// The token response type can't return the id_token, and the offline_access scope is only for flows that issue the code.
+func validateScopeForResponseType(rt, scope *StringSet) error {
+	if rt.String() == "token" {
+		if scope.Has("openid") {
+			return fmt.Errorf("openid scope can't use with token response type")
+		}
+		if scope.String() == "" {
+			return fmt.Errorf("scope is required when use token response type")
+		}
+	}
+	if scope.Has("offline_access") && !rt.Has("code") {
+		return fmt.Errorf("offline_access scope can't use without code response type")
+	}
+	return nil
+}
+
 func (req *GetAuthzRequestUnmarshaller) PreProcess(api *LauthAPI) *errors.Error {
 	if err := req.processRequestObject(api); err != nil {
 		return err
@@ -319,13 +584,20 @@ type PostAuthzRequestUnmarshaller struct {
 func (req *PostAuthzRequestUnmarshaller) GetRequest() *AuthzRequest {
 	return &AuthzRequest{
 		ResponseType: req.claims.ResponseType,
+		ResponseMode: req.claims.ResponseMode,
 		ClientID:     req.claims.ClientID,
 		RedirectURI:  req.claims.RedirectURI,
 		Scope:        req.claims.Scope,
 		State:        req.claims.State,
+		HasState:     req.claims.HasState,
 		Nonce:        req.claims.Nonce,
 		MaxAge:       req.claims.MaxAge,
 
+		ClaimsRequest: req.claims.Claims,
+
+		CodeChallenge:       req.claims.CodeChallenge,
+		CodeChallengeMethod: req.claims.CodeChallengeMethod,
+
 		User:     req.User,
 		Password: req.Password,
 
@@ -344,7 +616,7 @@ func (req *PostAuthzRequestUnmarshaller) PreProcess(api *LauthAPI) *errors.Error
 	}
 
 	var err error
-	req.claims, err = api.TokenManager.ParseRequestObject(req.Request, "")
+	req.claims, err = api.TokenManager.ParseRequestObject(req.Request, "", "")
 	if err == token.TokenExpiredError {
 		return req.GetRequest().makeNonRedirectError(
 			err,
@@ -377,6 +649,31 @@ type AuthzContext struct {
 	Report  *metrics.Context
 }
 
+// isInitialRequest reports whether the request is an authorization request from the client, rather than a submission of the login or confirm page.
+// Submissions of the pages have username and password, or only request without client_id and response_type.
+func isInitialRequest(c *gin.Context) bool {
+	if c.Request.Method == "GET" {
+		return true
+	}
+
+	_, hasUser := c.GetPostForm("username")
+	_, hasPassword := c.GetPostForm("password")
+	if hasUser || hasPassword {
+		return false
+	}
+
+	return c.PostForm("client_id") != "" || c.PostForm("response_type") != ""
+}
+
+// hasParam reports whether the request has the parameter in the query or the form, even if it is empty.
+func hasParam(c *gin.Context, key string) bool {
+	if _, ok := c.GetQuery(key); ok {
+		return true
+	}
+	_, ok := c.GetPostForm(key)
+	return ok
+}
+
 func NewAuthzContext(api *LauthAPI, c *gin.Context) (*AuthzContext, *errors.Error) {
 	m := metrics.StartAuthz(c)
 
@@ -384,7 +681,7 @@ func NewAuthzContext(api *LauthAPI, c *gin.Context) (*AuthzContext, *errors.Erro
 	c.Header("Pragma", "no-cache")
 
 	var unmarshaller AuthzRequestUnmarshaller
-	if c.Request.Method == "GET" {
+	if isInitialRequest(c) {
 		unmarshaller = new(GetAuthzRequestUnmarshaller)
 	} else {
 		unmarshaller = new(PostAuthzRequestUnmarshaller)
@@ -400,6 +697,10 @@ func NewAuthzContext(api *LauthAPI, c *gin.Context) (*AuthzContext, *errors.Erro
 		return nil, e
 	}
 
+	if isInitialRequest(c) && hasParam(c, "state") {
+		unmarshaller.GetRequest().HasState = true
+	}
+
 	if err := unmarshaller.PreProcess(api); err != nil {
 		m.SetError(err)
 		m.Close()
@@ -442,7 +743,7 @@ func (ctx *AuthzContext) MakeRequestObject() (string, error) {
 
 func (ctx *AuthzContext) ErrorRedirect(err *errors.Error) {
 	ctx.Report.SetError(err)
-	errors.SendRedirect(ctx.Gin, err)
+	errors.SendRedirect(ctx.Gin, ctx.API.authzError(err))
 }
 
 func (ctx *AuthzContext) TrySSO(authorized bool) (proceed bool) {
@@ -454,15 +755,31 @@ func (ctx *AuthzContext) TrySSO(authorized bool) (proceed bool) {
 		return false
 	}
 
+	// The SSO session can't satisfy the client that requires the password authentication.
+	if ctx.API.Config.Clients[ctx.Request.ClientID].RequireACR == config.ACR_PASSWORD {
+		if prompt.Has("none") {
+			ctx.ErrorRedirect(ctx.Request.makeRedirectError(nil, errors.LoginRequired, ""))
+			return true
+		}
+		return false
+	}
+
 	token, err := ctx.API.GetSSOToken(ctx.Gin)
 	if err == nil {
-		if ctx.Request.MaxAge <= 0 || ctx.Request.MaxAge > time.Now().Unix()-token.AuthTime {
+		// The session of another user can't be used if the client requested the sub claim with a value.
+		fresh := ctx.Request.MaxAge <= 0 || ctx.Request.MaxAge > time.Now().Unix()-token.AuthTime
+		if fresh && ctx.Request.ClaimsRequest.AllowSubject(token.Subject) {
 			ctx.Report.Set("authn_by", "sso_token")
 			ctx.Report.Set("username", token.Subject)
+			if authorized {
+				ctx.Report.Audit(ctx.API.Audit, audit.Consent)
+			} else {
+				ctx.Report.Audit(ctx.API.Audit, audit.SSOLogin)
+			}
 
 			if !authorized && (prompt.Has("consent") || !token.Authorized.Includes(ctx.Request.ClientID)) {
 				if prompt.Has("none") {
-					ctx.ErrorRedirect(ctx.Request.makeRedirectError(nil, errors.InteractionRequired, ""))
+					ctx.ErrorRedirect(ctx.Request.makeRedirectError(nil, errors.ConsentRequired, ""))
 				} else {
 					ctx.ShowConfirmPage(http.StatusOK, token.Subject)
 				}
@@ -471,7 +788,7 @@ func (ctx *AuthzContext) TrySSO(authorized bool) (proceed bool) {
 			}
 
 			ctx.API.SetSSOToken(ctx.Gin, token.Subject, ctx.Request.ClientID, false)
-			ctx.SendTokens(token.Subject, time.Unix(token.AuthTime, 0))
+			ctx.SendTokens(token.Subject, ctx.API.authentication(ctx.Request.ClientID, time.Unix(token.AuthTime, 0), config.ACR_SSO))
 			return true
 		}
 	} else if err != http.ErrNoCookie {
@@ -496,12 +813,20 @@ func (ctx *AuthzContext) showPage(code int, authzOnly bool, initialUser, errorDe
 
 	client := ctx.API.Config.Clients[ctx.Request.ClientID]
 
+	scopes := make([]string, 0)
+	for _, s := range ParseStringSet(ctx.Request.Scope).List() {
+		if s != "openid" {
+			scopes = append(scopes, s)
+		}
+	}
+
 	data := map[string]interface{}{
 		"client": map[string]interface{}{
 			"ID":      ctx.Request.ClientID,
 			"Name":    client.Name,
 			"IconURL": client.IconURL,
 		},
+		"scopes":           ctx.API.Config.Scopes.DetailsFor(scopes),
 		"response_type":    ctx.Request.ResponseType,
 		"request":          requestObject,
 		"initial_username": initialUser,
@@ -521,31 +846,40 @@ func (ctx *AuthzContext) ShowConfirmPage(code int, initialUser string) {
 	ctx.showPage(code, true, initialUser, "")
 }
 
-func (ctx *AuthzContext) makeCodeToken(subject string, authTime time.Time) (string, *errors.Error) {
-	code, err := ctx.API.TokenManager.CreateCode(
+func (ctx *AuthzContext) makeCodeToken(subject string, auth token.Authentication) (string, *errors.Error) {
+	code, err := ctx.API.TokenManager.CreateCodeWithClaims(
 		ctx.API.Config.Issuer,
 		subject,
 		ctx.Request.ClientID,
 		ctx.Request.RedirectURI,
 		ctx.Request.Scope,
 		ctx.Request.Nonce,
-		authTime,
-		ctx.API.Config.Expire.Code.Duration(),
+		ctx.Request.CodeChallenge,
+		ctx.Request.CodeChallengeMethod,
+		ctx.Request.ClaimsRequest,
+		auth,
+		ctx.API.Config.CodeExpireFor(ctx.Request.ClientID).Duration(),
 	)
 	if err != nil {
 		return "", ctx.Request.makeRedirectError(err, errors.ServerError, "failed to generate code")
 	}
+	if ctx.API.Config.SingleActiveCode {
+		ctx.API.Codes.Issue(subject, auth.Time, ctx.Request.ClientID, code, ctx.API.Config.CodeExpireFor(ctx.Request.ClientID).Duration())
+	}
 	return code, nil
 }
 
-func (ctx *AuthzContext) makeAccessToken(subject string, authTime time.Time) (string, *errors.Error) {
-	token, err := ctx.API.TokenManager.CreateAccessToken(
+func (ctx *AuthzContext) makeAccessToken(subject string, auth token.Authentication) (string, *errors.Error) {
+	token, err := ctx.API.TokenManager.CreateAccessTokenWithClaims(
 		ctx.API.Config.Issuer,
 		subject,
 		ctx.Request.ClientID,
 		ctx.Request.Scope,
-		authTime,
-		ctx.API.Config.Expire.Token.Duration(),
+		ctx.API.tokenRequestID(ctx.Gin),
+		"",
+		ctx.Request.ClaimsRequest.ForUserinfo(),
+		auth,
+		ctx.API.Config.TokenExpireFor(ctx.Request.ClientID).Duration(),
 	)
 	if err != nil {
 		return "", ctx.Request.makeRedirectError(err, errors.ServerError, "failed to generate access_token")
@@ -553,13 +887,14 @@ func (ctx *AuthzContext) makeAccessToken(subject string, authTime time.Time) (st
 	return token, nil
 }
 
-func (ctx *AuthzContext) makeIDToken(subject string, authTime time.Time, code, accessToken string) (string, *errors.Error) {
+func (ctx *AuthzContext) makeIDToken(subject string, auth token.Authentication, code, accessToken string) (string, *errors.Error) {
 	scope := ParseStringSet(ctx.Request.Scope)
-	userinfo, errMsg := ctx.API.userinfo(subject, scope)
+	userinfo, errMsg := ctx.API.userinfo(ctx.Request.ClientID, subject, scope, ctx.Request.ClaimsRequest.ForIDToken())
 	if errMsg != nil {
 		errMsg.RedirectURI, _ = url.Parse(ctx.Request.RedirectURI)
 		return "", errMsg
 	}
+	ctx.API.setIDTokenClaims(ctx.Gin, ctx.Request.ClientID, userinfo)
 
 	token, err := ctx.API.TokenManager.CreateIDToken(
 		ctx.API.Config.Issuer,
@@ -569,8 +904,8 @@ func (ctx *AuthzContext) makeIDToken(subject string, authTime time.Time, code, a
 		code,
 		accessToken,
 		userinfo,
-		authTime,
-		ctx.API.Config.Expire.Token.Duration(),
+		auth,
+		ctx.API.Config.TokenExpireFor(ctx.Request.ClientID).Duration(),
 	)
 	if err != nil {
 		return "", ctx.Request.makeRedirectError(err, errors.ServerError, "failed to generate id_token")
@@ -579,57 +914,117 @@ func (ctx *AuthzContext) makeIDToken(subject string, authTime time.Time, code, a
 	return token, nil
 }
 
-func (ctx *AuthzContext) makeAuthzTokens(subject string, authTime time.Time) (*url.URL, *errors.Error) {
+func (ctx *AuthzContext) makeAuthzTokens(subject string, auth token.Authentication) (url.Values, *errors.Error) {
 	resp := make(url.Values)
 
-	if ctx.Request.State != "" {
+	if ctx.Request.hasState() {
 		resp.Set("state", ctx.Request.State)
 	}
+	if ctx.API.Config.StrictOIDC {
+		resp.Set("iss", ctx.API.Config.Issuer.String())
+	}
 
 	rt := ParseStringSet(ctx.Request.ResponseType)
 
 	if rt.Has("code") {
-		code, err := ctx.makeCodeToken(subject, authTime)
+		code, err := ctx.makeCodeToken(subject, auth)
 		if err != nil {
 			return nil, err
 		}
 		resp.Set("code", code)
 	}
 	if rt.Has("token") {
-		token, err := ctx.makeAccessToken(subject, authTime)
+		token, err := ctx.makeAccessToken(subject, auth)
 		if err != nil {
 			return nil, err
 		}
 		resp.Set("token_type", "Bearer")
 		resp.Set("access_token", token)
 		resp.Set("scope", ctx.Request.Scope)
-		resp.Set("expires_in", ctx.API.Config.Expire.Token.StrSeconds())
+		resp.Set("expires_in", ctx.API.Config.TokenExpireFor(ctx.Request.ClientID).StrSeconds())
 	}
 	if rt.Has("id_token") {
-		token, err := ctx.makeIDToken(subject, authTime, resp.Get("code"), resp.Get("access_token"))
+		token, err := ctx.makeIDToken(subject, auth, resp.Get("code"), resp.Get("access_token"))
 		if err != nil {
 			return nil, err
 		}
 		resp.Set("id_token", token)
-		resp.Set("expires_in", ctx.API.Config.Expire.Token.StrSeconds())
+		resp.Set("expires_in", ctx.API.Config.TokenExpireFor(ctx.Request.ClientID).StrSeconds())
 	}
 
-	redirectURI, _ := url.Parse(ctx.Request.RedirectURI)
-	if rt.String() != "code" {
-		redirectURI.Fragment = resp.Encode()
-	} else {
-		redirectURI.RawQuery = resp.Encode()
+	return resp, nil
+}
+
+// warnImplicitFlow sets deprecation headers and logs if the request is implicit/hybrid flow and ImplicitWarning is set.
+func (ctx *AuthzContext) warnImplicitFlow() {
+	msg := ctx.API.Config.ImplicitWarning
+	if msg == "" || ParseStringSet(ctx.Request.ResponseType).String() == "code" {
+		return
 	}
-	return redirectURI, nil
+
+	ctx.Gin.Header("Deprecation", "true")
+	ctx.Gin.Header("Warning", fmt.Sprintf("299 - %s", strconv.Quote(msg)))
+
+	log.Warn().
+		Str("client_id", ctx.Request.ClientID).
+		Str("response_type", ctx.Request.ResponseType).
+		Str("request_id", metrics.RequestID(ctx.Gin)).
+		Msg("implicit/hybrid flow is used")
 }
 
-func (ctx *AuthzContext) SendTokens(subject string, authTime time.Time) {
-	redirect, errMsg := ctx.makeAuthzTokens(subject, authTime)
+// consentedScope removes optional scopes that the user didn't select on the consent page.
+// If the page wasn't shown, such as SSO without confirmation, preselected optional scopes are kept.
+func (ctx *AuthzContext) consentedScope(requested *StringSet) *StringSet {
+	pageShown := !isInitialRequest(ctx.Gin)
+	selected := StringSet(ctx.Gin.PostFormArray("optional_scope"))
+
+	consented := new(StringSet)
+	for _, name := range *requested {
+		scope := ctx.API.Config.Scopes[name]
+
+		switch {
+		case name == "openid" || !scope.Optional:
+			consented.Add(name)
+		case pageShown && selected.Has(name):
+			consented.Add(name)
+		case !pageShown && scope.Preselected:
+			consented.Add(name)
+		}
+	}
+	return consented
+}
 
+func (ctx *AuthzContext) SendTokens(subject string, auth token.Authentication) {
+	scope, errMsg := ctx.API.grantedScope(subject, ctx.consentedScope(ParseStringSet(ctx.Request.Scope)))
+	if errMsg != nil {
+		ctx.ErrorRedirect(ctx.Request.makeRedirectError(errMsg.Err, errMsg.Reason, errMsg.Description))
+		return
+	}
+	ctx.Request.Scope = scope.String()
+	ctx.Report.Set("scope", ctx.Request.Scope)
+
+	if ctx.API.Config.RejectReusedNonce && ctx.Request.Nonce != "" {
+		if !ctx.API.Nonces.Use(ctx.Request.ClientID, ctx.Request.Nonce, ctx.API.Config.Expire.Login.Duration()) {
+			ctx.ErrorRedirect(ctx.Request.makeRedirectError(nil, errors.InvalidRequest, "nonce is already used"))
+			return
+		}
+	}
+
+	resp, errMsg := ctx.makeAuthzTokens(subject, auth)
 	if errMsg != nil {
 		ctx.ErrorRedirect(errMsg)
-	} else {
-		ctx.Report.Success()
-		ctx.Gin.Redirect(http.StatusFound, redirect.String())
+		return
+	}
+
+	ctx.warnImplicitFlow()
+	ctx.Report.Success()
+
+	redirectURI, _ := url.Parse(ctx.Request.RedirectURI)
+	switch mode := ctx.Request.responseMode(); mode {
+	case "form_post":
+		errors.SendFormPost(ctx.Gin, redirectURI, resp)
+	default:
+		errors.SetRedirectParams(redirectURI, resp, mode == "fragment")
+		ctx.Gin.Redirect(http.StatusFound, redirectURI.String())
 	}
 }
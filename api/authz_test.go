@@ -234,7 +234,7 @@ func TestSSOLogin(t *testing.T) {
 	location, err = url.Parse(resp.Header().Get("Location"))
 	if err != nil {
 		t.Errorf("failed to parse location: %s", err)
-	} else if errMsg := location.Query().Get("error"); errMsg != "interaction_required" {
+	} else if errMsg := location.Query().Get("error"); errMsg != "consent_required" {
 		t.Errorf("unexpected error message: %#v", errMsg)
 	}
 
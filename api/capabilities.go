@@ -0,0 +1,99 @@
+package api
+
+import (
+	"net/http"
+	"path"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/metrics"
+)
+
+// Capabilities is a machine-readable summary of the features that enabled in this server.
+// It is for inventory automation, and contains more information than the discovery document.
+type Capabilities struct {
+	Features                 CapabilityFeatures           `json:"features"`
+	Tenants                  int                          `json:"tenants"`
+	Clients                  int                          `json:"clients"`
+	Scopes                   []string                     `json:"scopes"`
+	SigningAlgorithms        []string                     `json:"signing_algorithms"`
+	Endpoints                config.ResolvedEndpointPaths `json:"endpoints"`
+	ResponseModes            []string                     `json:"response_modes"`
+	TokenEndpointAuthMethods []string                     `json:"token_endpoint_auth_methods"`
+}
+
+type CapabilityFeatures struct {
+	SSO                    bool `json:"sso"`
+	RefreshToken           bool `json:"refresh_token"`
+	HostBasedIssuer        bool `json:"host_based_issuer"`
+	ScopeAttribute         bool `json:"scope_attribute"`
+	LowercaseUsername      bool `json:"lowercase_username"`
+	RejectReusedNonce      bool `json:"reject_reused_nonce"`
+	SingleActiveCode       bool `json:"single_active_code"`
+	RequestIDClaim         bool `json:"request_id_claim"`
+	AuthContextClaims      bool `json:"auth_context_claims"`
+	RestrictImplicitScopes bool `json:"restrict_implicit_scopes"`
+	Maintenance            bool `json:"maintenance"`
+	DebugToken             bool `json:"debug_token"`
+}
+
+func (api *LauthAPI) Capabilities() Capabilities {
+	tenants := len(api.Config.IssuerHosts)
+	if tenants == 0 {
+		tenants = 1
+	}
+
+	scopes := append(api.Config.Scopes.ScopeNames(), "openid")
+	sort.Strings(scopes)
+
+	return Capabilities{
+		Features: CapabilityFeatures{
+			SSO:                    api.Config.Expire.SSO > 0,
+			RefreshToken:           api.Config.Expire.Refresh > 0,
+			HostBasedIssuer:        len(api.Config.IssuerHosts) > 0,
+			ScopeAttribute:         api.Config.LDAP.ScopeAttribute != "",
+			LowercaseUsername:      api.Config.LDAP.LowercaseUsername,
+			RejectReusedNonce:      api.Config.RejectReusedNonce,
+			SingleActiveCode:       api.Config.SingleActiveCode,
+			RequestIDClaim:         api.Config.RequestIDClaim,
+			AuthContextClaims:      api.Config.AuthContextClaims,
+			RestrictImplicitScopes: len(api.Config.ImplicitScopes) > 0,
+			Maintenance:            api.Maintenance.Enabled(),
+			DebugToken:             api.Config.DebugTokenPath != "",
+		},
+		Tenants:                  tenants,
+		Clients:                  len(api.Config.Clients),
+		Scopes:                   scopes,
+		SigningAlgorithms:        api.TokenManager.SigningAlgorithms(),
+		Endpoints:                api.Config.EndpointPaths(),
+		ResponseModes:            config.SupportedResponseModes,
+		TokenEndpointAuthMethods: api.Config.Clients.TokenEndpointAuthMethods(),
+	}
+}
+
+func (api *LauthAPI) GetCapabilities(c *gin.Context) {
+	report := metrics.StartLogging(c)
+	defer report.Close()
+
+	c.IndentedJSON(http.StatusOK, api.Capabilities())
+}
+
+// SetAdminRoutes registers endpoints for administrators.
+// Each endpoint will be registered only if its path is set in Admin config.
+func (api *LauthAPI) SetAdminRoutes(r gin.IRoutes) {
+	conf := api.Config.Admin
+	if conf.CapabilitiesPath == "" && conf.SessionsPath == "" {
+		return
+	}
+
+	auth := gin.BasicAuthForRealm(gin.Accounts{conf.Username: conf.Password}, "lauth admin")
+	if conf.CapabilitiesPath != "" {
+		r.GET(conf.CapabilitiesPath, auth, func(c *gin.Context) {
+			api.current().GetCapabilities(c)
+		})
+	}
+	if conf.SessionsPath != "" {
+		r.GET(path.Join(conf.SessionsPath, ":sid"), auth, api.GetSession)
+	}
+}
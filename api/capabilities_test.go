@@ -0,0 +1,88 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/macrat/lauth/api"
+	"github.com/macrat/lauth/testutil"
+)
+
+func TestGetCapabilities(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.Admin.CapabilitiesPath = "/admin/capabilities"
+	env.API.Config.Admin.Username = "admin"
+	env.API.Config.Admin.Password = "admin-password"
+	env.API.Config.RejectReusedNonce = true
+	env.API.SetAdminRoutes(env.App)
+
+	get := func(username, password string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/admin/capabilities", nil)
+		if username != "" {
+			req.SetBasicAuth(username, password)
+		}
+		return env.DoRequest(req)
+	}
+
+	if resp := get("", ""); resp.Code != http.StatusUnauthorized {
+		t.Errorf("expected status code %d without credentials but got %d", http.StatusUnauthorized, resp.Code)
+	}
+	if resp := get("admin", "wrong-password"); resp.Code != http.StatusUnauthorized {
+		t.Errorf("expected status code %d with wrong password but got %d", http.StatusUnauthorized, resp.Code)
+	}
+
+	check := func(t *testing.T, maintenance bool) {
+		t.Helper()
+
+		resp := get("admin", "admin-password")
+		if resp.Code != http.StatusOK {
+			t.Fatalf("unexpected status code: %d", resp.Code)
+		}
+
+		var caps api.Capabilities
+		if err := json.Unmarshal(resp.Body.Bytes(), &caps); err != nil {
+			t.Fatalf("failed to parse response: %s", err)
+		}
+
+		features := api.CapabilityFeatures{
+			SSO:               true,
+			RefreshToken:      true,
+			RejectReusedNonce: true,
+			Maintenance:       maintenance,
+		}
+		if !reflect.DeepEqual(caps.Features, features) {
+			t.Errorf("unexpected features:\nexpected: %#v\n but got: %#v", features, caps.Features)
+		}
+
+		if caps.Tenants != 1 {
+			t.Errorf("unexpected number of tenants: %d", caps.Tenants)
+		}
+		if caps.Clients != 2 {
+			t.Errorf("unexpected number of clients: %d", caps.Clients)
+		}
+		if !reflect.DeepEqual(caps.SigningAlgorithms, []string{"RS256"}) {
+			t.Errorf("unexpected signing algorithms: %#v", caps.SigningAlgorithms)
+		}
+		if caps.Endpoints.Token != "/token" || caps.Endpoints.Authz != "/authz" {
+			t.Errorf("unexpected endpoints: %#v", caps.Endpoints)
+		}
+	}
+
+	check(t, false)
+
+	env.API.Maintenance.Set(true)
+	defer env.API.Maintenance.Set(false)
+	check(t, true)
+}
+
+func TestSetAdminRoutes_Disabled(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.SetAdminRoutes(env.App)
+
+	if resp := env.Get("/admin/capabilities", "", nil); resp.Code != http.StatusNotFound {
+		t.Errorf("capabilities document should be disabled by default but got status code %d", resp.Code)
+	}
+}
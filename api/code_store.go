@@ -0,0 +1,112 @@
+package api
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type activeCode struct {
+	Hash   [sha256.Size]byte
+	Expire time.Time
+}
+
+type failedCode struct {
+	Count  int
+	Expire time.Time
+}
+
+// CodeStore remembers the latest authorization code for each pair of session and client, and failed exchanges of each code.
+// It is for rejecting codes that superseded by a newer code, or that attacked by guessing code_verifier.
+//
+// This is an in-memory store, so it doesn't share codes between multiple instances of lauth.
+type CodeStore struct {
+	mu       sync.Mutex
+	active   map[string]activeCode
+	failures map[[sha256.Size]byte]failedCode
+
+	activeSweep  sweepSchedule
+	failureSweep sweepSchedule
+}
+
+func NewCodeStore() *CodeStore {
+	return &CodeStore{
+		active:   make(map[string]activeCode),
+		failures: make(map[[sha256.Size]byte]failedCode),
+	}
+}
+
+func codeStoreKey(subject string, authTime time.Time, clientID string) string {
+	return fmt.Sprintf("%s %d %s", subject, authTime.Unix(), clientID)
+}
+
+// Issue records the code as the only active code of the session and client, and invalidates the previous one.
+func (s *CodeStore) Issue(subject string, authTime time.Time, clientID, code string, expiresIn time.Duration) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.activeSweep.due(now) {
+		for k, c := range s.active {
+			if !now.Before(c.Expire) {
+				delete(s.active, k)
+			}
+		}
+	}
+
+	s.active[codeStoreKey(subject, authTime, clientID)] = activeCode{
+		Hash:   sha256.Sum256([]byte(code)),
+		Expire: now.Add(expiresIn),
+	}
+}
+
+// IsActive reports whether the code is the latest code that issued for the session and client.
+func (s *CodeStore) IsActive(subject string, authTime time.Time, clientID, code string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.active[codeStoreKey(subject, authTime, clientID)]
+	return ok && time.Now().Before(c.Expire) && c.Hash == sha256.Sum256([]byte(code))
+}
+
+// Fail records a failed exchange of the code, and returns the number of failures of it.
+// The record is kept until the code expires.
+func (s *CodeStore) Fail(code string, expiresAt time.Time) int {
+	now := time.Now()
+	hash := sha256.Sum256([]byte(code))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.failureSweep.due(now) {
+		for k, f := range s.failures {
+			if !now.Before(f.Expire) {
+				delete(s.failures, k)
+			}
+		}
+	}
+
+	f := s.failures[hash]
+	if !now.Before(f.Expire) {
+		f.Count = 0
+	}
+	f.Count++
+	f.Expire = expiresAt
+	s.failures[hash] = f
+
+	return f.Count
+}
+
+// Failures returns the number of failed exchanges of the code.
+func (s *CodeStore) Failures(code string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	f, ok := s.failures[sha256.Sum256([]byte(code))]
+	if !ok || !time.Now().Before(f.Expire) {
+		return 0
+	}
+	return f.Count
+}
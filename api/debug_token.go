@@ -0,0 +1,54 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/errors"
+	"github.com/macrat/lauth/metrics"
+	"github.com/macrat/lauth/token"
+)
+
+type DebugTokenResponse struct {
+	Valid  bool                     `json:"valid"`
+	Claims *token.AccessTokenClaims `json:"claims,omitempty"`
+	Error  string                   `json:"error,omitempty"`
+}
+
+// PostDebugToken validates the access_token in the request, and responds the claims or the reason why it is invalid.
+// It is for debugging integration of clients, so it doesn't require any authentication.
+func (api *LauthAPI) PostDebugToken(c *gin.Context) {
+	report := metrics.StartLogging(c)
+	defer report.Close()
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	rawToken := c.PostForm("token")
+	if rawToken == "" {
+		e := &errors.Error{
+			Reason:      errors.InvalidRequest,
+			Description: "token is required",
+		}
+		report.SetError(e)
+		errors.SendJSON(c, e)
+		return
+	}
+
+	claims, err := api.TokenManager.ParseAccessToken(rawToken)
+	if err == nil {
+		err = claims.Validate(api.Config.Issuer)
+	}
+	if err != nil {
+		c.IndentedJSON(http.StatusOK, DebugTokenResponse{
+			Valid: false,
+			Error: err.Error(),
+		})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, DebugTokenResponse{
+		Valid:  true,
+		Claims: &claims,
+	})
+}
@@ -0,0 +1,93 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/api"
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/testutil"
+	"github.com/macrat/lauth/token"
+)
+
+func TestPostDebugToken(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.App.POST("/debug/token", env.API.PostDebugToken)
+
+	issuer := env.API.Config.Issuer
+
+	accessToken, err := env.API.TokenManager.CreateAccessToken(issuer, "macrat", "some_client_id", "openid profile", "", token.Authentication{Time: time.Now()}, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create access token: %s", err)
+	}
+	expiredToken, err := env.API.TokenManager.CreateAccessToken(issuer, "macrat", "some_client_id", "openid", "", token.Authentication{Time: time.Now().Add(-2 * time.Hour)}, -time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create access token: %s", err)
+	}
+	anotherIssuerToken, err := env.API.TokenManager.CreateAccessToken(&config.URL{Scheme: "https", Host: "another.example.com"}, "macrat", "some_client_id", "openid", "", token.Authentication{Time: time.Now()}, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create access token: %s", err)
+	}
+	idToken, err := env.API.TokenManager.CreateIDToken(issuer, "macrat", "some_client_id", "", "", "", nil, token.Authentication{Time: time.Now()}, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create id token: %s", err)
+	}
+
+	tests := []struct {
+		Name  string
+		Token string
+		Valid bool
+		Error string
+	}{
+		{"valid", accessToken, true, ""},
+		{"expired", expiredToken, false, "token has already expired"},
+		{"another issuer", anotherIssuerToken, false, "unexpected issuer"},
+		{"id_token", idToken, false, "unexpected audience"},
+		{"broken", "this-is-not-a-token", false, "token contains an invalid number of segments"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			resp := env.Post("/debug/token", "", url.Values{"token": {tt.Token}})
+			if resp.Code != http.StatusOK {
+				t.Fatalf("unexpected status code: %d", resp.Code)
+			}
+			if cc := resp.Header().Get("Cache-Control"); cc != "no-store" {
+				t.Errorf("unexpected Cache-Control: %#v", cc)
+			}
+
+			var body api.DebugTokenResponse
+			if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+				t.Fatalf("failed to unmarshal response: %s", err)
+			}
+
+			if body.Valid != tt.Valid {
+				t.Errorf("expected valid=%v but got %v", tt.Valid, body.Valid)
+			}
+			if !strings.HasPrefix(body.Error, tt.Error) {
+				t.Errorf("unexpected error: %#v", body.Error)
+			}
+			if tt.Valid {
+				if body.Claims == nil || body.Claims.Subject != "macrat" || body.Claims.Scope != "openid profile" {
+					t.Errorf("unexpected claims: %#v", body.Claims)
+				}
+			} else if body.Claims != nil {
+				t.Errorf("claims of invalid token should not be responded: %#v", body.Claims)
+			}
+		})
+	}
+
+	t.Run("no token", func(t *testing.T) {
+		resp := env.Post("/debug/token", "", url.Values{})
+		if resp.Code != http.StatusBadRequest {
+			t.Fatalf("unexpected status code: %d", resp.Code)
+		}
+		if body := resp.Body.String(); body != `{"error":"invalid_request","error_description":"token is required"}` {
+			t.Errorf("unexpected response body: %s", body)
+		}
+	})
+}
@@ -10,7 +10,7 @@ import (
 func (api *LauthAPI) GetAuthz(c *gin.Context) {
 	ctx, err := NewAuthzContext(api, c)
 	if err != nil {
-		errors.SendRedirect(c, err)
+		errors.SendRedirect(c, api.authzError(err))
 		return
 	}
 	defer ctx.Close()
@@ -4,11 +4,13 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"reflect"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/macrat/lauth/api"
+	"github.com/macrat/lauth/config"
 	"github.com/macrat/lauth/testutil"
 	"github.com/macrat/lauth/token"
 )
@@ -83,7 +85,7 @@ func TestGetAuthz(t *testing.T) {
 			Code:        http.StatusFound,
 			HasLocation: true,
 			Query: url.Values{
-				"error":             {"unsupported_response_type"},
+				"error":             {"invalid_request"},
 				"error_description": {"response_type is required"},
 			},
 			Fragment: url.Values{},
@@ -272,7 +274,7 @@ func TestGetAuthz(t *testing.T) {
 			HasLocation: true,
 			Query: url.Values{
 				"error":             {"invalid_request"},
-				"error_description": {"prompt=none can't use same time with login, select_account, or consent"},
+				"error_description": {"prompt=none can't use same time with other values"},
 			},
 			Fragment: url.Values{},
 		},
@@ -367,6 +369,23 @@ func TestGetAuthz(t *testing.T) {
 				"error_description": {"nonce is required in the implicit/hybrid flow of OpenID Connect"},
 			},
 		},
+		{
+			Name: "id_token without openid scope",
+			Request: url.Values{
+				"redirect_uri":  {"http://implicit-client.example.com/callback"},
+				"client_id":     {"implicit_client_id"},
+				"response_type": {"token id_token"},
+				"nonce":         {"this is nonce"},
+				"scope":         {"profile"},
+			},
+			Code:        http.StatusFound,
+			HasLocation: true,
+			Query:       url.Values{},
+			Fragment: url.Values{
+				"error":             {"invalid_request"},
+				"error_description": {"openid scope is required when use id_token response type"},
+			},
+		},
 		{
 			Name: "can't use both prompt of none and login",
 			Request: url.Values{
@@ -379,7 +398,7 @@ func TestGetAuthz(t *testing.T) {
 			HasLocation: true,
 			Query: url.Values{
 				"error":             {"invalid_request"},
-				"error_description": {"prompt=none can't use same time with login, select_account, or consent"},
+				"error_description": {"prompt=none can't use same time with other values"},
 			},
 			Fragment: url.Values{},
 		},
@@ -395,7 +414,7 @@ func TestGetAuthz(t *testing.T) {
 			HasLocation: true,
 			Query: url.Values{
 				"error":             {"invalid_request"},
-				"error_description": {"prompt=none can't use same time with login, select_account, or consent"},
+				"error_description": {"prompt=none can't use same time with other values"},
 			},
 			Fragment: url.Values{},
 		},
@@ -411,7 +430,7 @@ func TestGetAuthz(t *testing.T) {
 			HasLocation: true,
 			Query: url.Values{
 				"error":             {"invalid_request"},
-				"error_description": {"prompt=none can't use same time with login, select_account, or consent"},
+				"error_description": {"prompt=none can't use same time with other values"},
 			},
 			Fragment: url.Values{},
 		},
@@ -496,7 +515,7 @@ func TestGetAuthz_LoginExpires(t *testing.T) {
 				t.Fatalf("failed to get inputs: %s", err)
 			}
 
-			claims, err := env.API.TokenManager.ParseRequestObject(inputs["request"], "")
+			claims, err := env.API.TokenManager.ParseRequestObject(inputs["request"], "", "")
 			if err != nil {
 				t.Fatalf("failed to parse request object: %s", err)
 			}
@@ -519,7 +538,7 @@ func TestGetAuthz_SSO(t *testing.T) {
 		"",
 		"",
 		nil,
-		time.Now().Add(-5*time.Minute),
+		token.Authentication{Time: time.Now().Add(-5 * time.Minute)},
 		10*time.Minute,
 	)
 	if err != nil {
@@ -650,6 +669,7 @@ func TestGetAuthz_SSO(t *testing.T) {
 				ssoToken, err = env.API.TokenManager.CreateSSOToken(
 					env.API.Config.Issuer,
 					"macrat",
+					"",
 					token.AuthorizedParties{"some_client_id"},
 					tt.AuthTime,
 					time.Now().Add(10*time.Minute),
@@ -726,3 +746,1433 @@ func TestGetAuthz_SSO(t *testing.T) {
 		}
 	})
 }
+
+func TestGetAuthz_ResponseMode(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	client := env.API.Config.Clients["implicit_client_id"]
+	client.ResponseModes = []string{"query"}
+	env.API.Config.Clients["implicit_client_id"] = client
+
+	env.RedirectTest(t, "GET", "/authz", []testutil.RedirectTest{
+		{
+			Name: "fragment for code",
+			Request: url.Values{
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+				"client_id":     {"some_client_id"},
+				"response_type": {"code"},
+				"response_mode": {"fragment"},
+			},
+			Code: http.StatusOK,
+		},
+		{
+			Name: "unsupported mode",
+			Request: url.Values{
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+				"client_id":     {"some_client_id"},
+				"response_type": {"code"},
+				"response_mode": {"query.jwt"},
+			},
+			Code:        http.StatusFound,
+			HasLocation: true,
+			Query: url.Values{
+				"error":             {"invalid_request"},
+				"error_description": {"response_mode \"query.jwt\" is not supported"},
+			},
+			Fragment: url.Values{},
+		},
+		{
+			Name: "unsupported mode for implicit",
+			Request: url.Values{
+				"redirect_uri":  {"http://implicit-client.example.com/callback"},
+				"client_id":     {"implicit_client_id"},
+				"response_type": {"token"},
+				"response_mode": {"web_message"},
+			},
+			Code:        http.StatusFound,
+			HasLocation: true,
+			Query:       url.Values{},
+			Fragment: url.Values{
+				"error":             {"invalid_request"},
+				"error_description": {"response_mode \"web_message\" is not supported"},
+			},
+		},
+		{
+			Name: "query for token",
+			Request: url.Values{
+				"redirect_uri":  {"http://implicit-client.example.com/callback"},
+				"client_id":     {"implicit_client_id"},
+				"response_type": {"token"},
+				"response_mode": {"query"},
+			},
+			Code:        http.StatusFound,
+			HasLocation: true,
+			Query: url.Values{
+				"error":             {"invalid_request"},
+				"error_description": {"query response_mode can't use in the implicit/hybrid flow"},
+			},
+			Fragment: url.Values{},
+		},
+		{
+			Name: "allowed mode of restricted client",
+			Request: url.Values{
+				"redirect_uri":  {"http://implicit-client.example.com/callback"},
+				"client_id":     {"implicit_client_id"},
+				"response_type": {"code"},
+			},
+			Code: http.StatusOK,
+		},
+		{
+			Name: "disallowed mode of restricted client",
+			Request: url.Values{
+				"redirect_uri":  {"http://implicit-client.example.com/callback"},
+				"client_id":     {"implicit_client_id"},
+				"response_type": {"code"},
+				"response_mode": {"fragment"},
+			},
+			Code:        http.StatusFound,
+			HasLocation: true,
+			Query:       url.Values{},
+			Fragment: url.Values{
+				"error":             {"unauthorized_client"},
+				"error_description": {"fragment response_mode is not allowed for this client"},
+			},
+		},
+		{
+			Name: "implicit flow of restricted client",
+			Request: url.Values{
+				"redirect_uri":  {"http://implicit-client.example.com/callback"},
+				"client_id":     {"implicit_client_id"},
+				"response_type": {"token"},
+			},
+			Code:        http.StatusFound,
+			HasLocation: true,
+			Query:       url.Values{},
+			Fragment: url.Values{
+				"error":             {"unauthorized_client"},
+				"error_description": {"fragment response_mode is not allowed for this client"},
+			},
+		},
+	})
+}
+
+func TestGetAuthz_ImplicitScopes(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.ImplicitScopes = []string{"profile"}
+
+	env.RedirectTest(t, "GET", "/authz", []testutil.RedirectTest{
+		{
+			Name: "allowed scope in implicit",
+			Request: url.Values{
+				"redirect_uri":  {"http://implicit-client.example.com/callback"},
+				"client_id":     {"implicit_client_id"},
+				"response_type": {"token"},
+				"scope":         {"openid profile"},
+			},
+			Code: http.StatusOK,
+		},
+		{
+			Name: "restricted scope in implicit",
+			Request: url.Values{
+				"redirect_uri":  {"http://implicit-client.example.com/callback"},
+				"client_id":     {"implicit_client_id"},
+				"response_type": {"token"},
+				"scope":         {"openid profile email"},
+			},
+			Code:        http.StatusFound,
+			HasLocation: true,
+			Query:       url.Values{},
+			Fragment: url.Values{
+				"error":             {"invalid_scope"},
+				"error_description": {"email scope can't request in the implicit/hybrid flow"},
+			},
+		},
+		{
+			Name: "restricted scope in hybrid",
+			Request: url.Values{
+				"redirect_uri":  {"http://implicit-client.example.com/callback"},
+				"client_id":     {"implicit_client_id"},
+				"response_type": {"code id_token"},
+				"scope":         {"openid email"},
+				"nonce":         {"this-is-nonce"},
+			},
+			Code:        http.StatusFound,
+			HasLocation: true,
+			Query:       url.Values{},
+			Fragment: url.Values{
+				"error":             {"invalid_scope"},
+				"error_description": {"email scope can't request in the implicit/hybrid flow"},
+			},
+		},
+		{
+			Name: "restricted scope in code",
+			Request: url.Values{
+				"redirect_uri":  {"http://implicit-client.example.com/callback"},
+				"client_id":     {"implicit_client_id"},
+				"response_type": {"code"},
+				"scope":         {"openid profile email"},
+			},
+			Code: http.StatusOK,
+		},
+	})
+}
+
+func TestGetAuthz_StrictScope(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	env.RedirectTest(t, "GET", "/authz", []testutil.RedirectTest{
+		{
+			Name: "openid in token before enable",
+			Request: url.Values{
+				"redirect_uri":  {"http://implicit-client.example.com/callback"},
+				"client_id":     {"implicit_client_id"},
+				"response_type": {"token"},
+				"scope":         {"openid profile"},
+			},
+			Code: http.StatusOK,
+		},
+	})
+
+	env.API.Config.StrictScope = true
+
+	env.RedirectTest(t, "GET", "/authz", []testutil.RedirectTest{
+		{
+			Name: "id_token without openid",
+			Request: url.Values{
+				"redirect_uri":  {"http://implicit-client.example.com/callback"},
+				"client_id":     {"implicit_client_id"},
+				"response_type": {"id_token"},
+				"scope":         {"profile"},
+				"nonce":         {"this-is-nonce"},
+			},
+			Code:        http.StatusFound,
+			HasLocation: true,
+			Query:       url.Values{},
+			Fragment: url.Values{
+				"error":             {"invalid_request"},
+				"error_description": {"openid scope is required when use id_token response type"},
+			},
+		},
+		{
+			Name: "openid in token",
+			Request: url.Values{
+				"redirect_uri":  {"http://implicit-client.example.com/callback"},
+				"client_id":     {"implicit_client_id"},
+				"response_type": {"token"},
+				"scope":         {"openid profile"},
+			},
+			Code:        http.StatusFound,
+			HasLocation: true,
+			Query:       url.Values{},
+			Fragment: url.Values{
+				"error":             {"invalid_scope"},
+				"error_description": {"openid scope can't use with token response type"},
+			},
+		},
+		{
+			Name: "empty scope in token",
+			Request: url.Values{
+				"redirect_uri":  {"http://implicit-client.example.com/callback"},
+				"client_id":     {"implicit_client_id"},
+				"response_type": {"token"},
+			},
+			Code:        http.StatusFound,
+			HasLocation: true,
+			Query:       url.Values{},
+			Fragment: url.Values{
+				"error":             {"invalid_scope"},
+				"error_description": {"scope is required when use token response type"},
+			},
+		},
+		{
+			Name: "offline_access in implicit",
+			Request: url.Values{
+				"redirect_uri":  {"http://implicit-client.example.com/callback"},
+				"client_id":     {"implicit_client_id"},
+				"response_type": {"id_token token"},
+				"scope":         {"openid offline_access"},
+				"nonce":         {"this-is-nonce"},
+			},
+			Code:        http.StatusFound,
+			HasLocation: true,
+			Query:       url.Values{},
+			Fragment: url.Values{
+				"error":             {"invalid_scope"},
+				"error_description": {"offline_access scope can't use without code response type"},
+			},
+		},
+		{
+			Name: "profile in token",
+			Request: url.Values{
+				"redirect_uri":  {"http://implicit-client.example.com/callback"},
+				"client_id":     {"implicit_client_id"},
+				"response_type": {"token"},
+				"scope":         {"profile"},
+			},
+			Code: http.StatusOK,
+		},
+		{
+			Name: "offline_access in hybrid",
+			Request: url.Values{
+				"redirect_uri":  {"http://implicit-client.example.com/callback"},
+				"client_id":     {"implicit_client_id"},
+				"response_type": {"code id_token"},
+				"scope":         {"openid offline_access"},
+				"nonce":         {"this-is-nonce"},
+			},
+			Code: http.StatusOK,
+		},
+		{
+			Name: "code without openid",
+			Request: url.Values{
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+				"client_id":     {"some_client_id"},
+				"response_type": {"code"},
+				"scope":         {"profile"},
+			},
+			Code: http.StatusOK,
+		},
+	})
+}
+
+func TestGetAuthz_RequireACR(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	ssoToken, err := env.API.TokenManager.CreateSSOToken(
+		env.API.Config.Issuer,
+		"macrat",
+		"",
+		token.AuthorizedParties{"implicit_client_id"},
+		time.Now().Add(-time.Minute),
+		time.Now().Add(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("failed to create SSO token: %s", err)
+	}
+
+	tests := []struct {
+		RequireACR string
+		Prompt     string
+		Code       int
+		Error      string
+	}{
+		{"", "", http.StatusFound, ""},
+		{"0", "", http.StatusFound, ""},
+		{"1", "", http.StatusOK, ""},
+		{"1", "none", http.StatusFound, "login_required"},
+		{"2", "", http.StatusFound, "unmet_authentication_requirements"},
+	}
+
+	for _, tt := range tests {
+		client := env.API.Config.Clients["implicit_client_id"]
+		client.RequireACR = tt.RequireACR
+		env.API.Config.Clients["implicit_client_id"] = client
+
+		query := url.Values{
+			"client_id":     {"implicit_client_id"},
+			"redirect_uri":  {"http://implicit-client.example.com/callback"},
+			"response_type": {"code"},
+			"scope":         {"openid"},
+		}
+		if tt.Prompt != "" {
+			query.Set("prompt", tt.Prompt)
+		}
+
+		req, _ := http.NewRequest("GET", "/authz?"+query.Encode(), nil)
+		req.AddCookie(&http.Cookie{Name: api.SSO_TOKEN_COOKIE, Value: ssoToken})
+		resp := env.DoRequest(req)
+
+		name := fmt.Sprintf("require_acr=%#v prompt=%#v", tt.RequireACR, tt.Prompt)
+		if resp.Code != tt.Code {
+			t.Errorf("%s: expected status code %d but got %d", name, tt.Code, resp.Code)
+			continue
+		}
+		if resp.Code != http.StatusFound {
+			continue
+		}
+
+		location, err := url.Parse(resp.Header().Get("Location"))
+		if err != nil {
+			t.Fatalf("%s: failed to parse location: %s", name, err)
+		}
+		if e := location.Query().Get("error"); e != tt.Error {
+			t.Errorf("%s: unexpected error: %#v", name, e)
+		}
+		if tt.Error == "" && location.Query().Get("code") == "" {
+			t.Errorf("%s: expected SSO login but code is not issued", name)
+		}
+	}
+}
+
+func TestGetAuthz_PromptCombinations(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	ssoToken, err := env.API.TokenManager.CreateSSOToken(
+		env.API.Config.Issuer,
+		"macrat",
+		"",
+		token.AuthorizedParties{"some_client_id"},
+		time.Now(),
+		time.Now().Add(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("failed to create SSO token: %s", err)
+	}
+
+	// Result is "code" if issued the code, "login" or "consent" if showed the page, or otherwise the error name.
+	tests := []struct {
+		Prompt string
+		SSO    bool
+		Result string
+	}{
+		{"", true, "code"},
+		{"", false, "login"},
+		{"none", true, "code"},
+		{"none", false, "login_required"},
+		{"login", true, "login"},
+		{"consent", true, "consent"},
+		{"consent", false, "login"},
+		{"select_account", true, "login"},
+		{"login consent", true, "login"},
+		{"consent select_account", true, "login"},
+		{"login select_account", true, "login"},
+		{"login consent select_account", true, "login"},
+		{"none login", true, "invalid_request"},
+		{"none consent", true, "invalid_request"},
+		{"none select_account", true, "invalid_request"},
+		{"login consent none", false, "invalid_request"},
+		{"none none", true, "invalid_request"},
+		{"none unknown", true, "invalid_request"},
+		{"unknown", true, "code"},
+	}
+
+	for _, tt := range tests {
+		name := fmt.Sprintf("prompt=%#v sso=%v", tt.Prompt, tt.SSO)
+
+		req, _ := http.NewRequest("GET", "/authz?"+url.Values{
+			"client_id":     {"some_client_id"},
+			"redirect_uri":  {"http://some-client.example.com/callback"},
+			"response_type": {"code"},
+			"scope":         {"openid"},
+			"prompt":        {tt.Prompt},
+		}.Encode(), nil)
+		if tt.SSO {
+			req.AddCookie(&http.Cookie{Name: api.SSO_TOKEN_COOKIE, Value: ssoToken})
+		}
+		resp := env.DoRequest(req)
+
+		result := ""
+		switch resp.Code {
+		case http.StatusOK:
+			if strings.Contains(resp.Body.String(), `name="password"`) {
+				result = "login"
+			} else {
+				result = "consent"
+			}
+		case http.StatusFound:
+			location, err := url.Parse(resp.Header().Get("Location"))
+			if err != nil {
+				t.Fatalf("%s: failed to parse location: %s", name, err)
+			}
+			if e := location.Query().Get("error"); e != "" {
+				result = e
+			} else if location.Query().Get("code") != "" {
+				result = "code"
+			}
+		default:
+			t.Errorf("%s: unexpected status code: %d", name, resp.Code)
+			continue
+		}
+
+		if result != tt.Result {
+			t.Errorf("%s: expected %s but got %s", name, tt.Result, result)
+		}
+	}
+}
+
+func TestGetAuthz_StrictOIDC(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	issuer := env.API.Config.Issuer.String()
+
+	ssoToken, err := env.API.TokenManager.CreateSSOToken(
+		env.API.Config.Issuer,
+		"macrat",
+		"",
+		token.AuthorizedParties{"implicit_client_id"},
+		time.Now().Add(-time.Minute),
+		time.Now().Add(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("failed to create SSO token: %s", err)
+	}
+
+	authz := func(t *testing.T, params url.Values) (int, url.Values) {
+		t.Helper()
+
+		req, _ := http.NewRequest("GET", "/authz?"+params.Encode(), nil)
+		req.AddCookie(&http.Cookie{Name: api.SSO_TOKEN_COOKIE, Value: ssoToken})
+		resp := env.DoRequest(req)
+
+		location, err := url.Parse(resp.Header().Get("Location"))
+		if err != nil {
+			t.Fatalf("failed to parse location: %s", err)
+		}
+		if location.Fragment != "" {
+			values, _ := url.ParseQuery(location.Fragment)
+			return resp.Code, values
+		}
+		return resp.Code, location.Query()
+	}
+
+	tests := []struct {
+		Name         string
+		Params       url.Values
+		LenientError string
+		StrictError  string
+	}{
+		{
+			Name: "code flow",
+			Params: url.Values{
+				"client_id":     {"implicit_client_id"},
+				"redirect_uri":  {"http://implicit-client.example.com/callback"},
+				"response_type": {"code"},
+				"scope":         {"openid"},
+				"state":         {"this-is-state"},
+			},
+		},
+		{
+			Name: "OAuth2 only response type",
+			Params: url.Values{
+				"client_id":     {"implicit_client_id"},
+				"redirect_uri":  {"http://implicit-client.example.com/callback"},
+				"response_type": {"token"},
+				"scope":         {"openid"},
+				"state":         {"this-is-state"},
+			},
+			StrictError: "unsupported_response_type",
+		},
+		{
+			Name: "duplicated response type",
+			Params: url.Values{
+				"client_id":     {"implicit_client_id"},
+				"redirect_uri":  {"http://implicit-client.example.com/callback"},
+				"response_type": {"code code"},
+				"scope":         {"openid"},
+				"state":         {"this-is-state"},
+			},
+			StrictError: "unsupported_response_type",
+		},
+		{
+			Name: "missing nonce",
+			Params: url.Values{
+				"client_id":     {"implicit_client_id"},
+				"redirect_uri":  {"http://implicit-client.example.com/callback"},
+				"response_type": {"id_token"},
+				"scope":         {"openid"},
+				"state":         {"this-is-state"},
+			},
+			LenientError: "invalid_request",
+			StrictError:  "invalid_request",
+		},
+		{
+			Name: "missing scope",
+			Params: url.Values{
+				"client_id":     {"implicit_client_id"},
+				"redirect_uri":  {"http://implicit-client.example.com/callback"},
+				"response_type": {"code"},
+				"state":         {"this-is-state"},
+			},
+			StrictError: "invalid_request",
+		},
+		{
+			Name: "scope without openid",
+			Params: url.Values{
+				"client_id":     {"implicit_client_id"},
+				"redirect_uri":  {"http://implicit-client.example.com/callback"},
+				"response_type": {"code"},
+				"scope":         {"profile"},
+				"state":         {"this-is-state"},
+			},
+			StrictError: "invalid_scope",
+		},
+	}
+
+	for _, strict := range []bool{false, true} {
+		env.API.Config.StrictOIDC = strict
+
+		for _, tt := range tests {
+			expectError := tt.LenientError
+			if strict {
+				expectError = tt.StrictError
+			}
+
+			code, values := authz(t, tt.Params)
+			if code != http.StatusFound {
+				t.Errorf("strict=%v %s: unexpected status code: %d", strict, tt.Name, code)
+				continue
+			}
+			if e := values.Get("error"); e != expectError {
+				t.Errorf("strict=%v %s: expected error %#v but got %#v", strict, tt.Name, expectError, e)
+			}
+			if s := values.Get("state"); s != "this-is-state" {
+				t.Errorf("strict=%v %s: state is not echoed: %#v", strict, tt.Name, s)
+			}
+			if iss := values.Get("iss"); strict && iss != issuer {
+				t.Errorf("strict=%v %s: unexpected iss: %#v", strict, tt.Name, iss)
+			} else if !strict && iss != "" {
+				t.Errorf("strict=%v %s: iss should not be set: %#v", strict, tt.Name, iss)
+			}
+		}
+
+		request := testutil.ImplicitClientRequestObject(t, map[string]interface{}{
+			"iss": "implicit_client_id",
+			"aud": issuer + "/",
+		})
+		code, values := authz(t, url.Values{
+			"client_id":     {"implicit_client_id"},
+			"redirect_uri":  {"http://implicit-client.example.com/callback"},
+			"response_type": {"code"},
+			"scope":         {"openid"},
+			"request":       {request},
+		})
+		if strict && code != http.StatusBadRequest {
+			t.Errorf("strict=%v: request object with not exact audience should be rejected but got %d", strict, code)
+		} else if !strict && (code != http.StatusFound || values.Get("code") == "") {
+			t.Errorf("strict=%v: request object with equivalent audience should be accepted but got %d %s", strict, code, values)
+		}
+
+		conf := env.API.Config.OpenIDConfiguration()
+		hasToken := false
+		for _, rt := range conf.ResponseTypesSupported {
+			if rt == "token" {
+				hasToken = true
+			}
+		}
+		if hasToken == strict {
+			t.Errorf("strict=%v: unexpected response_types_supported: %#v", strict, conf.ResponseTypesSupported)
+		}
+		if conf.AuthorizationResponseIssParameterSupported != strict {
+			t.Errorf("strict=%v: unexpected authorization_response_iss_parameter_supported", strict)
+		}
+	}
+}
+
+func TestGetAuthz_StrictRedirectURI(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	var pattern config.Pattern
+	if err := pattern.UnmarshalText([]byte("http://some-client.example.com/app/**")); err != nil {
+		t.Fatalf("failed to compile pattern: %s", err)
+	}
+	client := env.API.Config.Clients["some_client_id"]
+	client.RedirectURI = config.PatternSet{pattern}
+	env.API.Config.Clients["some_client_id"] = client
+
+	tests := []struct {
+		RedirectURI string
+		Lenient     bool
+		Strict      bool
+	}{
+		{"http://some-client.example.com/app/callback", true, true},
+		{"http://some-client.example.com/app/../admin", true, false},
+		{"http://some-client.example.com/app/%2e%2e/admin", true, false},
+		{"http://some-client.example.com/app/x/../callback", true, true},
+		{"http://some-client.example.com@evil.example.com/app/callback", false, false},
+		{"http://evil.example.com/../app/callback", false, false},
+	}
+
+	for _, strict := range []bool{false, true} {
+		env.API.Config.StrictRedirectURI = strict
+
+		for _, tt := range tests {
+			resp := env.Get("/authz", "", url.Values{
+				"redirect_uri":  {tt.RedirectURI},
+				"client_id":     {"some_client_id"},
+				"response_type": {"code"},
+				"scope":         {"openid"},
+			})
+
+			expect := tt.Lenient
+			if strict {
+				expect = tt.Strict
+			}
+			rejected := resp.Code == http.StatusBadRequest && strings.Contains(resp.Body.String(), "redirect_uri is not registered")
+			if rejected == expect {
+				t.Errorf("strict=%v %s: expected allowed=%v but got %d", strict, tt.RedirectURI, expect, resp.Code)
+			}
+		}
+	}
+}
+
+func TestGetAuthz_OptionalScope(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	ssoToken, err := env.API.TokenManager.CreateSSOToken(
+		env.API.Config.Issuer,
+		"macrat",
+		"",
+		token.AuthorizedParties{"some_client_id"},
+		time.Now(),
+		time.Now().Add(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("failed to create sso token: %s", err)
+	}
+
+	for _, preselected := range []bool{false, true} {
+		scopes := make(config.ScopeConfig)
+		for name, scope := range env.API.Config.Scopes {
+			scopes[name] = scope
+		}
+		email := scopes["email"]
+		email.Optional = true
+		email.Preselected = preselected
+		scopes["email"] = email
+		env.API.Config.Scopes = scopes
+
+		req, _ := http.NewRequest("GET", "/authz?"+url.Values{
+			"client_id":     {"some_client_id"},
+			"redirect_uri":  {"http://some-client.example.com/callback"},
+			"response_type": {"code"},
+			"scope":         {"openid email"},
+		}.Encode(), nil)
+		req.AddCookie(&http.Cookie{Name: api.SSO_TOKEN_COOKIE, Value: ssoToken})
+		resp := env.DoRequest(req)
+		if resp.Code != http.StatusFound {
+			t.Fatalf("preselected=%v: unexpected status code: %d", preselected, resp.Code)
+		}
+
+		location, err := url.Parse(resp.Header().Get("Location"))
+		if err != nil {
+			t.Fatalf("preselected=%v: failed to parse location: %s", preselected, err)
+		}
+		code, err := env.API.TokenManager.ParseCode(location.Query().Get("code"))
+		if err != nil {
+			t.Fatalf("preselected=%v: failed to parse code: %s", preselected, err)
+		}
+
+		expect := "openid"
+		if preselected {
+			expect = "email openid"
+		}
+		if code.Scope != expect {
+			t.Errorf("preselected=%v: expected scope %#v but got %#v", preselected, expect, code.Scope)
+		}
+	}
+}
+
+func TestGetAuthz_State(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	ssoToken, err := env.API.TokenManager.CreateSSOToken(
+		env.API.Config.Issuer,
+		"macrat",
+		"",
+		token.AuthorizedParties{"some_client_id", "implicit_client_id"},
+		time.Now(),
+		time.Now().Add(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("failed to create sso token: %s", err)
+	}
+
+	states := []struct {
+		Name  string
+		Query url.Values
+	}{
+		{"absent", url.Values{}},
+		{"empty", url.Values{"state": {""}}},
+		{"special characters", url.Values{"state": {"a&b=c %/+é#?;"}}},
+	}
+
+	requests := []struct {
+		Name     string
+		Query    url.Values
+		Fragment bool
+		Error    bool
+	}{
+		{
+			Name: "success in query",
+			Query: url.Values{
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+				"client_id":     {"some_client_id"},
+				"response_type": {"code"},
+			},
+		},
+		{
+			Name: "success in fragment",
+			Query: url.Values{
+				"redirect_uri":  {"http://implicit-client.example.com/callback"},
+				"client_id":     {"implicit_client_id"},
+				"response_type": {"id_token"},
+				"scope":         {"openid"},
+				"nonce":         {"this-is-nonce"},
+			},
+			Fragment: true,
+		},
+		{
+			Name: "error in query",
+			Query: url.Values{
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+				"client_id":     {"some_client_id"},
+				"response_type": {"code"},
+				"response_mode": {"query.jwt"},
+			},
+			Error: true,
+		},
+		{
+			Name: "error in fragment",
+			Query: url.Values{
+				"redirect_uri":  {"http://implicit-client.example.com/callback"},
+				"client_id":     {"implicit_client_id"},
+				"response_type": {"id_token"},
+				"response_mode": {"web_message"},
+			},
+			Fragment: true,
+			Error:    true,
+		},
+	}
+
+	for _, state := range states {
+		for _, tt := range requests {
+			t.Run(state.Name+"/"+tt.Name, func(t *testing.T) {
+				query := url.Values{}
+				for k, v := range tt.Query {
+					query[k] = v
+				}
+				for k, v := range state.Query {
+					query[k] = v
+				}
+
+				req, _ := http.NewRequest("GET", "/authz?"+query.Encode(), nil)
+				req.AddCookie(&http.Cookie{Name: api.SSO_TOKEN_COOKIE, Value: ssoToken})
+				resp := env.DoRequest(req)
+				if resp.Code != http.StatusFound {
+					t.Fatalf("unexpected status code: %d", resp.Code)
+				}
+
+				location, err := url.Parse(resp.Header().Get("Location"))
+				if err != nil {
+					t.Fatalf("failed to parse location: %s", err)
+				}
+				raw := location.RawQuery
+				if tt.Fragment {
+					raw = location.EscapedFragment()
+				}
+				params, err := url.ParseQuery(raw)
+				if err != nil {
+					t.Fatalf("failed to parse response parameters: %s", err)
+				}
+
+				if _, ok := params["error"]; ok != tt.Error {
+					t.Fatalf("unexpected response: %s", location)
+				}
+
+				expect, present := state.Query["state"]
+				got, ok := params["state"]
+				if ok != present {
+					t.Errorf("expected presence of state is %v but got %s", present, location)
+				} else if present && !reflect.DeepEqual(got, expect) {
+					t.Errorf("expected state %#v but got %#v", expect, got)
+				}
+			})
+		}
+	}
+}
+
+func TestGetAuthz_PKCE(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	env.RedirectTest(t, "GET", "/authz", []testutil.RedirectTest{
+		{
+			Name: "S256",
+			Request: url.Values{
+				"redirect_uri":          {"http://some-client.example.com/callback"},
+				"client_id":             {"some_client_id"},
+				"response_type":         {"code"},
+				"code_challenge":        {challenge},
+				"code_challenge_method": {"S256"},
+			},
+			Code: http.StatusOK,
+		},
+		{
+			Name: "plain by default",
+			Request: url.Values{
+				"redirect_uri":   {"http://some-client.example.com/callback"},
+				"client_id":      {"some_client_id"},
+				"response_type":  {"code"},
+				"code_challenge": {challenge},
+			},
+			Code: http.StatusOK,
+		},
+		{
+			Name: "unsupported method",
+			Request: url.Values{
+				"redirect_uri":          {"http://some-client.example.com/callback"},
+				"client_id":             {"some_client_id"},
+				"response_type":         {"code"},
+				"code_challenge":        {challenge},
+				"code_challenge_method": {"S512"},
+			},
+			Code:        http.StatusFound,
+			HasLocation: true,
+			Query: url.Values{
+				"error":             {"invalid_request"},
+				"error_description": {"unsupported code_challenge_method: S512"},
+			},
+			Fragment: url.Values{},
+		},
+		{
+			Name: "method without challenge",
+			Request: url.Values{
+				"redirect_uri":          {"http://some-client.example.com/callback"},
+				"client_id":             {"some_client_id"},
+				"response_type":         {"code"},
+				"code_challenge_method": {"S256"},
+			},
+			Code:        http.StatusFound,
+			HasLocation: true,
+			Query: url.Values{
+				"error":             {"invalid_request"},
+				"error_description": {"code_challenge is required when use code_challenge_method"},
+			},
+			Fragment: url.Values{},
+		},
+		{
+			Name: "invalid challenge",
+			Request: url.Values{
+				"redirect_uri":          {"http://some-client.example.com/callback"},
+				"client_id":             {"some_client_id"},
+				"response_type":         {"code"},
+				"code_challenge":        {"too-short"},
+				"code_challenge_method": {"S256"},
+			},
+			Code:        http.StatusFound,
+			HasLocation: true,
+			Query: url.Values{
+				"error":             {"invalid_request"},
+				"error_description": {"code_challenge is invalid format"},
+			},
+			Fragment: url.Values{},
+		},
+	})
+
+	query := url.Values{
+		"client_id":             {"some_client_id"},
+		"redirect_uri":          {"http://some-client.example.com/callback"},
+		"response_type":         {"code"},
+		"scope":                 {"openid"},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+
+	resp := env.Get("/authz", "", query)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("unexpected status code of login page: %d", resp.Code)
+	}
+	request, err := testutil.FindRequestObjectByHTML(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to find request object: %s", err)
+	}
+	claims, err := env.API.TokenManager.ParseRequestObject(request, "", "")
+	if err != nil {
+		t.Fatalf("failed to parse request object: %s", err)
+	}
+	if claims.CodeChallenge != challenge || claims.CodeChallengeMethod != "S256" {
+		t.Errorf("login session should keep code_challenge but got %#v %#v", claims.CodeChallenge, claims.CodeChallengeMethod)
+	}
+
+	ssoToken, err := env.API.TokenManager.CreateSSOToken(
+		env.API.Config.Issuer,
+		"macrat",
+		"",
+		token.AuthorizedParties{"some_client_id"},
+		time.Now(),
+		time.Now().Add(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("failed to create sso token: %s", err)
+	}
+
+	req, _ := http.NewRequest("GET", "/authz?"+query.Encode(), nil)
+	req.AddCookie(&http.Cookie{Name: api.SSO_TOKEN_COOKIE, Value: ssoToken})
+	resp = env.DoRequest(req)
+	if resp.Code != http.StatusFound {
+		t.Fatalf("unexpected status code: %d", resp.Code)
+	}
+
+	location, err := url.Parse(resp.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("failed to parse location: %s", err)
+	}
+	code, err := env.API.TokenManager.ParseCode(location.Query().Get("code"))
+	if err != nil {
+		t.Fatalf("failed to parse code: %s", err)
+	}
+	if code.CodeChallenge != challenge || code.CodeChallengeMethod != "S256" {
+		t.Errorf("code should bound to code_challenge but got %#v %#v", code.CodeChallenge, code.CodeChallengeMethod)
+	}
+}
+
+func TestGetAuthz_AllowedScopes(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	client := env.API.Config.Clients["some_client_id"]
+	client.AllowedScopes = []string{"profile"}
+	env.API.Config.Clients["some_client_id"] = client
+
+	request := url.Values{
+		"redirect_uri":  {"http://some-client.example.com/callback"},
+		"client_id":     {"some_client_id"},
+		"response_type": {"code"},
+		"scope":         {"openid profile email"},
+	}
+
+	env.RedirectTest(t, "GET", "/authz", []testutil.RedirectTest{
+		{
+			Name:    "drop disallowed scope",
+			Request: request,
+			Code:    http.StatusOK,
+		},
+	})
+
+	client.RejectDisallowedScopes = true
+	env.API.Config.Clients["some_client_id"] = client
+
+	env.RedirectTest(t, "GET", "/authz", []testutil.RedirectTest{
+		{
+			Name:        "reject disallowed scope",
+			Request:     request,
+			Code:        http.StatusFound,
+			HasLocation: true,
+			Query: url.Values{
+				"error":             {"invalid_scope"},
+				"error_description": {"email scope is not allowed for this client"},
+			},
+			Fragment: url.Values{},
+		},
+		{
+			Name: "allowed scope only",
+			Request: url.Values{
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+				"client_id":     {"some_client_id"},
+				"response_type": {"code"},
+				"scope":         {"openid profile"},
+			},
+			Code: http.StatusOK,
+		},
+	})
+}
+
+func TestGetAuthz_MissingParameters(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.StrictOIDC = true
+
+	tests := []struct {
+		Missing  string
+		Redirect bool
+	}{
+		{"client_id", false},
+		{"redirect_uri", false},
+		{"response_type", true},
+		{"scope", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Missing, func(t *testing.T) {
+			params := url.Values{
+				"client_id":     {"some_client_id"},
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+				"response_type": {"code"},
+				"scope":         {"openid"},
+			}
+			params.Del(tt.Missing)
+
+			resp := env.Get("/authz", "", params)
+
+			description := ""
+			if tt.Redirect {
+				if resp.Code != http.StatusFound {
+					t.Fatalf("unexpected status code: %d", resp.Code)
+				}
+				location, err := url.Parse(resp.Header().Get("Location"))
+				if err != nil {
+					t.Fatalf("failed to parse location: %s", err)
+				}
+				if location.Host != "some-client.example.com" {
+					t.Fatalf("unexpected redirect: %s", location)
+				}
+				if e := location.Query().Get("error"); e != "invalid_request" {
+					t.Errorf("unexpected error: %#v", e)
+				}
+				description = location.Query().Get("error_description")
+			} else {
+				if resp.Code != http.StatusBadRequest {
+					t.Fatalf("unexpected status code: %d", resp.Code)
+				}
+				if location := resp.Header().Get("Location"); location != "" {
+					t.Fatalf("unexpected redirect: %s", location)
+				}
+				description = resp.Body.String()
+			}
+
+			if expect := tt.Missing + " is required"; !strings.Contains(description, expect) {
+				t.Errorf("error description does not say %#v: %#v", expect, description)
+			}
+		})
+	}
+}
+
+func TestGetAuthz_MaxScopes(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.MaxScopes = 3
+
+	env.RedirectTest(t, "GET", "/authz", []testutil.RedirectTest{
+		{
+			Name: "within the limit",
+			Request: url.Values{
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+				"client_id":     {"some_client_id"},
+				"response_type": {"code"},
+				"scope":         {"openid profile email"},
+			},
+			Code: http.StatusOK,
+		},
+		{
+			Name: "duplicated scopes are counted once",
+			Request: url.Values{
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+				"client_id":     {"some_client_id"},
+				"response_type": {"code"},
+				"scope":         {"openid profile email profile email"},
+			},
+			Code: http.StatusOK,
+		},
+		{
+			Name: "too many scopes",
+			Request: url.Values{
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+				"client_id":     {"some_client_id"},
+				"response_type": {"code"},
+				"scope":         {"openid profile email phone"},
+				"state":         {"this-is-state"},
+			},
+			Code:        http.StatusFound,
+			HasLocation: true,
+			Query: url.Values{
+				"error":             {"invalid_scope"},
+				"error_description": {"too many scopes are requested; up to 3 scopes are allowed"},
+				"state":             {"this-is-state"},
+			},
+			Fragment: url.Values{},
+		},
+	})
+}
+
+func TestGetAuthz_ClaimsParameter(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	env.RedirectTest(t, "GET", "/authz", []testutil.RedirectTest{
+		{
+			Name: "malformed claims",
+			Request: url.Values{
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+				"client_id":     {"some_client_id"},
+				"response_type": {"code"},
+				"scope":         {"openid"},
+				"claims":        {`{"id_token": {"email": true}}`},
+			},
+			Code:        http.StatusFound,
+			HasLocation: true,
+			Query: url.Values{
+				"error":             {"invalid_request"},
+				"error_description": {"claims is invalid format"},
+			},
+			Fragment: url.Values{},
+		},
+		{
+			Name: "broken json",
+			Request: url.Values{
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+				"client_id":     {"some_client_id"},
+				"response_type": {"code"},
+				"scope":         {"openid"},
+				"claims":        {`{"id_token": `},
+			},
+			Code:        http.StatusFound,
+			HasLocation: true,
+			Query: url.Values{
+				"error":             {"invalid_request"},
+				"error_description": {"claims is invalid format"},
+			},
+			Fragment: url.Values{},
+		},
+	})
+
+	ssoToken, err := env.API.TokenManager.CreateSSOToken(
+		env.API.Config.Issuer,
+		"macrat",
+		"",
+		token.AuthorizedParties{"some_client_id"},
+		time.Now(),
+		time.Now().Add(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("failed to create sso token: %s", err)
+	}
+
+	authorize := func(t *testing.T) token.CodeClaims {
+		t.Helper()
+
+		req, _ := http.NewRequest("GET", "/authz?"+url.Values{
+			"client_id":     {"some_client_id"},
+			"redirect_uri":  {"http://some-client.example.com/callback"},
+			"response_type": {"code"},
+			"scope":         {"openid"},
+			"claims":        {`{"id_token": {"email": {"essential": true}}, "userinfo": {"phone_number": null}}`},
+		}.Encode(), nil)
+		req.AddCookie(&http.Cookie{Name: api.SSO_TOKEN_COOKIE, Value: ssoToken})
+		resp := env.DoRequest(req)
+		if resp.Code != http.StatusFound {
+			t.Fatalf("unexpected status code: %d", resp.Code)
+		}
+
+		location, err := url.Parse(resp.Header().Get("Location"))
+		if err != nil {
+			t.Fatalf("failed to parse location: %s", err)
+		}
+		code, err := env.API.TokenManager.ParseCode(location.Query().Get("code"))
+		if err != nil {
+			t.Fatalf("failed to parse code: %s", err)
+		}
+		return code
+	}
+
+	code := authorize(t)
+	expect := &token.ClaimsRequest{
+		Userinfo: token.ClaimRequests{"phone_number": nil},
+		IDToken:  token.ClaimRequests{"email": {Essential: true}},
+	}
+	if !reflect.DeepEqual(code.Claims, expect) {
+		t.Errorf("unexpected claims in code: %#v", code.Claims)
+	}
+	if code.Scope != "email openid phone" {
+		t.Errorf("scopes of the requested claims should be added but got %#v", code.Scope)
+	}
+
+	client := env.API.Config.Clients["some_client_id"]
+	client.AllowedScopes = []string{"email"}
+	env.API.Config.Clients["some_client_id"] = client
+
+	if code := authorize(t); code.Scope != "email openid" {
+		t.Errorf("scope that not allowed for the client should not be added but got %#v", code.Scope)
+	}
+
+	client.AllowedScopes = nil
+	env.API.Config.Clients["some_client_id"] = client
+
+	scopes := make(config.ScopeConfig)
+	for name, scope := range env.API.Config.Scopes {
+		scopes[name] = scope
+	}
+	phone := scopes["phone"]
+	phone.Optional = true
+	scopes["phone"] = phone
+	env.API.Config.Scopes = scopes
+
+	if code := authorize(t); code.Scope != "email openid" {
+		t.Errorf("optional scope should not be added but got %#v", code.Scope)
+	}
+
+	env.API.Config.MaxScopes = 1
+	env.RedirectTest(t, "GET", "/authz", []testutil.RedirectTest{
+		{
+			Name: "scopes of claims exceed max_scopes",
+			Request: url.Values{
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+				"client_id":     {"some_client_id"},
+				"response_type": {"code"},
+				"scope":         {"openid"},
+				"claims":        {`{"id_token": {"email": null}}`},
+			},
+			Code:        http.StatusFound,
+			HasLocation: true,
+			Query: url.Values{
+				"error":             {"invalid_scope"},
+				"error_description": {"too many scopes are requested; up to 1 scopes are allowed"},
+			},
+			Fragment: url.Values{},
+		},
+	})
+}
+
+func TestGetAuthz_RequestedSubject(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	ssoToken, err := env.API.TokenManager.CreateSSOToken(
+		env.API.Config.Issuer,
+		"macrat",
+		"",
+		token.AuthorizedParties{"some_client_id"},
+		time.Now(),
+		time.Now().Add(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("failed to create sso token: %s", err)
+	}
+
+	tests := []struct {
+		Name   string
+		Claims string
+		Prompt string
+		Code   int
+		Error  string
+	}{
+		{"same user", `{"id_token": {"sub": {"value": "macrat"}}}`, "none", http.StatusFound, ""},
+		{"another user", `{"id_token": {"sub": {"value": "someone"}}}`, "none", http.StatusFound, "login_required"},
+		{"another user in userinfo", `{"userinfo": {"sub": {"values": ["someone", "other"]}}}`, "none", http.StatusFound, "login_required"},
+		{"another user without prompt", `{"id_token": {"sub": {"value": "someone"}}}`, "", http.StatusOK, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			query := url.Values{
+				"client_id":     {"some_client_id"},
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+				"response_type": {"code"},
+				"scope":         {"openid"},
+				"claims":        {tt.Claims},
+			}
+			if tt.Prompt != "" {
+				query.Set("prompt", tt.Prompt)
+			}
+			req, _ := http.NewRequest("GET", "/authz?"+query.Encode(), nil)
+			req.AddCookie(&http.Cookie{Name: api.SSO_TOKEN_COOKIE, Value: ssoToken})
+			resp := env.DoRequest(req)
+
+			if resp.Code != tt.Code {
+				t.Fatalf("unexpected status code: %d", resp.Code)
+			}
+			if tt.Code != http.StatusFound {
+				if location := resp.Header().Get("Location"); location != "" {
+					t.Errorf("login page should be shown but redirected to %s", location)
+				}
+				return
+			}
+
+			location, err := url.Parse(resp.Header().Get("Location"))
+			if err != nil {
+				t.Fatalf("failed to parse location: %s", err)
+			}
+			if e := location.Query().Get("error"); e != tt.Error {
+				t.Errorf("expected error %#v but got %#v", tt.Error, e)
+			}
+			if tt.Error == "" && location.Query().Get("code") == "" {
+				t.Errorf("code is missing: %s", location)
+			}
+		})
+	}
+}
+
+func TestGetAuthz_ClaimsParameterLimits(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.MaxClaimsRequestSize = 128
+	env.API.Config.MaxClaimsRequestMembers = 3
+
+	env.RedirectTest(t, "GET", "/authz", []testutil.RedirectTest{
+		{
+			Name: "oversized claims",
+			Request: url.Values{
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+				"client_id":     {"some_client_id"},
+				"response_type": {"code"},
+				"scope":         {"openid"},
+				"claims":        {`{"id_token": {"email": {"value": "` + strings.Repeat("a", 128) + `"}}}`},
+			},
+			Code:        http.StatusFound,
+			HasLocation: true,
+			Query: url.Values{
+				"error":             {"invalid_request"},
+				"error_description": {"claims is too large; up to 128 bytes are allowed"},
+			},
+			Fragment: url.Values{},
+		},
+		{
+			Name: "too many claims",
+			Request: url.Values{
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+				"client_id":     {"some_client_id"},
+				"response_type": {"code"},
+				"scope":         {"openid"},
+				"claims":        {`{"id_token": {"email": null, "name": null}, "userinfo": {"email": null, "name": null}}`},
+			},
+			Code:        http.StatusFound,
+			HasLocation: true,
+			Query: url.Values{
+				"error":             {"invalid_request"},
+				"error_description": {"too many claims are requested; up to 3 claims are allowed"},
+			},
+			Fragment: url.Values{},
+		},
+		{
+			Name: "within limits",
+			Request: url.Values{
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+				"client_id":     {"some_client_id"},
+				"response_type": {"code"},
+				"scope":         {"openid"},
+				"claims":        {`{"id_token": {"email": null}, "userinfo": {"email": null, "name": null}}`},
+			},
+			Code: http.StatusOK,
+		},
+	})
+}
+func TestGetAuthz_PublicClient(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	client := env.API.Config.Clients["some_client_id"]
+	client.TokenEndpointAuthMethod = config.AUTH_METHOD_NONE
+	client.Secret = ""
+	env.API.Config.Clients["some_client_id"] = client
+
+	request := func(challenge, method string) url.Values {
+		return url.Values{
+			"redirect_uri":          {"http://some-client.example.com/callback"},
+			"client_id":             {"some_client_id"},
+			"response_type":         {"code"},
+			"scope":                 {"openid"},
+			"code_challenge":        {challenge},
+			"code_challenge_method": {method},
+		}
+	}
+	rejected := url.Values{
+		"error":             {"invalid_request"},
+		"error_description": {"code_challenge with S256 method is required for public client"},
+	}
+
+	env.RedirectTest(t, "GET", "/authz", []testutil.RedirectTest{
+		{
+			Name:    "S256",
+			Request: request("E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", "S256"),
+			Code:    http.StatusOK,
+		},
+		{
+			Name:        "without PKCE",
+			Request:     request("", ""),
+			Code:        http.StatusFound,
+			HasLocation: true,
+			Query:       rejected,
+			Fragment:    url.Values{},
+		},
+		{
+			Name:        "plain",
+			Request:     request("dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk", "plain"),
+			Code:        http.StatusFound,
+			HasLocation: true,
+			Query:       rejected,
+			Fragment:    url.Values{},
+		},
+	})
+}
@@ -0,0 +1,29 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/errors"
+	"github.com/macrat/lauth/metrics"
+)
+
+// GetSession responds the clients that the SSO session has authorized, for administrators.
+func (api *LauthAPI) GetSession(c *gin.Context) {
+	report := metrics.StartLogging(c)
+	defer report.Close()
+
+	info, ok := api.Sessions.Get(c.Param("sid"))
+	if !ok {
+		e := &errors.Error{
+			Reason:      errors.PageNotFound,
+			Description: "no such session",
+		}
+		report.SetError(e)
+		errors.SendJSON(c, e)
+		return
+	}
+
+	c.Header("Cache-Control", "no-store")
+	c.IndentedJSON(http.StatusOK, info)
+}
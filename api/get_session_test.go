@@ -0,0 +1,167 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/api"
+	"github.com/macrat/lauth/testutil"
+	"github.com/macrat/lauth/token"
+)
+
+func TestGetSession(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Sessions = api.NewSessionStore()
+	env.API.Config.Admin.SessionsPath = "/admin/sessions"
+	env.API.Config.Admin.Username = "admin"
+	env.API.Config.Admin.Password = "admin-password"
+	env.API.SetAdminRoutes(env.App)
+
+	var cookie *http.Cookie
+
+	login := func(clientID, redirectURI, username, password string) token.SSOTokenClaims {
+		t.Helper()
+
+		request, err := env.API.TokenManager.CreateRequestObject(
+			env.API.Config.Issuer,
+			"::1",
+			token.RequestObjectClaims{
+				ClientID:     clientID,
+				RedirectURI:  redirectURI,
+				ResponseType: "code",
+				Scope:        "openid",
+			},
+			time.Now().Add(10*time.Minute),
+		)
+		if err != nil {
+			t.Fatalf("failed to make request: %s", err)
+		}
+
+		body := url.Values{
+			"client_id":     {clientID},
+			"response_type": {"code"},
+			"request":       {request},
+			"username":      {username},
+			"password":      {password},
+		}
+		req, _ := http.NewRequest("POST", "/authz", strings.NewReader(body.Encode()))
+		req.RemoteAddr = "[::1]:54321"
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+
+		resp := env.DoRequest(req)
+		if resp.Code != http.StatusFound {
+			t.Fatalf("unexpected status code: %d", resp.Code)
+		}
+
+		cookie, err = (&http.Request{Header: http.Header{"Cookie": resp.Header()["Set-Cookie"]}}).Cookie(api.SSO_TOKEN_COOKIE)
+		if err != nil {
+			t.Fatalf("failed to get SSO token: %s", err)
+		}
+		claims, err := env.API.TokenManager.ParseSSOToken(cookie.Value)
+		if err != nil {
+			t.Fatalf("failed to parse SSO token: %s", err)
+		}
+		if claims.SessionID == "" {
+			t.Fatalf("SSO token has no session ID")
+		}
+		return claims
+	}
+
+	getSession := func(sid string) (int, api.SessionInfo) {
+		t.Helper()
+
+		req, _ := http.NewRequest("GET", "/admin/sessions/"+sid, nil)
+		req.SetBasicAuth("admin", "admin-password")
+		resp := env.DoRequest(req)
+
+		var info api.SessionInfo
+		if resp.Code == http.StatusOK {
+			if err := json.Unmarshal(resp.Body.Bytes(), &info); err != nil {
+				t.Fatalf("failed to parse response: %s", err)
+			}
+		}
+		return resp.Code, info
+	}
+
+	clientIDs := func(info api.SessionInfo) []string {
+		var ids []string
+		for _, c := range info.Clients {
+			ids = append(ids, c.ClientID)
+		}
+		return ids
+	}
+
+	first := login("some_client_id", "http://some-client.example.com/callback", "macrat", "foobar")
+	second := login("implicit_client_id", "http://implicit-client.example.com/callback", "macrat", "foobar")
+	third := login("some_client_id", "http://some-client.example.com/callback", "macrat", "foobar")
+
+	if second.SessionID != first.SessionID || third.SessionID != first.SessionID {
+		t.Fatalf("session ID should be kept in the same session: %s, %s, %s", first.SessionID, second.SessionID, third.SessionID)
+	}
+	if expected := (token.AuthorizedParties{"some_client_id", "implicit_client_id"}); !reflect.DeepEqual(third.Authorized, expected) {
+		t.Errorf("unexpected authorized parties in SSO token: %v", third.Authorized)
+	}
+
+	code, info := getSession(first.SessionID)
+	if code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", code)
+	}
+	if info.ID != first.SessionID || info.Subject != "macrat" {
+		t.Errorf("unexpected session: %#v", info)
+	}
+	if ids := clientIDs(info); !reflect.DeepEqual(ids, []string{"some_client_id", "implicit_client_id"}) {
+		t.Errorf("unexpected clients: %v", ids)
+	}
+
+	cookie = nil
+	another := login("implicit_client_id", "http://implicit-client.example.com/callback", "j.smith", "hello")
+	if another.SessionID == first.SessionID {
+		t.Errorf("login without SSO token should start a new session")
+	}
+	if code, info := getSession(another.SessionID); code != http.StatusOK {
+		t.Errorf("unexpected status code: %d", code)
+	} else if ids := clientIDs(info); !reflect.DeepEqual(ids, []string{"implicit_client_id"}) {
+		t.Errorf("unexpected clients of new session: %v", ids)
+	}
+
+	idToken, err := env.API.TokenManager.CreateIDToken(
+		env.API.Config.Issuer,
+		"j.smith",
+		"implicit_client_id",
+		"",
+		"",
+		"",
+		nil,
+		token.Authentication{Time: time.Now()},
+		10*time.Minute,
+	)
+	if err != nil {
+		t.Fatalf("failed to create test id_token: %s", err)
+	}
+
+	req, _ := http.NewRequest("GET", "/logout?"+url.Values{"id_token_hint": {idToken}}.Encode(), nil)
+	req.AddCookie(cookie)
+	if resp := env.DoRequest(req); resp.Code != http.StatusOK {
+		t.Fatalf("failed to logout: status code %d", resp.Code)
+	}
+
+	if code, _ := getSession(another.SessionID); code != http.StatusNotFound {
+		t.Errorf("session should be forgotten after logout but got status code %d", code)
+	}
+	if code, _ := getSession("no-such-session"); code != http.StatusNotFound {
+		t.Errorf("unexpected status code for unknown session: %d", code)
+	}
+
+	req, _ = http.NewRequest("GET", "/admin/sessions/"+first.SessionID, nil)
+	if resp := env.DoRequest(req); resp.Code != http.StatusUnauthorized {
+		t.Errorf("expected status code %d without credentials but got %d", http.StatusUnauthorized, resp.Code)
+	}
+}
@@ -1,9 +1,12 @@
 package api_test
 
 import (
+	"net/http"
 	"testing"
+	"time"
 
 	"github.com/macrat/lauth/testutil"
+	"github.com/macrat/lauth/token"
 )
 
 func TestGetUserInfo(t *testing.T) {
@@ -11,3 +14,38 @@ func TestGetUserInfo(t *testing.T) {
 
 	env.JSONTest(t, "GET", "/userinfo", UserInfoCommonTests(t, env))
 }
+
+func TestGetUserInfo_InsufficientScope(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.UserinfoScopes = []string{"openid"}
+
+	withoutOpenID, err := env.API.TokenManager.CreateAccessToken(
+		env.API.Config.Issuer,
+		"macrat",
+		"some_client_id",
+		"profile",
+		"",
+		token.Authentication{Time: time.Now()},
+		10*time.Minute,
+	)
+	if err != nil {
+		t.Fatalf("failed to generate access_token: %s", err)
+	}
+
+	resp := env.Get("/userinfo", "Bearer "+withoutOpenID, nil)
+	if resp.Code != http.StatusForbidden {
+		t.Fatalf("unexpected status code: %d", resp.Code)
+	}
+	if h := resp.Header().Get("WWW-Authenticate"); h != `Bearer error="insufficient_scope",error_description="openid scope is required to read userinfo",scope="openid"` {
+		t.Errorf("unexpected WWW-Authenticate header: %#v", h)
+	}
+	if body := resp.Body.String(); body != `{"error":"insufficient_scope","error_description":"openid scope is required to read userinfo"}` {
+		t.Errorf("unexpected body: %s", body)
+	}
+
+	env.API.Config.UserinfoScopes = nil
+
+	if resp := env.Get("/userinfo", "Bearer "+withoutOpenID, nil); resp.Code != http.StatusOK {
+		t.Errorf("token without openid should be accepted if no scope is required: %d", resp.Code)
+	}
+}
@@ -0,0 +1,49 @@
+package api
+
+import (
+	"sync/atomic"
+	"time"
+
+	"github.com/macrat/lauth/config"
+)
+
+// LiveConfig holds the config that can be replaced at runtime, such as by reloading the config file.
+//
+// Each request takes a snapshot at the beginning, so it never sees a mix of the old and the new config.
+// Nil LiveConfig means the config never changes.
+type LiveConfig struct {
+	value atomic.Value
+}
+
+type liveConfigValue struct {
+	conf     *config.Config
+	loadedAt time.Time
+}
+
+func NewLiveConfig(conf *config.Config) *LiveConfig {
+	l := &LiveConfig{}
+	l.Store(conf)
+	return l
+}
+
+// Load returns the current config.
+func (l *LiveConfig) Load() *config.Config {
+	if l == nil {
+		return nil
+	}
+	return l.value.Load().(liveConfigValue).conf
+}
+
+// LoadedAt returns the time when the current config was stored, or zero time if the receiver is nil.
+func (l *LiveConfig) LoadedAt() time.Time {
+	if l == nil {
+		return time.Time{}
+	}
+	return l.value.Load().(liveConfigValue).loadedAt
+}
+
+// Store replaces the config.
+// The config must not be modified after stored, because requests may be reading it.
+func (l *LiveConfig) Store(conf *config.Config) {
+	l.value.Store(liveConfigValue{conf: conf, loadedAt: time.Now()})
+}
@@ -0,0 +1,44 @@
+package api_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/macrat/lauth/api"
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/testutil"
+)
+
+func TestLiveConfig(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Live = api.NewLiveConfig(env.API.Config)
+
+	request := url.Values{
+		"redirect_uri":  {"http://some-client.example.com/callback"},
+		"client_id":     {"new_client_id"},
+		"response_type": {"code"},
+	}
+
+	if resp := env.Get("/authz", "", request); resp.Code != http.StatusBadRequest {
+		t.Fatalf("unregistered client should be rejected: %d", resp.Code)
+	}
+
+	next := *env.API.Config
+	next.Clients = make(config.ClientConfigSet)
+	for id, client := range env.API.Config.Clients {
+		next.Clients[id] = client
+	}
+	next.Clients["new_client_id"] = env.API.Config.Clients["some_client_id"]
+	env.API.Live.Store(&next)
+
+	if resp := env.Get("/authz", "", request); resp.Code != http.StatusOK {
+		t.Errorf("client in the new config should be accepted: %d: %s", resp.Code, resp.Body.String())
+	}
+
+	env.API.Live.Store(env.API.Config)
+
+	if resp := env.Get("/authz", "", request); resp.Code != http.StatusBadRequest {
+		t.Errorf("client should be rejected after restored the config: %d", resp.Code)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"net/url"
 
 	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/audit"
 	"github.com/macrat/lauth/errors"
 	"github.com/macrat/lauth/metrics"
 )
@@ -29,6 +30,7 @@ func (req *LogoutRequest) Bind(c *gin.Context) *errors.Error {
 
 func (api *LauthAPI) Logout(c *gin.Context) {
 	report := metrics.StartLogout(c)
+	report.Audit(api.Audit, audit.Logout)
 	defer report.Close()
 
 	var req LogoutRequest
@@ -82,10 +84,15 @@ func (api *LauthAPI) Logout(c *gin.Context) {
 		errors.SendHTML(c, e)
 		return
 	}
-	report.Set("client_id", idToken.Audience)
+	// ID tokens of lauth always have single audience that is the client_id.
+	clientID := ""
+	if len(idToken.Audience) == 1 {
+		clientID = idToken.Audience[0]
+	}
+	report.Set("client_id", clientID)
 	report.Set("username", idToken.Subject)
 
-	if client, ok := api.Config.Clients[idToken.Audience]; !ok {
+	if client, ok := api.Config.Clients[clientID]; !ok {
 		e := &errors.Error{
 			Reason:      errors.InvalidRequest,
 			Description: "client is not registered",
@@ -93,7 +100,7 @@ func (api *LauthAPI) Logout(c *gin.Context) {
 		report.SetError(e)
 		errors.SendHTML(c, e)
 		return
-	} else if req.RedirectURI != "" && !client.RedirectURI.Match(req.RedirectURI) {
+	} else if req.RedirectURI != "" && !client.AllowPostLogoutRedirectURI(req.RedirectURI, api.Config.StrictRedirectURI) {
 		e := &errors.Error{
 			Reason:      errors.InvalidRequest,
 			Description: "post_logout_redirect_uri is not registered",
@@ -124,7 +131,7 @@ func (api *LauthAPI) Logout(c *gin.Context) {
 		errors.SendHTML(c, e)
 		return
 	}
-	if !ssoToken.Authorized.Includes(idToken.Audience) || idToken.Subject != ssoToken.Subject {
+	if !ssoToken.Authorized.Includes(clientID) || idToken.Subject != ssoToken.Subject {
 		e := &errors.Error{
 			Reason:      errors.InvalidRequest,
 			Description: "user not logged in",
@@ -135,11 +142,12 @@ func (api *LauthAPI) Logout(c *gin.Context) {
 	}
 
 	api.DeleteSSOToken(c)
+	report.Success()
 
 	if req.RedirectURI == "" {
 		c.HTML(http.StatusOK, "logout.tmpl", nil)
 	} else {
-		if req.State != "" {
+		if req.State != "" || hasParam(c, "state") {
 			query := redirectURI.Query()
 			query.Set("state", req.State)
 			redirectURI.RawQuery = query.Encode()
@@ -20,6 +20,7 @@ func TestLogout(t *testing.T) {
 	ssoToken, err := env.API.TokenManager.CreateSSOToken(
 		env.API.Config.Issuer,
 		"macrat",
+		"",
 		token.AuthorizedParties{"some_client_id"},
 		time.Now(),
 		time.Now().Add(10*time.Minute),
@@ -36,7 +37,7 @@ func TestLogout(t *testing.T) {
 		"",
 		"",
 		nil,
-		time.Now(),
+		token.Authentication{Time: time.Now()},
 		10*time.Minute,
 	)
 	if err != nil {
@@ -51,7 +52,7 @@ func TestLogout(t *testing.T) {
 		"",
 		"",
 		nil,
-		time.Now(),
+		token.Authentication{Time: time.Now()},
 		10*time.Minute,
 	)
 	if err != nil {
@@ -66,7 +67,7 @@ func TestLogout(t *testing.T) {
 		"",
 		"",
 		nil,
-		time.Now(),
+		token.Authentication{Time: time.Now()},
 		10*time.Minute,
 	)
 	if err != nil {
@@ -81,7 +82,7 @@ func TestLogout(t *testing.T) {
 		"",
 		"",
 		nil,
-		time.Now(),
+		token.Authentication{Time: time.Now()},
 		10*time.Minute,
 	)
 	if err != nil {
@@ -96,7 +97,7 @@ func TestLogout(t *testing.T) {
 		"",
 		"",
 		nil,
-		time.Now(),
+		token.Authentication{Time: time.Now()},
 		10*time.Minute,
 	)
 	if err != nil {
@@ -303,3 +304,72 @@ func TestLogout(t *testing.T) {
 		}
 	}
 }
+
+func TestLogout_PostLogoutRedirectURIs(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	var pattern config.Pattern
+	if err := pattern.UnmarshalText([]byte("http://some-client.example.com/bye")); err != nil {
+		t.Fatalf("failed to compile pattern: %s", err)
+	}
+	client := env.API.Config.Clients["some_client_id"]
+	client.PostLogoutRedirectURI = config.PatternSet{pattern}
+	env.API.Config.Clients["some_client_id"] = client
+
+	ssoToken, err := env.API.TokenManager.CreateSSOToken(
+		env.API.Config.Issuer,
+		"macrat",
+		"",
+		token.AuthorizedParties{"some_client_id"},
+		time.Now(),
+		time.Now().Add(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("failed to create test sso token: %s", err)
+	}
+
+	idToken, err := env.API.TokenManager.CreateIDToken(
+		env.API.Config.Issuer,
+		"macrat",
+		"some_client_id",
+		"",
+		"",
+		"",
+		nil,
+		token.Authentication{Time: time.Now()},
+		10*time.Minute,
+	)
+	if err != nil {
+		t.Fatalf("failed to create test id_token: %s", err)
+	}
+
+	tests := []struct {
+		RedirectURI string
+		Code        int
+	}{
+		{"http://some-client.example.com/bye", http.StatusFound},
+		{"http://some-client.example.com/logout", http.StatusBadRequest},
+		{"http://some-client.example.com/callback", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		query := url.Values{
+			"id_token_hint":            {idToken},
+			"post_logout_redirect_uri": {tt.RedirectURI},
+			"state":                    {"this is a state"},
+		}
+		req, err := http.NewRequest("GET", "/logout?"+query.Encode(), nil)
+		if err != nil {
+			t.Fatalf("failed to prepare test request: %s", err)
+		}
+		req.Header.Set("Cookie", fmt.Sprintf("%s=%s", api.SSO_TOKEN_COOKIE, ssoToken))
+
+		resp := env.DoRequest(req)
+		if resp.Code != tt.Code {
+			t.Errorf("%s: expected status code is %d but got %d", tt.RedirectURI, tt.Code, resp.Code)
+		}
+		if tt.Code == http.StatusFound && resp.Header().Get("Location") != tt.RedirectURI+"?state=this+is+a+state" {
+			t.Errorf("%s: unexpected location: %s", tt.RedirectURI, resp.Header().Get("Location"))
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package api
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/errors"
+	"github.com/macrat/lauth/metrics"
+)
+
+// Maintenance is a switch of the maintenance mode that can toggle at runtime.
+//
+// The authorization, token, and userinfo endpoints respond 503 while the maintenance mode is enabled.
+// Nil Maintenance means always disabled.
+type Maintenance struct {
+	enabled int32
+}
+
+func (m *Maintenance) Enabled() bool {
+	return m != nil && atomic.LoadInt32(&m.enabled) != 0
+}
+
+func (m *Maintenance) Set(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&m.enabled, v)
+}
+
+// Toggle switches the maintenance mode and returns the new state.
+func (m *Maintenance) Toggle() bool {
+	for {
+		old := atomic.LoadInt32(&m.enabled)
+		if atomic.CompareAndSwapInt32(&m.enabled, old, 1-old) {
+			return old == 0
+		}
+	}
+}
+
+func (api *LauthAPI) maintenanceError() *errors.Error {
+	return &errors.Error{
+		Reason:      errors.TemporarilyUnavailable,
+		Description: api.Config.MaintenanceMessage,
+	}
+}
+
+// unlessMaintenance wraps handler to respond 503 while the maintenance mode is enabled.
+// The error page will be HTML if html is true, otherwise JSON.
+func unlessMaintenance(html bool, handler func(*LauthAPI, *gin.Context)) func(*LauthAPI, *gin.Context) {
+	return func(api *LauthAPI, c *gin.Context) {
+		if !api.Maintenance.Enabled() {
+			handler(api, c)
+			return
+		}
+
+		report := metrics.StartLogging(c)
+		defer report.Close()
+
+		e := api.maintenanceError()
+		report.SetError(e)
+		if html {
+			errors.SendHTML(c, e)
+		} else {
+			errors.SendJSON(c, e)
+		}
+	}
+}
+
+// GetHealth responds the maintenance state.
+// If failover servers are configured, X-LDAP-Upstream header tells the LDAP server connected last time, or "none" if all of them were unreachable.
+func (api *LauthAPI) GetHealth(c *gin.Context) {
+	if api.Failover != nil {
+		upstream := api.Failover.Current()
+		if upstream == "" {
+			upstream = "none"
+		}
+		c.Header("X-LDAP-Upstream", upstream)
+	}
+
+	if api.Maintenance.Enabled() {
+		c.String(http.StatusOK, "MAINTENANCE")
+	} else {
+		c.String(http.StatusOK, "OK")
+	}
+}
@@ -0,0 +1,97 @@
+package api_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/macrat/lauth/ldap"
+	"github.com/macrat/lauth/testutil"
+)
+
+func TestMaintenance(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.App.GET("/healthz", env.API.GetHealth)
+
+	tests := []struct {
+		Method string
+		Path   string
+		Values url.Values
+		Code   int
+	}{
+		{"GET", "/healthz", nil, http.StatusOK},
+		{"GET", "/.well-known/openid-configuration", nil, http.StatusOK},
+		{"GET", "/certs", nil, http.StatusOK},
+		{"GET", "/authz", url.Values{
+			"response_type": {"code"},
+			"client_id":     {"some_client_id"},
+			"redirect_uri":  {"http://some-client.example.com/callback"},
+		}, http.StatusOK},
+		{"POST", "/authz", url.Values{}, http.StatusBadRequest},
+		{"POST", "/token", url.Values{}, http.StatusBadRequest},
+		{"GET", "/userinfo", nil, http.StatusUnauthorized},
+		{"POST", "/userinfo", nil, http.StatusUnauthorized},
+	}
+
+	check := func(t *testing.T, maintenance bool, health string) {
+		t.Helper()
+
+		for _, tt := range tests {
+			code := tt.Code
+			if maintenance && (tt.Path == "/authz" || tt.Path == "/token" || tt.Path == "/userinfo") {
+				code = http.StatusServiceUnavailable
+			}
+
+			resp := env.Do(tt.Method, tt.Path, "", tt.Values)
+			if resp.Code != code {
+				t.Errorf("%s %s: expected status code %d but got %d", tt.Method, tt.Path, code, resp.Code)
+			}
+			if tt.Path == "/healthz" && resp.Body.String() != health {
+				t.Errorf("unexpected health status: %#v", resp.Body.String())
+			}
+		}
+	}
+
+	check(t, false, "OK")
+
+	if !env.API.Maintenance.Toggle() {
+		t.Fatalf("maintenance mode should be enabled by toggle")
+	}
+	check(t, true, "MAINTENANCE")
+
+	resp := env.Post("/token", "", url.Values{})
+	if body := resp.Body.String(); body != `{"error":"temporarily_unavailable","error_description":"lauth is under maintenance"}` {
+		t.Errorf("unexpected response body: %s", body)
+	}
+
+	if env.API.Maintenance.Toggle() {
+		t.Fatalf("maintenance mode should be disabled by toggle")
+	}
+	check(t, false, "OK")
+}
+
+func TestGetHealth_LDAPUpstream(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.App.GET("/healthz", env.API.GetHealth)
+
+	if resp := env.Get("/healthz", "", nil); resp.Header().Get("X-LDAP-Upstream") != "" {
+		t.Errorf("unexpected upstream header without failover: %#v", resp.Header().Get("X-LDAP-Upstream"))
+	}
+
+	env.API.Failover = ldap.NewFailoverConnector(ldap.Upstream{Name: "ldap://dummy", Connector: env.API.Connector})
+	env.API.Connector = env.API.Failover
+
+	if resp := env.Get("/healthz", "", nil); resp.Header().Get("X-LDAP-Upstream") != "none" {
+		t.Errorf("unexpected upstream header before connect: %#v", resp.Header().Get("X-LDAP-Upstream"))
+	}
+
+	sess, err := env.API.Connector.Connect()
+	if err != nil {
+		t.Fatalf("failed to connect: %s", err)
+	}
+	sess.Close()
+
+	if resp := env.Get("/healthz", "", nil); resp.Header().Get("X-LDAP-Upstream") != "ldap://dummy" {
+		t.Errorf("unexpected upstream header after connect: %#v", resp.Header().Get("X-LDAP-Upstream"))
+	}
+}
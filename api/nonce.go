@@ -0,0 +1,45 @@
+package api
+
+import (
+	"sync"
+	"time"
+)
+
+// NonceStore remembers nonces that already used for a while, for detecting replay of the authorization request.
+// It also remembers jti of client_assertion, for detecting replay of the client authentication.
+//
+// This is an in-memory store, so it doesn't share nonces between multiple instances of lauth.
+type NonceStore struct {
+	mu    sync.Mutex
+	used  map[string]time.Time
+	sweep sweepSchedule
+}
+
+func NewNonceStore() *NonceStore {
+	return &NonceStore{
+		used: make(map[string]time.Time),
+	}
+}
+
+// Use records the nonce for the client and reports whether it is the first use in the window.
+func (s *NonceStore) Use(clientID, nonce string, window time.Duration) bool {
+	now := time.Now()
+	key := clientID + " " + nonce
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sweep.due(now) {
+		for k, expire := range s.used {
+			if !now.Before(expire) {
+				delete(s.used, k)
+			}
+		}
+	}
+
+	if expire, ok := s.used[key]; ok && now.Before(expire) {
+		return false
+	}
+	s.used[key] = now.Add(window)
+	return true
+}
@@ -0,0 +1,28 @@
+package api_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/api"
+)
+
+func TestNonceStore(t *testing.T) {
+	store := api.NewNonceStore()
+
+	if !store.Use("client", "nonce", 100*time.Millisecond) {
+		t.Fatalf("failed to use a new nonce")
+	}
+	if store.Use("client", "nonce", 100*time.Millisecond) {
+		t.Fatalf("succeed to reuse a nonce in the window")
+	}
+	if !store.Use("another", "nonce", 100*time.Millisecond) {
+		t.Fatalf("failed to use the same nonce for another client")
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	if !store.Use("client", "nonce", 100*time.Millisecond) {
+		t.Fatalf("failed to reuse a nonce after the window")
+	}
+}
@@ -25,6 +25,8 @@ func (api *LauthAPI) OptionsUserInfo(c *gin.Context) {
 			if settings.CORSOrigin.Match(req.Origin) {
 				report.Set("client_id", clientID)
 				c.Header("Access-Control-Allow-Origin", req.Origin)
+				c.Header("Access-Control-Allow-Methods", "GET, POST")
+				c.Header("Access-Control-Allow-Headers", "Authorization, Content-Type")
 				return
 			}
 		}
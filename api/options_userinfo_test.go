@@ -11,10 +11,11 @@ func TestOptionsUserInfo(t *testing.T) {
 	env := testutil.NewAPITestEnvironment(t)
 
 	tests := []struct {
-		Name   string
-		Origin string
-		Code   int
-		CORS   string
+		Name    string
+		Origin  string
+		Code    int
+		CORS    string
+		Methods string
 	}{
 		{
 			Name:   "without origin",
@@ -23,16 +24,18 @@ func TestOptionsUserInfo(t *testing.T) {
 			CORS:   "",
 		},
 		{
-			Name:   "with valid origin that root domain",
-			Origin: "http://implicit-client.example.com",
-			Code:   http.StatusOK,
-			CORS:   "http://implicit-client.example.com",
+			Name:    "with valid origin that root domain",
+			Origin:  "http://implicit-client.example.com",
+			Code:    http.StatusOK,
+			CORS:    "http://implicit-client.example.com",
+			Methods: "GET, POST",
 		},
 		{
-			Name:   "with valid origin that subdomain",
-			Origin: "http://subdomain.implicit-client.example.com",
-			Code:   http.StatusOK,
-			CORS:   "http://subdomain.implicit-client.example.com",
+			Name:    "with valid origin that subdomain",
+			Origin:  "http://subdomain.implicit-client.example.com",
+			Code:    http.StatusOK,
+			CORS:    "http://subdomain.implicit-client.example.com",
+			Methods: "GET, POST",
 		},
 		{
 			Name:   "with invalid origin",
@@ -58,6 +61,10 @@ func TestOptionsUserInfo(t *testing.T) {
 			if cors := resp.Header().Get("Access-Control-Allow-Origin"); cors != tt.CORS {
 				t.Errorf("Access-Control-Allow-Origin: expected %#v but got %#v", tt.CORS, cors)
 			}
+
+			if methods := resp.Header().Get("Access-Control-Allow-Methods"); methods != tt.Methods {
+				t.Errorf("Access-Control-Allow-Methods: expected %#v but got %#v", tt.Methods, methods)
+			}
 		})
 	}
 }
@@ -2,22 +2,31 @@ package api
 
 import (
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/audit"
+	"github.com/macrat/lauth/config"
 	"github.com/macrat/lauth/errors"
 	"github.com/rs/zerolog/log"
 )
 
 func (api *LauthAPI) PostAuthz(c *gin.Context) {
+	if isInitialRequest(c) {
+		api.GetAuthz(c)
+		return
+	}
+
 	ctx, e := NewAuthzContext(api, c)
 	if e != nil {
-		errors.SendRedirect(c, e)
+		errors.SendRedirect(c, api.authzError(e))
 		return
 	}
 	defer ctx.Close()
 
 	ctx.Report.Set("username", ctx.Request.User)
+	ctx.Report.Audit(api.Audit, audit.Login)
 
 	showLoginForm := func(err error, description string) {
 		ctx.Report.SetError(ctx.Request.makeRedirectError(err, errors.InvalidRequest, description))
@@ -40,6 +49,17 @@ func (api *LauthAPI) PostAuthz(c *gin.Context) {
 		return
 	}
 
+	username := ctx.Request.User
+	if api.Config.LDAP.LowercaseUsername {
+		username = strings.ToLower(username)
+	}
+
+	if !ctx.Request.ClaimsRequest.AllowSubject(username) {
+		ctx.Report.UserError()
+		showLoginForm(nil, "please log in as the user that requested by the client")
+		return
+	}
+
 	conn, err := api.Connector.Connect()
 	if err != nil {
 		log.Error().
@@ -52,7 +72,7 @@ func (api *LauthAPI) PostAuthz(c *gin.Context) {
 	}
 	defer conn.Close()
 
-	if err := conn.LoginTest(ctx.Request.User, ctx.Request.Password); err != nil {
+	if err := conn.LoginTest(username, ctx.Request.Password); err != nil {
 		ctx.Report.UserError()
 		RandomDelay()
 		showLoginForm(err, "invalid username or password")
@@ -60,8 +80,8 @@ func (api *LauthAPI) PostAuthz(c *gin.Context) {
 	}
 
 	if api.Config.Expire.SSO > 0 {
-		api.SetSSOToken(c, ctx.Request.User, ctx.Request.ClientID, true)
+		api.SetSSOToken(c, username, ctx.Request.ClientID, true)
 	}
 
-	ctx.SendTokens(ctx.Request.User, time.Now())
+	ctx.SendTokens(username, api.authentication(ctx.Request.ClientID, time.Now(), config.ACR_PASSWORD))
 }
@@ -1,9 +1,12 @@
 package api_test
 
 import (
+	"fmt"
 	"net/http"
+	"net/http/httptest"
 	"net/url"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -402,3 +405,792 @@ func TestPostAuthz(t *testing.T) {
 		},
 	})
 }
+
+func TestPostAuthz_ScopeAttribute(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	login := func(t *testing.T, username, password string) url.Values {
+		request, err := env.API.TokenManager.CreateRequestObject(
+			env.API.Config.Issuer,
+			"::1",
+			token.RequestObjectClaims{
+				ClientID:     "implicit_client_id",
+				RedirectURI:  "http://implicit-client.example.com/callback",
+				ResponseType: "token",
+				Scope:        "openid profile admin audit",
+			},
+			time.Now().Add(10*time.Minute),
+		)
+		if err != nil {
+			t.Fatalf("faield to make request: %s", err)
+		}
+
+		resp := env.Post("/authz", "", url.Values{
+			"request":  {request},
+			"username": {username},
+			"password": {password},
+		})
+		if resp.Code != http.StatusFound {
+			t.Fatalf("unexpected status code: %d", resp.Code)
+		}
+
+		location, err := url.Parse(resp.Header().Get("Location"))
+		if err != nil {
+			t.Fatalf("failed to parse location: %s", err)
+		}
+		fragment, err := url.ParseQuery(location.Fragment)
+		if err != nil {
+			t.Fatalf("failed to parse fragment: %s", err)
+		}
+		return fragment
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		env.API.Config.LDAP.ScopeAttribute = ""
+
+		fragment := login(t, "macrat", "foobar")
+		if scope := fragment.Get("scope"); scope != "admin audit openid profile" {
+			t.Errorf("unexpected scope: %#v", scope)
+		}
+	})
+
+	t.Run("user has entitlements", func(t *testing.T) {
+		env.API.Config.LDAP.ScopeAttribute = "entitlements"
+
+		fragment := login(t, "macrat", "foobar")
+		if scope := fragment.Get("scope"); scope != "admin openid profile" {
+			t.Errorf("unexpected scope: %#v", scope)
+		}
+
+		accessToken, err := env.API.TokenManager.ParseAccessToken(fragment.Get("access_token"))
+		if err != nil {
+			t.Fatalf("failed to parse access_token: %s", err)
+		}
+		if accessToken.Scope != "admin openid profile" {
+			t.Errorf("unexpected scope in access_token: %#v", accessToken.Scope)
+		}
+	})
+
+	t.Run("user has no entitlements", func(t *testing.T) {
+		env.API.Config.LDAP.ScopeAttribute = "entitlements"
+
+		fragment := login(t, "j.smith", "hello")
+		if scope := fragment.Get("scope"); scope != "openid profile" {
+			t.Errorf("unexpected scope: %#v", scope)
+		}
+	})
+}
+
+func TestPostAuthz_RejectReusedNonce(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	login := func(t *testing.T, clientID, redirectURI, nonce string) url.Values {
+		request, err := env.API.TokenManager.CreateRequestObject(
+			env.API.Config.Issuer,
+			"::1",
+			token.RequestObjectClaims{
+				ClientID:     clientID,
+				RedirectURI:  redirectURI,
+				ResponseType: "code",
+				Scope:        "openid",
+				Nonce:        nonce,
+			},
+			time.Now().Add(10*time.Minute),
+		)
+		if err != nil {
+			t.Fatalf("faield to make request: %s", err)
+		}
+
+		resp := env.Post("/authz", "", url.Values{
+			"request":  {request},
+			"username": {"macrat"},
+			"password": {"foobar"},
+		})
+		if resp.Code != http.StatusFound {
+			t.Fatalf("unexpected status code: %d", resp.Code)
+		}
+
+		location, err := url.Parse(resp.Header().Get("Location"))
+		if err != nil {
+			t.Fatalf("failed to parse location: %s", err)
+		}
+		return location.Query()
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		env.API.Config.RejectReusedNonce = false
+
+		for i := 0; i < 2; i++ {
+			if query := login(t, "some_client_id", "http://some-client.example.com/callback", "disabled-nonce"); query.Get("code") == "" {
+				t.Errorf("%d: failed to get code: %s", i, query)
+			}
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		env.API.Config.RejectReusedNonce = true
+
+		if query := login(t, "some_client_id", "http://some-client.example.com/callback", "enabled-nonce"); query.Get("code") == "" {
+			t.Errorf("failed to get code at first time: %s", query)
+		}
+
+		query := login(t, "some_client_id", "http://some-client.example.com/callback", "enabled-nonce")
+		if query.Get("code") != "" {
+			t.Errorf("code issued for reused nonce")
+		}
+		if query.Get("error") != "invalid_request" || query.Get("error_description") != "nonce is already used" {
+			t.Errorf("unexpected error: %s", query)
+		}
+
+		if query := login(t, "implicit_client_id", "http://implicit-client.example.com/callback", "enabled-nonce"); query.Get("error") == "invalid_request" {
+			t.Errorf("nonce of other client should not be rejected: %s", query)
+		}
+	})
+}
+
+func TestPostAuthz_RequestedSubject(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	tests := []struct {
+		Subject string
+		Code    int
+	}{
+		{"macrat", http.StatusFound},
+		{"someone", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		request, err := env.API.TokenManager.CreateRequestObject(
+			env.API.Config.Issuer,
+			"::1",
+			token.RequestObjectClaims{
+				ClientID:     "some_client_id",
+				RedirectURI:  "http://some-client.example.com/callback",
+				ResponseType: "code",
+				Scope:        "openid",
+				Claims: &token.ClaimsRequest{
+					IDToken: token.ClaimRequests{"sub": {Value: tt.Subject}},
+				},
+			},
+			time.Now().Add(10*time.Minute),
+		)
+		if err != nil {
+			t.Fatalf("failed to make request: %s", err)
+		}
+
+		resp := env.Post("/authz", "", url.Values{
+			"request":  {request},
+			"username": {"macrat"},
+			"password": {"foobar"},
+		})
+		if resp.Code != tt.Code {
+			t.Errorf("%s: unexpected status code: %d", tt.Subject, resp.Code)
+		}
+		if tt.Code != http.StatusFound && resp.Header().Get("Location") != "" {
+			t.Errorf("%s: login page should be shown but redirected to %s", tt.Subject, resp.Header().Get("Location"))
+		}
+	}
+}
+
+func TestPostAuthz_RedirectURIWithQuery(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	tests := []struct {
+		ClientID     string
+		RedirectURI  string
+		ResponseType string
+		Fragment     bool
+	}{
+		{"some_client_id", "http://some-client.example.com/callback?tenant=x", "code", false},
+		{"implicit_client_id", "http://implicit-client.example.com/callback?tenant=x", "token", true},
+	}
+
+	for _, tt := range tests {
+		var pattern config.Pattern
+		if err := pattern.UnmarshalText([]byte(tt.RedirectURI)); err != nil {
+			t.Fatalf("%s: failed to prepare redirect_uri: %s", tt.ResponseType, err)
+		}
+		client := env.API.Config.Clients[tt.ClientID]
+		client.RedirectURI = append(client.RedirectURI, pattern)
+		env.API.Config.Clients[tt.ClientID] = client
+
+		request, err := env.API.TokenManager.CreateRequestObject(
+			env.API.Config.Issuer,
+			"::1",
+			token.RequestObjectClaims{
+				ClientID:     tt.ClientID,
+				RedirectURI:  tt.RedirectURI,
+				ResponseType: tt.ResponseType,
+				Scope:        "openid",
+				State:        "this-is-state",
+			},
+			time.Now().Add(10*time.Minute),
+		)
+		if err != nil {
+			t.Fatalf("faield to make request: %s", err)
+		}
+
+		resp := env.Post("/authz", "", url.Values{
+			"request":  {request},
+			"username": {"macrat"},
+			"password": {"foobar"},
+		})
+		if resp.Code != http.StatusFound {
+			t.Fatalf("%s: unexpected status code: %d", tt.ResponseType, resp.Code)
+		}
+
+		location, err := url.Parse(resp.Header().Get("Location"))
+		if err != nil {
+			t.Fatalf("%s: failed to parse location: %s", tt.ResponseType, err)
+		}
+
+		query := location.Query()
+		if query.Get("tenant") != "x" {
+			t.Errorf("%s: original query parameter was lost: %s", tt.ResponseType, location)
+		}
+
+		params := query
+		if tt.Fragment {
+			if params, err = url.ParseQuery(location.Fragment); err != nil {
+				t.Fatalf("%s: failed to parse fragment: %s", tt.ResponseType, err)
+			}
+		}
+		if params.Get("state") != "this-is-state" {
+			t.Errorf("%s: state is missing: %s", tt.ResponseType, location)
+		}
+		if params.Get("code") == "" && params.Get("access_token") == "" {
+			t.Errorf("%s: token is missing: %s", tt.ResponseType, location)
+		}
+	}
+}
+
+func TestPostAuthz_LowercaseUsername(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	login := func(t *testing.T, username string) *httptest.ResponseRecorder {
+		request, err := env.API.TokenManager.CreateRequestObject(
+			env.API.Config.Issuer,
+			"::1",
+			token.RequestObjectClaims{
+				ClientID:     "implicit_client_id",
+				RedirectURI:  "http://implicit-client.example.com/callback",
+				ResponseType: "token",
+				Scope:        "openid",
+			},
+			time.Now().Add(10*time.Minute),
+		)
+		if err != nil {
+			t.Fatalf("faield to make request: %s", err)
+		}
+
+		return env.Post("/authz", "", url.Values{
+			"request":  {request},
+			"username": {username},
+			"password": {"foobar"},
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		env.API.Config.LDAP.LowercaseUsername = false
+
+		if resp := login(t, "MaCrat"); resp.Code != http.StatusForbidden {
+			t.Errorf("unexpected status code: %d", resp.Code)
+		}
+	})
+
+	t.Run("enabled", func(t *testing.T) {
+		env.API.Config.LDAP.LowercaseUsername = true
+
+		for _, username := range []string{"macrat", "MaCrat", "MACRAT"} {
+			resp := login(t, username)
+			if resp.Code != http.StatusFound {
+				t.Errorf("%s: unexpected status code: %d", username, resp.Code)
+				continue
+			}
+
+			location, err := url.Parse(resp.Header().Get("Location"))
+			if err != nil {
+				t.Fatalf("%s: failed to parse location: %s", username, err)
+			}
+			fragment, err := url.ParseQuery(location.Fragment)
+			if err != nil {
+				t.Fatalf("%s: failed to parse fragment: %s", username, err)
+			}
+
+			accessToken, err := env.API.TokenManager.ParseAccessToken(fragment.Get("access_token"))
+			if err != nil {
+				t.Fatalf("%s: failed to parse access_token: %s", username, err)
+			}
+			if accessToken.Subject != "macrat" {
+				t.Errorf("%s: unexpected subject: %#v", username, accessToken.Subject)
+			}
+		}
+	})
+}
+
+func TestPostAuthz_ResponseMode(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	request, err := env.API.TokenManager.CreateRequestObject(
+		env.API.Config.Issuer,
+		"::1",
+		token.RequestObjectClaims{
+			ClientID:     "some_client_id",
+			RedirectURI:  "http://some-client.example.com/callback",
+			ResponseType: "code",
+			ResponseMode: "fragment",
+			Scope:        "openid",
+			State:        "this-is-state",
+		},
+		time.Now().Add(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("faield to make request: %s", err)
+	}
+
+	resp := env.Post("/authz", "", url.Values{
+		"request":  {request},
+		"username": {"macrat"},
+		"password": {"foobar"},
+	})
+	if resp.Code != http.StatusFound {
+		t.Fatalf("unexpected status code: %d", resp.Code)
+	}
+
+	location, err := url.Parse(resp.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("failed to parse location: %s", err)
+	}
+	if location.RawQuery != "" {
+		t.Errorf("response should not be in query: %s", location)
+	}
+	fragment, err := url.ParseQuery(location.Fragment)
+	if err != nil {
+		t.Fatalf("failed to parse fragment: %s", err)
+	}
+	if fragment.Get("code") == "" || fragment.Get("state") != "this-is-state" {
+		t.Errorf("unexpected fragment: %s", location.Fragment)
+	}
+}
+
+func TestPostAuthz_FormPost(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.RejectReusedNonce = true
+
+	request, err := env.API.TokenManager.CreateRequestObject(
+		env.API.Config.Issuer,
+		"::1",
+		token.RequestObjectClaims{
+			ClientID:     "implicit_client_id",
+			RedirectURI:  "http://implicit-client.example.com/callback",
+			ResponseType: "code id_token",
+			ResponseMode: "form_post",
+			Scope:        "openid",
+			State:        "this-is-state",
+			Nonce:        "form-post-nonce",
+		},
+		time.Now().Add(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("faield to make request: %s", err)
+	}
+
+	login := func() string {
+		resp := env.Post("/authz", "", url.Values{
+			"request":  {request},
+			"username": {"macrat"},
+			"password": {"foobar"},
+		})
+		if resp.Code != http.StatusOK {
+			t.Fatalf("unexpected status code: %d", resp.Code)
+		}
+		if resp.Header().Get("Location") != "" {
+			t.Errorf("form_post response should not redirect: %s", resp.Header().Get("Location"))
+		}
+		if resp.Header().Get("Cache-Control") != "no-store" {
+			t.Errorf("unexpected Cache-Control header: %#v", resp.Header().Get("Cache-Control"))
+		}
+
+		body := resp.Body.String()
+		if !strings.Contains(body, `action="http://implicit-client.example.com/callback"`) {
+			t.Errorf("form is not posted to redirect_uri:\n%s", body)
+		}
+		return body
+	}
+
+	body := login()
+	for _, name := range []string{"code", "id_token"} {
+		if !strings.Contains(body, fmt.Sprintf(`name="%s" value="`, name)) {
+			t.Errorf("%s is not included in the form:\n%s", name, body)
+		}
+	}
+	if !strings.Contains(body, `name="state" value="this-is-state"`) {
+		t.Errorf("state is not included in the form:\n%s", body)
+	}
+
+	body = login()
+	if !strings.Contains(body, `name="error" value="invalid_request"`) {
+		t.Errorf("error is not included in the form:\n%s", body)
+	}
+	if strings.Contains(body, `name="code"`) {
+		t.Errorf("code should not be included in the error form:\n%s", body)
+	}
+}
+
+func TestPostAuthz_RequireACR(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	for _, acr := range []string{"", "1"} {
+		client := env.API.Config.Clients["implicit_client_id"]
+		client.RequireACR = acr
+		env.API.Config.Clients["implicit_client_id"] = client
+
+		request, err := env.API.TokenManager.CreateRequestObject(
+			env.API.Config.Issuer,
+			"::1",
+			token.RequestObjectClaims{
+				ClientID:     "implicit_client_id",
+				RedirectURI:  "http://implicit-client.example.com/callback",
+				ResponseType: "id_token",
+				Scope:        "openid",
+				Nonce:        "this-is-nonce",
+			},
+			time.Now().Add(10*time.Minute),
+		)
+		if err != nil {
+			t.Fatalf("require_acr=%#v: failed to make request: %s", acr, err)
+		}
+
+		resp := env.Post("/authz", "", url.Values{
+			"request":  {request},
+			"username": {"macrat"},
+			"password": {"foobar"},
+		})
+		if resp.Code != http.StatusFound {
+			t.Fatalf("require_acr=%#v: unexpected status code: %d", acr, resp.Code)
+		}
+
+		location, err := url.Parse(resp.Header().Get("Location"))
+		if err != nil {
+			t.Fatalf("require_acr=%#v: failed to parse location: %s", acr, err)
+		}
+		fragment, _ := url.ParseQuery(location.Fragment)
+
+		idToken, err := env.API.TokenManager.ParseIDToken(fragment.Get("id_token"))
+		if err != nil {
+			t.Fatalf("require_acr=%#v: failed to parse id_token: %s", acr, err)
+		}
+
+		if idToken.ACR != acr {
+			t.Errorf("require_acr=%#v: unexpected acr: %#v", acr, idToken.ACR)
+		}
+	}
+}
+
+func TestPostAuthz_ImplicitWarning(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.ImplicitWarning = "implicit flow is deprecated"
+
+	tests := []struct {
+		ResponseType string
+		Warning      bool
+	}{
+		{"code", false},
+		{"token", true},
+		{"id_token", true},
+		{"code id_token", true},
+	}
+
+	for _, tt := range tests {
+		request, err := env.API.TokenManager.CreateRequestObject(
+			env.API.Config.Issuer,
+			"::1",
+			token.RequestObjectClaims{
+				ClientID:     "implicit_client_id",
+				RedirectURI:  "http://implicit-client.example.com/callback",
+				ResponseType: tt.ResponseType,
+				Scope:        "openid",
+				Nonce:        "this-is-nonce",
+			},
+			time.Now().Add(10*time.Minute),
+		)
+		if err != nil {
+			t.Fatalf("%s: failed to make request: %s", tt.ResponseType, err)
+		}
+
+		resp := env.Post("/authz", "", url.Values{
+			"request":  {request},
+			"username": {"macrat"},
+			"password": {"foobar"},
+		})
+		if resp.Code != http.StatusFound {
+			t.Fatalf("%s: unexpected status code: %d", tt.ResponseType, resp.Code)
+		}
+
+		deprecation := resp.Header().Get("Deprecation")
+		warning := resp.Header().Get("Warning")
+		if tt.Warning {
+			if deprecation != "true" {
+				t.Errorf("%s: unexpected Deprecation header: %#v", tt.ResponseType, deprecation)
+			}
+			if warning != `299 - "implicit flow is deprecated"` {
+				t.Errorf("%s: unexpected Warning header: %#v", tt.ResponseType, warning)
+			}
+		} else if deprecation != "" || warning != "" {
+			t.Errorf("%s: unexpected deprecation headers: %#v / %#v", tt.ResponseType, deprecation, warning)
+		}
+	}
+}
+
+func TestPostAuthz_InitialRequest(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	params := url.Values{
+		"client_id":     {"some_client_id"},
+		"redirect_uri":  {"http://some-client.example.com/callback"},
+		"response_type": {"code"},
+		"scope":         {"openid profile"},
+		"state":         {"this-is-state"},
+	}
+
+	for _, method := range []string{"GET", "POST"} {
+		resp := env.Do(method, "/authz", "", params)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("%s: unexpected status code: %d", method, resp.Code)
+		}
+
+		request, err := testutil.FindRequestObjectByHTML(resp.Body)
+		if err != nil {
+			t.Fatalf("%s: failed to find request object in login page: %s", method, err)
+		}
+		claims, err := env.API.TokenManager.ParseRequestObject(request, "", "")
+		if err != nil {
+			t.Fatalf("%s: failed to parse request object: %s", method, err)
+		}
+		if claims.ClientID != "some_client_id" || claims.Scope != "openid profile" || claims.State != "this-is-state" {
+			t.Errorf("%s: unexpected request object: %#v", method, claims)
+		}
+
+		resp = env.Post("/authz", "", url.Values{
+			"request":  {request},
+			"username": {"macrat"},
+			"password": {"foobar"},
+		})
+		if resp.Code != http.StatusFound {
+			t.Fatalf("%s: unexpected status code on login: %d", method, resp.Code)
+		}
+		location, err := url.Parse(resp.Header().Get("Location"))
+		if err != nil {
+			t.Fatalf("%s: failed to parse location: %s", method, err)
+		}
+		if query := location.Query(); query.Get("code") == "" || query.Get("state") != "this-is-state" {
+			t.Errorf("%s: unexpected redirect: %s", method, location)
+		}
+	}
+
+	resp := env.Post("/authz", "", url.Values{
+		"client_id":     {"some_client_id"},
+		"redirect_uri":  {"http://some-client.example.com/callback"},
+		"response_type": {"token"},
+	})
+	if resp.Code != http.StatusFound {
+		t.Fatalf("unexpected status code for invalid request: %d", resp.Code)
+	}
+	location, _ := url.Parse(resp.Header().Get("Location"))
+	fragment, _ := url.ParseQuery(location.Fragment)
+	if e := fragment.Get("error"); e != "unsupported_response_type" {
+		t.Errorf("POST request should be validated as same as GET but got error %#v", e)
+	}
+}
+
+func TestPostAuthz_ErrorResponseMode(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.RejectReusedNonce = true
+
+	tests := []struct {
+		ResponseType string
+		ResponseMode string
+		Fragment     bool
+	}{
+		{"code", "", false},
+		{"code", "query", false},
+		{"code", "fragment", true},
+		{"id_token", "", true},
+		{"id_token", "fragment", true},
+	}
+
+	for i, tt := range tests {
+		name := fmt.Sprintf("%s/%s", tt.ResponseType, tt.ResponseMode)
+		nonce := fmt.Sprintf("reused-nonce-%d", i)
+
+		login := func() *url.URL {
+			request, err := env.API.TokenManager.CreateRequestObject(
+				env.API.Config.Issuer,
+				"::1",
+				token.RequestObjectClaims{
+					ClientID:     "implicit_client_id",
+					RedirectURI:  "http://implicit-client.example.com/callback",
+					ResponseType: tt.ResponseType,
+					ResponseMode: tt.ResponseMode,
+					Scope:        "openid",
+					State:        "this-is-state",
+					Nonce:        nonce,
+				},
+				time.Now().Add(10*time.Minute),
+			)
+			if err != nil {
+				t.Fatalf("%s: failed to make request: %s", name, err)
+			}
+
+			resp := env.Post("/authz", "", url.Values{
+				"request":  {request},
+				"username": {"macrat"},
+				"password": {"foobar"},
+			})
+			if resp.Code != http.StatusFound {
+				t.Fatalf("%s: unexpected status code: %d", name, resp.Code)
+			}
+
+			location, err := url.Parse(resp.Header().Get("Location"))
+			if err != nil {
+				t.Fatalf("%s: failed to parse location: %s", name, err)
+			}
+			return location
+		}
+
+		login()
+		location := login()
+
+		values := location.Query()
+		other := location.Fragment
+		if tt.Fragment {
+			values, _ = url.ParseQuery(location.Fragment)
+			other = location.RawQuery
+		}
+
+		if values.Get("error") != "invalid_request" || values.Get("state") != "this-is-state" {
+			t.Errorf("%s: error is not delivered in expected mode: %s", name, location)
+		}
+		if other != "" {
+			t.Errorf("%s: error is delivered in unexpected part: %s", name, location)
+		}
+	}
+}
+
+func TestPostAuthz_OptionalScope(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	scopes := make(config.ScopeConfig)
+	for name, scope := range env.API.Config.Scopes {
+		scopes[name] = scope
+	}
+	email := scopes["email"]
+	email.Optional = true
+	scopes["email"] = email
+	env.API.Config.Scopes = scopes
+
+	tests := []struct {
+		Name     string
+		Selected []string
+		Scope    string
+		HasEmail bool
+	}{
+		{"decline", nil, "openid profile", false},
+		{"accept", []string{"email"}, "email openid profile", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			request, err := env.API.TokenManager.CreateRequestObject(
+				env.API.Config.Issuer,
+				"::1",
+				token.RequestObjectClaims{
+					ClientID:     "implicit_client_id",
+					RedirectURI:  "http://implicit-client.example.com/callback",
+					ResponseType: "code id_token",
+					Scope:        "openid profile email",
+					Nonce:        "this-is-nonce",
+				},
+				time.Now().Add(10*time.Minute),
+			)
+			if err != nil {
+				t.Fatalf("failed to make request: %s", err)
+			}
+
+			resp := env.Post("/authz", "", url.Values{
+				"request":        {request},
+				"username":       {"macrat"},
+				"password":       {"foobar"},
+				"optional_scope": tt.Selected,
+			})
+			if resp.Code != http.StatusFound {
+				t.Fatalf("unexpected status code: %d", resp.Code)
+			}
+
+			location, err := url.Parse(resp.Header().Get("Location"))
+			if err != nil {
+				t.Fatalf("failed to parse location: %s", err)
+			}
+			fragment, _ := url.ParseQuery(location.Fragment)
+
+			code, err := env.API.TokenManager.ParseCode(fragment.Get("code"))
+			if err != nil {
+				t.Fatalf("failed to parse code: %s", err)
+			}
+			if code.Scope != tt.Scope {
+				t.Errorf("expected scope %#v but got %#v", tt.Scope, code.Scope)
+			}
+
+			idToken, err := env.API.TokenManager.ParseIDToken(fragment.Get("id_token"))
+			if err != nil {
+				t.Fatalf("failed to parse id_token: %s", err)
+			}
+			if _, ok := idToken.ExtraClaims["name"]; !ok {
+				t.Errorf("required scope's claim is missing: %#v", idToken.ExtraClaims)
+			}
+			if _, ok := idToken.ExtraClaims["email"]; ok != tt.HasEmail {
+				t.Errorf("unexpected existence of email claim: %#v", idToken.ExtraClaims)
+			}
+		})
+	}
+}
+
+func TestPostAuthz_EmptyState(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	resp := env.Get("/authz", "", url.Values{
+		"redirect_uri":  {"http://implicit-client.example.com/callback"},
+		"client_id":     {"implicit_client_id"},
+		"response_type": {"id_token"},
+		"scope":         {"openid"},
+		"nonce":         {"this-is-nonce"},
+		"state":         {""},
+	})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("unexpected status code of login page: %d", resp.Code)
+	}
+
+	request, err := testutil.FindRequestObjectByHTML(resp.Body)
+	if err != nil {
+		t.Fatalf("failed to get request object: %s", err)
+	}
+
+	resp = env.Post("/authz", "", url.Values{
+		"request":  {request},
+		"username": {"macrat"},
+		"password": {"foobar"},
+	})
+	if resp.Code != http.StatusFound {
+		t.Fatalf("unexpected status code: %d", resp.Code)
+	}
+
+	location, err := url.Parse(resp.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("failed to parse location: %s", err)
+	}
+	fragment, _ := url.ParseQuery(location.EscapedFragment())
+
+	if state, ok := fragment["state"]; !ok || len(state) != 1 || state[0] != "" {
+		t.Errorf("expected empty state but got %s", location)
+	}
+}
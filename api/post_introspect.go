@@ -0,0 +1,146 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/errors"
+	"github.com/macrat/lauth/metrics"
+	"github.com/macrat/lauth/token"
+)
+
+// PostIntrospectRequest is a request to the token introspection endpoint. (RFC 7662)
+// The client authenticates in the same way as the token endpoint.
+type PostIntrospectRequest struct {
+	Client        PostTokenRequest
+	Token         string
+	TokenTypeHint string
+}
+
+func (req *PostIntrospectRequest) Bind(c *gin.Context) *errors.Error {
+	switch c.ContentType() {
+	case "", binding.MIMEPOSTForm:
+	default:
+		return &errors.Error{
+			Reason:      errors.InvalidRequest,
+			Description: fmt.Sprintf("unsupported content type: %s", c.ContentType()),
+		}
+	}
+
+	if err := req.Client.Bind(c); err != nil {
+		return err
+	}
+	req.Token = c.PostForm("token")
+	req.TokenTypeHint = c.PostForm("token_type_hint")
+
+	return nil
+}
+
+func (req *PostIntrospectRequest) BindAndValidate(c *gin.Context, api *LauthAPI) *errors.Error {
+	if err := req.Bind(c); err != nil {
+		return err
+	}
+
+	if err := req.Client.authenticateClient(api); err != nil {
+		return err
+	}
+
+	if req.Client.AuthMethod == config.AUTH_METHOD_NONE {
+		return &errors.Error{
+			Reason:      errors.InvalidClient,
+			Description: "public client can't use the introspection endpoint",
+		}
+	}
+
+	if req.Token == "" {
+		return &errors.Error{
+			Reason:      errors.InvalidRequest,
+			Description: "token is required",
+		}
+	}
+
+	return nil
+}
+
+type PostIntrospectResponse struct {
+	Active    bool           `json:"active"`
+	Scope     string         `json:"scope,omitempty"`
+	ClientID  string         `json:"client_id,omitempty"`
+	Subject   string         `json:"sub,omitempty"`
+	ExpiresAt int64          `json:"exp,omitempty"`
+	IssuedAt  int64          `json:"iat,omitempty"`
+	Audience  token.Audience `json:"aud,omitempty"`
+	Issuer    string         `json:"iss,omitempty"`
+	TokenType string         `json:"token_type,omitempty"`
+	AuthTime  int64          `json:"auth_time,omitempty"`
+	ACR       string         `json:"acr,omitempty"`
+	AMR       []string       `json:"amr,omitempty"`
+
+	// ClientCredentials is true if the token is issued by the client_credentials grant.
+	// The sub of such token is the client_id, so resource servers must not take it as a user.
+	ClientCredentials bool `json:"client_credentials,omitempty"`
+}
+
+// introspect returns information of the access token.
+// Tokens that are expired, malformed, or not an access token of this issuer are just inactive.
+func (api *LauthAPI) introspect(raw string) PostIntrospectResponse {
+	token, err := api.TokenManager.ParseAccessToken(raw)
+	if err != nil {
+		return PostIntrospectResponse{Active: false}
+	}
+	if err := token.Validate(api.Config.Issuer); err != nil {
+		return PostIntrospectResponse{Active: false}
+	}
+
+	clientID := ""
+	if len(token.AuthorizedParties) > 0 {
+		clientID = token.AuthorizedParties[0]
+	}
+
+	resp := PostIntrospectResponse{
+		Active:    true,
+		Scope:     token.Scope,
+		ClientID:  clientID,
+		Subject:   token.Subject,
+		ExpiresAt: token.ExpiresAt,
+		IssuedAt:  token.IssuedAt,
+		Audience:  token.Audience,
+		Issuer:    token.Issuer,
+		TokenType: "Bearer",
+
+		ClientCredentials: token.ClientCredentials,
+	}
+	if api.Config.AuthContextClaims {
+		resp.AuthTime = token.AuthTime
+		resp.ACR = token.ACR
+		resp.AMR = token.AMR
+	}
+	return resp
+}
+
+func (api *LauthAPI) PostIntrospect(c *gin.Context) {
+	report := metrics.StartIntrospect(c)
+	defer report.Close()
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	var req PostIntrospectRequest
+	if err := (&req).BindAndValidate(c, api); err != nil {
+		report.Set("client_id", req.Client.ClientID)
+		report.SetError(err)
+		errors.SendTokenError(c, err)
+		return
+	}
+	report.Set("client_id", req.Client.ClientID)
+
+	resp := api.introspect(req.Token)
+	report.Set("active", strconv.FormatBool(resp.Active))
+	report.Success()
+
+	c.JSON(http.StatusOK, resp)
+}
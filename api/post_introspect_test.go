@@ -0,0 +1,208 @@
+package api_test
+
+import (
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/api"
+	"github.com/macrat/lauth/testutil"
+	"github.com/macrat/lauth/token"
+)
+
+func TestPostIntrospect(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	accessToken, err := env.API.TokenManager.CreateAccessToken(
+		env.API.Config.Issuer,
+		"macrat",
+		"some_client_id",
+		"openid profile",
+		"",
+		token.Authentication{Time: time.Now()},
+		10*time.Minute,
+	)
+	if err != nil {
+		t.Fatalf("failed to create access token: %s", err)
+	}
+
+	expiredToken, err := env.API.TokenManager.CreateAccessToken(
+		env.API.Config.Issuer,
+		"macrat",
+		"some_client_id",
+		"openid profile",
+		"",
+		token.Authentication{Time: time.Now().Add(-20 * time.Minute)},
+		-10*time.Minute,
+	)
+	if err != nil {
+		t.Fatalf("failed to create access token: %s", err)
+	}
+
+	refreshToken, err := env.API.TokenManager.CreateRefreshToken(
+		env.API.Config.Issuer,
+		"macrat",
+		"some_client_id",
+		"openid profile",
+		"",
+		token.Authentication{Time: time.Now()},
+		10*time.Minute,
+	)
+	if err != nil {
+		t.Fatalf("failed to create refresh token: %s", err)
+	}
+
+	inactive := map[string]interface{}{"active": false}
+
+	env.JSONTest(t, "POST", "/introspect", []testutil.JSONTest{
+		{
+			Name: "active token",
+			Request: url.Values{
+				"client_id":     {"some_client_id"},
+				"client_secret": {"secret for some-client"},
+				"token":         {accessToken},
+			},
+			Code: http.StatusOK,
+			CheckBody: func(t *testing.T, body testutil.RawBody) {
+				var resp api.PostIntrospectResponse
+				if err := body.Bind(&resp); err != nil {
+					t.Fatalf("failed to unmarshal response body: %s", err)
+				}
+
+				if !resp.Active {
+					t.Errorf("token should be active")
+				}
+				if resp.Scope != "openid profile" {
+					t.Errorf("unexpected scope: %#v", resp.Scope)
+				}
+				if resp.ClientID != "some_client_id" {
+					t.Errorf("unexpected client_id: %#v", resp.ClientID)
+				}
+				if resp.ClientCredentials {
+					t.Errorf("token of user should not be marked as client_credentials")
+				}
+				if resp.Subject != "macrat" {
+					t.Errorf("unexpected sub: %#v", resp.Subject)
+				}
+				if resp.Issuer != env.API.Config.Issuer.String() {
+					t.Errorf("unexpected iss: %#v", resp.Issuer)
+				}
+				if resp.TokenType != "Bearer" {
+					t.Errorf("unexpected token_type: %#v", resp.TokenType)
+				}
+				if resp.ExpiresAt <= time.Now().Unix() {
+					t.Errorf("unexpected exp: %d", resp.ExpiresAt)
+				}
+			},
+		},
+		{
+			Name: "with token_type_hint",
+			Request: url.Values{
+				"client_id":       {"some_client_id"},
+				"client_secret":   {"secret for some-client"},
+				"token":           {accessToken},
+				"token_type_hint": {"refresh_token"},
+			},
+			Code: http.StatusOK,
+			CheckBody: func(t *testing.T, body testutil.RawBody) {
+				var resp api.PostIntrospectResponse
+				if err := body.Bind(&resp); err != nil {
+					t.Fatalf("failed to unmarshal response body: %s", err)
+				}
+				if !resp.Active {
+					t.Errorf("token should be active even if the hint is wrong")
+				}
+			},
+		},
+		{
+			Name: "expired token",
+			Request: url.Values{
+				"client_id":     {"some_client_id"},
+				"client_secret": {"secret for some-client"},
+				"token":         {expiredToken},
+			},
+			Code: http.StatusOK,
+			Body: inactive,
+		},
+		{
+			Name: "refresh token",
+			Request: url.Values{
+				"client_id":     {"some_client_id"},
+				"client_secret": {"secret for some-client"},
+				"token":         {refreshToken},
+			},
+			Code: http.StatusOK,
+			Body: inactive,
+		},
+		{
+			Name: "malformed token",
+			Request: url.Values{
+				"client_id":     {"some_client_id"},
+				"client_secret": {"secret for some-client"},
+				"token":         {"this-is-not-a-token"},
+			},
+			Code: http.StatusOK,
+			Body: inactive,
+		},
+		{
+			Name: "missing token",
+			Request: url.Values{
+				"client_id":     {"some_client_id"},
+				"client_secret": {"secret for some-client"},
+			},
+			Code: http.StatusBadRequest,
+			Body: map[string]interface{}{
+				"error":             "invalid_request",
+				"error_description": "token is required",
+			},
+		},
+		{
+			Name: "without client authentication",
+			Request: url.Values{
+				"token": {accessToken},
+			},
+			Code: http.StatusBadRequest,
+			CheckBody: func(t *testing.T, body testutil.RawBody) {
+				var resp map[string]interface{}
+				if err := body.Bind(&resp); err != nil {
+					t.Fatalf("failed to unmarshal response body: %s", err)
+				}
+				if _, ok := resp["active"]; ok {
+					t.Errorf("token information should not be returned: %s", string(body))
+				}
+			},
+		},
+		{
+			Name: "invalid client secret",
+			Request: url.Values{
+				"client_id":     {"some_client_id"},
+				"client_secret": {"invalid secret"},
+				"token":         {accessToken},
+			},
+			Code: http.StatusBadRequest,
+			Body: map[string]interface{}{
+				"error": "invalid_client",
+			},
+		},
+	})
+}
+
+func TestPostIntrospect_Discovery(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	resp := env.Get("/.well-known/openid-configuration", "", nil)
+	if resp.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", resp.Code)
+	}
+
+	var body map[string]interface{}
+	if err := testutil.RawBody(resp.Body.Bytes()).Bind(&body); err != nil {
+		t.Fatalf("failed to unmarshal response body: %s", err)
+	}
+
+	expected := env.API.Config.Issuer.String() + "/introspect"
+	if body["introspection_endpoint"] != expected {
+		t.Errorf("unexpected introspection_endpoint: expected %#v but got %#v", expected, body["introspection_endpoint"])
+	}
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/audit"
+	"github.com/macrat/lauth/errors"
+	"github.com/macrat/lauth/metrics"
+)
+
+// PostRevokeRequest is a request to the token revocation endpoint. (RFC 7009)
+// It has the same parameters as the introspection request.
+type PostRevokeRequest struct {
+	PostIntrospectRequest
+}
+
+// revokeAccessToken revokes the token if it is a valid access token.
+// It returns false if the token is not an access token.
+func (api *LauthAPI) revokeAccessToken(raw, clientID string, report *metrics.Context) (bool, *errors.Error) {
+	token, err := api.TokenManager.ParseAccessToken(raw)
+	if err != nil || token.Validate(api.Config.Issuer) != nil {
+		return false, nil
+	}
+	report.Set("username", token.Subject)
+
+	if !StringSet(token.AuthorizedParties).Has(clientID) {
+		return true, &errors.Error{
+			Reason:      errors.UnauthorizedClient,
+			Description: "the token was issued to another client",
+		}
+	}
+
+	api.TokenManager.Revoke(token.Id, time.Unix(token.ExpiresAt, 0))
+	return true, nil
+}
+
+// revokeRefreshToken revokes the token if it is a valid refresh token.
+// It returns false if the token is not a refresh token.
+func (api *LauthAPI) revokeRefreshToken(raw, clientID string, report *metrics.Context) (bool, *errors.Error) {
+	token, err := api.TokenManager.ParseRefreshToken(raw)
+	if err != nil || token.Validate(api.Config.Issuer) != nil {
+		return false, nil
+	}
+	report.Set("username", token.Subject)
+
+	if token.ClientID != clientID {
+		return true, &errors.Error{
+			Reason:      errors.UnauthorizedClient,
+			Description: "the token was issued to another client",
+		}
+	}
+
+	api.TokenManager.Revoke(token.Id, time.Unix(token.ExpiresAt, 0))
+
+	// Access tokens of the same grant are invalidated too, as RFC 7009 section 2.1.
+	// They may live longer than the refresh token, so the grant is kept until both expire.
+	if token.GrantID != "" {
+		expiresAt := time.Unix(token.ExpiresAt, 0)
+		if t := time.Now().Add(api.Config.TokenExpireFor(clientID).Duration()); t.After(expiresAt) {
+			expiresAt = t
+		}
+		api.TokenManager.Revoke(token.GrantID, expiresAt)
+	}
+	return true, nil
+}
+
+func (api *LauthAPI) PostRevoke(c *gin.Context) {
+	report := metrics.StartRevoke(c)
+	defer report.Close()
+	report.Audit(api.Audit, audit.Revoke)
+
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+
+	var req PostRevokeRequest
+	if err := (&req).BindAndValidate(c, api); err != nil {
+		report.Set("client_id", req.Client.ClientID)
+		report.SetError(err)
+		errors.SendTokenError(c, err)
+		return
+	}
+	report.Set("client_id", req.Client.ClientID)
+
+	// The token_type_hint only decides which type to try first, as RFC 7009 section 2.1.
+	types := []string{"access_token", "refresh_token"}
+	revokers := []func(string, string, *metrics.Context) (bool, *errors.Error){api.revokeAccessToken, api.revokeRefreshToken}
+	if req.TokenTypeHint == "refresh_token" {
+		types[0], types[1] = types[1], types[0]
+		revokers[0], revokers[1] = revokers[1], revokers[0]
+	}
+
+	for i, revoke := range revokers {
+		found, err := revoke(req.Token, req.Client.ClientID, report)
+		if !found {
+			continue
+		}
+
+		report.Set("token_type", types[i])
+		if err != nil {
+			report.SetError(err)
+			errors.SendTokenError(c, err)
+			return
+		}
+		break
+	}
+
+	// Invalid or already revoked token is not an error, as RFC 7009 section 2.2.
+	report.Success()
+	c.Status(http.StatusOK)
+}
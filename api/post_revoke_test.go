@@ -0,0 +1,228 @@
+package api_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/testutil"
+	"github.com/macrat/lauth/token"
+)
+
+func TestPostRevoke(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	createAccessToken := func(clientID string) string {
+		token, err := env.API.TokenManager.CreateAccessToken(
+			env.API.Config.Issuer,
+			"macrat",
+			clientID,
+			"openid profile",
+			"",
+			token.Authentication{Time: time.Now()},
+			10*time.Minute,
+		)
+		if err != nil {
+			t.Fatalf("failed to create access token: %s", err)
+		}
+		return token
+	}
+
+	revoke := func(token, hint string) *http.Response {
+		values := url.Values{
+			"client_id":     {"some_client_id"},
+			"client_secret": {"secret for some-client"},
+			"token":         {token},
+		}
+		if hint != "" {
+			values.Set("token_type_hint", hint)
+		}
+		return env.Post("/revoke", "", values).Result()
+	}
+
+	t.Run("access_token", func(t *testing.T) {
+		token := createAccessToken("some_client_id")
+
+		if resp := env.Get("/userinfo", "Bearer "+token, nil); resp.Code != http.StatusOK {
+			t.Fatalf("userinfo should accept the token before revoke but got %d", resp.Code)
+		}
+
+		if resp := revoke(token, ""); resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected status code: %d", resp.StatusCode)
+		} else if resp.Header.Get("Cache-Control") != "no-store" {
+			t.Errorf("unexpected Cache-Control header: %#v", resp.Header.Get("Cache-Control"))
+		}
+
+		if resp := env.Get("/userinfo", "Bearer "+token, nil); resp.Code != http.StatusUnauthorized {
+			t.Errorf("userinfo should reject the revoked token but got %d", resp.Code)
+		}
+
+		resp := env.Post("/introspect", "", url.Values{
+			"client_id":     {"some_client_id"},
+			"client_secret": {"secret for some-client"},
+			"token":         {token},
+		})
+		if resp.Body.String() != `{"active":false}` {
+			t.Errorf("introspection should report inactive but got %s", resp.Body.String())
+		}
+
+		if resp := revoke(token, ""); resp.StatusCode != http.StatusOK {
+			t.Errorf("revoking again should succeed but got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("refresh_token", func(t *testing.T) {
+		token, err := env.API.TokenManager.CreateRefreshToken(
+			env.API.Config.Issuer,
+			"macrat",
+			"some_client_id",
+			"openid profile",
+			"",
+			token.Authentication{Time: time.Now()},
+			10*time.Minute,
+		)
+		if err != nil {
+			t.Fatalf("failed to create refresh token: %s", err)
+		}
+
+		if resp := revoke(token, "refresh_token"); resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected status code: %d", resp.StatusCode)
+		}
+
+		resp := env.Post("/token", "", url.Values{
+			"grant_type":    {"refresh_token"},
+			"client_id":     {"some_client_id"},
+			"client_secret": {"secret for some-client"},
+			"refresh_token": {token},
+		})
+		if resp.Code != http.StatusBadRequest {
+			t.Errorf("revoked refresh token should be rejected but got %d: %s", resp.Code, resp.Body.String())
+		}
+	})
+
+	t.Run("access_token of revoked refresh_token", func(t *testing.T) {
+		code, err := env.API.TokenManager.CreateCode(
+			env.API.Config.Issuer,
+			"macrat",
+			"some_client_id",
+			"http://some-client.example.com/callback",
+			"openid profile",
+			"",
+			token.Authentication{Time: time.Now()},
+			time.Minute,
+		)
+		if err != nil {
+			t.Fatalf("failed to create code: %s", err)
+		}
+
+		var issued struct {
+			AccessToken  string `json:"access_token"`
+			RefreshToken string `json:"refresh_token"`
+		}
+		resp := env.Post("/token", "", url.Values{
+			"grant_type":    {"authorization_code"},
+			"client_id":     {"some_client_id"},
+			"client_secret": {"secret for some-client"},
+			"code":          {code},
+			"redirect_uri":  {"http://some-client.example.com/callback"},
+		})
+		if resp.Code != http.StatusOK {
+			t.Fatalf("failed to exchange code: %d: %s", resp.Code, resp.Body.String())
+		} else if err := json.Unmarshal(resp.Body.Bytes(), &issued); err != nil {
+			t.Fatalf("failed to unmarshal token response: %s", err)
+		}
+
+		var refreshed struct {
+			AccessToken string `json:"access_token"`
+		}
+		resp = env.Post("/token", "", url.Values{
+			"grant_type":    {"refresh_token"},
+			"client_id":     {"some_client_id"},
+			"client_secret": {"secret for some-client"},
+			"refresh_token": {issued.RefreshToken},
+		})
+		if resp.Code != http.StatusOK {
+			t.Fatalf("failed to refresh token: %d: %s", resp.Code, resp.Body.String())
+		} else if err := json.Unmarshal(resp.Body.Bytes(), &refreshed); err != nil {
+			t.Fatalf("failed to unmarshal token response: %s", err)
+		}
+
+		unrelated := createAccessToken("some_client_id")
+
+		if resp := revoke(issued.RefreshToken, "refresh_token"); resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected status code: %d", resp.StatusCode)
+		}
+
+		for _, tok := range []string{issued.AccessToken, refreshed.AccessToken} {
+			if resp := env.Get("/userinfo", "Bearer "+tok, nil); resp.Code != http.StatusUnauthorized {
+				t.Errorf("access_token of the revoked refresh_token should be rejected but got %d", resp.Code)
+			}
+		}
+		if resp := env.Get("/userinfo", "Bearer "+unrelated, nil); resp.Code != http.StatusOK {
+			t.Errorf("access_token of another grant should not be revoked but got %d", resp.Code)
+		}
+	})
+
+	t.Run("wrong hint", func(t *testing.T) {
+		token := createAccessToken("some_client_id")
+
+		if resp := revoke(token, "refresh_token"); resp.StatusCode != http.StatusOK {
+			t.Fatalf("unexpected status code: %d", resp.StatusCode)
+		}
+		if _, err := env.API.TokenManager.ParseAccessToken(token); err == nil {
+			t.Errorf("token should be revoked even if the hint is wrong")
+		}
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		if resp := revoke("this-is-not-a-token", ""); resp.StatusCode != http.StatusOK {
+			t.Errorf("unexpected status code: %d", resp.StatusCode)
+		}
+	})
+
+	env.JSONTest(t, "POST", "/revoke", []testutil.JSONTest{
+		{
+			Name: "token of another client",
+			Request: url.Values{
+				"client_id":     {"some_client_id"},
+				"client_secret": {"secret for some-client"},
+				"token":         {createAccessToken("implicit_client_id")},
+			},
+			Code: http.StatusBadRequest,
+			Body: map[string]interface{}{
+				"error":             "unauthorized_client",
+				"error_description": "the token was issued to another client",
+			},
+		},
+		{
+			Name: "without client authentication",
+			Request: url.Values{
+				"token": {createAccessToken("some_client_id")},
+			},
+			Code: http.StatusBadRequest,
+			CheckBody: func(t *testing.T, body testutil.RawBody) {
+				var resp map[string]interface{}
+				if err := body.Bind(&resp); err != nil {
+					t.Fatalf("failed to unmarshal response body: %s", err)
+				}
+				if resp["error"] == nil {
+					t.Errorf("expected error but got %s", string(body))
+				}
+			},
+		},
+		{
+			Name: "missing token",
+			Request: url.Values{
+				"client_id":     {"some_client_id"},
+				"client_secret": {"secret for some-client"},
+			},
+			Code: http.StatusBadRequest,
+			Body: map[string]interface{}{
+				"error":             "invalid_request",
+				"error_description": "token is required",
+			},
+		},
+	})
+}
@@ -4,25 +4,45 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/macrat/lauth/audit"
 	"github.com/macrat/lauth/config"
 	"github.com/macrat/lauth/errors"
 	"github.com/macrat/lauth/metrics"
 	"github.com/macrat/lauth/secret"
+	"github.com/macrat/lauth/token"
+	"github.com/rs/zerolog/log"
 )
 
 type PostTokenRequest struct {
-	GrantType    string `form:"grant_type"    json:"grant_type"    xml:"grant_type"`
-	Code         string `form:"code"          json:"code"          xml:"code"`
-	RefreshToken string `form:"refresh_token" json:"refresh_token" xml:"refresh_token"`
-	ClientID     string `form:"client_id"     json:"client_id"     xml:"client_id"`
-	ClientSecret string `form:"client_secret" json:"client_secret" xml:"client_secret"`
-	RedirectURI  string `form:"redirect_uri"  json:"redirect_uri"  xml:"redirect_uri"`
+	GrantType           string `form:"grant_type"            json:"grant_type"            xml:"grant_type"`
+	Code                string `form:"code"                  json:"code"                  xml:"code"`
+	RefreshToken        string `form:"refresh_token"         json:"refresh_token"         xml:"refresh_token"`
+	ClientID            string `form:"client_id"             json:"client_id"             xml:"client_id"`
+	ClientSecret        string `form:"client_secret"         json:"client_secret"         xml:"client_secret"`
+	ClientAssertionType string `form:"client_assertion_type" json:"client_assertion_type" xml:"client_assertion_type"`
+	ClientAssertion     string `form:"client_assertion"      json:"client_assertion"      xml:"client_assertion"`
+	RedirectURI         string `form:"redirect_uri"          json:"redirect_uri"          xml:"redirect_uri"`
+	Scope               string `form:"scope"                 json:"scope"                 xml:"scope"`
+	CodeVerifier        string `form:"code_verifier"         json:"code_verifier"         xml:"code_verifier"`
+
+	AuthMethod string `form:"-" json:"-" xml:"-"`
 }
 
 func (req *PostTokenRequest) Bind(c *gin.Context) *errors.Error {
+	switch c.ContentType() {
+	case "", binding.MIMEPOSTForm, binding.MIMEJSON:
+	default:
+		return &errors.Error{
+			Reason:      errors.InvalidRequest,
+			Description: fmt.Sprintf("unsupported content type: %s", c.ContentType()),
+		}
+	}
+
 	err := c.ShouldBind(req)
 	if err != nil {
 		return &errors.Error{
@@ -34,11 +54,134 @@ func (req *PostTokenRequest) Bind(c *gin.Context) *errors.Error {
 	if u, p, ok := c.Request.BasicAuth(); ok {
 		req.ClientID = u
 		req.ClientSecret = p
+		req.AuthMethod = config.AUTH_METHOD_CLIENT_SECRET_BASIC
+	} else if req.ClientAssertion != "" || req.ClientAssertionType != "" {
+		if req.ClientID == "" {
+			req.ClientID = token.ClientAssertionSubject(req.ClientAssertion)
+		}
+		if strings.HasPrefix(token.ClientAssertionAlgorithm(req.ClientAssertion), "HS") {
+			req.AuthMethod = config.AUTH_METHOD_CLIENT_SECRET_JWT
+		} else {
+			req.AuthMethod = config.AUTH_METHOD_PRIVATE_KEY_JWT
+		}
+	} else if req.ClientSecret == "" {
+		req.AuthMethod = config.AUTH_METHOD_NONE
+	} else {
+		req.AuthMethod = config.AUTH_METHOD_CLIENT_SECRET_POST
+	}
+	return nil
+}
+
+func (req PostTokenRequest) authenticateClient(api *LauthAPI) *errors.Error {
+	if req.ClientID == "" {
+		return &errors.Error{
+			Reason:      errors.InvalidRequest,
+			Description: "client_id is required",
+		}
+	}
+
+	if req.usesClientAssertion() {
+		if req.ClientAssertionType != token.CLIENT_ASSERTION_TYPE_JWT_BEARER {
+			return &errors.Error{
+				Reason:      errors.InvalidRequest,
+				Description: "client_assertion_type must be " + token.CLIENT_ASSERTION_TYPE_JWT_BEARER,
+			}
+		} else if req.ClientAssertion == "" {
+			return &errors.Error{
+				Reason:      errors.InvalidRequest,
+				Description: "client_assertion is required",
+			}
+		}
+	}
+
+	client, ok := api.Config.Clients[req.ClientID]
+
+	// Public clients have no credential. They are checked by PKCE instead.
+	if req.AuthMethod == config.AUTH_METHOD_NONE && client.IsPublic() {
+		return nil
+	}
+
+	if !req.usesClientAssertion() && req.ClientSecret == "" {
+		return &errors.Error{
+			Reason:      errors.InvalidRequest,
+			Description: "client_secret is required",
+		}
+	}
+	if !ok {
+		return &errors.Error{Reason: errors.InvalidClient}
+	}
+
+	if !client.AllowTokenEndpointAuthMethod(req.AuthMethod) {
+		return &errors.Error{
+			Reason:      errors.InvalidClient,
+			Description: req.AuthMethod + " is not allowed for this client",
+		}
+	}
+
+	if req.usesClientAssertion() {
+		return req.verifyClientAssertion(api, client)
+	} else if err := compareClientSecret(req.ClientID, client, req.ClientSecret); err != nil {
+		return &errors.Error{Err: err, Reason: errors.InvalidClient}
+	}
+
+	return nil
+}
+
+func (req PostTokenRequest) usesClientAssertion() bool {
+	return req.AuthMethod == config.AUTH_METHOD_CLIENT_SECRET_JWT || req.AuthMethod == config.AUTH_METHOD_PRIVATE_KEY_JWT
+}
+
+// verifyClientAssertion checks the signature and the claims of client_assertion, and rejects reused assertion until it expires.
+func (req PostTokenRequest) verifyClientAssertion(api *LauthAPI, client config.ClientConfig) *errors.Error {
+	var claims token.ClientAssertionClaims
+	var err error
+	switch {
+	case req.AuthMethod == config.AUTH_METHOD_CLIENT_SECRET_JWT:
+		claims, err = api.TokenManager.ParseClientSecretAssertion(req.ClientAssertion, client.AssertionSecret)
+	case client.JWKS != "" || client.JWKSURI != "":
+		claims, err = api.TokenManager.ParseClientAssertionWithJWKS(req.ClientAssertion, client.JWKS, client.JWKSURI)
+	default:
+		claims, err = api.TokenManager.ParseClientAssertion(req.ClientAssertion, req.ClientID, client.RequestKey)
+	}
+	if err != nil {
+		return &errors.Error{Err: err, Reason: errors.InvalidClient}
+	}
+
+	if err = claims.Validate(req.ClientID, api.Config.OpenIDConfiguration().TokenEndpoint); err != nil {
+		return &errors.Error{Err: err, Reason: errors.InvalidClient}
+	}
+
+	if !api.Nonces.Use(req.ClientID, "client_assertion:"+claims.Id, time.Until(time.Unix(claims.ExpiresAt, 0))) {
+		return &errors.Error{
+			Reason:      errors.InvalidClient,
+			Description: "client_assertion is already used",
+		}
+	}
+
+	return nil
+}
+
+// compareClientSecret checks the secret against the current secret of the client.
+// The previous secret is also accepted until it expires, to rotate the secret without downtime.
+func compareClientSecret(clientID string, client config.ClientConfig, s string) error {
+	err := secret.Compare(client.Secret, s)
+	if err == nil || !client.PreviousSecretActive(time.Now()) {
+		return err
+	}
+
+	if secret.Compare(client.PreviousSecret, s) != nil {
+		return err
 	}
+
+	log.Warn().
+		Str("client_id", clientID).
+		Time("expires_at", client.PreviousSecretExpiresAt).
+		Msg("client authenticated by the previous secret; please update the secret of the client before it expires")
+
 	return nil
 }
 
-func (req PostTokenRequest) Validate(conf *config.Config) *errors.Error {
+func (req PostTokenRequest) Validate(api *LauthAPI) *errors.Error {
 	switch req.GrantType {
 	case "authorization_code":
 		if req.Code == "" {
@@ -66,29 +209,35 @@ func (req PostTokenRequest) Validate(conf *config.Config) *errors.Error {
 				Description: "can't set code when use refresh_token grant type",
 			}
 		}
+	case "client_credentials":
+		if req.Code != "" || req.RefreshToken != "" {
+			return &errors.Error{
+				Reason:      errors.InvalidRequest,
+				Description: "can't set code or refresh_token when use client_credentials grant type",
+			}
+		}
 	default:
 		return &errors.Error{
 			Reason:      errors.UnsupportedGrantType,
-			Description: "supported grant_type is authorization_code or refresh_token",
+			Description: "supported grant_type is authorization_code, refresh_token, or client_credentials",
 		}
 	}
 
-	if req.ClientID == "" {
+	if err := req.authenticateClient(api); err != nil {
+		return err
+	}
+
+	if req.GrantType == "refresh_token" && !api.Config.Clients[req.ClientID].RefreshTokensAllowed() {
 		return &errors.Error{
-			Reason:      errors.InvalidRequest,
-			Description: "client_id is required",
+			Reason:      errors.UnauthorizedClient,
+			Description: "refresh_token is not allowed for this client",
 		}
-	} else if req.ClientSecret == "" {
+	}
+
+	if req.GrantType == "client_credentials" && !api.Config.Clients[req.ClientID].AllowClientCredentials {
 		return &errors.Error{
-			Reason:      errors.InvalidRequest,
-			Description: "client_secret is required",
-		}
-	} else {
-		client, ok := conf.Clients[req.ClientID]
-		if !ok {
-			return &errors.Error{Reason: errors.InvalidClient}
-		} else if err := secret.Compare(client.Secret, req.ClientSecret); err != nil {
-			return &errors.Error{Err: err, Reason: errors.InvalidClient}
+			Reason:      errors.UnauthorizedClient,
+			Description: "client_credentials is not allowed for this client",
 		}
 	}
 
@@ -114,22 +263,57 @@ func (req PostTokenRequest) Validate(conf *config.Config) *errors.Error {
 	return nil
 }
 
-func (req *PostTokenRequest) BindAndValidate(c *gin.Context, conf *config.Config) *errors.Error {
+func (req *PostTokenRequest) BindAndValidate(c *gin.Context, api *LauthAPI) *errors.Error {
 	if err := req.Bind(c); err != nil {
 		return err
 	}
-	return req.Validate(conf)
+	return req.Validate(api)
 }
 
 type PostTokenResponse struct {
 	TokenType    string `json:"token_type"`
 	AccessToken  string `json:"access_token"`
-	IDToken      string `json:"id_token"`
+	IDToken      string `json:"id_token,omitempty"`
 	ExpiresIn    int64  `json:"expires_in"`
-	Scope        string `json:"string"`
+	Scope        string `json:"scope"`
 	RefreshToken string `json:"refresh_token,omitempty"`
 }
 
+// matchCode checks that the request is made by the client that the code issued for.
+func (req PostTokenRequest) matchCode(code token.CodeClaims) *errors.Error {
+	if req.ClientID != code.ClientID {
+		return &errors.Error{
+			Err:    fmt.Errorf("mismatch client_id"),
+			Reason: errors.InvalidGrant,
+		}
+	}
+
+	if req.RedirectURI != code.RedirectURI {
+		return &errors.Error{
+			Err:    fmt.Errorf("mismatch redirect_uri"),
+			Reason: errors.InvalidGrant,
+		}
+	}
+
+	// Anyone can send the client_id of the public client, so the code_verifier is the only proof that the request is from the client.
+	if req.AuthMethod == config.AUTH_METHOD_NONE && (code.CodeChallenge == "" || code.CodeChallengeMethod != config.CODE_CHALLENGE_METHOD_S256) {
+		return &errors.Error{
+			Reason:      errors.InvalidGrant,
+			Description: "public client must use PKCE with S256",
+		}
+	}
+
+	if err := code.VerifyCodeVerifier(req.CodeVerifier); err != nil {
+		return &errors.Error{
+			Err:         err,
+			Reason:      errors.InvalidGrant,
+			Description: err.Error(),
+		}
+	}
+
+	return nil
+}
+
 func (api *LauthAPI) postTokenWithCode(c *gin.Context, req PostTokenRequest, report *metrics.Context) (*PostTokenResponse, *errors.Error) {
 	code, err := api.TokenManager.ParseCode(req.Code)
 	if err != nil {
@@ -146,29 +330,47 @@ func (api *LauthAPI) postTokenWithCode(c *gin.Context, req PostTokenRequest, rep
 		}
 	}
 
-	if req.ClientID != code.ClientID {
+	maxAttempts := api.Config.MaxCodeAttempts
+	if maxAttempts > 0 && api.Codes.Failures(req.Code) >= maxAttempts {
 		return nil, &errors.Error{
-			Err:    fmt.Errorf("mismatch client_id"),
-			Reason: errors.InvalidGrant,
+			Err:         fmt.Errorf("too many failed attempts"),
+			Reason:      errors.InvalidGrant,
+			Description: "code is invalidated by too many failed attempts",
 		}
 	}
 
-	if req.RedirectURI != code.RedirectURI {
+	if err := req.matchCode(code); err != nil {
+		if maxAttempts > 0 {
+			api.Codes.Fail(req.Code, time.Unix(code.ExpiresAt, 0))
+		}
+		return nil, err
+	}
+
+	if api.Config.SingleActiveCode && !api.Codes.IsActive(code.Subject, time.Unix(code.AuthTime, 0), code.ClientID, req.Code) {
 		return nil, &errors.Error{
-			Err:    fmt.Errorf("mismatch redirect_uri"),
+			Err:    fmt.Errorf("superseded code"),
 			Reason: errors.InvalidGrant,
 		}
 	}
 
-	scope := ParseStringSet(code.Scope)
+	scope := api.clientScope(code.ClientID, ParseStringSet(code.Scope))
 
-	accessToken, err := api.TokenManager.CreateAccessToken(
+	// The grant ID binds the access token to the refresh token, to invalidate both by revoking the refresh token.
+	grantID := ""
+	if api.Config.RefreshExpireFor(code.ClientID) > 0 && (!api.Config.RequireOfflineAccess || scope.Has("offline_access")) {
+		grantID = api.TokenManager.NewGrantID()
+	}
+
+	accessToken, err := api.TokenManager.CreateAccessTokenWithClaims(
 		api.Config.Issuer,
 		code.Subject,
 		code.ClientID,
 		scope.String(),
-		time.Unix(code.AuthTime, 0),
-		api.Config.Expire.Token.Duration(),
+		api.tokenRequestID(c),
+		grantID,
+		code.Claims.ForUserinfo(),
+		code.Authentication(),
+		api.Config.TokenExpireFor(code.ClientID).Duration(),
 	)
 	if err != nil {
 		return nil, &errors.Error{
@@ -180,10 +382,14 @@ func (api *LauthAPI) postTokenWithCode(c *gin.Context, req PostTokenRequest, rep
 
 	var idToken string
 	if scope.Has("openid") {
-		userinfo, errMsg := api.userinfo(code.Subject, scope)
-		if err != nil {
+		userinfo, errMsg := api.userinfo(code.ClientID, code.Subject, scope, code.Claims.ForIDToken())
+		if errMsg != nil {
+			if errMsg.Reason == errors.InvalidToken {
+				errMsg.Reason = errors.InvalidGrant
+			}
 			return nil, errMsg
 		}
+		api.setIDTokenClaims(c, code.ClientID, userinfo)
 
 		idToken, err = api.TokenManager.CreateIDToken(
 			api.Config.Issuer,
@@ -193,8 +399,8 @@ func (api *LauthAPI) postTokenWithCode(c *gin.Context, req PostTokenRequest, rep
 			req.Code,
 			accessToken,
 			userinfo,
-			time.Unix(code.AuthTime, 0),
-			api.Config.Expire.Token.Duration(),
+			code.Authentication(),
+			api.Config.TokenExpireFor(code.ClientID).Duration(),
 		)
 		if err != nil {
 			return nil, &errors.Error{
@@ -206,15 +412,17 @@ func (api *LauthAPI) postTokenWithCode(c *gin.Context, req PostTokenRequest, rep
 	}
 
 	refreshToken := ""
-	if api.Config.Expire.Refresh > 0 {
-		refreshToken, err = api.TokenManager.CreateRefreshToken(
+	if grantID != "" {
+		refreshToken, err = api.TokenManager.CreateRefreshTokenWithClaims(
 			api.Config.Issuer,
 			code.Subject,
 			code.ClientID,
 			code.Scope,
 			code.Nonce,
-			time.Unix(code.AuthTime, 0),
-			api.Config.Expire.Refresh.Duration(),
+			grantID,
+			code.Claims,
+			code.Authentication(),
+			api.Config.RefreshExpireFor(code.ClientID).Duration(),
 		)
 		if err != nil {
 			return nil, &errors.Error{
@@ -229,8 +437,8 @@ func (api *LauthAPI) postTokenWithCode(c *gin.Context, req PostTokenRequest, rep
 		TokenType:    "Bearer",
 		AccessToken:  accessToken,
 		IDToken:      idToken,
-		ExpiresIn:    api.Config.Expire.Token.IntSeconds(),
-		Scope:        code.Scope,
+		ExpiresIn:    api.Config.TokenExpireFor(code.ClientID).IntSeconds(),
+		Scope:        scope.String(),
 		RefreshToken: refreshToken,
 	}, nil
 }
@@ -258,13 +466,54 @@ func (api *LauthAPI) postTokenWithRefreshToken(c *gin.Context, req PostTokenRequ
 		}
 	}
 
-	accessToken, err := api.TokenManager.CreateAccessToken(
+	scope := ParseStringSet(refreshToken.Scope)
+	if api.Config.RequireOfflineAccess && !scope.Has("offline_access") {
+		return nil, &errors.Error{
+			Reason:      errors.InvalidGrant,
+			Description: "refresh_token was issued without offline_access scope",
+		}
+	}
+	if req.Scope != "" {
+		requested := ParseStringSet(req.Scope)
+		for _, s := range requested.List() {
+			if !scope.Has(s) {
+				return nil, &errors.Error{
+					Reason:      errors.InvalidScope,
+					Description: "can't request scope that not granted by the resource owner",
+				}
+			}
+		}
+		scope = requested
+	}
+	scope = api.clientScope(refreshToken.ClientID, scope)
+
+	// Re-read the user from LDAP even if id_token is not needed, so the removed or disabled user can't refresh tokens anymore.
+	// Scopes that revoked from the user after login are dropped as well.
+	scope, errMsg := api.grantedScope(refreshToken.Subject, scope)
+	if errMsg != nil {
+		if errMsg.Reason == errors.AccessDenied {
+			errMsg.Reason = errors.InvalidGrant
+		}
+		return nil, errMsg
+	}
+	userinfo, errMsg := api.userinfo(refreshToken.ClientID, refreshToken.Subject, scope, refreshToken.Claims.ForIDToken())
+	if errMsg != nil {
+		if errMsg.Reason == errors.InvalidToken {
+			errMsg.Reason = errors.InvalidGrant
+		}
+		return nil, errMsg
+	}
+
+	accessToken, err := api.TokenManager.CreateAccessTokenWithClaims(
 		api.Config.Issuer,
 		refreshToken.Subject,
 		refreshToken.ClientID,
-		refreshToken.Scope,
-		time.Unix(refreshToken.AuthTime, 0),
-		api.Config.Expire.Token.Duration(),
+		scope.String(),
+		api.tokenRequestID(c),
+		refreshToken.GrantID,
+		refreshToken.Claims.ForUserinfo(),
+		refreshToken.Authentication(),
+		api.Config.TokenExpireFor(refreshToken.ClientID).Duration(),
 	)
 	if err != nil {
 		return nil, &errors.Error{
@@ -274,13 +523,9 @@ func (api *LauthAPI) postTokenWithRefreshToken(c *gin.Context, req PostTokenRequ
 		}
 	}
 
-	scope := ParseStringSet(refreshToken.Scope)
 	var idToken string
 	if scope.Has("openid") {
-		userinfo, errMsg := api.userinfo(refreshToken.Subject, scope)
-		if err != nil {
-			return nil, errMsg
-		}
+		api.setIDTokenClaims(c, refreshToken.ClientID, userinfo)
 
 		idToken, err = api.TokenManager.CreateIDToken(
 			api.Config.Issuer,
@@ -290,8 +535,8 @@ func (api *LauthAPI) postTokenWithRefreshToken(c *gin.Context, req PostTokenRequ
 			"",
 			accessToken,
 			userinfo,
-			time.Unix(refreshToken.AuthTime, 0),
-			api.Config.Expire.Token.Duration(),
+			refreshToken.Authentication(),
+			api.Config.TokenExpireFor(refreshToken.ClientID).Duration(),
 		)
 		if err != nil {
 			return nil, &errors.Error{
@@ -306,24 +551,102 @@ func (api *LauthAPI) postTokenWithRefreshToken(c *gin.Context, req PostTokenRequ
 		TokenType:   "Bearer",
 		AccessToken: accessToken,
 		IDToken:     idToken,
-		ExpiresIn:   api.Config.Expire.Token.IntSeconds(),
-		Scope:       refreshToken.Scope,
+		ExpiresIn:   api.Config.TokenExpireFor(refreshToken.ClientID).IntSeconds(),
+		Scope:       scope.String(),
+	}, nil
+}
+
+// postTokenWithClientCredentials issues access_token for the client itself. (RFC 6749 4.4)
+// The token has no user, so refresh_token is never issued.
+// id_token is issued only if the client enables client_credentials_id_token and requests the openid scope, with the client_id as the subject.
+func (api *LauthAPI) postTokenWithClientCredentials(c *gin.Context, req PostTokenRequest) (*PostTokenResponse, *errors.Error) {
+	client := api.Config.Clients[req.ClientID]
+
+	scope := ParseStringSet(strings.Join(client.ServiceScopes, " "))
+	if req.Scope != "" {
+		requested := ParseStringSet(req.Scope)
+		for _, s := range requested.List() {
+			// openid is only for requesting ID token, so it doesn't have to be in service_scopes.
+			if s == "openid" && client.ClientCredentialsIDToken {
+				continue
+			}
+			if !scope.Has(s) {
+				return nil, &errors.Error{
+					Reason:      errors.InvalidScope,
+					Description: fmt.Sprintf("%s scope is not allowed for this client", s),
+				}
+			}
+		}
+		scope = requested
+	}
+
+	accessToken, err := api.TokenManager.CreateClientAccessToken(
+		api.Config.Issuer,
+		req.ClientID,
+		scope.String(),
+		api.tokenRequestID(c),
+		api.Config.TokenExpireFor(req.ClientID).Duration(),
+	)
+	if err != nil {
+		return nil, &errors.Error{
+			Err:         err,
+			Reason:      errors.ServerError,
+			Description: "failed to generate access_token",
+		}
+	}
+
+	// ID token about the client itself is not in the spec, so it is issued only if the client opted in.
+	var idToken string
+	if client.ClientCredentialsIDToken && scope.Has("openid") {
+		claims := make(map[string]interface{})
+		for k, v := range client.ServiceClaims {
+			claims[k] = v
+		}
+		api.setIDTokenClaims(c, req.ClientID, claims)
+
+		idToken, err = api.TokenManager.CreateIDToken(
+			api.Config.Issuer,
+			req.ClientID,
+			req.ClientID,
+			"",
+			"",
+			accessToken,
+			claims,
+			token.Authentication{},
+			api.Config.TokenExpireFor(req.ClientID).Duration(),
+		)
+		if err != nil {
+			return nil, &errors.Error{
+				Err:         err,
+				Reason:      errors.ServerError,
+				Description: "failed to generate id_token",
+			}
+		}
+	}
+
+	return &PostTokenResponse{
+		TokenType:   "Bearer",
+		AccessToken: accessToken,
+		IDToken:     idToken,
+		ExpiresIn:   api.Config.TokenExpireFor(req.ClientID).IntSeconds(),
+		Scope:       scope.String(),
 	}, nil
 }
 
 func (api *LauthAPI) PostToken(c *gin.Context) {
 	report := metrics.StartToken(c)
+	report.Audit(api.Audit, audit.Token)
 	defer report.Close()
 
 	c.Header("Cache-Control", "no-store")
 	c.Header("Pragma", "no-cache")
 
 	var req PostTokenRequest
-	if err := (&req).BindAndValidate(c, api.Config); err != nil {
+	if err := (&req).BindAndValidate(c, api); err != nil {
 		report.Set("grant_type", req.GrantType)
 		report.Set("client_id", req.ClientID)
 		report.SetError(err)
-		c.JSON(http.StatusBadRequest, err)
+		errors.SendTokenError(c, err)
 		return
 	}
 
@@ -342,14 +665,17 @@ func (api *LauthAPI) PostToken(c *gin.Context) {
 
 	var resp *PostTokenResponse
 	var err *errors.Error
-	if req.GrantType == "authorization_code" {
+	switch req.GrantType {
+	case "authorization_code":
 		resp, err = api.postTokenWithCode(c, req, report)
-	} else {
+	case "client_credentials":
+		resp, err = api.postTokenWithClientCredentials(c, req)
+	default:
 		resp, err = api.postTokenWithRefreshToken(c, req, report)
 	}
 	if err != nil {
 		report.SetError(err)
-		errors.SendJSON(c, err)
+		errors.SendTokenError(c, err)
 	} else {
 		report.Set("scope", resp.Scope)
 		report.Success()
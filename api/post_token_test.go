@@ -1,7 +1,9 @@
 package api_test
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/url"
 	"reflect"
@@ -11,8 +13,10 @@ import (
 
 	"github.com/macrat/lauth/api"
 	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/secret"
 	"github.com/macrat/lauth/testutil"
 	"github.com/macrat/lauth/token"
+	"gopkg.in/dgrijalva/jwt-go.v3"
 )
 
 func TestPostToken(t *testing.T) {
@@ -30,7 +34,7 @@ func TestPostToken(t *testing.T) {
 			Code: http.StatusBadRequest,
 			Body: map[string]interface{}{
 				"error":             "unsupported_grant_type",
-				"error_description": "supported grant_type is authorization_code or refresh_token",
+				"error_description": "supported grant_type is authorization_code, refresh_token, or client_credentials",
 			},
 		},
 	})
@@ -52,6 +56,13 @@ func ResponseValidation(env *testutil.APITestEnvironment, scope, codeHash string
 			t.Errorf("expires_in is expected 3600 but got %#v", resp.ExpiresIn)
 		}
 
+		var fields map[string]interface{}
+		if err := body.Bind(&fields); err != nil {
+			t.Errorf("failed to unmarshal response body: %s", err)
+		} else if _, ok := fields["scope"]; !ok {
+			t.Errorf("scope is expected to be always included but not found")
+		}
+
 		if resp.Scope != scope {
 			t.Errorf("scope is expected %#v but got %#v", scope, resp.Scope)
 		}
@@ -65,7 +76,10 @@ func ResponseValidation(env *testutil.APITestEnvironment, scope, codeHash string
 		}
 
 		if !api.ParseStringSet(scope).Has("openid") {
-			if resp.IDToken != "" {
+			var raw map[string]interface{}
+			if err := body.Bind(&raw); err != nil {
+				t.Errorf("failed to unmarshal response body: %s", err)
+			} else if _, ok := raw["id_token"]; ok {
 				t.Errorf("openid is not includes in scope but got id_token")
 			}
 		} else {
@@ -100,7 +114,7 @@ func TestPostToken_Code(t *testing.T) {
 		"http://some-client.example.com/callback",
 		"openid profile",
 		"something-nonce",
-		time.Now(),
+		token.Authentication{Time: time.Now()},
 		env.API.Config.Expire.Code.Duration(),
 	)
 	if err != nil {
@@ -114,7 +128,21 @@ func TestPostToken_Code(t *testing.T) {
 		"http://some-client.example.com/callback",
 		"profile",
 		"something-nonce",
-		time.Now(),
+		token.Authentication{Time: time.Now()},
+		env.API.Config.Expire.Code.Duration(),
+	)
+	if err != nil {
+		t.Fatalf("failed to generate test code: %s", err)
+	}
+
+	unsortedScopeCode, err := env.API.TokenManager.CreateCode(
+		env.API.Config.Issuer,
+		"macrat",
+		"some_client_id",
+		"http://some-client.example.com/callback",
+		"profile openid",
+		"something-nonce",
+		token.Authentication{Time: time.Now()},
 		env.API.Config.Expire.Code.Duration(),
 	)
 	if err != nil {
@@ -128,7 +156,7 @@ func TestPostToken_Code(t *testing.T) {
 		"http://some-client.example.com/callback",
 		"openid profile",
 		"",
-		time.Now(),
+		token.Authentication{Time: time.Now()},
 		env.API.Config.Expire.Code.Duration(),
 	)
 	if err != nil {
@@ -384,6 +412,17 @@ func TestPostToken_Code(t *testing.T) {
 			Code:      http.StatusOK,
 			CheckBody: ResponseValidation(env, "profile", token.TokenHash(code)),
 		},
+		{
+			Name: "success with canonicalized scope",
+			Request: url.Values{
+				"grant_type":   {"authorization_code"},
+				"code":         {unsortedScopeCode},
+				"redirect_uri": {"http://some-client.example.com/callback"},
+			},
+			Token:     "Basic c29tZV9jbGllbnRfaWQ6c2VjcmV0IGZvciBzb21lLWNsaWVudA==",
+			Code:      http.StatusOK,
+			CheckBody: ResponseValidation(env, "openid profile", token.TokenHash(unsortedScopeCode)),
+		},
 	})
 }
 
@@ -396,7 +435,7 @@ func TestPostToken_RefreshToken(t *testing.T) {
 		"some_client_id",
 		"openid profile",
 		"something-nonce",
-		time.Now(),
+		token.Authentication{Time: time.Now()},
 		env.API.Config.Expire.Refresh.Duration(),
 	)
 	if err != nil {
@@ -409,7 +448,7 @@ func TestPostToken_RefreshToken(t *testing.T) {
 		"some_client_id",
 		"profile",
 		"something-nonce",
-		time.Now(),
+		token.Authentication{Time: time.Now()},
 		env.API.Config.Expire.Refresh.Duration(),
 	)
 	if err != nil {
@@ -422,13 +461,26 @@ func TestPostToken_RefreshToken(t *testing.T) {
 		"some_client_id",
 		"openid profile",
 		"",
-		time.Now(),
+		token.Authentication{Time: time.Now()},
 		env.API.Config.Expire.Code.Duration(),
 	)
 	if err != nil {
 		t.Fatalf("failed to generate test refresh_token: %s", err)
 	}
 
+	removedUserRefreshToken, err := env.API.TokenManager.CreateRefreshToken(
+		env.API.Config.Issuer,
+		"removed_user",
+		"some_client_id",
+		"profile",
+		"",
+		token.Authentication{Time: time.Now()},
+		env.API.Config.Expire.Refresh.Duration(),
+	)
+	if err != nil {
+		t.Fatalf("failed to generate test refresh_token: %s", err)
+	}
+
 	env.JSONTest(t, "POST", "/token", []testutil.JSONTest{
 		{
 			Name: "missing refresh_token",
@@ -558,6 +610,20 @@ func TestPostToken_RefreshToken(t *testing.T) {
 				"error": "invalid_grant",
 			},
 		},
+		{
+			Name: "removed user",
+			Request: url.Values{
+				"grant_type":    {"refresh_token"},
+				"refresh_token": {removedUserRefreshToken},
+				"client_id":     {"some_client_id"},
+				"client_secret": {"secret for some-client"},
+			},
+			Code: http.StatusBadRequest,
+			Body: map[string]interface{}{
+				"error":             "invalid_grant",
+				"error_description": "user was not found or disabled",
+			},
+		},
 		{
 			Name: "success",
 			Request: url.Values{
@@ -582,7 +648,223 @@ func TestPostToken_RefreshToken(t *testing.T) {
 			Code:      http.StatusOK,
 			CheckBody: ResponseValidation(env, "profile", ""),
 		},
+		{
+			Name: "success / narrow scope",
+			Request: url.Values{
+				"grant_type":    {"refresh_token"},
+				"refresh_token": {refreshToken},
+				"client_id":     {"some_client_id"},
+				"client_secret": {"secret for some-client"},
+				"scope":         {"profile"},
+			},
+			Code:      http.StatusOK,
+			CheckBody: ResponseValidation(env, "profile", ""),
+		},
+	})
+}
+
+func TestPostToken_ErrorCodes(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	makeCode := func(subject string) string {
+		code, err := env.API.TokenManager.CreateCode(
+			env.API.Config.Issuer,
+			subject,
+			"some_client_id",
+			"http://some-client.example.com/callback",
+			"openid profile",
+			"something-nonce",
+			token.Authentication{Time: time.Now()},
+			env.API.Config.Expire.Code.Duration(),
+		)
+		if err != nil {
+			t.Fatalf("failed to generate test code: %s", err)
+		}
+		return code
+	}
+
+	refreshToken, err := env.API.TokenManager.CreateRefreshToken(
+		env.API.Config.Issuer,
+		"macrat",
+		"some_client_id",
+		"profile",
+		"something-nonce",
+		token.Authentication{Time: time.Now()},
+		env.API.Config.Expire.Refresh.Duration(),
+	)
+	if err != nil {
+		t.Fatalf("failed to generate test refresh_token: %s", err)
+	}
+
+	basicAuth := func(clientID, secret string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(clientID+":"+secret))
+	}
+
+	tests := []struct {
+		Name            string
+		Request         url.Values
+		Token           string
+		Code            int
+		Error           string
+		WWWAuthenticate string
+	}{
+		{
+			Name: "invalid_request",
+			Request: url.Values{
+				"grant_type":    {"authorization_code"},
+				"client_id":     {"some_client_id"},
+				"client_secret": {"secret for some-client"},
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+			},
+			Code:  http.StatusBadRequest,
+			Error: "invalid_request",
+		},
+		{
+			Name: "invalid_client / client_secret_post",
+			Request: url.Values{
+				"grant_type":    {"authorization_code"},
+				"code":          {makeCode("macrat")},
+				"client_id":     {"some_client_id"},
+				"client_secret": {"invalid secret"},
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+			},
+			Code:  http.StatusBadRequest,
+			Error: "invalid_client",
+		},
+		{
+			Name: "invalid_client / client_secret_basic",
+			Request: url.Values{
+				"grant_type":   {"authorization_code"},
+				"code":         {makeCode("macrat")},
+				"redirect_uri": {"http://some-client.example.com/callback"},
+			},
+			Token:           basicAuth("some_client_id", "invalid secret"),
+			Code:            http.StatusUnauthorized,
+			Error:           "invalid_client",
+			WWWAuthenticate: `Basic realm="lauth"`,
+		},
+		{
+			Name: "invalid_client / unknown client with client_secret_basic",
+			Request: url.Values{
+				"grant_type":   {"authorization_code"},
+				"code":         {makeCode("macrat")},
+				"redirect_uri": {"http://some-client.example.com/callback"},
+			},
+			Token:           basicAuth("unknown_client_id", "secret for some-client"),
+			Code:            http.StatusUnauthorized,
+			Error:           "invalid_client",
+			WWWAuthenticate: `Basic realm="lauth"`,
+		},
+		{
+			Name: "invalid_grant / broken code",
+			Request: url.Values{
+				"grant_type":    {"authorization_code"},
+				"code":          {"this-is-not-a-code"},
+				"client_id":     {"some_client_id"},
+				"client_secret": {"secret for some-client"},
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+			},
+			Code:  http.StatusBadRequest,
+			Error: "invalid_grant",
+		},
+		{
+			Name: "invalid_grant / user was deleted",
+			Request: url.Values{
+				"grant_type":    {"authorization_code"},
+				"code":          {makeCode("deleted_user")},
+				"client_id":     {"some_client_id"},
+				"client_secret": {"secret for some-client"},
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+			},
+			Code:  http.StatusBadRequest,
+			Error: "invalid_grant",
+		},
+		{
+			Name: "unsupported_grant_type",
+			Request: url.Values{
+				"grant_type":    {"password"},
+				"client_id":     {"some_client_id"},
+				"client_secret": {"secret for some-client"},
+			},
+			Code:  http.StatusBadRequest,
+			Error: "unsupported_grant_type",
+		},
+		{
+			Name: "invalid_scope",
+			Request: url.Values{
+				"grant_type":    {"refresh_token"},
+				"refresh_token": {refreshToken},
+				"client_id":     {"some_client_id"},
+				"client_secret": {"secret for some-client"},
+				"scope":         {"openid profile"},
+			},
+			Code:  http.StatusBadRequest,
+			Error: "invalid_scope",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			resp := env.Post("/token", tt.Token, tt.Request)
+
+			if resp.Code != tt.Code {
+				t.Errorf("expected status code %d but got %d", tt.Code, resp.Code)
+			}
+
+			if h := resp.Header().Get("WWW-Authenticate"); h != tt.WWWAuthenticate {
+				t.Errorf("unexpected WWW-Authenticate header: %#v", h)
+			}
+
+			var body map[string]interface{}
+			if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+				t.Errorf("failed to unmarshal response body: %s", err)
+			} else if body["error"] != tt.Error {
+				t.Errorf("expected error %#v but got %s", tt.Error, resp.Body.String())
+			}
+		})
+	}
+}
+
+func TestPostToken_LDAPUnavailable(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Connector = testutil.UnavailableLDAP{}
+	env.API.Config.LDAP.RetryAfter = config.Duration(5 * time.Minute)
+
+	code, err := env.API.TokenManager.CreateCode(
+		env.API.Config.Issuer,
+		"macrat",
+		"some_client_id",
+		"http://some-client.example.com/callback",
+		"openid profile",
+		"something-nonce",
+		token.Authentication{Time: time.Now()},
+		env.API.Config.Expire.Code.Duration(),
+	)
+	if err != nil {
+		t.Fatalf("failed to generate test code: %s", err)
+	}
+
+	resp := env.Post("/token", "", url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"client_id":     {"some_client_id"},
+		"client_secret": {"secret for some-client"},
+		"redirect_uri":  {"http://some-client.example.com/callback"},
 	})
+
+	if resp.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected status code 503 but got %d", resp.Code)
+	}
+	if retryAfter := resp.Header().Get("Retry-After"); retryAfter != "300" {
+		t.Errorf("unexpected Retry-After header: %#v", retryAfter)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		t.Errorf("failed to unmarshal response body: %s", err)
+	} else if body["error"] != "temporarily_unavailable" {
+		t.Errorf("unexpected response body: %s", resp.Body.String())
+	}
 }
 
 func TestPostToken_CORS(t *testing.T) {
@@ -595,7 +877,7 @@ func TestPostToken_CORS(t *testing.T) {
 		"http://implicit-client.example.com/callback",
 		"openid profile",
 		"something-nonce",
-		time.Now(),
+		token.Authentication{Time: time.Now()},
 		env.API.Config.Expire.Code.Duration(),
 	)
 	if err != nil {
@@ -639,3 +921,1488 @@ func TestPostToken_CORS(t *testing.T) {
 		t.Errorf("unexpected response: %#v", string(resp.Body.Bytes()))
 	}
 }
+
+func TestPostToken_AuthMethod(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	const assertionSecret = "this is a shared secret for client_secret_jwt"
+
+	someClient := env.API.Config.Clients["some_client_id"]
+	for _, method := range []string{"client_secret_basic", "client_secret_post", "client_secret_jwt", "private_key_jwt"} {
+		client := someClient
+		client.TokenEndpointAuthMethod = method
+		client.AssertionSecret = assertionSecret
+		env.API.Config.Clients[method] = client
+	}
+
+	jwksClient := someClient
+	jwksClient.TokenEndpointAuthMethod = "private_key_jwt"
+	jwksClient.RequestKey = ""
+	jwksClient.JWKS = testutil.MakeJWKSet(t, testutil.ImplicitClientPublicKey, testutil.SomeClientPublicKey)
+	env.API.Config.Clients["jwks_client"] = jwksClient
+
+	makeCode := func(clientID string) string {
+		code, err := env.API.TokenManager.CreateCode(
+			env.API.Config.Issuer,
+			"macrat",
+			clientID,
+			"http://some-client.example.com/callback",
+			"openid profile",
+			"something-nonce",
+			token.Authentication{Time: time.Now()},
+			env.API.Config.Expire.Code.Duration(),
+		)
+		if err != nil {
+			t.Fatalf("failed to generate test code: %s", err)
+		}
+		return code
+	}
+	basicAuth := func(clientID string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(clientID+":secret for some-client"))
+	}
+	assertionCount := 0
+	assertionClaims := func(clientID, audience string) map[string]interface{} {
+		assertionCount++
+		return map[string]interface{}{
+			"iss": clientID,
+			"sub": clientID,
+			"aud": audience,
+			"exp": time.Now().Add(5 * time.Minute).Unix(),
+			"jti": fmt.Sprintf("assertion-%d", assertionCount),
+		}
+	}
+	makeAssertion := func(clientID, audience, key string) string {
+		return testutil.MakeRequestObject(t, assertionClaims(clientID, audience), key)
+	}
+	makeSecretAssertion := func(clientID, audience, secret string) string {
+		assertion, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims(assertionClaims(clientID, audience))).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatalf("failed to sign assertion: %s", err)
+		}
+		return assertion
+	}
+	tokenEndpoint := env.API.Config.OpenIDConfiguration().TokenEndpoint
+	usedAssertion := makeAssertion("private_key_jwt", tokenEndpoint, testutil.SomeClientPrivateKey)
+
+	checkSuccess := func(t *testing.T, body testutil.RawBody) {
+		var resp api.PostTokenResponse
+		if err := body.Bind(&resp); err != nil {
+			t.Errorf("failed to unmarshal response body: %s", err)
+		} else if resp.AccessToken == "" {
+			t.Errorf("access_token is not included: %s", string(body))
+		}
+	}
+
+	env.JSONTest(t, "POST", "/token", []testutil.JSONTest{
+		{
+			Name: "client_secret_basic / success",
+			Request: url.Values{
+				"grant_type":   {"authorization_code"},
+				"code":         {makeCode("client_secret_basic")},
+				"redirect_uri": {"http://some-client.example.com/callback"},
+			},
+			Token:     basicAuth("client_secret_basic"),
+			Code:      http.StatusOK,
+			CheckBody: checkSuccess,
+		},
+		{
+			Name: "client_secret_basic / use client_secret_post",
+			Request: url.Values{
+				"grant_type":    {"authorization_code"},
+				"code":          {makeCode("client_secret_basic")},
+				"client_id":     {"client_secret_basic"},
+				"client_secret": {"secret for some-client"},
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+			},
+			Code: http.StatusBadRequest,
+			Body: map[string]interface{}{
+				"error":             "invalid_client",
+				"error_description": "client_secret_post is not allowed for this client",
+			},
+		},
+		{
+			Name: "client_secret_post / success",
+			Request: url.Values{
+				"grant_type":    {"authorization_code"},
+				"code":          {makeCode("client_secret_post")},
+				"client_id":     {"client_secret_post"},
+				"client_secret": {"secret for some-client"},
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+			},
+			Code:      http.StatusOK,
+			CheckBody: checkSuccess,
+		},
+		{
+			Name: "client_secret_post / use client_secret_basic",
+			Request: url.Values{
+				"grant_type":   {"authorization_code"},
+				"code":         {makeCode("client_secret_post")},
+				"redirect_uri": {"http://some-client.example.com/callback"},
+			},
+			Token: basicAuth("client_secret_post"),
+			Code:  http.StatusUnauthorized,
+			Body: map[string]interface{}{
+				"error":             "invalid_client",
+				"error_description": "client_secret_basic is not allowed for this client",
+			},
+		},
+		{
+			Name: "private_key_jwt / success",
+			Request: url.Values{
+				"grant_type":            {"authorization_code"},
+				"code":                  {makeCode("private_key_jwt")},
+				"client_assertion_type": {token.CLIENT_ASSERTION_TYPE_JWT_BEARER},
+				"client_assertion":      {makeAssertion("private_key_jwt", tokenEndpoint, testutil.SomeClientPrivateKey)},
+				"redirect_uri":          {"http://some-client.example.com/callback"},
+			},
+			Code:      http.StatusOK,
+			CheckBody: checkSuccess,
+		},
+		{
+			Name: "private_key_jwt / use client_secret_post",
+			Request: url.Values{
+				"grant_type":    {"authorization_code"},
+				"code":          {makeCode("private_key_jwt")},
+				"client_id":     {"private_key_jwt"},
+				"client_secret": {"secret for some-client"},
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+			},
+			Code: http.StatusBadRequest,
+			Body: map[string]interface{}{
+				"error":             "invalid_client",
+				"error_description": "client_secret_post is not allowed for this client",
+			},
+		},
+		{
+			Name: "private_key_jwt / signed by another key",
+			Request: url.Values{
+				"grant_type":            {"authorization_code"},
+				"code":                  {makeCode("private_key_jwt")},
+				"client_assertion_type": {token.CLIENT_ASSERTION_TYPE_JWT_BEARER},
+				"client_assertion":      {makeAssertion("private_key_jwt", tokenEndpoint, testutil.ImplicitClientPrivateKey)},
+				"redirect_uri":          {"http://some-client.example.com/callback"},
+			},
+			Code: http.StatusBadRequest,
+			Body: map[string]interface{}{
+				"error": "invalid_client",
+			},
+		},
+		{
+			Name: "private_key_jwt / incorrect audience",
+			Request: url.Values{
+				"grant_type":            {"authorization_code"},
+				"code":                  {makeCode("private_key_jwt")},
+				"client_assertion_type": {token.CLIENT_ASSERTION_TYPE_JWT_BEARER},
+				"client_assertion":      {makeAssertion("private_key_jwt", "http://another.example.com/token", testutil.SomeClientPrivateKey)},
+				"redirect_uri":          {"http://some-client.example.com/callback"},
+			},
+			Code: http.StatusBadRequest,
+			Body: map[string]interface{}{
+				"error": "invalid_client",
+			},
+		},
+		{
+			Name: "private_key_jwt / invalid assertion type",
+			Request: url.Values{
+				"grant_type":            {"authorization_code"},
+				"code":                  {makeCode("private_key_jwt")},
+				"client_id":             {"private_key_jwt"},
+				"client_assertion_type": {"something-invalid"},
+				"client_assertion":      {makeAssertion("private_key_jwt", tokenEndpoint, testutil.SomeClientPrivateKey)},
+				"redirect_uri":          {"http://some-client.example.com/callback"},
+			},
+			Code: http.StatusBadRequest,
+			Body: map[string]interface{}{
+				"error":             "invalid_request",
+				"error_description": "client_assertion_type must be " + token.CLIENT_ASSERTION_TYPE_JWT_BEARER,
+			},
+		},
+		{
+			Name: "private_key_jwt / first use of assertion",
+			Request: url.Values{
+				"grant_type":            {"authorization_code"},
+				"code":                  {makeCode("private_key_jwt")},
+				"client_assertion_type": {token.CLIENT_ASSERTION_TYPE_JWT_BEARER},
+				"client_assertion":      {usedAssertion},
+				"redirect_uri":          {"http://some-client.example.com/callback"},
+			},
+			Code:      http.StatusOK,
+			CheckBody: checkSuccess,
+		},
+		{
+			Name: "private_key_jwt / reuse assertion",
+			Request: url.Values{
+				"grant_type":            {"authorization_code"},
+				"code":                  {makeCode("private_key_jwt")},
+				"client_assertion_type": {token.CLIENT_ASSERTION_TYPE_JWT_BEARER},
+				"client_assertion":      {usedAssertion},
+				"redirect_uri":          {"http://some-client.example.com/callback"},
+			},
+			Code: http.StatusBadRequest,
+			Body: map[string]interface{}{
+				"error":             "invalid_client",
+				"error_description": "client_assertion is already used",
+			},
+		},
+		{
+			Name: "private_key_jwt / without jti",
+			Request: url.Values{
+				"grant_type":            {"authorization_code"},
+				"code":                  {makeCode("private_key_jwt")},
+				"client_assertion_type": {token.CLIENT_ASSERTION_TYPE_JWT_BEARER},
+				"client_assertion": {testutil.MakeRequestObject(t, map[string]interface{}{
+					"iss": "private_key_jwt",
+					"sub": "private_key_jwt",
+					"aud": tokenEndpoint,
+					"exp": time.Now().Add(5 * time.Minute).Unix(),
+				}, testutil.SomeClientPrivateKey)},
+				"redirect_uri": {"http://some-client.example.com/callback"},
+			},
+			Code: http.StatusBadRequest,
+			Body: map[string]interface{}{
+				"error": "invalid_client",
+			},
+		},
+		{
+			Name: "private_key_jwt / jwks",
+			Request: url.Values{
+				"grant_type":            {"authorization_code"},
+				"code":                  {makeCode("jwks_client")},
+				"client_assertion_type": {token.CLIENT_ASSERTION_TYPE_JWT_BEARER},
+				"client_assertion":      {makeAssertion("jwks_client", tokenEndpoint, testutil.SomeClientPrivateKey)},
+				"redirect_uri":          {"http://some-client.example.com/callback"},
+			},
+			Code:      http.StatusOK,
+			CheckBody: checkSuccess,
+		},
+		{
+			Name: "private_key_jwt / use client_secret_jwt",
+			Request: url.Values{
+				"grant_type":            {"authorization_code"},
+				"code":                  {makeCode("jwks_client")},
+				"client_assertion_type": {token.CLIENT_ASSERTION_TYPE_JWT_BEARER},
+				"client_assertion":      {makeSecretAssertion("jwks_client", tokenEndpoint, assertionSecret)},
+				"redirect_uri":          {"http://some-client.example.com/callback"},
+			},
+			Code: http.StatusBadRequest,
+			Body: map[string]interface{}{
+				"error":             "invalid_client",
+				"error_description": "client_secret_jwt is not allowed for this client",
+			},
+		},
+		{
+			Name: "client_secret_jwt / success",
+			Request: url.Values{
+				"grant_type":            {"authorization_code"},
+				"code":                  {makeCode("client_secret_jwt")},
+				"client_assertion_type": {token.CLIENT_ASSERTION_TYPE_JWT_BEARER},
+				"client_assertion":      {makeSecretAssertion("client_secret_jwt", tokenEndpoint, assertionSecret)},
+				"redirect_uri":          {"http://some-client.example.com/callback"},
+			},
+			Code:      http.StatusOK,
+			CheckBody: checkSuccess,
+		},
+		{
+			Name: "client_secret_jwt / signed by another secret",
+			Request: url.Values{
+				"grant_type":            {"authorization_code"},
+				"code":                  {makeCode("client_secret_jwt")},
+				"client_assertion_type": {token.CLIENT_ASSERTION_TYPE_JWT_BEARER},
+				"client_assertion":      {makeSecretAssertion("client_secret_jwt", tokenEndpoint, "this is another secret for client_secret_jwt")},
+				"redirect_uri":          {"http://some-client.example.com/callback"},
+			},
+			Code: http.StatusBadRequest,
+			Body: map[string]interface{}{
+				"error": "invalid_client",
+			},
+		},
+		{
+			Name: "client_secret_jwt / incorrect audience",
+			Request: url.Values{
+				"grant_type":            {"authorization_code"},
+				"code":                  {makeCode("client_secret_jwt")},
+				"client_assertion_type": {token.CLIENT_ASSERTION_TYPE_JWT_BEARER},
+				"client_assertion":      {makeSecretAssertion("client_secret_jwt", "http://another.example.com/token", assertionSecret)},
+				"redirect_uri":          {"http://some-client.example.com/callback"},
+			},
+			Code: http.StatusBadRequest,
+			Body: map[string]interface{}{
+				"error": "invalid_client",
+			},
+		},
+		{
+			Name: "client_secret_jwt / use private_key_jwt",
+			Request: url.Values{
+				"grant_type":            {"authorization_code"},
+				"code":                  {makeCode("client_secret_jwt")},
+				"client_assertion_type": {token.CLIENT_ASSERTION_TYPE_JWT_BEARER},
+				"client_assertion":      {makeAssertion("client_secret_jwt", tokenEndpoint, testutil.SomeClientPrivateKey)},
+				"redirect_uri":          {"http://some-client.example.com/callback"},
+			},
+			Code: http.StatusBadRequest,
+			Body: map[string]interface{}{
+				"error":             "invalid_client",
+				"error_description": "private_key_jwt is not allowed for this client",
+			},
+		},
+		{
+			Name: "default client / use private_key_jwt",
+			Request: url.Values{
+				"grant_type":            {"authorization_code"},
+				"code":                  {makeCode("some_client_id")},
+				"client_assertion_type": {token.CLIENT_ASSERTION_TYPE_JWT_BEARER},
+				"client_assertion":      {makeAssertion("some_client_id", tokenEndpoint, testutil.SomeClientPrivateKey)},
+				"redirect_uri":          {"http://some-client.example.com/callback"},
+			},
+			Code: http.StatusBadRequest,
+			Body: map[string]interface{}{
+				"error":             "invalid_client",
+				"error_description": "private_key_jwt is not allowed for this client",
+			},
+		},
+	})
+}
+
+func TestPostToken_Nonce(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	for _, nonce := range []string{"", "this-is-nonce"} {
+		code, err := env.API.TokenManager.CreateCode(
+			env.API.Config.Issuer,
+			"macrat",
+			"some_client_id",
+			"http://some-client.example.com/callback",
+			"openid",
+			nonce,
+			token.Authentication{Time: time.Now()},
+			env.API.Config.Expire.Code.Duration(),
+		)
+		if err != nil {
+			t.Fatalf("failed to generate test code: %s", err)
+		}
+
+		resp := env.Post("/token", "", url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"client_id":     {"some_client_id"},
+			"client_secret": {"secret for some-client"},
+			"redirect_uri":  {"http://some-client.example.com/callback"},
+		})
+		if resp.Code != http.StatusOK {
+			t.Fatalf("%#v: unexpected status code: %d", nonce, resp.Code)
+		}
+
+		var body map[string]interface{}
+		if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%#v: failed to unmarshal response body: %s", nonce, err)
+		}
+		idToken, _ := body["id_token"].(string)
+
+		parts := strings.Split(idToken, ".")
+		if len(parts) != 3 {
+			t.Fatalf("%#v: unexpected id_token: %#v", nonce, idToken)
+		}
+		payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+		if err != nil {
+			t.Fatalf("%#v: failed to decode id_token: %s", nonce, err)
+		}
+		var claims map[string]interface{}
+		if err := json.Unmarshal(payload, &claims); err != nil {
+			t.Fatalf("%#v: failed to unmarshal id_token: %s", nonce, err)
+		}
+
+		if got, ok := claims["nonce"]; nonce == "" && ok {
+			t.Errorf("nonce should be absent if not requested but got %#v", got)
+		} else if nonce != "" && got != nonce {
+			t.Errorf("unexpected nonce: %#v", got)
+		}
+	}
+}
+
+func TestPostToken_SingleActiveCode(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.SingleActiveCode = true
+
+	ssoToken, err := env.API.TokenManager.CreateSSOToken(
+		env.API.Config.Issuer,
+		"macrat",
+		"",
+		token.AuthorizedParties{"some_client_id"},
+		time.Now().Add(-time.Minute),
+		time.Now().Add(10*time.Minute),
+	)
+	if err != nil {
+		t.Fatalf("failed to create SSO token: %s", err)
+	}
+
+	issueCode := func(t *testing.T) string {
+		t.Helper()
+
+		req, _ := http.NewRequest("GET", "/authz?"+url.Values{
+			"client_id":     {"some_client_id"},
+			"redirect_uri":  {"http://some-client.example.com/callback"},
+			"response_type": {"code"},
+			"scope":         {"openid"},
+		}.Encode(), nil)
+		req.AddCookie(&http.Cookie{Name: api.SSO_TOKEN_COOKIE, Value: ssoToken})
+		resp := env.DoRequest(req)
+		if resp.Code != http.StatusFound {
+			t.Fatalf("unexpected status code: %d", resp.Code)
+		}
+
+		location, err := url.Parse(resp.Header().Get("Location"))
+		if err != nil {
+			t.Fatalf("failed to parse location: %s", err)
+		}
+		code := location.Query().Get("code")
+		if code == "" {
+			t.Fatalf("failed to get code: %s", location)
+		}
+		return code
+	}
+
+	exchange := func(code string) int {
+		return env.Post("/token", "", url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"client_id":     {"some_client_id"},
+			"client_secret": {"secret for some-client"},
+			"redirect_uri":  {"http://some-client.example.com/callback"},
+		}).Code
+	}
+
+	first := issueCode(t)
+	second := issueCode(t)
+	if first == second {
+		t.Fatalf("same code issued twice")
+	}
+
+	if code := exchange(first); code != http.StatusBadRequest {
+		t.Errorf("first code should be invalidated but got status code %d", code)
+	}
+	if code := exchange(second); code != http.StatusOK {
+		t.Errorf("second code should be usable but got status code %d", code)
+	}
+
+	env.API.Config.SingleActiveCode = false
+	if code := exchange(first); code != http.StatusOK {
+		t.Errorf("first code should be usable if disabled but got status code %d", code)
+	}
+}
+
+func TestPostToken_AuthorizedParty(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	for _, includeAzp := range []bool{false, true} {
+		client := env.API.Config.Clients["some_client_id"]
+		client.IncludeAzp = includeAzp
+		env.API.Config.Clients["some_client_id"] = client
+
+		code, err := env.API.TokenManager.CreateCode(
+			env.API.Config.Issuer,
+			"macrat",
+			"some_client_id",
+			"http://some-client.example.com/callback",
+			"openid",
+			"",
+			token.Authentication{Time: time.Now()},
+			env.API.Config.Expire.Code.Duration(),
+		)
+		if err != nil {
+			t.Fatalf("failed to generate test code: %s", err)
+		}
+
+		resp := env.Post("/token", "", url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"client_id":     {"some_client_id"},
+			"client_secret": {"secret for some-client"},
+			"redirect_uri":  {"http://some-client.example.com/callback"},
+		})
+		if resp.Code != http.StatusOK {
+			t.Fatalf("include_azp=%v: unexpected status code: %d", includeAzp, resp.Code)
+		}
+
+		var body struct {
+			IDToken string `json:"id_token"`
+		}
+		if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+			t.Fatalf("include_azp=%v: failed to unmarshal response body: %s", includeAzp, err)
+		}
+
+		idToken, err := env.API.TokenManager.ParseIDToken(body.IDToken)
+		if err != nil {
+			t.Fatalf("include_azp=%v: failed to parse id_token: %s", includeAzp, err)
+		}
+
+		azp, ok := idToken.ExtraClaims["azp"]
+		if includeAzp && azp != "some_client_id" {
+			t.Errorf("include_azp=%v: unexpected azp: %#v", includeAzp, azp)
+		} else if !includeAzp && ok {
+			t.Errorf("include_azp=%v: azp should be absent for single audience but got %#v", includeAzp, azp)
+		}
+	}
+}
+
+func TestPostToken_MaxTokenExpire(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	client := env.API.Config.Clients["some_client_id"]
+	client.MaxTokenExpire = config.Duration(15 * time.Minute)
+	env.API.Config.Clients["some_client_id"] = client
+
+	code, err := env.API.TokenManager.CreateCode(
+		env.API.Config.Issuer,
+		"macrat",
+		"some_client_id",
+		"http://some-client.example.com/callback",
+		"openid",
+		"",
+		token.Authentication{Time: time.Now()},
+		env.API.Config.Expire.Code.Duration(),
+	)
+	if err != nil {
+		t.Fatalf("failed to generate test code: %s", err)
+	}
+
+	resp := env.Post("/token", "", url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"client_id":     {"some_client_id"},
+		"client_secret": {"secret for some-client"},
+		"redirect_uri":  {"http://some-client.example.com/callback"},
+	})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", resp.Code)
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		IDToken     string `json:"id_token"`
+		ExpiresIn   int64  `json:"expires_in"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to unmarshal response body: %s", err)
+	}
+
+	if body.ExpiresIn != 15*60 {
+		t.Errorf("expires_in should be capped to 15 minutes but got %d", body.ExpiresIn)
+	}
+
+	accessToken, err := env.API.TokenManager.ParseAccessToken(body.AccessToken)
+	if err != nil {
+		t.Fatalf("failed to parse access_token: %s", err)
+	}
+	if remain := accessToken.ExpiresAt - time.Now().Unix(); remain > 15*60 {
+		t.Errorf("access_token should expire within 15 minutes but remains %d seconds", remain)
+	}
+
+	idToken, err := env.API.TokenManager.ParseIDToken(body.IDToken)
+	if err != nil {
+		t.Fatalf("failed to parse id_token: %s", err)
+	}
+	if remain := idToken.ExpiresAt - time.Now().Unix(); remain > 15*60 {
+		t.Errorf("id_token should expire within 15 minutes but remains %d seconds", remain)
+	}
+}
+
+func TestPostToken_ClaimsParameter(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	claims, err := token.ParseClaimsRequest(`{
+		"id_token": {"email": null, "name": {"value": "someone else"}, "family_name": {"values": ["smith", "shida"]}},
+		"userinfo": {"phone_number": {"essential": true}}
+	}`, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to parse claims: %s", err)
+	}
+
+	type Response struct {
+		AccessToken  string `json:"access_token"`
+		IDToken      string `json:"id_token"`
+		RefreshToken string `json:"refresh_token"`
+		Scope        string `json:"scope"`
+	}
+	exchange := func(t *testing.T, scope string) (Response, token.IDTokenClaims) {
+		t.Helper()
+
+		code, err := env.API.TokenManager.CreateCodeWithClaims(
+			env.API.Config.Issuer,
+			"macrat",
+			"some_client_id",
+			"http://some-client.example.com/callback",
+			scope,
+			"",
+			"",
+			"",
+			claims,
+			token.Authentication{Time: time.Now()},
+			env.API.Config.Expire.Code.Duration(),
+		)
+		if err != nil {
+			t.Fatalf("failed to generate test code: %s", err)
+		}
+
+		resp := env.Post("/token", "", url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"client_id":     {"some_client_id"},
+			"client_secret": {"secret for some-client"},
+			"redirect_uri":  {"http://some-client.example.com/callback"},
+		})
+		if resp.Code != http.StatusOK {
+			t.Fatalf("unexpected status code: %d: %s", resp.Code, resp.Body.String())
+		}
+
+		var body Response
+		if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+			t.Fatalf("failed to unmarshal response body: %s", err)
+		}
+		if body.Scope != scope {
+			t.Errorf("scope should not be changed by claims but got %#v", body.Scope)
+		}
+
+		idToken, err := env.API.TokenManager.ParseIDToken(body.IDToken)
+		if err != nil {
+			t.Fatalf("failed to parse id_token: %s", err)
+		}
+		return body, idToken
+	}
+
+	getUserinfo := func(t *testing.T, accessToken string) map[string]interface{} {
+		t.Helper()
+
+		resp := env.Get("/userinfo", "Bearer "+accessToken, nil)
+		if resp.Code != http.StatusOK {
+			t.Fatalf("unexpected status code of userinfo: %d: %s", resp.Code, resp.Body.String())
+		}
+		var info map[string]interface{}
+		if err := json.Unmarshal(resp.Body.Bytes(), &info); err != nil {
+			t.Fatalf("failed to unmarshal userinfo: %s", err)
+		}
+		return info
+	}
+
+	t.Run("claims of not granted scopes", func(t *testing.T) {
+		body, idToken := exchange(t, "openid")
+
+		for _, name := range []string{"email", "family_name", "phone_number"} {
+			if v, ok := idToken.ExtraClaims[name]; ok {
+				t.Errorf("id_token should not include %s that the scope is not granted but got %#v", name, v)
+			}
+		}
+		if phone, ok := getUserinfo(t, body.AccessToken)["phone_number"]; ok {
+			t.Errorf("userinfo should not include phone_number that the scope is not granted but got %#v", phone)
+		}
+	})
+
+	t.Run("claims of granted scopes", func(t *testing.T) {
+		body, idToken := exchange(t, "email openid phone profile")
+
+		if email := idToken.ExtraClaims["email"]; email != "m@crat.jp" {
+			t.Errorf("id_token should include requested email but got %#v", email)
+		}
+		if familyName := idToken.ExtraClaims["family_name"]; familyName != "shida" {
+			t.Errorf("id_token should include family_name that matches requested values but got %#v", familyName)
+		}
+		if name, ok := idToken.ExtraClaims["name"]; ok {
+			t.Errorf("id_token should not include name that doesn't match requested value but got %#v", name)
+		}
+
+		refreshToken, err := env.API.TokenManager.ParseRefreshToken(body.RefreshToken)
+		if err != nil {
+			t.Fatalf("failed to parse refresh_token: %s", err)
+		}
+		if !reflect.DeepEqual(refreshToken.Claims, claims) {
+			t.Errorf("refresh_token should carry claims but got %#v", refreshToken.Claims)
+		}
+
+		if phone := getUserinfo(t, body.AccessToken)["phone_number"]; phone != "000-1234-5678" {
+			t.Errorf("userinfo should include requested phone_number but got %#v", phone)
+		}
+	})
+}
+
+func TestPostToken_ContentType(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	makeCode := func(t *testing.T) string {
+		t.Helper()
+
+		code, err := env.API.TokenManager.CreateCode(
+			env.API.Config.Issuer,
+			"macrat",
+			"some_client_id",
+			"http://some-client.example.com/callback",
+			"openid",
+			"",
+			token.Authentication{Time: time.Now()},
+			env.API.Config.Expire.Code.Duration(),
+		)
+		if err != nil {
+			t.Fatalf("failed to generate test code: %s", err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		ContentType string
+		Body        func(code string) string
+		Code        int
+	}{
+		{
+			"application/x-www-form-urlencoded",
+			func(code string) string {
+				return url.Values{
+					"grant_type":    {"authorization_code"},
+					"code":          {code},
+					"client_id":     {"some_client_id"},
+					"client_secret": {"secret for some-client"},
+					"redirect_uri":  {"http://some-client.example.com/callback"},
+				}.Encode()
+			},
+			http.StatusOK,
+		},
+		{
+			"application/json; charset=utf-8",
+			func(code string) string {
+				body, _ := json.Marshal(map[string]string{
+					"grant_type":    "authorization_code",
+					"code":          code,
+					"client_id":     "some_client_id",
+					"client_secret": "secret for some-client",
+					"redirect_uri":  "http://some-client.example.com/callback",
+				})
+				return string(body)
+			},
+			http.StatusOK,
+		},
+		{
+			"application/xml",
+			func(code string) string {
+				return "<xml><grant_type>authorization_code</grant_type><code>" + code + "</code></xml>"
+			},
+			http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("POST", "/token", strings.NewReader(tt.Body(makeCode(t))))
+		req.Header.Set("Content-Type", tt.ContentType)
+		resp := env.DoRequest(req)
+
+		if resp.Code != tt.Code {
+			t.Errorf("%s: expected status code %d but got %d: %s", tt.ContentType, tt.Code, resp.Code, resp.Body.String())
+			continue
+		}
+
+		var body map[string]interface{}
+		if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: failed to unmarshal response body: %s", tt.ContentType, err)
+		}
+		if tt.Code == http.StatusOK && body["access_token"] == nil {
+			t.Errorf("%s: access_token is not issued: %#v", tt.ContentType, body)
+		} else if tt.Code != http.StatusOK && body["error"] != "invalid_request" {
+			t.Errorf("%s: unexpected error: %#v", tt.ContentType, body)
+		}
+	}
+}
+
+func TestPostToken_AllowRefreshTokens(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	client := env.API.Config.Clients["some_client_id"]
+	client.AllowRefreshTokens = new(bool)
+	env.API.Config.Clients["some_client_id"] = client
+
+	code, err := env.API.TokenManager.CreateCode(
+		env.API.Config.Issuer,
+		"macrat",
+		"some_client_id",
+		"http://some-client.example.com/callback",
+		"openid offline_access",
+		"",
+		token.Authentication{Time: time.Now()},
+		env.API.Config.Expire.Code.Duration(),
+	)
+	if err != nil {
+		t.Fatalf("failed to generate test code: %s", err)
+	}
+
+	resp := env.Post("/token", "", url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"client_id":     {"some_client_id"},
+		"client_secret": {"secret for some-client"},
+		"redirect_uri":  {"http://some-client.example.com/callback"},
+	})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d", resp.Code)
+	}
+
+	var body map[string]interface{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to unmarshal response body: %s", err)
+	}
+	if _, ok := body["refresh_token"]; ok {
+		t.Errorf("refresh_token should not be issued even with offline_access: %#v", body)
+	}
+
+	refreshToken, err := env.API.TokenManager.CreateRefreshToken(
+		env.API.Config.Issuer,
+		"macrat",
+		"some_client_id",
+		"openid offline_access",
+		"",
+		token.Authentication{Time: time.Now()},
+		time.Hour,
+	)
+	if err != nil {
+		t.Fatalf("failed to generate test refresh token: %s", err)
+	}
+
+	resp = env.Post("/token", "", url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {refreshToken},
+		"client_id":     {"some_client_id"},
+		"client_secret": {"secret for some-client"},
+	})
+	if resp.Code != http.StatusBadRequest {
+		t.Errorf("refresh_token grant should be rejected but got status code %d", resp.Code)
+	} else if !strings.Contains(resp.Body.String(), `"unauthorized_client"`) {
+		t.Errorf("unexpected error response: %s", resp.Body.String())
+	}
+}
+
+func TestPostToken_RequireOfflineAccess(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.RequireOfflineAccess = true
+
+	tests := []struct {
+		Scope   string
+		Refresh bool
+	}{
+		{"openid profile", false},
+		{"openid offline_access", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Scope, func(t *testing.T) {
+			code, err := env.API.TokenManager.CreateCode(
+				env.API.Config.Issuer,
+				"macrat",
+				"some_client_id",
+				"http://some-client.example.com/callback",
+				tt.Scope,
+				"",
+				token.Authentication{Time: time.Now()},
+				env.API.Config.Expire.Code.Duration(),
+			)
+			if err != nil {
+				t.Fatalf("failed to generate test code: %s", err)
+			}
+
+			resp := env.Post("/token", "", url.Values{
+				"grant_type":    {"authorization_code"},
+				"code":          {code},
+				"client_id":     {"some_client_id"},
+				"client_secret": {"secret for some-client"},
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+			})
+			if resp.Code != http.StatusOK {
+				t.Fatalf("unexpected status code: %d: %s", resp.Code, resp.Body.String())
+			}
+
+			var body map[string]interface{}
+			if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+				t.Fatalf("failed to unmarshal response body: %s", err)
+			}
+			if _, ok := body["refresh_token"]; ok != tt.Refresh {
+				t.Errorf("expected refresh_token issued %v but got %#v", tt.Refresh, body)
+			}
+
+			refreshToken, err := env.API.TokenManager.CreateRefreshToken(
+				env.API.Config.Issuer,
+				"macrat",
+				"some_client_id",
+				tt.Scope,
+				"",
+				token.Authentication{Time: time.Now()},
+				time.Hour,
+			)
+			if err != nil {
+				t.Fatalf("failed to generate test refresh token: %s", err)
+			}
+
+			resp = env.Post("/token", "", url.Values{
+				"grant_type":    {"refresh_token"},
+				"refresh_token": {refreshToken},
+				"client_id":     {"some_client_id"},
+				"client_secret": {"secret for some-client"},
+			})
+			if tt.Refresh && resp.Code != http.StatusOK {
+				t.Errorf("unexpected status code of refresh_token grant: %d: %s", resp.Code, resp.Body.String())
+			} else if !tt.Refresh && (resp.Code != http.StatusBadRequest || !strings.Contains(resp.Body.String(), `"invalid_grant"`)) {
+				t.Errorf("refresh_token without offline_access should be rejected: %d: %s", resp.Code, resp.Body.String())
+			}
+		})
+	}
+}
+
+func TestPostToken_PKCE(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+	tests := []struct {
+		Name      string
+		Challenge string
+		Method    string
+		Verifier  string
+		Error     string
+	}{
+		{"S256", "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", "S256", verifier, ""},
+		{"plain", verifier, "plain", verifier, ""},
+		{"missing verifier", "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", "S256", "", "code_verifier is required"},
+		{"wrong verifier", "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", "S256", strings.Repeat("a", 43), "code_verifier does not match to code_challenge"},
+		{"unexpected verifier", "", "", verifier, "code_verifier is sent but code_challenge was not"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			code, err := env.API.TokenManager.CreateCodeWithChallenge(
+				env.API.Config.Issuer,
+				"macrat",
+				"some_client_id",
+				"http://some-client.example.com/callback",
+				"openid",
+				"",
+				tt.Challenge,
+				tt.Method,
+				token.Authentication{Time: time.Now()},
+				env.API.Config.Expire.Code.Duration(),
+			)
+			if err != nil {
+				t.Fatalf("failed to generate test code: %s", err)
+			}
+
+			params := url.Values{
+				"grant_type":    {"authorization_code"},
+				"code":          {code},
+				"client_id":     {"some_client_id"},
+				"client_secret": {"secret for some-client"},
+				"redirect_uri":  {"http://some-client.example.com/callback"},
+			}
+			if tt.Verifier != "" {
+				params.Set("code_verifier", tt.Verifier)
+			}
+			resp := env.Post("/token", "", params)
+
+			if tt.Error == "" {
+				if resp.Code != http.StatusOK {
+					t.Fatalf("unexpected status code: %d: %s", resp.Code, resp.Body.String())
+				}
+				return
+			}
+
+			if resp.Code != http.StatusBadRequest {
+				t.Fatalf("unexpected status code: %d", resp.Code)
+			}
+			var body struct {
+				Error       string `json:"error"`
+				Description string `json:"error_description"`
+			}
+			if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+				t.Fatalf("failed to unmarshal response body: %s", err)
+			}
+			if body.Error != "invalid_grant" || body.Description != tt.Error {
+				t.Errorf("unexpected error: %#v", body)
+			}
+		})
+	}
+}
+
+func TestPostToken_PublicClient(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	public := env.API.Config.Clients["some_client_id"]
+	public.TokenEndpointAuthMethod = config.AUTH_METHOD_NONE
+	public.Secret = ""
+	env.API.Config.Clients["public_client_id"] = public
+
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	challenge := "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	tests := []struct {
+		Name      string
+		ClientID  string
+		Challenge string
+		Method    string
+		Verifier  string
+		Secret    string
+		Error     string
+	}{
+		{"S256", "public_client_id", challenge, "S256", verifier, "", ""},
+		{"missing verifier", "public_client_id", challenge, "S256", "", "", "code_verifier is required"},
+		{"without PKCE", "public_client_id", "", "", "", "", "public client must use PKCE with S256"},
+		{"plain", "public_client_id", verifier, "plain", verifier, "", "public client must use PKCE with S256"},
+		{"with secret", "public_client_id", challenge, "S256", verifier, "something", "invalid_client"},
+		{"confidential client without secret", "some_client_id", challenge, "S256", verifier, "", "client_secret is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			redirectURI := "http://some-client.example.com/callback"
+
+			code, err := env.API.TokenManager.CreateCodeWithChallenge(
+				env.API.Config.Issuer,
+				"macrat",
+				tt.ClientID,
+				redirectURI,
+				"openid",
+				"",
+				tt.Challenge,
+				tt.Method,
+				token.Authentication{Time: time.Now()},
+				env.API.Config.Expire.Code.Duration(),
+			)
+			if err != nil {
+				t.Fatalf("failed to generate test code: %s", err)
+			}
+
+			params := url.Values{
+				"grant_type":   {"authorization_code"},
+				"code":         {code},
+				"client_id":    {tt.ClientID},
+				"redirect_uri": {redirectURI},
+			}
+			if tt.Verifier != "" {
+				params.Set("code_verifier", tt.Verifier)
+			}
+			if tt.Secret != "" {
+				params.Set("client_secret", tt.Secret)
+			}
+			resp := env.Post("/token", "", params)
+
+			if tt.Error == "" {
+				if resp.Code != http.StatusOK {
+					t.Fatalf("unexpected status code: %d: %s", resp.Code, resp.Body.String())
+				}
+				return
+			}
+
+			var body struct {
+				Error       string `json:"error"`
+				Description string `json:"error_description"`
+			}
+			if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+				t.Fatalf("failed to unmarshal response body: %s", err)
+			}
+			if body.Error != tt.Error && body.Description != tt.Error {
+				t.Errorf("unexpected error: %#v", body)
+			}
+		})
+	}
+
+	t.Run("refresh_token", func(t *testing.T) {
+		code, err := env.API.TokenManager.CreateCodeWithChallenge(
+			env.API.Config.Issuer,
+			"macrat",
+			"public_client_id",
+			"http://some-client.example.com/callback",
+			"openid offline_access",
+			"",
+			challenge,
+			"S256",
+			token.Authentication{Time: time.Now()},
+			env.API.Config.Expire.Code.Duration(),
+		)
+		if err != nil {
+			t.Fatalf("failed to generate test code: %s", err)
+		}
+
+		resp := env.Post("/token", "", url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"client_id":     {"public_client_id"},
+			"redirect_uri":  {"http://some-client.example.com/callback"},
+			"code_verifier": {verifier},
+		})
+		if resp.Code != http.StatusOK {
+			t.Fatalf("unexpected status code: %d: %s", resp.Code, resp.Body.String())
+		}
+		var body struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+			t.Fatalf("failed to unmarshal response body: %s", err)
+		}
+		if body.RefreshToken != "" {
+			t.Errorf("refresh_token should not be issued to public client")
+		}
+
+		refreshToken, err := env.API.TokenManager.CreateRefreshToken(
+			env.API.Config.Issuer,
+			"macrat",
+			"public_client_id",
+			"openid offline_access",
+			"",
+			token.Authentication{Time: time.Now()},
+			env.API.Config.Expire.Refresh.Duration(),
+		)
+		if err != nil {
+			t.Fatalf("failed to generate test refresh_token: %s", err)
+		}
+		resp = env.Post("/token", "", url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {refreshToken},
+			"client_id":     {"public_client_id"},
+		})
+		if resp.Code != http.StatusBadRequest || !strings.Contains(resp.Body.String(), `"unauthorized_client"`) {
+			t.Errorf("public client should not be able to use refresh_token: %d: %s", resp.Code, resp.Body.String())
+		}
+	})
+
+	t.Run("introspection", func(t *testing.T) {
+		resp := env.Post("/introspect", "", url.Values{
+			"client_id": {"public_client_id"},
+			"token":     {"something"},
+		})
+		if resp.Code != http.StatusBadRequest || !strings.Contains(resp.Body.String(), `"invalid_client"`) {
+			t.Errorf("public client should be rejected: %d: %s", resp.Code, resp.Body.String())
+		}
+	})
+}
+
+func TestPostToken_MaxCodeAttempts(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.MaxCodeAttempts = 3
+
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+	makeCode := func(t *testing.T) string {
+		code, err := env.API.TokenManager.CreateCodeWithChallenge(
+			env.API.Config.Issuer,
+			"macrat",
+			"some_client_id",
+			"http://some-client.example.com/callback",
+			"openid",
+			"",
+			"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM",
+			"S256",
+			token.Authentication{Time: time.Now()},
+			env.API.Config.Expire.Code.Duration(),
+		)
+		if err != nil {
+			t.Fatalf("failed to generate test code: %s", err)
+		}
+		return code
+	}
+
+	exchange := func(code, verifier string) (int, string) {
+		resp := env.Post("/token", "", url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"client_id":     {"some_client_id"},
+			"client_secret": {"secret for some-client"},
+			"redirect_uri":  {"http://some-client.example.com/callback"},
+			"code_verifier": {verifier},
+		})
+
+		var body struct {
+			Description string `json:"error_description"`
+		}
+		json.Unmarshal(resp.Body.Bytes(), &body)
+		return resp.Code, body.Description
+	}
+
+	attacked := makeCode(t)
+	for i := 0; i < 3; i++ {
+		status, desc := exchange(attacked, strings.Repeat(fmt.Sprint(i), 43))
+		if status != http.StatusBadRequest || desc != "code_verifier does not match to code_challenge" {
+			t.Errorf("%d: unexpected response: %d %s", i, status, desc)
+		}
+	}
+
+	if status, desc := exchange(attacked, verifier); status != http.StatusBadRequest || desc != "code is invalidated by too many failed attempts" {
+		t.Errorf("code should be invalidated but got: %d %s", status, desc)
+	}
+
+	another := makeCode(t)
+	if _, desc := exchange(another, strings.Repeat("x", 43)); desc != "code_verifier does not match to code_challenge" {
+		t.Errorf("unexpected error for another code: %s", desc)
+	}
+	if status, desc := exchange(another, verifier); status != http.StatusOK {
+		t.Errorf("another code should be usable but got: %d %s", status, desc)
+	}
+}
+
+func TestPostToken_AllowedScopes(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	client := env.API.Config.Clients["some_client_id"]
+	client.AllowedScopes = []string{"profile"}
+	env.API.Config.Clients["some_client_id"] = client
+
+	refreshToken, err := env.API.TokenManager.CreateRefreshToken(
+		env.API.Config.Issuer,
+		"macrat",
+		"some_client_id",
+		"openid profile email",
+		"",
+		token.Authentication{Time: time.Now()},
+		env.API.Config.Expire.Refresh.Duration(),
+	)
+	if err != nil {
+		t.Fatalf("failed to generate test refresh_token: %s", err)
+	}
+
+	resp := env.Post("/token", "", url.Values{
+		"grant_type":    {"refresh_token"},
+		"client_id":     {"some_client_id"},
+		"client_secret": {"secret for some-client"},
+		"refresh_token": {refreshToken},
+	})
+	if resp.Code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d: %s", resp.Code, resp.Body.String())
+	}
+
+	var body struct {
+		Scope string `json:"scope"`
+	}
+	if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+		t.Fatalf("failed to parse response: %s", err)
+	}
+	if body.Scope != "openid profile" {
+		t.Errorf("unexpected scope: %q", body.Scope)
+	}
+}
+
+func TestPostToken_PreviousSecret(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	current, err := secret.Hash([]byte("new secret"))
+	if err != nil {
+		t.Fatalf("failed to hash secret: %s", err)
+	}
+
+	client := env.API.Config.Clients["some_client_id"]
+	client.PreviousSecret = client.Secret
+	client.Secret = string(current)
+
+	exchange := func(clientSecret string) int {
+		code, err := env.API.TokenManager.CreateCode(
+			env.API.Config.Issuer,
+			"macrat",
+			"some_client_id",
+			"http://some-client.example.com/callback",
+			"openid",
+			"",
+			token.Authentication{Time: time.Now()},
+			env.API.Config.Expire.Code.Duration(),
+		)
+		if err != nil {
+			t.Fatalf("failed to generate test code: %s", err)
+		}
+
+		return env.Post("/token", "", url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"client_id":     {"some_client_id"},
+			"client_secret": {clientSecret},
+			"redirect_uri":  {"http://some-client.example.com/callback"},
+		}).Code
+	}
+
+	tests := []struct {
+		Name      string
+		ExpiresAt time.Time
+		Secret    string
+		Code      int
+	}{
+		{"current secret within the window", time.Now().Add(time.Hour), "new secret", http.StatusOK},
+		{"previous secret within the window", time.Now().Add(time.Hour), "secret for some-client", http.StatusOK},
+		{"wrong secret within the window", time.Now().Add(time.Hour), "wrong secret", http.StatusBadRequest},
+		{"current secret after the window", time.Now().Add(-time.Second), "new secret", http.StatusOK},
+		{"previous secret after the window", time.Now().Add(-time.Second), "secret for some-client", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		client.PreviousSecretExpiresAt = tt.ExpiresAt
+		env.API.Config.Clients["some_client_id"] = client
+
+		if code := exchange(tt.Secret); code != tt.Code {
+			t.Errorf("%s: expected status code %d but got %d", tt.Name, tt.Code, code)
+		}
+	}
+}
+
+func TestPostToken_ClientCredentials(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.UserinfoScopes = nil
+
+	request := func(clientSecret, scope string) (int, map[string]interface{}) {
+		values := url.Values{
+			"grant_type":    {"client_credentials"},
+			"client_id":     {"some_client_id"},
+			"client_secret": {clientSecret},
+		}
+		if scope != "" {
+			values.Set("scope", scope)
+		}
+		resp := env.Post("/token", "", values)
+
+		var body map[string]interface{}
+		if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+			t.Fatalf("failed to parse response: %s", err)
+		}
+		return resp.Code, body
+	}
+
+	if code, body := request("secret for some-client", ""); code != http.StatusBadRequest || body["error"] != "unauthorized_client" {
+		t.Errorf("client_credentials should be rejected if not allowed: %d %#v", code, body)
+	}
+
+	client := env.API.Config.Clients["some_client_id"]
+	client.AllowClientCredentials = true
+	client.ServiceScopes = []string{"api.write", "api.read"}
+	env.API.Config.Clients["some_client_id"] = client
+
+	tests := []struct {
+		Secret string
+		Scope  string
+		Code   int
+		Expect map[string]interface{}
+	}{
+		{"secret for some-client", "", http.StatusOK, map[string]interface{}{"scope": "api.read api.write"}},
+		{"secret for some-client", "api.read", http.StatusOK, map[string]interface{}{"scope": "api.read"}},
+		{"secret for some-client", "openid api.read", http.StatusBadRequest, map[string]interface{}{"error": "invalid_scope"}},
+		{"wrong secret", "", http.StatusBadRequest, map[string]interface{}{"error": "invalid_client"}},
+	}
+
+	for _, tt := range tests {
+		code, body := request(tt.Secret, tt.Scope)
+		if code != tt.Code {
+			t.Errorf("%#v: unexpected status code: %d", tt.Scope, code)
+		}
+		for k, v := range tt.Expect {
+			if body[k] != v {
+				t.Errorf("%#v: unexpected %s: %#v", tt.Scope, k, body[k])
+			}
+		}
+		if _, ok := body["id_token"]; ok {
+			t.Errorf("%#v: id_token should not be issued", tt.Scope)
+		}
+		if _, ok := body["refresh_token"]; ok {
+			t.Errorf("%#v: refresh_token should not be issued", tt.Scope)
+		}
+	}
+
+	_, body := request("secret for some-client", "")
+	accessToken, _ := body["access_token"].(string)
+
+	claims, err := env.API.TokenManager.ParseAccessToken(accessToken)
+	if err != nil {
+		t.Fatalf("failed to parse access_token: %s", err)
+	}
+	if claims.Subject != "some_client_id" || !claims.ClientCredentials {
+		t.Errorf("unexpected access_token: %#v", claims)
+	}
+
+	if resp := env.Get("/userinfo", "Bearer "+accessToken, nil); resp.Code != http.StatusUnauthorized {
+		t.Errorf("token by client_credentials should be rejected by userinfo: %d %s", resp.Code, resp.Body)
+	}
+
+	resp := env.Post("/introspect", "", url.Values{
+		"client_id":     {"some_client_id"},
+		"client_secret": {"secret for some-client"},
+		"token":         {accessToken},
+	})
+	var introspection map[string]interface{}
+	if err := json.Unmarshal(resp.Body.Bytes(), &introspection); err != nil {
+		t.Fatalf("failed to parse introspection response: %s", err)
+	}
+	if introspection["active"] != true || introspection["sub"] != "some_client_id" || introspection["client_credentials"] != true {
+		t.Errorf("introspection should mark the token as client_credentials: %#v", introspection)
+	}
+}
+
+func TestPostToken_ClientCredentialsIDToken(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	client := env.API.Config.Clients["some_client_id"]
+	client.AllowClientCredentials = true
+	client.ServiceScopes = []string{"api.read"}
+	client.ServiceClaims = map[string]interface{}{"service": "billing"}
+	env.API.Config.Clients["some_client_id"] = client
+
+	request := func(scope string) (int, map[string]interface{}) {
+		resp := env.Post("/token", "", url.Values{
+			"grant_type":    {"client_credentials"},
+			"client_id":     {"some_client_id"},
+			"client_secret": {"secret for some-client"},
+			"scope":         {scope},
+		})
+
+		var body map[string]interface{}
+		if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+			t.Fatalf("failed to parse response: %s", err)
+		}
+		return resp.Code, body
+	}
+
+	if code, body := request("openid api.read"); code != http.StatusBadRequest || body["error"] != "invalid_scope" {
+		t.Errorf("openid should be rejected without opt-in: %d %#v", code, body)
+	}
+
+	client.ClientCredentialsIDToken = true
+	env.API.Config.Clients["some_client_id"] = client
+
+	if code, body := request("api.read"); code != http.StatusOK {
+		t.Errorf("unexpected status code: %d %#v", code, body)
+	} else if _, ok := body["id_token"]; ok {
+		t.Errorf("id_token should not be issued without openid scope")
+	}
+
+	code, body := request("openid api.read")
+	if code != http.StatusOK {
+		t.Fatalf("unexpected status code: %d %#v", code, body)
+	}
+	if body["scope"] != "api.read openid" {
+		t.Errorf("unexpected scope: %#v", body["scope"])
+	}
+
+	rawIDToken, _ := body["id_token"].(string)
+	idToken, err := env.API.TokenManager.ParseIDToken(rawIDToken)
+	if err != nil {
+		t.Fatalf("failed to parse id_token: %s", err)
+	}
+	if err := idToken.Validate(env.API.Config.Issuer, "some_client_id"); err != nil {
+		t.Errorf("failed to validate id_token: %s", err)
+	}
+	if idToken.Subject != "some_client_id" {
+		t.Errorf("unexpected subject: %#v", idToken.Subject)
+	}
+	if idToken.AuthTime != 0 {
+		t.Errorf("auth_time should not be set: %d", idToken.AuthTime)
+	}
+	if parts := strings.Split(rawIDToken, "."); len(parts) != 3 {
+		t.Errorf("id_token is invalid format: %#v", rawIDToken)
+	} else if payload, err := base64.RawURLEncoding.DecodeString(parts[1]); err != nil {
+		t.Errorf("failed to decode payload of id_token: %s", err)
+	} else {
+		var raw map[string]interface{}
+		if err := json.Unmarshal(payload, &raw); err != nil {
+			t.Errorf("failed to parse payload of id_token: %s", err)
+		} else if _, ok := raw["auth_time"]; ok {
+			t.Errorf("auth_time should be absent in id_token: %s", payload)
+		}
+	}
+	if idToken.ExtraClaims["service"] != "billing" {
+		t.Errorf("unexpected service claim: %#v", idToken.ExtraClaims)
+	}
+
+	accessToken, _ := body["access_token"].(string)
+	if idToken.AccessTokenHash != token.TokenHash(accessToken) {
+		t.Errorf("at_hash should match to access_token: %#v", idToken.AccessTokenHash)
+	}
+}
@@ -16,7 +16,7 @@ func (req *PostUserInfoRequest) Bind(c *gin.Context) *errors.Error {
 	if e := (&req.GetUserInfoRequest).Bind(c); e != nil {
 		return e
 	}
-	if err := c.ShouldBind(&req); err != nil {
+	if err := c.ShouldBind(req); err != nil {
 		return &errors.Error{
 			Err:         err,
 			Reason:      errors.InvalidToken,
@@ -29,6 +29,12 @@ func (req *PostUserInfoRequest) Bind(c *gin.Context) *errors.Error {
 func (req PostUserInfoRequest) GetToken() (string, *errors.Error) {
 	token, err := req.GetUserInfoRequest.GetToken()
 	if err == nil {
+		if req.AccessToken != "" {
+			return "", &errors.Error{
+				Reason:      errors.InvalidRequest,
+				Description: "access token must be sent by only one method",
+			}
+		}
 		return token, nil
 	}
 
@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/macrat/lauth/testutil"
+	"github.com/macrat/lauth/token"
 )
 
 func TestPostUserInfo_withHeader(t *testing.T) {
@@ -23,7 +24,8 @@ func TestPostUserInfo_withBody(t *testing.T) {
 		"macrat",
 		"some_client_id",
 		"openid email",
-		time.Now(),
+		"",
+		token.Authentication{Time: time.Now()},
 		10*time.Minute,
 	)
 	if err != nil {
@@ -47,18 +49,30 @@ func TestPostUserInfo_withBody(t *testing.T) {
 			Request: url.Values{
 				"access_token": {"hello world"},
 			},
-			Code: http.StatusForbidden,
+			Code: http.StatusUnauthorized,
 			Body: map[string]interface{}{
 				"error":             "invalid_token",
 				"error_description": "token is invalid",
 			},
 		},
+		{
+			Name: "both of header and body",
+			Request: url.Values{
+				"access_token": {token},
+			},
+			Token: "Bearer " + token,
+			Code:  http.StatusBadRequest,
+			Body: map[string]interface{}{
+				"error":             "invalid_request",
+				"error_description": "access token must be sent by only one method",
+			},
+		},
 		{
 			Name: "empty token",
 			Request: url.Values{
 				"access_token": {""},
 			},
-			Code: http.StatusForbidden,
+			Code: http.StatusUnauthorized,
 			Body: map[string]interface{}{
 				"error":             "invalid_token",
 				"error_description": "access token is required",
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Readiness is a gate that tells load balancers whether this instance can authenticate users.
+//
+// The zero value is not ready, and nil Readiness means always ready.
+type Readiness struct {
+	ready int32
+}
+
+func (r *Readiness) Ready() bool {
+	return r == nil || atomic.LoadInt32(&r.ready) != 0
+}
+
+func (r *Readiness) SetReady() {
+	atomic.StoreInt32(&r.ready, 1)
+}
+
+// WaitReady tries to connect to LDAP server each interval until succeeded, and then marks the instance ready.
+// It returns the last error if could not connect until the context is done.
+func (api *LauthAPI) WaitReady(ctx context.Context, interval time.Duration) error {
+	for {
+		sess, err := api.Connector.Connect()
+		if err == nil {
+			sess.Close()
+			api.Readiness.SetReady()
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(interval):
+		}
+	}
+}
+
+func (api *LauthAPI) GetReady(c *gin.Context) {
+	if api.Readiness.Ready() {
+		c.String(http.StatusOK, "OK")
+	} else {
+		c.String(http.StatusServiceUnavailable, "NOT READY")
+	}
+}
@@ -0,0 +1,85 @@
+package api_test
+
+import (
+	"context"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/api"
+	"github.com/macrat/lauth/ldap"
+	"github.com/macrat/lauth/testutil"
+)
+
+// flakyLDAP is a connector that is unavailable until failures reach zero.
+type flakyLDAP struct {
+	testutil.DummyLDAP
+
+	failures *int32
+}
+
+func (c flakyLDAP) Connect() (ldap.Session, error) {
+	if atomic.AddInt32(c.failures, -1) >= 0 {
+		return testutil.UnavailableLDAP{}.Connect()
+	}
+	return c.DummyLDAP.Connect()
+}
+
+func TestReadiness(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.App.GET("/readyz", env.API.GetReady)
+
+	check := func(t *testing.T, code int, body string) {
+		t.Helper()
+
+		resp := env.Get("/readyz", "", nil)
+		if resp.Code != code {
+			t.Errorf("expected status code %d but got %d", code, resp.Code)
+		}
+		if resp.Body.String() != body {
+			t.Errorf("unexpected body: %#v", resp.Body.String())
+		}
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		env.API.Readiness = nil
+		check(t, http.StatusOK, "OK")
+	})
+
+	t.Run("wait", func(t *testing.T) {
+		failures := int32(3)
+		env.API.Connector = flakyLDAP{env.API.Connector.(testutil.DummyLDAP), &failures}
+		env.API.Readiness = &api.Readiness{}
+
+		check(t, http.StatusServiceUnavailable, "NOT READY")
+
+		done := make(chan error)
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			done <- env.API.WaitReady(ctx, 10*time.Millisecond)
+		}()
+
+		if err := <-done; err != nil {
+			t.Fatalf("failed to get ready: %s", err)
+		}
+		if atomic.LoadInt32(&failures) >= 0 {
+			t.Errorf("ready before LDAP is available")
+		}
+		check(t, http.StatusOK, "OK")
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		env.API.Connector = testutil.UnavailableLDAP{}
+		env.API.Readiness = &api.Readiness{}
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		if err := env.API.WaitReady(ctx, 10*time.Millisecond); err == nil {
+			t.Errorf("expected error but succeeded")
+		}
+		check(t, http.StatusServiceUnavailable, "NOT READY")
+	})
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"sync"
+	"time"
+)
+
+// SessionClient is a client that the SSO session has authorized.
+type SessionClient struct {
+	ClientID     string `json:"client_id"`
+	AuthorizedAt int64  `json:"authorized_at"`
+}
+
+// SessionInfo is a summary of the SSO session.
+type SessionInfo struct {
+	ID        string          `json:"sid"`
+	Subject   string          `json:"sub"`
+	AuthTime  int64           `json:"auth_time"`
+	ExpiresAt int64           `json:"expires_at"`
+	Clients   []SessionClient `json:"clients"`
+}
+
+// SessionStore remembers the clients that each SSO session has authorized, keyed by the session ID (sid).
+// It is for administrators to inspect sessions, and for logout to know which clients to notify.
+//
+// This is an in-memory store, so it knows only the authorizations through this instance of lauth.
+// All methods do nothing if the store is nil.
+type SessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*SessionInfo
+	sweep    sweepSchedule
+}
+
+func NewSessionStore() *SessionStore {
+	return &SessionStore{
+		sessions: make(map[string]*SessionInfo),
+	}
+}
+
+// Record adds the client to the session, or updates the time that the client is authorized.
+// The session is created if it is the first authorization.
+func (s *SessionStore) Record(id, subject, clientID string, authTime, expiresAt time.Time) {
+	if s == nil || id == "" {
+		return
+	}
+
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sweep.due(now) {
+		for k, sess := range s.sessions {
+			if !now.Before(time.Unix(sess.ExpiresAt, 0)) {
+				delete(s.sessions, k)
+			}
+		}
+	}
+
+	sess, ok := s.sessions[id]
+	if !ok || !now.Before(time.Unix(sess.ExpiresAt, 0)) {
+		sess = &SessionInfo{
+			ID:      id,
+			Subject: subject,
+		}
+		s.sessions[id] = sess
+	}
+	sess.AuthTime = authTime.Unix()
+	sess.ExpiresAt = expiresAt.Unix()
+
+	for i, c := range sess.Clients {
+		if c.ClientID == clientID {
+			sess.Clients[i].AuthorizedAt = now.Unix()
+			return
+		}
+	}
+	sess.Clients = append(sess.Clients, SessionClient{
+		ClientID:     clientID,
+		AuthorizedAt: now.Unix(),
+	})
+}
+
+// Get returns a copy of the session.
+func (s *SessionStore) Get(id string) (SessionInfo, bool) {
+	if s == nil {
+		return SessionInfo{}, false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sess, ok := s.sessions[id]
+	if !ok || !time.Now().Before(time.Unix(sess.ExpiresAt, 0)) {
+		return SessionInfo{}, false
+	}
+
+	info := *sess
+	info.Clients = append([]SessionClient(nil), sess.Clients...)
+	return info, true
+}
+
+// Delete forgets the session, for logout.
+func (s *SessionStore) Delete(id string) {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, id)
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"github.com/macrat/lauth/token"
 )
 
@@ -11,22 +12,31 @@ const (
 	SSO_TOKEN_COOKIE = "lauth_token"
 )
 
+// SetSSOToken issues the SSO token that records the client as authorized.
+//
+// The current session is continued if the same user has it; its session ID (sid) and authorized clients are kept.
+// A new session starts if there is no session or the session is of another user.
 func (api *LauthAPI) SetSSOToken(c *gin.Context, subject, client string, authenticated bool) error {
 	authTime := time.Now()
 	expiresAt := time.Now().Add(api.Config.Expire.SSO.Duration())
+	sessionID := uuid.New().String()
 	azp := token.AuthorizedParties{client}
 
-	if current, err := api.GetSSOToken(c); err == nil {
+	if current, err := api.GetSSOToken(c); err == nil && current.Subject == subject {
 		if !authenticated {
 			authTime = time.Unix(current.AuthTime, 0)
 			expiresAt = time.Unix(current.ExpiresAt, 0)
 		}
+		if current.SessionID != "" {
+			sessionID = current.SessionID
+		}
 		azp = current.Authorized.Append(client)
 	}
 
 	token, err := api.TokenManager.CreateSSOToken(
 		api.Config.Issuer,
 		subject,
+		sessionID,
 		azp,
 		authTime,
 		expiresAt,
@@ -35,6 +45,8 @@ func (api *LauthAPI) SetSSOToken(c *gin.Context, subject, client string, authent
 		return err
 	}
 
+	api.Sessions.Record(sessionID, subject, client, authTime, expiresAt)
+
 	secure := api.Config.Issuer.Scheme == "https"
 	c.SetCookie(
 		SSO_TOKEN_COOKIE,
@@ -69,6 +81,10 @@ func (api *LauthAPI) GetSSOToken(c *gin.Context) (token.SSOTokenClaims, error) {
 }
 
 func (api *LauthAPI) DeleteSSOToken(c *gin.Context) {
+	if current, err := api.GetSSOToken(c); err == nil {
+		api.Sessions.Delete(current.SessionID)
+	}
+
 	secure := api.Config.Issuer.Scheme == "https"
 	c.SetCookie(SSO_TOKEN_COOKIE, "", 0, "/", api.Config.Issuer.Hostname(), secure, true)
 }
@@ -28,6 +28,16 @@ func (ss StringSet) List() []string {
 	return []string(ss)
 }
 
+// hasEquivalentSet reports whether ss includes a space separated value that is the same set as other.
+func (ss StringSet) hasEquivalentSet(other *StringSet) bool {
+	for _, s := range ss {
+		if ParseStringSet(s).String() == other.String() {
+			return true
+		}
+	}
+	return false
+}
+
 func (ss StringSet) Has(value string) bool {
 	for _, s := range ss {
 		if s == value {
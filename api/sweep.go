@@ -0,0 +1,25 @@
+package api
+
+import (
+	"time"
+)
+
+// sweepInterval is how often in-memory stores drop expired entries.
+// Lookups ignore expired entries anyway, so sweeping is only for keeping the memory usage small.
+const sweepInterval = time.Minute
+
+// sweepSchedule decides when a store drops expired entries.
+// It makes the cost of scanning all entries amortized, instead of paying it on every request.
+// It is not thread-safe, so use it under the lock of the store.
+type sweepSchedule struct {
+	next time.Time
+}
+
+// due reports whether it is time to sweep, and schedules the next sweep if so.
+func (s *sweepSchedule) due(now time.Time) bool {
+	if now.Before(s.next) {
+		return false
+	}
+	s.next = now.Add(sweepInterval)
+	return true
+}
@@ -1,22 +1,44 @@
 package api
 
 import (
+	"fmt"
 	"net/http"
+	"sort"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/macrat/lauth/config"
 	"github.com/macrat/lauth/errors"
+	"github.com/macrat/lauth/ldap"
 	"github.com/macrat/lauth/metrics"
+	"github.com/macrat/lauth/token"
 	"github.com/rs/zerolog/log"
 )
 
-func (api *LauthAPI) userinfo(subject string, scope *StringSet) (map[string]interface{}, *errors.Error) {
+func (api *LauthAPI) ldapUnavailable(err error) *errors.Error {
+	return &errors.Error{
+		Err:         err,
+		Reason:      errors.TemporarilyUnavailable,
+		Description: "LDAP server is unavailable",
+		RetryAfter:  api.Config.LDAP.RetryAfter.Duration(),
+	}
+}
+
+// userinfo returns claims of the user for the scope in the format for the client.
+// The claims that don't match the value or values of the claims parameter are removed.
+func (api *LauthAPI) userinfo(clientID, subject string, scope *StringSet, requested token.ClaimRequests) (map[string]interface{}, *errors.Error) {
+	maps := api.Config.Scopes.ClaimMapFor(scope.List())
+	attrs := api.Config.Scopes.AttributesFor(scope.List())
+
 	conn, err := api.Connector.Connect()
 	if err != nil {
 		log.Error().
 			Err(err).
 			Msg("failed to connecting LDAP server")
 
+		if ldap.IsUnavailable(err) {
+			return nil, api.ldapUnavailable(err)
+		}
 		return nil, &errors.Error{
 			Err:         err,
 			Reason:      errors.ServerError,
@@ -25,8 +47,10 @@ func (api *LauthAPI) userinfo(subject string, scope *StringSet) (map[string]inte
 	}
 	defer conn.Close()
 
-	attrs, err := conn.GetUserAttributes(subject, api.Config.Scopes.AttributesFor(scope.List()))
-	if err != nil {
+	values, err := conn.GetUserAttributes(subject, attrs)
+	if ldap.IsUnavailable(err) {
+		return nil, api.ldapUnavailable(err)
+	} else if err != nil {
 		return nil, &errors.Error{
 			Err:         err,
 			Reason:      errors.InvalidToken,
@@ -34,13 +58,123 @@ func (api *LauthAPI) userinfo(subject string, scope *StringSet) (map[string]inte
 		}
 	}
 
-	maps := api.Config.Scopes.ClaimMapFor(scope.List())
-	result := config.MappingClaims(attrs, maps)
+	result := config.MappingClaims(values, api.Config.Clients[clientID].OverrideClaims(maps))
+	requested.Filter(result)
 	result["sub"] = subject
 
+	for name, r := range requested {
+		if _, ok := result[name]; !ok && r != nil && r.Essential {
+			log.Debug().
+				Str("client_id", clientID).
+				Str("claim", name).
+				Msg("essential claim is requested but not available")
+		}
+	}
+
 	return result, nil
 }
 
+// claimsScope adds scopes that produce claims individually requested by the claims parameter, to the requested scope.
+// The claims are released only through the scopes, so they go through the same checks as scopes, like consent of the user and max_scopes.
+// The scopes are taken only from ones that the client is allowed, not optional, and allowed in the implicit/hybrid flow if it is used.
+func (api *LauthAPI) claimsScope(clientID string, rt, scope *StringSet, requested *token.ClaimsRequest) *StringSet {
+	if requested.Len() == 0 {
+		return scope
+	}
+
+	produced := make(map[string]bool)
+	for _, claims := range api.Config.Scopes.ClaimMapFor(scope.List()) {
+		for _, c := range claims {
+			produced[c.Claim] = true
+		}
+	}
+	var names []string
+	for _, name := range append(requested.ForUserinfo().Names(), requested.ForIDToken().Names()...) {
+		if !produced[name] {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return scope
+	}
+
+	client := api.Config.Clients[clientID]
+	implicit := StringSet(api.Config.ImplicitScopes)
+	var candidates []string
+	for _, name := range api.Config.Scopes.ScopeNames() {
+		if api.Config.Scopes[name].Optional || !client.AllowScope(name) {
+			continue
+		}
+		if rt.String() != "code" && len(implicit) > 0 && !implicit.Has(name) {
+			continue
+		}
+		candidates = append(candidates, name)
+	}
+	sort.Strings(candidates)
+
+	extended := ParseStringSet(scope.String())
+	for _, s := range api.Config.Scopes.ScopesForClaims(candidates, names) {
+		extended.Add(s)
+	}
+	return ParseStringSet(extended.String())
+}
+
+// clientScope returns scopes that the client is allowed to receive, dropping the others.
+func (api *LauthAPI) clientScope(clientID string, scope *StringSet) *StringSet {
+	client := api.Config.Clients[clientID]
+
+	allowed := new(StringSet)
+	for _, s := range scope.List() {
+		if client.AllowScope(s) {
+			allowed.Add(s)
+		}
+	}
+	return allowed
+}
+
+// grantedScope returns scopes that actually granted to the user.
+//
+// If ScopeAttribute of LDAP is set, requested scopes are granted only if it is openid, configured in the scope settings, or listed in the attribute of the user.
+// Otherwise, it returns requested scopes as is.
+func (api *LauthAPI) grantedScope(subject string, requested *StringSet) (*StringSet, *errors.Error) {
+	attr := api.Config.LDAP.ScopeAttribute
+	if attr == "" {
+		return requested, nil
+	}
+
+	conn, err := api.Connector.Connect()
+	if ldap.IsUnavailable(err) {
+		return nil, api.ldapUnavailable(err)
+	} else if err != nil {
+		return nil, &errors.Error{
+			Err:         err,
+			Reason:      errors.ServerError,
+			Description: "failed to get user info",
+		}
+	}
+	defer conn.Close()
+
+	attrs, err := conn.GetUserAttributes(subject, []string{attr})
+	if ldap.IsUnavailable(err) {
+		return nil, api.ldapUnavailable(err)
+	} else if err != nil {
+		return nil, &errors.Error{
+			Err:         err,
+			Reason:      errors.AccessDenied,
+			Description: "user was not found or disabled",
+		}
+	}
+	entitlements := StringSet(attrs[attr])
+
+	granted := new(StringSet)
+	for _, s := range requested.List() {
+		if _, ok := api.Config.Scopes[s]; ok || s == "openid" || entitlements.Has(s) {
+			granted.Add(s)
+		}
+	}
+	return granted, nil
+}
+
 func (api *LauthAPI) sendUserInfo(c *gin.Context, report *metrics.Context, origin, rawToken string) {
 	token, err := api.TokenManager.ParseAccessToken(rawToken)
 	if err == nil {
@@ -65,6 +199,17 @@ func (api *LauthAPI) sendUserInfo(c *gin.Context, report *metrics.Context, origi
 		return
 	}
 
+	// The subject of the token by client_credentials is the client, so it must not be looked up in LDAP.
+	if token.ClientCredentials {
+		e := &errors.Error{
+			Reason:      errors.InvalidToken,
+			Description: "token is issued for the client, not for any user",
+		}
+		report.SetError(e)
+		errors.SendJSON(c, e)
+		return
+	}
+
 	if origin != "" {
 		client := api.Config.Clients[clientID]
 		if client.CORSOrigin.Match(origin) {
@@ -81,13 +226,36 @@ func (api *LauthAPI) sendUserInfo(c *gin.Context, report *metrics.Context, origi
 	}
 
 	scope := ParseStringSet(token.Scope)
-	info, e := api.userinfo(token.Subject, scope)
+	for _, s := range api.Config.UserinfoScopes {
+		if !scope.Has(s) {
+			e := &errors.Error{
+				Reason:      errors.InsufficientScope,
+				Description: fmt.Sprintf("%s scope is required to read userinfo", s),
+				Scope:       strings.Join(api.Config.UserinfoScopes, " "),
+			}
+			report.SetError(e)
+			errors.SendJSON(c, e)
+			return
+		}
+	}
+
+	info, e := api.userinfo(clientID, token.Subject, scope, token.Claims)
 	if e != nil {
 		report.SetError(e)
 		errors.SendJSON(c, e)
 		return
 	}
 
+	if api.Config.AuthContextClaims {
+		info["auth_time"] = token.AuthTime
+		if token.ACR != "" {
+			info["acr"] = token.ACR
+		}
+		if len(token.AMR) > 0 {
+			info["amr"] = token.AMR
+		}
+	}
+
 	report.Success()
 	c.JSON(http.StatusOK, info)
 }
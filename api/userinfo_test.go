@@ -2,11 +2,15 @@ package api_test
 
 import (
 	"bytes"
+	"encoding/json"
 	"net/http"
+	"reflect"
 	"testing"
 	"time"
 
+	"github.com/macrat/lauth/config"
 	"github.com/macrat/lauth/testutil"
+	"github.com/macrat/lauth/token"
 )
 
 func UserInfoCommonTests(t *testing.T, env *testutil.APITestEnvironment) []testutil.JSONTest {
@@ -15,7 +19,8 @@ func UserInfoCommonTests(t *testing.T, env *testutil.APITestEnvironment) []testu
 		"macrat",
 		"some_client_id",
 		"openid",
-		time.Now(),
+		"",
+		token.Authentication{Time: time.Now()},
 		10*time.Minute,
 	)
 	if err != nil {
@@ -27,7 +32,8 @@ func UserInfoCommonTests(t *testing.T, env *testutil.APITestEnvironment) []testu
 		"macrat",
 		"some_client_id",
 		"openid profile email",
-		time.Now(),
+		"",
+		token.Authentication{Time: time.Now()},
 		10*time.Minute,
 	)
 	if err != nil {
@@ -39,7 +45,8 @@ func UserInfoCommonTests(t *testing.T, env *testutil.APITestEnvironment) []testu
 		"nobody",
 		"some_client_id",
 		"openid profile",
-		time.Now(),
+		"",
+		token.Authentication{Time: time.Now()},
 		10*time.Minute,
 	)
 	if err != nil {
@@ -70,7 +77,7 @@ func UserInfoCommonTests(t *testing.T, env *testutil.APITestEnvironment) []testu
 		{
 			Name:  "invalid bearer token",
 			Token: "Bearer invalid token",
-			Code:  http.StatusForbidden,
+			Code:  http.StatusUnauthorized,
 			Body: map[string]interface{}{
 				"error":             "invalid_token",
 				"error_description": "token is invalid",
@@ -78,7 +85,7 @@ func UserInfoCommonTests(t *testing.T, env *testutil.APITestEnvironment) []testu
 		},
 		{
 			Name: "no set authorization header",
-			Code: http.StatusForbidden,
+			Code: http.StatusUnauthorized,
 			Body: map[string]interface{}{
 				"error":             "invalid_token",
 				"error_description": "access token is required",
@@ -87,7 +94,7 @@ func UserInfoCommonTests(t *testing.T, env *testutil.APITestEnvironment) []testu
 		{
 			Name:  "set empty authorization header",
 			Token: "",
-			Code:  http.StatusForbidden,
+			Code:  http.StatusUnauthorized,
 			Body: map[string]interface{}{
 				"error":             "invalid_token",
 				"error_description": "access token is required",
@@ -96,7 +103,7 @@ func UserInfoCommonTests(t *testing.T, env *testutil.APITestEnvironment) []testu
 		{
 			Name:  "using basic auth",
 			Token: "Basic c29tZV9jbGllbnRfaWQ6c2VjcmV0IGZvciBzb21lLWNsaWVudA==",
-			Code:  http.StatusForbidden,
+			Code:  http.StatusUnauthorized,
 			Body: map[string]interface{}{
 				"error":             "invalid_token",
 				"error_description": "access token is required",
@@ -105,7 +112,7 @@ func UserInfoCommonTests(t *testing.T, env *testutil.APITestEnvironment) []testu
 		{
 			Name:  "not registered user token",
 			Token: "Bearer " + nobodyToken,
-			Code:  http.StatusForbidden,
+			Code:  http.StatusUnauthorized,
 			Body: map[string]interface{}{
 				"error":             "invalid_token",
 				"error_description": "user was not found or disabled",
@@ -177,7 +184,8 @@ func TestUserinfoCORS(t *testing.T) {
 						"macrat",
 						tt.ClientID,
 						"openid",
-						time.Now(),
+						"",
+						token.Authentication{Time: time.Now()},
 						10*time.Minute,
 					)
 					if err != nil {
@@ -208,3 +216,123 @@ func TestUserinfoCORS(t *testing.T) {
 		})
 	}
 }
+
+func TestUserinfo_LDAPUnavailable(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Connector = testutil.UnavailableLDAP{}
+	env.API.Config.LDAP.RetryAfter = config.Duration(30 * time.Second)
+
+	token, err := env.API.TokenManager.CreateAccessToken(
+		env.API.Config.Issuer,
+		"macrat",
+		"some_client_id",
+		"openid",
+		"",
+		token.Authentication{Time: time.Now()},
+		10*time.Minute,
+	)
+	if err != nil {
+		t.Fatalf("failed to generate access_token: %s", err)
+	}
+
+	for _, method := range []string{"GET", "POST"} {
+		t.Run(method, func(t *testing.T) {
+			resp := env.Do(method, "/userinfo", "Bearer "+token, nil)
+
+			if resp.Code != http.StatusServiceUnavailable {
+				t.Errorf("expected status code 503 but got %d", resp.Code)
+			}
+			if retryAfter := resp.Header().Get("Retry-After"); retryAfter != "30" {
+				t.Errorf("unexpected Retry-After header: %#v", retryAfter)
+			}
+		})
+	}
+}
+
+func TestUserinfo_ClaimOverrides(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Connector = testutil.DummyLDAP{
+		"macrat": testutil.DummyUserInfo{
+			Password: "foobar",
+			Attributes: map[string][]string{
+				"memberOf": {"admin", "developer"},
+			},
+		},
+	}
+
+	client := env.API.Config.Clients["implicit_client_id"]
+	client.ClaimOverrides = map[string]config.ClaimOverride{
+		"groups": {Separator: " "},
+	}
+	env.API.Config.Clients["implicit_client_id"] = client
+
+	tests := []struct {
+		ClientID string
+		Expect   interface{}
+	}{
+		{"some_client_id", []interface{}{"admin", "developer"}},
+		{"implicit_client_id", "admin developer"},
+	}
+
+	for _, tt := range tests {
+		token, err := env.API.TokenManager.CreateAccessToken(
+			env.API.Config.Issuer,
+			"macrat",
+			tt.ClientID,
+			"openid groups",
+			"",
+			token.Authentication{Time: time.Now()},
+			10*time.Minute,
+		)
+		if err != nil {
+			t.Fatalf("%s: failed to generate access_token: %s", tt.ClientID, err)
+		}
+
+		resp := env.Get("/userinfo", "Bearer "+token, nil)
+		if resp.Code != http.StatusOK {
+			t.Errorf("%s: unexpected status code: %d", tt.ClientID, resp.Code)
+			continue
+		}
+
+		var body map[string]interface{}
+		if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%s: failed to unmarshal response body: %s", tt.ClientID, err)
+		}
+		if !reflect.DeepEqual(body["groups"], tt.Expect) {
+			t.Errorf("%s: unexpected groups: %#v", tt.ClientID, body["groups"])
+		}
+	}
+}
+
+func TestUserinfo_OpenIDOnly(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+
+	for _, scope := range []string{"openid", "openid unknown-scope"} {
+		token, err := env.API.TokenManager.CreateAccessToken(
+			env.API.Config.Issuer,
+			"macrat",
+			"some_client_id",
+			scope,
+			"",
+			token.Authentication{Time: time.Now()},
+			10*time.Minute,
+		)
+		if err != nil {
+			t.Fatalf("%#v: failed to generate access_token: %s", scope, err)
+		}
+
+		resp := env.Get("/userinfo", "Bearer "+token, nil)
+		if resp.Code != http.StatusOK {
+			t.Errorf("%#v: unexpected status code: %d", scope, resp.Code)
+			continue
+		}
+
+		var body map[string]interface{}
+		if err := json.Unmarshal(resp.Body.Bytes(), &body); err != nil {
+			t.Fatalf("%#v: failed to unmarshal response body: %s", scope, err)
+		}
+		if !reflect.DeepEqual(body, map[string]interface{}{"sub": "macrat"}) {
+			t.Errorf("%#v: unexpected response: %#v", scope, body)
+		}
+	}
+}
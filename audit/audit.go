@@ -0,0 +1,138 @@
+package audit
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Action string
+
+const (
+	Login    Action = "login"
+	SSOLogin Action = "sso_login"
+	Consent  Action = "consent"
+	Token    Action = "token"
+	Logout   Action = "logout"
+	Revoke   Action = "revoke"
+)
+
+const (
+	FORMAT_JSON = "json"
+	FORMAT_TEXT = "text"
+
+	RESULT_SUCCESS = "success"
+	RESULT_FAILURE = "failure"
+)
+
+type Event struct {
+	Time       time.Time `json:"time"`
+	Action     Action    `json:"action"`
+	Result     string    `json:"result"`
+	Subject    string    `json:"subject,omitempty"`
+	ClientID   string    `json:"client_id,omitempty"`
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+	RequestID  string    `json:"request_id,omitempty"`
+	Scope      string    `json:"scope,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// Logger writes audit events into a sink that separated from operational logs.
+//
+// The nil Logger is valid and discards all events.
+type Logger struct {
+	sync.Mutex
+
+	Writer io.Writer
+	Format string
+
+	// HashKey is the key to hash PII. PII is written as is if it is empty.
+	HashKey []byte
+}
+
+func NewLogger(w io.Writer, format string, hashKey []byte) *Logger {
+	if format == "" {
+		format = FORMAT_JSON
+	}
+	return &Logger{
+		Writer:  w,
+		Format:  format,
+		HashKey: hashKey,
+	}
+}
+
+// HashValue returns HMAC-SHA256 of value by key in hex, or empty string if value is empty.
+// The key prevents to reverse usernames or IP addresses by a dictionary.
+func HashValue(key []byte, value string) string {
+	if value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (e Event) text() string {
+	fields := []struct {
+		Key   string
+		Value string
+	}{
+		{"action", string(e.Action)},
+		{"result", e.Result},
+		{"subject", e.Subject},
+		{"client_id", e.ClientID},
+		{"remote_addr", e.RemoteAddr},
+		{"request_id", e.RequestID},
+		{"scope", e.Scope},
+		{"error", e.Error},
+	}
+
+	var b strings.Builder
+	b.WriteString(e.Time.Format(time.RFC3339))
+	for _, f := range fields {
+		if f.Value != "" {
+			fmt.Fprintf(&b, " %s=%q", f.Key, f.Value)
+		}
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// Emit writes an event.
+// If HashKey is set, the subject and the remote address are replaced by their hashes.
+func (l *Logger) Emit(e Event) error {
+	if l == nil || l.Writer == nil {
+		return nil
+	}
+
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+	if len(l.HashKey) > 0 {
+		e.Subject = HashValue(l.HashKey, e.Subject)
+		e.RemoteAddr = HashValue(l.HashKey, e.RemoteAddr)
+	}
+
+	var line []byte
+	if l.Format == FORMAT_TEXT {
+		line = []byte(e.text())
+	} else {
+		raw, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		line = append(raw, '\n')
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	_, err := l.Writer.Write(line)
+	return err
+}
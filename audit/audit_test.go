@@ -0,0 +1,94 @@
+package audit_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/audit"
+)
+
+func TestLogger(t *testing.T) {
+	event := audit.Event{
+		Time:       time.Date(2021, 1, 2, 3, 4, 5, 0, time.UTC),
+		Action:     audit.Login,
+		Result:     audit.RESULT_SUCCESS,
+		Subject:    "macrat",
+		ClientID:   "some_client_id",
+		RemoteAddr: "127.0.0.1",
+	}
+
+	tests := []struct {
+		Format  string
+		HashKey []byte
+		Output  string
+	}{
+		{
+			Format: audit.FORMAT_JSON,
+			Output: `{"time":"2021-01-02T03:04:05Z","action":"login","result":"success","subject":"macrat","client_id":"some_client_id","remote_addr":"127.0.0.1"}` + "\n",
+		},
+		{
+			Format: audit.FORMAT_TEXT,
+			Output: `2021-01-02T03:04:05Z action="login" result="success" subject="macrat" client_id="some_client_id" remote_addr="127.0.0.1"` + "\n",
+		},
+		{
+			Format:  audit.FORMAT_TEXT,
+			HashKey: []byte("secret key for hashing PII"),
+			Output:  `2021-01-02T03:04:05Z action="login" result="success" subject="` + audit.HashValue([]byte("secret key for hashing PII"), "macrat") + `" client_id="some_client_id" remote_addr="` + audit.HashValue([]byte("secret key for hashing PII"), "127.0.0.1") + `"` + "\n",
+		},
+	}
+
+	for _, tt := range tests {
+		buf := new(bytes.Buffer)
+		logger := audit.NewLogger(buf, tt.Format, tt.HashKey)
+
+		if err := logger.Emit(event); err != nil {
+			t.Errorf("%s/%v: failed to emit: %s", tt.Format, tt.HashKey != nil, err)
+			continue
+		}
+
+		if buf.String() != tt.Output {
+			t.Errorf("%s/%v: unexpected output\nexpected: %s\n but got: %s", tt.Format, tt.HashKey != nil, tt.Output, buf.String())
+		}
+	}
+}
+
+func TestLogger_DefaultValues(t *testing.T) {
+	var nilLogger *audit.Logger
+	if err := nilLogger.Emit(audit.Event{Action: audit.Logout}); err != nil {
+		t.Errorf("nil logger should discard events but got error: %s", err)
+	}
+
+	buf := new(bytes.Buffer)
+	if err := audit.NewLogger(buf, "", nil).Emit(audit.Event{Action: audit.Logout}); err != nil {
+		t.Fatalf("failed to emit: %s", err)
+	}
+
+	var event audit.Event
+	if err := json.Unmarshal(buf.Bytes(), &event); err != nil {
+		t.Fatalf("default format should be JSON but failed to parse: %s", err)
+	}
+	if event.Time.IsZero() {
+		t.Errorf("time should be set automatically")
+	}
+}
+
+func TestHashValue(t *testing.T) {
+	key := []byte("secret key for hashing PII")
+
+	if h := audit.HashValue(key, ""); h != "" {
+		t.Errorf("hash of empty value should be empty but got %#v", h)
+	}
+	if h := audit.HashValue(key, "macrat"); len(h) != 64 || h == audit.HashValue(key, "someone") {
+		t.Errorf("unexpected hash: %#v", h)
+	}
+
+	// HMAC-SHA256 by the key, not plain SHA-256 that can be reversed by a dictionary.
+	if h := audit.HashValue(key, "macrat"); h != "eb3f3f516128a44e06aebadff6a10e04f0bd370ecc3e1d41b06e092809da8e7d" {
+		t.Errorf("unexpected HMAC: %#v", h)
+	}
+	if audit.HashValue(key, "macrat") == audit.HashValue([]byte("another key for hashing PII"), "macrat") {
+		t.Errorf("hash should depend on the key")
+	}
+}
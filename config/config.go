@@ -6,75 +6,341 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
 	"path"
 	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/mitchellh/mapstructure"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
+	"golang.org/x/crypto/bcrypt"
 )
 
 var (
 	DefaultScopes = ScopeConfig{
-		"profile": []ClaimConfig{
+		"profile": Scope{Claims: []ClaimConfig{
 			{Claim: "name", Attribute: "displayName", Type: "string"},
 			{Claim: "given_name", Attribute: "givenName", Type: "string"},
 			{Claim: "family_name", Attribute: "sn", Type: "string"},
-		},
-		"email": []ClaimConfig{
+		}},
+		"email": Scope{Claims: []ClaimConfig{
 			{Claim: "email", Attribute: "mail", Type: "string"},
-		},
-		"phone": []ClaimConfig{
+		}},
+		"phone": Scope{Claims: []ClaimConfig{
 			{Claim: "phone_number", Attribute: "telephoneNumber", Type: "string"},
-		},
-		"groups": []ClaimConfig{
+		}},
+		"groups": Scope{Claims: []ClaimConfig{
 			{Claim: "groups", Attribute: "memberOf", Type: "[]string"},
-		},
+		}},
 	}
 )
 
 type ClaimConfig struct {
-	Claim     string    `json:"claim"          yaml:"claim"          toml:"claim"`
-	Attribute string    `json:"attribute"      yaml:"attribute"      toml:"attribute"`
-	Type      ClaimType `json:"type,omitempty" yaml:"type,omitempty" toml:"type,omitempty"`
+	Claim     string        `json:"claim"               yaml:"claim"               toml:"claim"`
+	Attribute string        `json:"attribute"           yaml:"attribute"           toml:"attribute"`
+	Type      ClaimType     `json:"type,omitempty"      yaml:"type,omitempty"      toml:"type,omitempty"`
+	Separator string        `json:"separator,omitempty" yaml:"separator,omitempty" toml:"separator,omitempty"`
+	Default   string        `json:"default,omitempty"   yaml:"default,omitempty"   toml:"default,omitempty"`
+	Prefix    string        `json:"prefix,omitempty"    yaml:"prefix,omitempty"    toml:"prefix,omitempty"`
+	Match     Regexp        `json:"match,omitempty"     yaml:"match,omitempty"     toml:"match,omitempty"`
+	Fallback  []string      `json:"fallback,omitempty"  yaml:"fallback,omitempty"  toml:"fallback,omitempty"`
+	Template  ClaimTemplate `json:"template,omitempty"  yaml:"template,omitempty"  toml:"template,omitempty"`
 }
 
-type ScopeConfig map[string][]ClaimConfig
+// ClaimOverride changes the format of a claim for a client.
+type ClaimOverride struct {
+	Type      ClaimType `json:"type,omitempty"      yaml:"type,omitempty"      toml:"type,omitempty"`
+	Separator string    `json:"separator,omitempty" yaml:"separator,omitempty" toml:"separator,omitempty"`
+}
+
+// Scope is a configuration of a scope.
+//
+// Title, Description, and Icon are used only for displaying on the consent page.
+type Scope struct {
+	Title       string        `json:"title,omitempty"       yaml:"title,omitempty"       toml:"title,omitempty"`
+	Description string        `json:"description,omitempty" yaml:"description,omitempty" toml:"description,omitempty"`
+	Icon        string        `json:"icon,omitempty"        yaml:"icon,omitempty"        toml:"icon,omitempty"`
+	Optional    bool          `json:"optional,omitempty"    yaml:"optional,omitempty"    toml:"optional,omitempty"`
+	Preselected bool          `json:"preselected,omitempty" yaml:"preselected,omitempty" toml:"preselected,omitempty"`
+	Claims      []ClaimConfig `json:"claims"                yaml:"claims"                toml:"claims"`
+}
+
+type ScopeConfig map[string]Scope
 
 type EndpointConfig struct {
-	Authz    string `json:"authorization" yaml:"authorization" toml:"authorization" flag:"authz-endpoint"`
-	Token    string `json:"token"         yaml:"token"         toml:"token"         flag:"token-endpoint"`
-	Userinfo string `json:"userinfo"      yaml:"userinfo"      toml:"userinfo"      flag:"userinfo-endpoint"`
-	Jwks     string `json:"jwks"          yaml:"jwks"          toml:"jwks"          flag:"jwks-uri"`
-	Logout   string `json:"logout"        yaml:"logout"        toml:"logout"        flag:"logout-endpoint"`
+	Authz         string `json:"authorization" yaml:"authorization" toml:"authorization" flag:"authz-endpoint"`
+	Token         string `json:"token"         yaml:"token"         toml:"token"         flag:"token-endpoint"`
+	Userinfo      string `json:"userinfo"      yaml:"userinfo"      toml:"userinfo"      flag:"userinfo-endpoint"`
+	Jwks          string `json:"jwks"          yaml:"jwks"          toml:"jwks"          flag:"jwks-uri"`
+	Logout        string `json:"logout"        yaml:"logout"        toml:"logout"        flag:"logout-endpoint"`
+	Introspection string `json:"introspection" yaml:"introspection" toml:"introspection" flag:"introspection-endpoint"`
+	Revocation    string `json:"revocation"    yaml:"revocation"    toml:"revocation"    flag:"revocation-endpoint"`
 }
 
 type ExpireConfig struct {
-	Login   Duration `json:"login"   yaml:"login"   toml:"login"   flag:"login-expire"`
-	Code    Duration `json:"code"    yaml:"code"    toml:"code"    flag:"code-expire"`
-	Token   Duration `json:"token"   yaml:"token"   toml:"token"   flag:"token-expire"`
-	Refresh Duration `json:"refresh" yaml:"refresh" toml:"refresh" flag:"refresh-expire"`
-	SSO     Duration `json:"sso"     yaml:"sso"     toml:"sso"     flag:"sso-expire"`
+	Login            Duration `json:"login"                        yaml:"login"                        toml:"login"                        flag:"login-expire"`
+	Code             Duration `json:"code"                         yaml:"code"                         toml:"code"                         flag:"code-expire"`
+	Token            Duration `json:"token"                        yaml:"token"                        toml:"token"                        flag:"token-expire"`
+	Refresh          Duration `json:"refresh"                      yaml:"refresh"                      toml:"refresh"                      flag:"refresh-expire"`
+	SSO              Duration `json:"sso"                          yaml:"sso"                          toml:"sso"                          flag:"sso-expire"`
+	SignKeyOverlap   Duration `json:"sign_key_overlap"             yaml:"sign_key_overlap"             toml:"sign_key_overlap"             flag:"sign-key-overlap"`
+	MaxClientCode    Duration `json:"max_client_code,omitempty"    yaml:"max_client_code,omitempty"    toml:"max_client_code,omitempty"    flag:"max-client-code-expire"`
+	MaxClientToken   Duration `json:"max_client_token,omitempty"   yaml:"max_client_token,omitempty"   toml:"max_client_token,omitempty"   flag:"max-client-token-expire"`
+	MaxClientRefresh Duration `json:"max_client_refresh,omitempty" yaml:"max_client_refresh,omitempty" toml:"max_client_refresh,omitempty" flag:"max-client-refresh-expire"`
 }
 
+// ClientExpireConfig overrides ExpireConfig for a client.
+// Omitted or zero values mean to use the global ones.
+type ClientExpireConfig struct {
+	Code    Duration `json:"code,omitempty"    yaml:"code,omitempty"    toml:"code,omitempty"`
+	Token   Duration `json:"token,omitempty"   yaml:"token,omitempty"   toml:"token,omitempty"`
+	Refresh Duration `json:"refresh,omitempty" yaml:"refresh,omitempty" toml:"refresh,omitempty"`
+}
+
+const (
+	AUTH_METHOD_CLIENT_SECRET_BASIC = "client_secret_basic"
+	AUTH_METHOD_CLIENT_SECRET_POST  = "client_secret_post"
+	AUTH_METHOD_CLIENT_SECRET_JWT   = "client_secret_jwt"
+	AUTH_METHOD_PRIVATE_KEY_JWT     = "private_key_jwt"
+	AUTH_METHOD_NONE                = "none"
+
+	// ACR_SSO is the authentication context class that the user authenticated by the SSO session.
+	ACR_SSO = "0"
+
+	// ACR_PASSWORD is the authentication context class that the user entered password in the current request.
+	ACR_PASSWORD = "1"
+
+	// AMR_PASSWORD is the authentication method reference of the password authentication. (RFC 8176)
+	// It is the only method of lauth, so it is also reported for the SSO session that authenticated by password.
+	AMR_PASSWORD = "pwd"
+)
+
+const (
+	JTI_FORMAT_UUID   = "uuid"
+	JTI_FORMAT_RANDOM = "random"
+
+	// MinJTILength is the minimum length of random jti, that has 132 bits entropy as more than UUIDv4 has.
+	MinJTILength = 22
+)
+
+const (
+	// MinAssertionSecretLength is the minimum length of the shared secret for client_secret_jwt, that is the same as the output size of HS256.
+	MinAssertionSecretLength = 32
+
+	// MinAuditHashKeyLength is the minimum length of the key to hash PII in audit events.
+	MinAuditHashKeyLength = 32
+)
+
+const (
+	CODE_CHALLENGE_METHOD_PLAIN = "plain"
+	CODE_CHALLENGE_METHOD_S256  = "S256"
+)
+
+var (
+	// AccessLogEndpoints are endpoints that the level of access logs can be configured.
+	AccessLogEndpoints = []string{"authz", "token", "userinfo", "introspect", "revoke", "logout"}
+
+	// AccessLogLevels are levels that can be used for access logs of successful requests.
+	AccessLogLevels = []string{"trace", "debug", "info", "disabled"}
+)
+
+var (
+	DefaultTokenEndpointAuthMethods = []string{AUTH_METHOD_CLIENT_SECRET_POST, AUTH_METHOD_CLIENT_SECRET_BASIC}
+	SupportedResponseModes          = []string{"query", "fragment", "form_post"}
+	SupportedACRValues              = []string{ACR_SSO, ACR_PASSWORD}
+	SupportedCodeChallengeMethods   = []string{CODE_CHALLENGE_METHOD_S256, CODE_CHALLENGE_METHOD_PLAIN}
+)
+
 type ClientConfig struct {
-	Name              string     `json:"name"                yaml:"name"                toml:"name"`
-	IconURL           string     `json:"icon_url"            yaml:"icon_url"            toml:"icon_url"`
-	Secret            string     `json:"secret"              yaml:"secret"              toml:"secret"`
-	RedirectURI       PatternSet `json:"redirect_uri"        yaml:"redirect_uri"        toml:"redirect_uri"`
-	CORSOrigin        PatternSet `json:"cors_origin"         yaml:"cors_origin"         toml:"cors_origin"`
-	AllowImplicitFlow bool       `json:"allow_implicit_flow" yaml:"allow_implicit_flow" toml:"allow_implicit_flow"`
-	RequestKey        string     `json:"request_key"         yaml:"request_key"         toml:"request_key"`
+	Name                     string                   `json:"name"                                  yaml:"name"                                  toml:"name"`
+	IconURL                  string                   `json:"icon_url"                              yaml:"icon_url"                              toml:"icon_url"`
+	Secret                   string                   `json:"secret"                                yaml:"secret"                                toml:"secret"`
+	PreviousSecret           string                   `json:"previous_secret,omitempty"             yaml:"previous_secret,omitempty"             toml:"previous_secret,omitempty"`
+	PreviousSecretExpiresAt  time.Time                `json:"previous_secret_expires_at,omitempty"  yaml:"previous_secret_expires_at,omitempty"  toml:"previous_secret_expires_at,omitempty"`
+	RedirectURI              PatternSet               `json:"redirect_uri"                          yaml:"redirect_uri"                          toml:"redirect_uri"`
+	PostLogoutRedirectURI    PatternSet               `json:"post_logout_redirect_uris,omitempty"   yaml:"post_logout_redirect_uris,omitempty"   toml:"post_logout_redirect_uris,omitempty"`
+	CORSOrigin               PatternSet               `json:"cors_origin"                           yaml:"cors_origin"                           toml:"cors_origin"`
+	AllowImplicitFlow        bool                     `json:"allow_implicit_flow"                   yaml:"allow_implicit_flow"                   toml:"allow_implicit_flow"`
+	RequestKey               string                   `json:"request_key"                           yaml:"request_key"                           toml:"request_key"`
+	JWKS                     string                   `json:"jwks,omitempty"                        yaml:"jwks,omitempty"                        toml:"jwks,omitempty"`
+	JWKSURI                  string                   `json:"jwks_uri,omitempty"                    yaml:"jwks_uri,omitempty"                    toml:"jwks_uri,omitempty"`
+	AssertionSecret          string                   `json:"assertion_secret,omitempty"            yaml:"assertion_secret,omitempty"            toml:"assertion_secret,omitempty"`
+	TokenEndpointAuthMethod  string                   `json:"token_endpoint_auth_method"            yaml:"token_endpoint_auth_method"            toml:"token_endpoint_auth_method"`
+	ResponseModes            []string                 `json:"response_modes,omitempty"              yaml:"response_modes,omitempty"              toml:"response_modes,omitempty"`
+	ClaimOverrides           map[string]ClaimOverride `json:"claim_overrides,omitempty"             yaml:"claim_overrides,omitempty"             toml:"claim_overrides,omitempty"`
+	RequireACR               string                   `json:"require_acr,omitempty"                 yaml:"require_acr,omitempty"                 toml:"require_acr,omitempty"`
+	MaxTokenExpire           Duration                 `json:"max_token_expire,omitempty"            yaml:"max_token_expire,omitempty"            toml:"max_token_expire,omitempty"`
+	MaxRefreshExpire         Duration                 `json:"max_refresh_expire,omitempty"          yaml:"max_refresh_expire,omitempty"          toml:"max_refresh_expire,omitempty"`
+	IncludeAzp               bool                     `json:"include_azp,omitempty"                 yaml:"include_azp,omitempty"                 toml:"include_azp,omitempty"`
+	AllowRefreshTokens       *bool                    `json:"allow_refresh_tokens,omitempty"        yaml:"allow_refresh_tokens,omitempty"        toml:"allow_refresh_tokens,omitempty"`
+	AllowedScopes            []string                 `json:"allowed_scopes,omitempty"              yaml:"allowed_scopes,omitempty"              toml:"allowed_scopes,omitempty"`
+	RejectDisallowedScopes   bool                     `json:"reject_disallowed_scopes,omitempty"    yaml:"reject_disallowed_scopes,omitempty"    toml:"reject_disallowed_scopes,omitempty"`
+	Expire                   ClientExpireConfig       `json:"expire,omitempty"                      yaml:"expire,omitempty"                      toml:"expire,omitempty"`
+	AllowClientCredentials   bool                     `json:"allow_client_credentials,omitempty"    yaml:"allow_client_credentials,omitempty"    toml:"allow_client_credentials,omitempty"`
+	ServiceScopes            []string                 `json:"service_scopes,omitempty"              yaml:"service_scopes,omitempty"              toml:"service_scopes,omitempty"`
+	ClientCredentialsIDToken bool                     `json:"client_credentials_id_token,omitempty" yaml:"client_credentials_id_token,omitempty" toml:"client_credentials_id_token,omitempty"`
+	ServiceClaims            map[string]interface{}   `json:"service_claims,omitempty"              yaml:"service_claims,omitempty"              toml:"service_claims,omitempty"`
+}
+
+// TokenEndpointAuthMethods returns client authentication methods that this client can use on the token endpoint.
+func (c ClientConfig) TokenEndpointAuthMethods() []string {
+	if c.TokenEndpointAuthMethod == "" {
+		return DefaultTokenEndpointAuthMethods
+	}
+	return []string{c.TokenEndpointAuthMethod}
+}
+
+// RefreshTokensAllowed reports whether this client can receive and use refresh_token.
+// It is allowed if AllowRefreshTokens is omitted, except for public clients.
+// Public clients can't keep refresh_token in secret, and anyone can use it by their client_id.
+func (c ClientConfig) RefreshTokensAllowed() bool {
+	if c.IsPublic() {
+		return false
+	}
+	return c.AllowRefreshTokens == nil || *c.AllowRefreshTokens
+}
+
+// PreviousSecretActive reports whether PreviousSecret is still accepted at the time.
+func (c ClientConfig) PreviousSecretActive(now time.Time) bool {
+	return c.PreviousSecret != "" && now.Before(c.PreviousSecretExpiresAt)
+}
+
+// AllowScope reports whether this client can receive the scope.
+// The openid scope is always allowed, and all scopes are allowed if AllowedScopes is empty.
+func (c ClientConfig) AllowScope(scope string) bool {
+	return len(c.AllowedScopes) == 0 || scope == "openid" || contains(c.AllowedScopes, scope)
+}
+
+// AllowResponseMode reports whether this client can receive the authorization response in the response mode.
+// All supported modes are allowed if ResponseModes is empty.
+func (c ClientConfig) AllowResponseMode(mode string) bool {
+	if len(c.ResponseModes) == 0 {
+		return contains(SupportedResponseModes, mode)
+	}
+	return contains(c.ResponseModes, mode)
+}
+
+// AllowRedirectURI checks if the URI can be used as redirect_uri of this client.
+// If strict is true, the URI is normalized and wildcards of the patterns work only in the path.
+func (c ClientConfig) AllowRedirectURI(uri string, strict bool) bool {
+	if strict {
+		return c.RedirectURI.MatchURI(uri)
+	}
+	return c.RedirectURI.Match(uri)
+}
+
+// AllowPostLogoutRedirectURI checks if the URI can be used as post_logout_redirect_uri of this client.
+// RedirectURI is used instead if PostLogoutRedirectURI is not set.
+func (c ClientConfig) AllowPostLogoutRedirectURI(uri string, strict bool) bool {
+	if len(c.PostLogoutRedirectURI) == 0 {
+		return c.AllowRedirectURI(uri, strict)
+	}
+	if strict {
+		return c.PostLogoutRedirectURI.MatchURI(uri)
+	}
+	return c.PostLogoutRedirectURI.Match(uri)
+}
+
+func (c ClientConfig) AllowTokenEndpointAuthMethod(method string) bool {
+	for _, m := range c.TokenEndpointAuthMethods() {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// OverrideClaims returns a copy of the claim map that ClaimOverrides of this client applied.
+func (c ClientConfig) OverrideClaims(maps map[string][]ClaimConfig) map[string][]ClaimConfig {
+	if len(c.ClaimOverrides) == 0 {
+		return maps
+	}
+
+	result := make(map[string][]ClaimConfig, len(maps))
+	for attr, claims := range maps {
+		overridden := make([]ClaimConfig, len(claims))
+		for i, claim := range claims {
+			if o, ok := c.ClaimOverrides[claim.Claim]; ok {
+				if o.Type != "" {
+					claim.Type = o.Type
+				}
+				claim.Separator = o.Separator
+			}
+			overridden[i] = claim
+		}
+		result[attr] = overridden
+	}
+	return result
 }
 
 type ClientConfigSet map[string]ClientConfig
 
+// IsPublic reports whether this client is a public client that doesn't authenticate on the token endpoint.
+// Public clients have to use PKCE with S256 instead.
+func (c ClientConfig) IsPublic() bool {
+	return c.TokenEndpointAuthMethod == AUTH_METHOD_NONE
+}
+
+// TokenEndpointAuthMethods returns union of client authentication methods of all clients.
+func (cs ClientConfigSet) TokenEndpointAuthMethods() []string {
+	if len(cs) == 0 {
+		return DefaultTokenEndpointAuthMethods
+	}
+
+	found := make(map[string]bool)
+	var methods []string
+	for _, client := range cs {
+		for _, m := range client.TokenEndpointAuthMethods() {
+			if !found[m] {
+				found[m] = true
+				methods = append(methods, m)
+			}
+		}
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// ClientCredentialsAllowed reports whether any client can use the client_credentials grant.
+func (cs ClientConfigSet) ClientCredentialsAllowed() bool {
+	for _, client := range cs {
+		if client.AllowClientCredentials {
+			return true
+		}
+	}
+	return false
+}
+
+type AdminConfig struct {
+	CapabilitiesPath string `json:"capabilities_path,omitempty" yaml:"capabilities_path,omitempty" toml:"capabilities_path,omitempty" flag:"admin-capabilities-path"`
+	SessionsPath     string `json:"sessions_path,omitempty"     yaml:"sessions_path,omitempty"     toml:"sessions_path,omitempty"     flag:"admin-sessions-path"`
+	Username         string `json:"username,omitempty"          yaml:"username,omitempty"          toml:"username,omitempty"          flag:"admin-username"`
+	Password         string `json:"password,omitempty"          yaml:"password,omitempty"          toml:"password,omitempty"          flag:"admin-password"`
+}
+
 type MetricsConfig struct {
-	Path     string `json:"path"               yaml:"path"               toml:"path"               flag:"metrics-path"`
-	Username string `json:"username,omitempty" yaml:"username,omitempty" toml:"username,omitempty" flag:"metrics-username"`
-	Password string `json:"password,omitempty" yaml:"password,omitempty" toml:"password,omitempty" flag:"metrics-password"`
+	Path            string   `json:"path"                       yaml:"path"                       toml:"path"                       flag:"metrics-path"`
+	Username        string   `json:"username,omitempty"         yaml:"username,omitempty"         toml:"username,omitempty"         flag:"metrics-username"`
+	Password        string   `json:"password,omitempty"         yaml:"password,omitempty"         toml:"password,omitempty"         flag:"metrics-password"`
+	SummaryInterval Duration `json:"summary_interval,omitempty" yaml:"summary_interval,omitempty" toml:"summary_interval,omitempty" flag:"metrics-summary-interval"`
+}
+
+// TenantConfig is the configuration for one of IssuerHosts.
+type TenantConfig struct {
+	Host    string `json:"host"               yaml:"host"               toml:"host"`
+	SignKey string `json:"sign_key,omitempty" yaml:"sign_key,omitempty" toml:"sign_key,omitempty"`
+}
+
+type AuditConfig struct {
+	File    string `json:"file,omitempty"     yaml:"file,omitempty"     toml:"file,omitempty"     flag:"audit-file"`
+	Format  string `json:"format,omitempty"   yaml:"format,omitempty"   toml:"format,omitempty"   flag:"audit-format"`
+	HashPII bool   `json:"hash_pii,omitempty" yaml:"hash_pii,omitempty" toml:"hash_pii,omitempty" flag:"audit-hash-pii"`
+	HashKey string `json:"hash_key,omitempty" yaml:"hash_key,omitempty" toml:"hash_key,omitempty" flag:"audit-hash-key"`
 }
 
 type TLSConfig struct {
@@ -84,32 +350,76 @@ type TLSConfig struct {
 }
 
 type LDAPConfig struct {
-	Server      *URL   `json:"server"       yaml:"server"       toml:"server"       flag:"ldap"`
-	User        string `json:"user"         yaml:"user"         toml:"user"         flag:"ldap-user"`
-	Password    string `json:"password"     yaml:"password"     toml:"password"     flag:"ldap-password"`
-	BaseDN      string `json:"base_dn"      yaml:"base_dn"      toml:"base_dn"      flag:"ldap-base-dn"`
-	IDAttribute string `json:"id_attribute" yaml:"id_attribute" toml:"id_attribute" flag:"ldap-id-attribute"`
-	DisableTLS  bool   `json:"disable_tls"  yaml:"disable_tls"  toml:"disable_tls"  flag:"ldap-disable-tls"`
+	Server            *URL     `json:"server"                       yaml:"server"                       toml:"server"                       flag:"ldap"`
+	FailoverServers   []*URL   `json:"failover_servers,omitempty"   yaml:"failover_servers,omitempty"   toml:"failover_servers,omitempty"   flag:"ldap-failover-server"`
+	ConnectTimeout    Duration `json:"connect_timeout"              yaml:"connect_timeout"              toml:"connect_timeout"              flag:"ldap-connect-timeout"`
+	User              string   `json:"user"                         yaml:"user"                         toml:"user"                         flag:"ldap-user"`
+	Password          string   `json:"password"                     yaml:"password"                     toml:"password"                     flag:"ldap-password"`
+	BaseDN            string   `json:"base_dn"                      yaml:"base_dn"                      toml:"base_dn"                      flag:"ldap-base-dn"`
+	IDAttribute       string   `json:"id_attribute"                 yaml:"id_attribute"                 toml:"id_attribute"                 flag:"ldap-id-attribute"`
+	DisableTLS        bool     `json:"disable_tls"                  yaml:"disable_tls"                  toml:"disable_tls"                  flag:"ldap-disable-tls"`
+	TLSCA             string   `json:"tls_ca,omitempty"             yaml:"tls_ca,omitempty"             toml:"tls_ca,omitempty"             flag:"ldap-tls-ca"`
+	TLSServerName     string   `json:"tls_server_name,omitempty"    yaml:"tls_server_name,omitempty"    toml:"tls_server_name,omitempty"    flag:"ldap-tls-server-name"`
+	TLSSkipVerify     bool     `json:"tls_skip_verify,omitempty"    yaml:"tls_skip_verify,omitempty"    toml:"tls_skip_verify,omitempty"    flag:"ldap-tls-skip-verify"`
+	RetryAfter        Duration `json:"retry_after"                  yaml:"retry_after"                  toml:"retry_after"                  flag:"ldap-retry-after"`
+	ScopeAttribute    string   `json:"scope_attribute,omitempty"    yaml:"scope_attribute,omitempty"    toml:"scope_attribute,omitempty"    flag:"ldap-scope-attribute"`
+	LowercaseUsername bool     `json:"lowercase_username"           yaml:"lowercase_username"           toml:"lowercase_username"           flag:"ldap-lowercase-username"`
+	NestedGroupDepth  int      `json:"nested_group_depth,omitempty" yaml:"nested_group_depth,omitempty" toml:"nested_group_depth,omitempty" flag:"ldap-nested-group-depth"`
+	WarmUp            int      `json:"warm_up,omitempty"            yaml:"warm_up,omitempty"            toml:"warm_up,omitempty"            flag:"ldap-warm-up"`
+	WarmUpTimeout     Duration `json:"warm_up_timeout"              yaml:"warm_up_timeout"              toml:"warm_up_timeout"              flag:"ldap-warm-up-timeout"`
+	PoolSize          int      `json:"pool_size,omitempty"          yaml:"pool_size,omitempty"          toml:"pool_size,omitempty"          flag:"ldap-pool-size"`
+	IdleTimeout       Duration `json:"idle_timeout"                 yaml:"idle_timeout"                 toml:"idle_timeout"                 flag:"ldap-idle-timeout"`
 }
 
 type TemplateConfig struct {
 	LoginPage  string `json:"login_page,omitempty"  yaml:"login_page,omitempty"  toml:"login_page,omitempty"  flag:"login-page"`
 	LogoutPage string `json:"logout_page,omitempty" yaml:"logout_page,omitempty" toml:"logout_page,omitempty" flag:"logout-page"`
 	ErrorPage  string `json:"error_page,omitempty"  yaml:"error_page,omitempty"  toml:"error_page,omitempty"  flag:"error-page"`
+	AssetsDir  string `json:"assets_dir,omitempty"  yaml:"assets_dir,omitempty"  toml:"assets_dir,omitempty"  flag:"assets-dir"`
+	AssetsPath string `json:"assets_path,omitempty" yaml:"assets_path,omitempty" toml:"assets_path,omitempty" flag:"assets-path"`
 }
 
 type Config struct {
-	Issuer    *URL            `json:"issuer"              yaml:"issuer"              toml:"issuer"             flag:"issuer"`
-	Listen    *TCPAddr        `json:"listen,omitempty"    yaml:"listen,omitempty"    toml:"listen,omitempty"   flag:"listen"`
-	SignKey   string          `json:"sign_key,omitempty"  yaml:"sign_key,omitempty"  toml:"sign_key,omitempty" flag:"sign-key"`
-	TLS       TLSConfig       `json:"tls,omitempty"       yaml:"tls,omitempty"       toml:"tls,omitempty"`
-	LDAP      LDAPConfig      `json:"ldap"                yaml:"ldap"                toml:"ldap"`
-	Expire    ExpireConfig    `json:"expire"              yaml:"expire"              toml:"expire"`
-	Endpoints EndpointConfig  `json:"endpoint"            yaml:"endpoint"            toml:"endpoint"`
-	Scopes    ScopeConfig     `json:"scope,omitempty"     yaml:"scope,omitempty"     toml:"scope,omitempty"`
-	Clients   ClientConfigSet `json:"client,omitempty"    yaml:"client,omitempty"    toml:"client,omitempty"`
-	Metrics   MetricsConfig   `json:"metrics"             yaml:"metrics"             toml:"metrics"`
-	Templates TemplateConfig  `json:"template,omitempty"  yaml:"template,omitempty"  toml:"template,omitempty"`
+	Issuer                  *URL              `json:"issuer"                               yaml:"issuer"                               toml:"issuer"                               flag:"issuer"`
+	IssuerHosts             []string          `json:"issuer_hosts,omitempty"               yaml:"issuer_hosts,omitempty"               toml:"issuer_hosts,omitempty"               flag:"issuer-host"`
+	Listen                  *TCPAddr          `json:"listen,omitempty"                     yaml:"listen,omitempty"                     toml:"listen,omitempty"                     flag:"listen"`
+	ReadyTimeout            Duration          `json:"ready_timeout,omitempty"              yaml:"ready_timeout,omitempty"              toml:"ready_timeout,omitempty"              flag:"ready-timeout"`
+	ShutdownTimeout         Duration          `json:"shutdown_timeout,omitempty"           yaml:"shutdown_timeout,omitempty"           toml:"shutdown_timeout,omitempty"           flag:"shutdown-timeout"`
+	SignKey                 string            `json:"sign_key,omitempty"                   yaml:"sign_key,omitempty"                   toml:"sign_key,omitempty"                   flag:"sign-key"`
+	SingleActiveCode        bool              `json:"single_active_code,omitempty"         yaml:"single_active_code,omitempty"         toml:"single_active_code,omitempty"         flag:"single-active-code"`
+	MaxCodeAttempts         int               `json:"max_code_attempts,omitempty"          yaml:"max_code_attempts,omitempty"          toml:"max_code_attempts,omitempty"          flag:"max-code-attempts"`
+	RejectReusedNonce       bool              `json:"reject_reused_nonce,omitempty"        yaml:"reject_reused_nonce,omitempty"        toml:"reject_reused_nonce,omitempty"        flag:"reject-reused-nonce"`
+	AudienceArray           bool              `json:"audience_array,omitempty"             yaml:"audience_array,omitempty"             toml:"audience_array,omitempty"             flag:"audience-array"`
+	JTIFormat               string            `json:"jti_format,omitempty"                 yaml:"jti_format,omitempty"                 toml:"jti_format,omitempty"                 flag:"jti-format"`
+	JTILength               int               `json:"jti_length,omitempty"                 yaml:"jti_length,omitempty"                 toml:"jti_length,omitempty"                 flag:"jti-length"`
+	ClientKeyCache          bool              `json:"client_key_cache,omitempty"           yaml:"client_key_cache,omitempty"           toml:"client_key_cache,omitempty"           flag:"client-key-cache"`
+	TLS                     TLSConfig         `json:"tls,omitempty"                        yaml:"tls,omitempty"                        toml:"tls,omitempty"`
+	LDAP                    LDAPConfig        `json:"ldap"                                 yaml:"ldap"                                 toml:"ldap"`
+	Expire                  ExpireConfig      `json:"expire"                               yaml:"expire"                               toml:"expire"`
+	Endpoints               EndpointConfig    `json:"endpoint"                             yaml:"endpoint"                             toml:"endpoint"`
+	Scopes                  ScopeConfig       `json:"scope,omitempty"                      yaml:"scope,omitempty"                      toml:"scope,omitempty"`
+	Clients                 ClientConfigSet   `json:"client,omitempty"                     yaml:"client,omitempty"                     toml:"client,omitempty"`
+	Tenants                 []TenantConfig    `json:"tenant,omitempty"                     yaml:"tenant,omitempty"                     toml:"tenant,omitempty"`
+	Admin                   AdminConfig       `json:"admin,omitempty"                      yaml:"admin,omitempty"                      toml:"admin,omitempty"`
+	Audit                   AuditConfig       `json:"audit,omitempty"                      yaml:"audit,omitempty"                      toml:"audit,omitempty"`
+	Metrics                 MetricsConfig     `json:"metrics"                              yaml:"metrics"                              toml:"metrics"`
+	Templates               TemplateConfig    `json:"template,omitempty"                   yaml:"template,omitempty"                   toml:"template,omitempty"`
+	ImplicitScopes          []string          `json:"implicit_scopes,omitempty"            yaml:"implicit_scopes,omitempty"            toml:"implicit_scopes,omitempty"            flag:"implicit-scope"`
+	UserinfoScopes          []string          `json:"userinfo_scopes,omitempty"            yaml:"userinfo_scopes,omitempty"            toml:"userinfo_scopes,omitempty"            flag:"userinfo-scope"`
+	StrictScope             bool              `json:"strict_scope,omitempty"               yaml:"strict_scope,omitempty"               toml:"strict_scope,omitempty"               flag:"strict-scope"`
+	RequireOfflineAccess    bool              `json:"require_offline_access,omitempty"     yaml:"require_offline_access,omitempty"     toml:"require_offline_access,omitempty"     flag:"require-offline-access"`
+	MaxScopes               int               `json:"max_scopes,omitempty"                 yaml:"max_scopes,omitempty"                 toml:"max_scopes,omitempty"                 flag:"max-scopes"`
+	MaxClaimsRequestSize    int               `json:"max_claims_request_size,omitempty"    yaml:"max_claims_request_size,omitempty"    toml:"max_claims_request_size,omitempty"    flag:"max-claims-request-size"`
+	MaxClaimsRequestMembers int               `json:"max_claims_request_members,omitempty" yaml:"max_claims_request_members,omitempty" toml:"max_claims_request_members,omitempty" flag:"max-claims-request-members"`
+	ErrorURI                string            `json:"error_uri,omitempty"                  yaml:"error_uri,omitempty"                  toml:"error_uri,omitempty"                  flag:"error-uri"`
+	ImplicitWarning         string            `json:"implicit_warning,omitempty"           yaml:"implicit_warning,omitempty"           toml:"implicit_warning,omitempty"           flag:"implicit-warning"`
+	StrictOIDC              bool              `json:"strict_oidc,omitempty"                yaml:"strict_oidc,omitempty"                toml:"strict_oidc,omitempty"                flag:"strict-oidc"`
+	StrictRedirectURI       bool              `json:"strict_redirect_uri,omitempty"        yaml:"strict_redirect_uri,omitempty"        toml:"strict_redirect_uri,omitempty"        flag:"strict-redirect-uri"`
+	RequestIDClaim          bool              `json:"request_id_claim,omitempty"           yaml:"request_id_claim,omitempty"           toml:"request_id_claim,omitempty"           flag:"request-id-claim"`
+	AuthContextClaims       bool              `json:"auth_context_claims,omitempty"        yaml:"auth_context_claims,omitempty"        toml:"auth_context_claims,omitempty"        flag:"auth-context-claims"`
+	MaintenanceMessage      string            `json:"maintenance_message"                  yaml:"maintenance_message"                  toml:"maintenance_message"                  flag:"maintenance-message"`
+	DebugTokenPath          string            `json:"debug_token_path,omitempty"           yaml:"debug_token_path,omitempty"           toml:"debug_token_path,omitempty"           flag:"debug-token-path"`
+	AccessLogLevels         map[string]string `json:"access_log_levels,omitempty"          yaml:"access_log_levels,omitempty"          toml:"access_log_levels,omitempty"          flag:"access-log-level"`
 }
 
 func TakeOptions(prefix string, typ reflect.Type, result map[string]string) {
@@ -143,18 +453,32 @@ func BindFlags(vip *viper.Viper, flags *pflag.FlagSet) {
 }
 
 func (c *Config) unmarshal(vip *viper.Viper) error {
+	applyDeprecatedKeys(vip)
+
 	err := vip.Unmarshal(c, func(m *mapstructure.DecoderConfig) {
 		m.TagName = "toml"
 		m.DecodeHook = func(f reflect.Type, t reflect.Type, data interface{}) (interface{}, error) {
+			if t == reflect.TypeOf(Scope{}) && f.Kind() == reflect.Slice {
+				// Compatibility for the style that only has claims like `profile = [ {claim = "name", ...} ]`.
+				return map[string]interface{}{"claims": data}, nil
+			}
 			if f.Kind() != reflect.String {
 				return data, nil
 			}
+			text, err := ExpandEnv(reflect.ValueOf(data).String())
+			if err != nil {
+				return nil, err
+			}
+			if t == reflect.TypeOf(map[string]string{}) {
+				// Environment variables for maps are written in the same style as flags, like `key1=value1,key2=value2`.
+				return parseStringMap(text)
+			}
 			result := reflect.New(t).Interface()
 			unmarshaller, ok := result.(encoding.TextUnmarshaler)
 			if !ok {
-				return data, nil
+				return text, nil
 			}
-			if err := unmarshaller.UnmarshalText([]byte(data.(string))); err != nil {
+			if err := unmarshaller.UnmarshalText([]byte(text)); err != nil {
 				return nil, err
 			}
 			return result, nil
@@ -179,6 +503,11 @@ func (c *Config) unmarshal(vip *viper.Viper) error {
 		}
 		c.LDAP.Server.User = nil
 	}
+	for _, s := range c.LDAP.FailoverServers {
+		if s != nil {
+			s.User = nil
+		}
+	}
 
 	if c.LDAP.BaseDN == "" {
 		c.LDAP.BaseDN, _ = GetDCByDN(c.LDAP.User)
@@ -200,6 +529,21 @@ func (r EnvReplacer) Replace(s string) string {
 	return strings.ReplaceAll(s, ".", "_")
 }
 
+func parseStringMap(s string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("%#v must be formatted as key=value", pair)
+		}
+		result[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return result, nil
+}
+
 func (c *Config) Load(file string, flags *pflag.FlagSet) error {
 	var replacer EnvReplacer
 	vip := viper.NewWithOptions(viper.EnvKeyReplacer(replacer))
@@ -245,6 +589,27 @@ func (c *Config) Validate() error {
 		es = append(es, errors.New("--issuer: Issuer URL must be absolute URL."))
 	}
 
+	for _, host := range c.IssuerHosts {
+		if u, err := url.Parse("//" + host); err != nil || u.Host != host || host == "" {
+			es = append(es, fmt.Errorf("--issuer-host: Issuer Host %#v is invalid.", host))
+		}
+	}
+
+	tenants := make(map[string]bool)
+	for _, t := range c.Tenants {
+		known := false
+		for _, host := range c.IssuerHosts {
+			known = known || strings.EqualFold(host, t.Host)
+		}
+		if !known {
+			es = append(es, fmt.Errorf("tenant.%s.host: Tenant Host must be one of --issuer-host.", t.Host))
+		}
+		if tenants[strings.ToLower(t.Host)] {
+			es = append(es, fmt.Errorf("tenant.%s.host: Tenant Host is duplicated.", t.Host))
+		}
+		tenants[strings.ToLower(t.Host)] = true
+	}
+
 	if c.TLS.Auto && (c.TLS.Cert != "" || c.TLS.Key != "") {
 		es = append(es, errors.New("--tls-auto: Can't use both of TLS auto and TLS Key/TLS Cert."))
 	}
@@ -260,6 +625,14 @@ func (c *Config) Validate() error {
 	if c.LDAP.Server.String() == "" {
 		es = append(es, errors.New("--ldap: LDAP Server address is required."))
 	}
+	for _, s := range c.LDAP.FailoverServers {
+		if s == nil || (s.Scheme != "ldap" && s.Scheme != "ldaps") || s.Host == "" {
+			es = append(es, fmt.Errorf("--ldap-failover-server: LDAP Failover Server %#v is invalid.", s.String()))
+		}
+	}
+	if c.LDAP.TLSSkipVerify && c.LDAP.TLSCA != "" {
+		es = append(es, errors.New("--ldap-tls-skip-verify: Can't use both of TLS Skip Verify and TLS CA."))
+	}
 	if c.LDAP.User == "" {
 		es = append(es, errors.New("--ldap-user: LDAP User is required."))
 	}
@@ -279,6 +652,74 @@ func (c *Config) Validate() error {
 	if c.Expire.Token <= 0 {
 		es = append(es, errors.New("--token-expire: Expiration of Token can't set 0 or less."))
 	}
+	if c.Expire.SignKeyOverlap < 0 {
+		es = append(es, errors.New("--sign-key-overlap: Overlap of Sign Key can't set less than 0."))
+	}
+	if c.Expire.MaxClientCode < 0 {
+		es = append(es, errors.New("--max-client-code-expire: Max Code Expiration of Clients can't set less than 0."))
+	}
+	if c.Expire.MaxClientToken < 0 {
+		es = append(es, errors.New("--max-client-token-expire: Max Token Expiration of Clients can't set less than 0."))
+	}
+	if c.Expire.MaxClientRefresh < 0 {
+		es = append(es, errors.New("--max-client-refresh-expire: Max Refresh Expiration of Clients can't set less than 0."))
+	}
+	if c.ErrorURI != "" {
+		if u, err := url.Parse(strings.ReplaceAll(c.ErrorURI, "{error}", "invalid_request")); err != nil || !u.IsAbs() {
+			es = append(es, errors.New("--error-uri: Error URI must be absolute URL."))
+		}
+	}
+	if c.ReadyTimeout < 0 {
+		es = append(es, errors.New("--ready-timeout: Timeout of readiness can't set less than 0."))
+	}
+	if c.ShutdownTimeout < 0 {
+		es = append(es, errors.New("--shutdown-timeout: Timeout of Shutdown can't set less than 0."))
+	}
+	if c.Templates.AssetsDir != "" && path.Clean("/"+c.Templates.AssetsPath) == "/" {
+		es = append(es, errors.New("--assets-path: Assets Path is required and can't be the root when set Assets Dir."))
+	}
+	if c.MaxCodeAttempts < 0 {
+		es = append(es, errors.New("--max-code-attempts: Max Code Attempts can't set less than 0."))
+	}
+	switch c.JTIFormat {
+	case "", JTI_FORMAT_UUID:
+	case JTI_FORMAT_RANDOM:
+		if c.JTILength < MinJTILength {
+			es = append(es, fmt.Errorf("--jti-length: JTI Length must be %d or more for enough entropy.", MinJTILength))
+		}
+	default:
+		es = append(es, fmt.Errorf("--jti-format: JTI Format must be %#v or %#v.", JTI_FORMAT_UUID, JTI_FORMAT_RANDOM))
+	}
+	if c.MaxScopes < 0 {
+		es = append(es, errors.New("--max-scopes: Max Scopes can't set less than 0."))
+	}
+	if c.MaxClaimsRequestSize < 0 {
+		es = append(es, errors.New("--max-claims-request-size: Max Claims Request Size can't set less than 0."))
+	}
+	if c.MaxClaimsRequestMembers < 0 {
+		es = append(es, errors.New("--max-claims-request-members: Max Claims Request Members can't set less than 0."))
+	}
+	if c.LDAP.RetryAfter < 0 {
+		es = append(es, errors.New("--ldap-retry-after: Retry-After of LDAP unavailable can't set less than 0."))
+	}
+	if c.LDAP.ConnectTimeout < 0 {
+		es = append(es, errors.New("--ldap-connect-timeout: Timeout of connecting to LDAP can't set less than 0."))
+	}
+	if c.LDAP.NestedGroupDepth < 0 {
+		es = append(es, errors.New("--ldap-nested-group-depth: Depth of nested groups can't set less than 0."))
+	}
+	if c.LDAP.WarmUp < 0 {
+		es = append(es, errors.New("--ldap-warm-up: Number of warm-up connections can't set less than 0."))
+	}
+	if c.LDAP.WarmUp > 0 && c.LDAP.WarmUpTimeout <= 0 {
+		es = append(es, errors.New("--ldap-warm-up-timeout: Timeout of warm-up must be greater than 0."))
+	}
+	if c.LDAP.PoolSize < 0 {
+		es = append(es, errors.New("--ldap-pool-size: Size of connection pool can't set less than 0."))
+	}
+	if c.LDAP.IdleTimeout < 0 {
+		es = append(es, errors.New("--ldap-idle-timeout: Idle timeout of pooled connections can't set less than 0."))
+	}
 
 	if c.Metrics.Path == "" {
 		es = append(es, errors.New("--metrics-path: Metrics Path can't set empty."))
@@ -289,19 +730,360 @@ func (c *Config) Validate() error {
 		es = append(es, errors.New("--metrics-password: Metrics Password is required when set Metrics Username."))
 	}
 
+	if c.Metrics.SummaryInterval < 0 {
+		es = append(es, errors.New("--metrics-summary-interval: Interval of Metrics Summary can't set less than 0."))
+	}
+
+	for endpoint, level := range c.AccessLogLevels {
+		if !contains(AccessLogEndpoints, endpoint) {
+			es = append(es, fmt.Errorf("--access-log-level: Unknown endpoint %#v. It must be one of %s.", endpoint, strings.Join(AccessLogEndpoints, ", ")))
+		} else if !contains(AccessLogLevels, level) {
+			es = append(es, fmt.Errorf("--access-log-level: Level of %s must be one of %s but got %#v.", endpoint, strings.Join(AccessLogLevels, ", "), level))
+		}
+	}
+
+	switch c.Audit.Format {
+	case "", "json", "text":
+	default:
+		es = append(es, fmt.Errorf("--audit-format: Format of Audit Log must be json or text but got %#v.", c.Audit.Format))
+	}
+	if c.Audit.HashPII && len(c.Audit.HashKey) < MinAuditHashKeyLength {
+		es = append(es, fmt.Errorf("--audit-hash-key: Hash Key must be at least %d characters to hash PII in Audit Log.", MinAuditHashKeyLength))
+	}
+
+	if c.DebugTokenPath != "" && path.Clean("/"+c.DebugTokenPath) == "/" {
+		es = append(es, errors.New("--debug-token-path: Debug Token Path can't be the root."))
+	}
+	if c.Admin.CapabilitiesPath != "" && (c.Admin.Username == "" || c.Admin.Password == "") {
+		es = append(es, errors.New("--admin-capabilities-path: Admin Username and Admin Password are required when set Capabilities Path."))
+	}
+	if c.Admin.SessionsPath != "" && (c.Admin.Username == "" || c.Admin.Password == "") {
+		es = append(es, errors.New("--admin-sessions-path: Admin Username and Admin Password are required when set Sessions Path."))
+	}
+
+	endpoints := []struct {
+		Flag string
+		Name string
+		Path string
+	}{
+		{"--authz-endpoint", "Authorization Endpoint", c.Endpoints.Authz},
+		{"--token-endpoint", "Token Endpoint", c.Endpoints.Token},
+		{"--userinfo-endpoint", "Userinfo Endpoint", c.Endpoints.Userinfo},
+		{"--jwks-uri", "JWKs URI", c.Endpoints.Jwks},
+		{"--logout-endpoint", "Logout Endpoint", c.Endpoints.Logout},
+		{"--introspection-endpoint", "Introspection Endpoint", c.Endpoints.Introspection},
+		{"--revocation-endpoint", "Revocation Endpoint", c.Endpoints.Revocation},
+	}
+	issuerPath := "/"
+	if c.Issuer != nil {
+		issuerPath = path.Join("/", c.Issuer.Path)
+	}
+
+	// Routes are registered at the resolved paths, so two of them on the same path would conflict.
+	// Prefix means that the route serves all paths under it, like the assets.
+	type route struct {
+		Flag   string
+		Name   string
+		Path   string
+		Prefix bool
+	}
+	var routes []route
+	for _, e := range endpoints {
+		if e.Path == "" {
+			es = append(es, fmt.Errorf("%s: %s is required.", e.Flag, e.Name))
+			continue
+		}
+		routes = append(routes, route{e.Flag, e.Name, path.Join(issuerPath, e.Path), false})
+	}
+	if c.DebugTokenPath != "" {
+		routes = append(routes, route{"--debug-token-path", "Debug Token Path", path.Clean("/" + c.DebugTokenPath), false})
+	}
+	if c.Admin.CapabilitiesPath != "" {
+		routes = append(routes, route{"--admin-capabilities-path", "Capabilities Path", path.Clean("/" + c.Admin.CapabilitiesPath), false})
+	}
+	if c.Admin.SessionsPath != "" {
+		routes = append(routes, route{"--admin-sessions-path", "Sessions Path", path.Clean("/" + c.Admin.SessionsPath), true})
+	}
+	if c.Templates.AssetsDir != "" {
+		routes = append(routes, route{"--assets-path", "Assets Path", path.Join(issuerPath, c.Templates.AssetsPath), true})
+	}
+	if c.Metrics.Path != "" {
+		routes = append(routes, route{"--metrics-path", "Metrics Path", path.Clean("/" + c.Metrics.Path), false})
+	}
+	for i, r := range routes {
+		for _, other := range routes[:i] {
+			if r.Path == other.Path {
+				es = append(es, fmt.Errorf("%s: %s can't be the same path as %s.", r.Flag, r.Name, other.Flag))
+			} else if other.Prefix && strings.HasPrefix(r.Path, other.Path+"/") {
+				es = append(es, fmt.Errorf("%s: %s can't be under the path of %s.", r.Flag, r.Name, other.Flag))
+			} else if r.Prefix && strings.HasPrefix(other.Path, r.Path+"/") {
+				es = append(es, fmt.Errorf("%s: %s can't contain the path of %s.", r.Flag, r.Name, other.Flag))
+			}
+		}
+	}
+
+	for id, client := range c.Clients {
+		if client.MaxTokenExpire < 0 {
+			es = append(es, fmt.Errorf("client.%s.max_token_expire: Max Token Expire can't set less than 0.", id))
+		}
+		if client.MaxRefreshExpire < 0 {
+			es = append(es, fmt.Errorf("client.%s.max_refresh_expire: Max Refresh Expire can't set less than 0.", id))
+		}
+		for _, e := range []struct {
+			Name     string
+			Flag     string
+			Override Duration
+			Max      Duration
+		}{
+			{"code", "--max-client-code-expire", client.Expire.Code, c.Expire.MaxClientCode},
+			{"token", "--max-client-token-expire", client.Expire.Token, c.Expire.MaxClientToken},
+			{"refresh", "--max-client-refresh-expire", client.Expire.Refresh, c.Expire.MaxClientRefresh},
+		} {
+			if e.Override < 0 {
+				es = append(es, fmt.Errorf("client.%s.expire.%s: Expiration can't set less than 0.", id, e.Name))
+			} else if e.Max > 0 && e.Override > e.Max {
+				es = append(es, fmt.Errorf("client.%s.expire.%s: Expiration can't be longer than %s (%s).", id, e.Name, e.Max, e.Flag))
+			}
+		}
+
+		switch client.TokenEndpointAuthMethod {
+		case "", AUTH_METHOD_CLIENT_SECRET_BASIC, AUTH_METHOD_CLIENT_SECRET_POST:
+			// Clients without secret can't use the token endpoint, so they work only in the implicit flow.
+			if client.Secret == "" && !client.AllowImplicitFlow {
+				es = append(es, fmt.Errorf("client.%s.secret: Secret is required when use client_secret_basic or client_secret_post.", id))
+			} else if _, err := bcrypt.Cost([]byte(client.Secret)); client.Secret != "" && err != nil {
+				es = append(es, fmt.Errorf("client.%s.secret: Secret must be a hash that generated by gen-client command.", id))
+			}
+			if client.PreviousSecret != "" {
+				if _, err := bcrypt.Cost([]byte(client.PreviousSecret)); err != nil {
+					es = append(es, fmt.Errorf("client.%s.previous_secret: Previous secret must be a hash that generated by gen-client command.", id))
+				}
+				if client.PreviousSecretExpiresAt.IsZero() {
+					es = append(es, fmt.Errorf("client.%s.previous_secret_expires_at: Expiry is required when set previous_secret, to make sure the old secret is retired.", id))
+				}
+			}
+		case AUTH_METHOD_CLIENT_SECRET_JWT:
+			if len(client.AssertionSecret) < MinAssertionSecretLength {
+				es = append(es, fmt.Errorf("client.%s.assertion_secret: Assertion Secret of at least %d bytes is required when use client_secret_jwt.", id, MinAssertionSecretLength))
+			}
+		case AUTH_METHOD_PRIVATE_KEY_JWT:
+			if client.RequestKey == "" && client.JWKS == "" && client.JWKSURI == "" {
+				es = append(es, fmt.Errorf("client.%s.request_key: Either of Request Key, JWKS, or JWKS URI is required when use private_key_jwt.", id))
+			}
+		case AUTH_METHOD_NONE:
+			// Public clients can't keep any credential, so they can't get tokens for themselves.
+			if client.Secret != "" {
+				es = append(es, fmt.Errorf("client.%s.secret: Secret can't be set when use none, because the client is public.", id))
+			}
+			if client.AllowClientCredentials {
+				es = append(es, fmt.Errorf("client.%s.allow_client_credentials: Client Credentials can't be allowed when use none, because the client is public.", id))
+			}
+			if client.AllowRefreshTokens != nil && *client.AllowRefreshTokens {
+				es = append(es, fmt.Errorf("client.%s.allow_refresh_tokens: Refresh Tokens can't be allowed when use none, because the client is public.", id))
+			}
+		default:
+			es = append(es, fmt.Errorf("client.%s.token_endpoint_auth_method: Unsupported method: %#v", id, client.TokenEndpointAuthMethod))
+		}
+
+		if client.JWKS != "" && client.JWKSURI != "" {
+			es = append(es, fmt.Errorf("client.%s.jwks: JWKS and JWKS URI can't be set at the same time.", id))
+		}
+		if client.JWKS != "" {
+			var set struct {
+				Keys []json.RawMessage `json:"keys"`
+			}
+			if err := json.Unmarshal([]byte(client.JWKS), &set); err != nil || len(set.Keys) == 0 {
+				es = append(es, fmt.Errorf("client.%s.jwks: JWKS must be a JSON like {\"keys\": [...]} with at least one key.", id))
+			}
+		}
+		if client.JWKSURI != "" {
+			if u, err := url.Parse(client.JWKSURI); err != nil || !u.IsAbs() || (u.Scheme != "https" && u.Scheme != "http") {
+				es = append(es, fmt.Errorf("client.%s.jwks_uri: JWKS URI must be an absolute URL of http or https.", id))
+			}
+		}
+
+		if c.StrictRedirectURI {
+			for _, p := range append(append(PatternSet{}, client.RedirectURI...), client.PostLogoutRedirectURI...) {
+				if !p.PathWildcardOnly() {
+					es = append(es, fmt.Errorf("client.%s.redirect_uri: Pattern %#v must be an absolute URL that has wildcards only in the path, because --strict-redirect-uri is set.", id, p.String()))
+				}
+			}
+		}
+
+		for _, mode := range client.ResponseModes {
+			if !contains(SupportedResponseModes, mode) {
+				es = append(es, fmt.Errorf("client.%s.response_modes: Unsupported response mode: %#v", id, mode))
+			}
+		}
+
+		if len(client.ServiceScopes) > 0 && !client.AllowClientCredentials {
+			es = append(es, fmt.Errorf("client.%s.service_scopes: Service scopes are used only if allow_client_credentials is true.", id))
+		}
+		if client.ClientCredentialsIDToken && !client.AllowClientCredentials {
+			es = append(es, fmt.Errorf("client.%s.client_credentials_id_token: ID token for client_credentials is issued only if allow_client_credentials is true.", id))
+		}
+		if len(client.ServiceClaims) > 0 && !client.ClientCredentialsIDToken {
+			es = append(es, fmt.Errorf("client.%s.service_claims: Service claims are used only if client_credentials_id_token is true.", id))
+		}
+		for claim := range client.ServiceClaims {
+			if contains(reservedServiceClaims, claim) {
+				es = append(es, fmt.Errorf("client.%s.service_claims: %#v is a reserved claim and can't be set.", id, claim))
+			}
+		}
+
+		for claim, o := range client.ClaimOverrides {
+			if !o.Type.IsSupported() {
+				es = append(es, fmt.Errorf("client.%s.claim_overrides: Unsupported type of %s claim: %#v", id, claim, o.Type))
+			}
+		}
+	}
+
+	for name, scope := range c.Scopes {
+		if !isSafeIconURL(scope.Icon) {
+			es = append(es, fmt.Errorf("scope.%s.icon: Icon must be http or https URL, or absolute path.", name))
+		}
+		if scope.Preselected && !scope.Optional {
+			es = append(es, fmt.Errorf("scope.%s.preselected: Preselected can only be set for optional scope.", name))
+		}
+
+		for _, claim := range scope.Claims {
+			if claim.Claim == "" || (claim.Attribute == "" && !claim.Template.IsSet()) {
+				es = append(es, fmt.Errorf("scope.%s.claims: Claim and either of attribute or template are required: %#v", name, claim.Claim))
+			}
+			if !claim.Type.IsSupported() {
+				es = append(es, fmt.Errorf("scope.%s.claims: Unsupported type of %s claim: %#v", name, claim.Claim, claim.Type))
+			}
+
+			if claim.Default == "" || claim.Separator != "" {
+				continue
+			}
+			switch claim.Type {
+			case CLAIM_TYPE_NUMBER, CLAIM_TYPE_NUMBER_LIST:
+				if _, err := strconv.ParseFloat(claim.Default, 64); err != nil {
+					es = append(es, fmt.Errorf("scope.%s.claims: Default of %s claim must be a number: %#v", name, claim.Claim, claim.Default))
+				}
+			case CLAIM_TYPE_BOOLEAN:
+				if _, err := parseBoolean(claim.Default); err != nil {
+					es = append(es, fmt.Errorf("scope.%s.claims: Default of %s claim must be TRUE, FALSE, 1, or 0: %#v", name, claim.Claim, claim.Default))
+				}
+			case CLAIM_TYPE_JSON:
+				if !json.Valid([]byte(claim.Default)) {
+					es = append(es, fmt.Errorf("scope.%s.claims: Default of %s claim must be valid JSON: %#v", name, claim.Claim, claim.Default))
+				}
+			}
+		}
+	}
+
 	if len(es) > 0 {
 		return es
 	}
 	return nil
 }
 
+func contains(xs []string, x string) bool {
+	for _, y := range xs {
+		if x == y {
+			return true
+		}
+	}
+	return false
+}
+
+func isSafeIconURL(icon string) bool {
+	if icon == "" {
+		return true
+	}
+	u, err := url.Parse(icon)
+	if err != nil {
+		return false
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return u.Host != ""
+	case "":
+		return u.Host == "" && strings.HasPrefix(u.Path, "/") && !strings.HasPrefix(icon, "//")
+	default:
+		return false
+	}
+}
+
 type ResolvedEndpointPaths struct {
-	OpenIDConfiguration string
-	Authz               string
-	Token               string
-	Userinfo            string
-	Jwks                string
-	Logout              string
+	OpenIDConfiguration string `json:"openid_configuration"`
+	Authz               string `json:"authorization"`
+	Token               string `json:"token"`
+	Userinfo            string `json:"userinfo"`
+	Jwks                string `json:"jwks"`
+	Logout              string `json:"logout"`
+	Introspection       string `json:"introspection"`
+	Revocation          string `json:"revocation"`
+}
+
+// IssuerFor returns the issuer URL for the request that came to the host.
+//
+// If IssuerHosts is empty, it always returns the configured Issuer.
+// Otherwise, it returns the Issuer that replaced the host by the given one if the host is included in IssuerHosts.
+func (c *Config) IssuerFor(host string) (*URL, bool) {
+	if len(c.IssuerHosts) == 0 {
+		return c.Issuer, true
+	}
+
+	for _, h := range c.IssuerHosts {
+		if strings.EqualFold(h, host) {
+			issuer := *c.Issuer
+			issuer.Host = strings.ToLower(host)
+			return &issuer, true
+		}
+	}
+	return nil, false
+}
+
+// SignKeyFor returns the path to the sign key for the host of IssuerHosts.
+// It is SignKey if the tenant doesn't have its own key.
+func (c *Config) SignKeyFor(host string) string {
+	for _, t := range c.Tenants {
+		if strings.EqualFold(t.Host, host) && t.SignKey != "" {
+			return t.SignKey
+		}
+	}
+	return c.SignKey
+}
+
+func capExpire(expire, max Duration) Duration {
+	if max > 0 && expire > max {
+		return max
+	}
+	return expire
+}
+
+func overrideExpire(expire, override Duration) Duration {
+	if override > 0 {
+		return override
+	}
+	return expire
+}
+
+// CodeExpireFor returns expiration of code for the client.
+// It is Expire.Code of the client if set, or the global Expire.Code.
+func (c *Config) CodeExpireFor(clientID string) Duration {
+	return overrideExpire(c.Expire.Code, c.Clients[clientID].Expire.Code)
+}
+
+// TokenExpireFor returns expiration of access_token and id_token for the client.
+// It is Expire.Token of the client if set or the global Expire.Token, and capped by MaxTokenExpire of the client.
+func (c *Config) TokenExpireFor(clientID string) Duration {
+	client := c.Clients[clientID]
+	return capExpire(overrideExpire(c.Expire.Token, client.Expire.Token), client.MaxTokenExpire)
+}
+
+// RefreshExpireFor returns expiration of refresh_token for the client.
+// It is Expire.Refresh of the client if set or the global Expire.Refresh, and capped by MaxRefreshExpire of the client.
+// It is 0 if the client is not allowed to use refresh_token.
+func (c *Config) RefreshExpireFor(clientID string) Duration {
+	client := c.Clients[clientID]
+	if !client.RefreshTokensAllowed() {
+		return 0
+	}
+	return capExpire(overrideExpire(c.Expire.Refresh, client.Expire.Refresh), client.MaxRefreshExpire)
 }
 
 func (c *Config) EndpointPaths() ResolvedEndpointPaths {
@@ -312,70 +1094,139 @@ func (c *Config) EndpointPaths() ResolvedEndpointPaths {
 		Userinfo:            path.Join(c.Issuer.Path, c.Endpoints.Userinfo),
 		Jwks:                path.Join(c.Issuer.Path, c.Endpoints.Jwks),
 		Logout:              path.Join(c.Issuer.Path, c.Endpoints.Logout),
+		Introspection:       path.Join(c.Issuer.Path, c.Endpoints.Introspection),
+		Revocation:          path.Join(c.Issuer.Path, c.Endpoints.Revocation),
 	}
 }
 
 type OpenIDConfiguration struct {
-	Issuer                            string   `json:"issuer"`
-	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
-	TokenEndpoint                     string   `json:"token_endpoint"`
-	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
-	JwksEndpoint                      string   `json:"jwks_uri"`
-	EndSessionEndpoint                string   `json:"end_session_endpoint"`
-	ScopesSupported                   []string `json:"scopes_supported"`
-	ResponseTypesSupported            []string `json:"response_types_supported"`
-	ResponseModesSupported            []string `json:"response_modes_supported"`
-	GrantTypesSupported               []string `json:"grant_types_supported"`
-	SubjectTypesSupported             []string `json:"subject_types_supported"`
-	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
-	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
-	DisplayValuesSupported            []string `json:"display_values_supported"`
-	ClaimsSupported                   []string `json:"claims_supported"`
-	RequestParameterSupported         bool     `json:"request_parameter_supported"`
-	RequestURIParameterSupported      bool     `json:"request_uri_parameter_supported"`
+	Issuer                                     string   `json:"issuer"`
+	AuthorizationEndpoint                      string   `json:"authorization_endpoint"`
+	TokenEndpoint                              string   `json:"token_endpoint"`
+	UserinfoEndpoint                           string   `json:"userinfo_endpoint"`
+	JwksEndpoint                               string   `json:"jwks_uri"`
+	EndSessionEndpoint                         string   `json:"end_session_endpoint"`
+	IntrospectionEndpoint                      string   `json:"introspection_endpoint"`
+	RevocationEndpoint                         string   `json:"revocation_endpoint"`
+	ScopesSupported                            []string `json:"scopes_supported"`
+	ResponseTypesSupported                     []string `json:"response_types_supported"`
+	ResponseModesSupported                     []string `json:"response_modes_supported"`
+	GrantTypesSupported                        []string `json:"grant_types_supported"`
+	SubjectTypesSupported                      []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported           []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported          []string `json:"token_endpoint_auth_methods_supported"`
+	TokenEndpointAuthSigningAlgValues          []string `json:"token_endpoint_auth_signing_alg_values_supported,omitempty"`
+	IntrospectionEndpointAuthMethodsSupported  []string `json:"introspection_endpoint_auth_methods_supported"`
+	RevocationEndpointAuthMethodsSupported     []string `json:"revocation_endpoint_auth_methods_supported"`
+	DisplayValuesSupported                     []string `json:"display_values_supported"`
+	ClaimsSupported                            []string `json:"claims_supported"`
+	ACRValuesSupported                         []string `json:"acr_values_supported"`
+	RequestParameterSupported                  bool     `json:"request_parameter_supported"`
+	RequestURIParameterSupported               bool     `json:"request_uri_parameter_supported"`
+	ClaimsParameterSupported                   bool     `json:"claims_parameter_supported"`
+	AuthorizationResponseIssParameterSupported bool     `json:"authorization_response_iss_parameter_supported,omitempty"`
+	CodeChallengeMethodsSupported              []string `json:"code_challenge_methods_supported"`
+}
+
+var (
+	// reservedServiceClaims are claims that lauth sets in ID token, so ServiceClaims can't override them.
+	reservedServiceClaims = []string{"iss", "sub", "aud", "exp", "iat", "nbf", "jti", "typ", "auth_time", "acr", "amr", "nonce", "c_hash", "at_hash", "azp", "rid", "sid"}
+
+	standardClaims = []string{"iss", "sub", "aud", "exp", "iat", "typ", "auth_time", "nonce", "c_hash", "at_hash"}
+)
+
+// ClaimsSupported returns deduplicated and sorted union of the standard claims and all claims that configured scopes can produce.
+// acr and amr are included if AuthContextClaims is enabled.
+func (c *Config) ClaimsSupported() []string {
+	claims := c.Scopes.AllClaims()
+
+	standard := standardClaims
+	if c.AuthContextClaims {
+		standard = append(append([]string{}, standardClaims...), "acr", "amr")
+	}
+
+	found := make(map[string]bool, len(claims)+len(standard))
+	for _, claim := range claims {
+		found[claim] = true
+	}
+	for _, claim := range standard {
+		if !found[claim] {
+			found[claim] = true
+			claims = append(claims, claim)
+		}
+	}
+
+	sort.Strings(claims)
+	return claims
+}
+
+// ResponseTypesSupported returns supported response types.
+// "token" is excluded in StrictOIDC mode, because it is not a response type of OpenID Connect but of OAuth2.
+func (c *Config) ResponseTypesSupported() []string {
+	types := []string{"code"}
+	if !c.StrictOIDC {
+		types = append(types, "token")
+	}
+	return append(types,
+		"id_token",
+		"code token",
+		"code id_token",
+		"token id_token",
+		"code token id_token",
+	)
 }
 
 func (c *Config) OpenIDConfiguration() OpenIDConfiguration {
 	issuer := c.Issuer.String()
 
+	authMethods := c.Clients.TokenEndpointAuthMethods()
+	var authSigningAlgs []string
+	// The introspection endpoint requires client authentication, so public clients can't use it.
+	var introspectionAuthMethods []string
+	for _, m := range authMethods {
+		switch m {
+		case AUTH_METHOD_CLIENT_SECRET_JWT:
+			authSigningAlgs = append(authSigningAlgs, "HS256")
+		case AUTH_METHOD_PRIVATE_KEY_JWT:
+			authSigningAlgs = append(authSigningAlgs, "RS256", "ES256", "ES384", "ES512")
+		}
+		if m != AUTH_METHOD_NONE {
+			introspectionAuthMethods = append(introspectionAuthMethods, m)
+		}
+	}
+
+	grantTypes := []string{"authorization_code", "implicit", "refresh_token"}
+	if c.Clients.ClientCredentialsAllowed() {
+		grantTypes = append(grantTypes, "client_credentials")
+	}
+
 	return OpenIDConfiguration{
-		Issuer:                issuer,
-		AuthorizationEndpoint: issuer + path.Join("/", c.Endpoints.Authz),
-		TokenEndpoint:         issuer + path.Join("/", c.Endpoints.Token),
-		UserinfoEndpoint:      issuer + path.Join("/", c.Endpoints.Userinfo),
-		JwksEndpoint:          issuer + path.Join("/", c.Endpoints.Jwks),
-		EndSessionEndpoint:    issuer + path.Join("/", c.Endpoints.Logout),
-		ScopesSupported:       append(c.Scopes.ScopeNames(), "openid"),
-		ResponseTypesSupported: []string{
-			"code",
-			"token",
-			"id_token",
-			"code token",
-			"code id_token",
-			"token id_token",
-			"code token id_token",
-		},
-		ResponseModesSupported:            []string{"query", "fragment"},
-		GrantTypesSupported:               []string{"authorization_code", "implicit", "refresh_token"},
-		SubjectTypesSupported:             []string{"public"},
-		IDTokenSigningAlgValuesSupported:  []string{"RS256"},
-		TokenEndpointAuthMethodsSupported: []string{"client_secret_post", "client_secret_basic"},
-		DisplayValuesSupported:            []string{"page"},
-		ClaimsSupported: append(
-			c.Scopes.AllClaims(),
-			"iss",
-			"sub",
-			"aud",
-			"exp",
-			"iat",
-			"typ",
-			"auth_time",
-			"nonce",
-			"c_hash",
-			"at_hash",
-		),
-		RequestParameterSupported:    true,
-		RequestURIParameterSupported: true,
+		Issuer:                                     issuer,
+		AuthorizationEndpoint:                      issuer + path.Join("/", c.Endpoints.Authz),
+		TokenEndpoint:                              issuer + path.Join("/", c.Endpoints.Token),
+		UserinfoEndpoint:                           issuer + path.Join("/", c.Endpoints.Userinfo),
+		JwksEndpoint:                               issuer + path.Join("/", c.Endpoints.Jwks),
+		EndSessionEndpoint:                         issuer + path.Join("/", c.Endpoints.Logout),
+		IntrospectionEndpoint:                      issuer + path.Join("/", c.Endpoints.Introspection),
+		RevocationEndpoint:                         issuer + path.Join("/", c.Endpoints.Revocation),
+		ScopesSupported:                            append(c.Scopes.ScopeNames(), "openid", "offline_access"),
+		ResponseTypesSupported:                     c.ResponseTypesSupported(),
+		ResponseModesSupported:                     SupportedResponseModes,
+		GrantTypesSupported:                        grantTypes,
+		SubjectTypesSupported:                      []string{"public"},
+		IDTokenSigningAlgValuesSupported:           []string{"RS256"},
+		TokenEndpointAuthMethodsSupported:          authMethods,
+		TokenEndpointAuthSigningAlgValues:          authSigningAlgs,
+		IntrospectionEndpointAuthMethodsSupported:  introspectionAuthMethods,
+		RevocationEndpointAuthMethodsSupported:     authMethods,
+		DisplayValuesSupported:                     []string{"page"},
+		ClaimsSupported:                            c.ClaimsSupported(),
+		ACRValuesSupported:                         SupportedACRValues,
+		RequestParameterSupported:                  true,
+		RequestURIParameterSupported:               true,
+		ClaimsParameterSupported:                   true,
+		AuthorizationResponseIssParameterSupported: c.StrictOIDC,
+		CodeChallengeMethodsSupported:              SupportedCodeChallengeMethods,
 	}
 }
 
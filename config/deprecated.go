@@ -0,0 +1,33 @@
+package config
+
+import (
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/viper"
+)
+
+// DeprecatedKey is a config key that will be removed in the next release.
+type DeprecatedKey struct {
+	Key         string
+	Replacement string
+}
+
+// DeprecatedKeys lists config keys that are still honored but deprecated.
+// Add an entry here when renaming a key, and remove it one release later.
+var DeprecatedKeys = []DeprecatedKey{}
+
+// applyDeprecatedKeys warns about deprecated keys and copies their values to the replacements.
+// The value of the replacement wins if both of them are set.
+func applyDeprecatedKeys(vip *viper.Viper) {
+	for _, d := range DeprecatedKeys {
+		if !vip.IsSet(d.Key) {
+			continue
+		}
+
+		log.Warn().
+			Str("key", d.Key).
+			Str("replacement", d.Replacement).
+			Msg("deprecated config key is used; it will be removed in the next release")
+
+		vip.SetDefault(d.Replacement, vip.Get(d.Key))
+	}
+}
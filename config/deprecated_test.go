@@ -0,0 +1,94 @@
+package config_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/macrat/lauth/config"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestLoad_DeprecatedKeys(t *testing.T) {
+	defer func(keys []config.DeprecatedKey, logger zerolog.Logger) {
+		config.DeprecatedKeys = keys
+		log.Logger = logger
+	}(config.DeprecatedKeys, log.Logger)
+
+	config.DeprecatedKeys = []config.DeprecatedKey{
+		{Key: "ldap.id_attr", Replacement: "ldap.id_attribute"},
+		{Key: "sso_expire", Replacement: "expire.sso"},
+	}
+
+	tests := []struct {
+		Name     string
+		Config   string
+		Warnings []string
+		Attr     string
+	}{
+		{
+			Name:     "deprecated",
+			Config:   "ldap:\n  id_attr: uid\n",
+			Warnings: []string{"ldap.id_attr"},
+			Attr:     "uid",
+		},
+		{
+			Name:     "both",
+			Config:   "ldap:\n  id_attr: uid\n  id_attribute: cn\n",
+			Warnings: []string{"ldap.id_attr"},
+			Attr:     "cn",
+		},
+		{
+			Name:   "replacement",
+			Config: "ldap:\n  id_attribute: cn\n",
+			Attr:   "cn",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "config.yml")
+			if err := os.WriteFile(file, []byte(tt.Config), 0600); err != nil {
+				t.Fatalf("failed to write config: %s", err)
+			}
+
+			buf := bytes.NewBuffer(nil)
+			log.Logger = zerolog.New(buf)
+
+			var conf config.Config
+			if err := conf.Load(file, nil); err != nil {
+				t.Fatalf("failed to load config: %s", err)
+			}
+
+			if conf.LDAP.IDAttribute != tt.Attr {
+				t.Errorf("unexpected id_attribute: %#v", conf.LDAP.IDAttribute)
+			}
+
+			var warnings []string
+			dec := json.NewDecoder(buf)
+			for dec.More() {
+				var entry struct {
+					Level       string `json:"level"`
+					Key         string `json:"key"`
+					Replacement string `json:"replacement"`
+				}
+				if err := dec.Decode(&entry); err != nil {
+					t.Fatalf("failed to decode log: %s", err)
+				}
+				if entry.Level != "warn" {
+					t.Errorf("unexpected log level: %s", entry.Level)
+				}
+				if entry.Replacement != "ldap.id_attribute" {
+					t.Errorf("unexpected replacement: %#v", entry.Replacement)
+				}
+				warnings = append(warnings, entry.Key)
+			}
+			if len(warnings) != len(tt.Warnings) || (len(warnings) > 0 && warnings[0] != tt.Warnings[0]) {
+				t.Errorf("unexpected warnings: %#v", warnings)
+			}
+		})
+	}
+}
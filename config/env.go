@@ -0,0 +1,39 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+)
+
+var envReference = regexp.MustCompile(`\$\$|\$\{([A-Za-z_][A-Za-z0-9_]*)\}|\$([A-Za-z_][A-Za-z0-9_]*)`)
+
+// ExpandEnv replaces ${VAR} and $VAR in s with the values of environment variables, and $$ with $.
+//
+// Undefined ${VAR} is an error to prevent using an empty secret by mistake.
+// Undefined $VAR is kept as is, because bcrypt hashes of client secrets look like "$2y$05$salt...".
+func ExpandEnv(s string) (string, error) {
+	var err error
+
+	result := envReference.ReplaceAllStringFunc(s, func(ref string) string {
+		if ref == "$$" {
+			return "$"
+		}
+
+		m := envReference.FindStringSubmatch(ref)
+		if m[1] != "" {
+			v, ok := os.LookupEnv(m[1])
+			if !ok && err == nil {
+				err = fmt.Errorf("environment variable %s is not set", m[1])
+			}
+			return v
+		}
+
+		if v, ok := os.LookupEnv(m[2]); ok {
+			return v
+		}
+		return ref
+	})
+
+	return result, err
+}
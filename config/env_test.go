@@ -0,0 +1,91 @@
+package config_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/macrat/lauth/config"
+)
+
+func setenv(t *testing.T, key, value string) {
+	t.Helper()
+
+	if err := os.Setenv(key, value); err != nil {
+		t.Fatalf("failed to set environment variable: %s", err)
+	}
+	t.Cleanup(func() {
+		os.Unsetenv(key)
+	})
+}
+
+func TestExpandEnv(t *testing.T) {
+	setenv(t, "LAUTH_TEST_SECRET", "hello world")
+	setenv(t, "LAUTH_TEST_EMPTY", "")
+
+	tests := []struct {
+		Input  string
+		Output string
+		Error  string
+	}{
+		{"no reference", "no reference", ""},
+		{"${LAUTH_TEST_SECRET}", "hello world", ""},
+		{"$LAUTH_TEST_SECRET", "hello world", ""},
+		{"say ${LAUTH_TEST_SECRET}!", "say hello world!", ""},
+		{"[${LAUTH_TEST_EMPTY}]", "[]", ""},
+		{"$${LAUTH_TEST_SECRET}", "${LAUTH_TEST_SECRET}", ""},
+		{"cost $$5", "cost $5", ""},
+		{"$2y$05$ctB3fgxdzGEXICdJCsb1qOkl3169uhjq0UC5vFQa7o.yWE69vJccC", "$2y$05$ctB3fgxdzGEXICdJCsb1qOkl3169uhjq0UC5vFQa7o.yWE69vJccC", ""},
+		{"${LAUTH_TEST_UNDEFINED}", "", "environment variable LAUTH_TEST_UNDEFINED is not set"},
+	}
+
+	for _, tt := range tests {
+		output, err := config.ExpandEnv(tt.Input)
+		if tt.Error != "" {
+			if err == nil || err.Error() != tt.Error {
+				t.Errorf("%#v: unexpected error: %v", tt.Input, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%#v: unexpected error: %s", tt.Input, err)
+		} else if output != tt.Output {
+			t.Errorf("%#v: expected %#v but got %#v", tt.Input, tt.Output, output)
+		}
+	}
+}
+
+func TestLoadConfig_ExpandEnv(t *testing.T) {
+	setenv(t, "LAUTH_TEST_ISSUER", "https://auth.example.com")
+	setenv(t, "LAUTH_TEST_CLIENT_SECRET", "$2a$10$fU1PBoQ6V4a3Mbg4BI5yJemdSU4bE5LogDMFG55n5C761X0/tzAkW")
+
+	conf := &config.Config{}
+	err := conf.ReadReader(strings.NewReader(`
+issuer = "${LAUTH_TEST_ISSUER}"
+
+[client.test]
+secret = "${LAUTH_TEST_CLIENT_SECRET}"
+redirect_uri = ["$LAUTH_TEST_ISSUER/callback"]
+`))
+	if err != nil {
+		t.Fatalf("failed to load config: %s", err)
+	}
+
+	if conf.Issuer.String() != "https://auth.example.com" {
+		t.Errorf("unexpected issuer: %s", conf.Issuer)
+	}
+	if secret := conf.Clients["test"].Secret; secret != "$2a$10$fU1PBoQ6V4a3Mbg4BI5yJemdSU4bE5LogDMFG55n5C761X0/tzAkW" {
+		t.Errorf("unexpected client secret: %s", secret)
+	}
+	if !conf.Clients["test"].RedirectURI.Match("https://auth.example.com/callback") {
+		t.Errorf("unexpected redirect_uri: %v", conf.Clients["test"].RedirectURI)
+	}
+
+	err = conf.ReadReader(strings.NewReader(`
+[client.test]
+secret = "${LAUTH_TEST_UNDEFINED_SECRET}"
+`))
+	if err == nil || !strings.Contains(err.Error(), "LAUTH_TEST_UNDEFINED_SECRET is not set") {
+		t.Errorf("undefined variable should be an error: %v", err)
+	}
+}
@@ -1,8 +1,13 @@
 package config
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
 )
 
 type ClaimType string
@@ -12,64 +17,302 @@ const (
 	CLAIM_TYPE_STRING_LIST           = "[]string"
 	CLAIM_TYPE_NUMBER                = "number"
 	CLAIM_TYPE_NUMBER_LIST           = "[]number"
+	CLAIM_TYPE_BOOLEAN               = "boolean"
+	CLAIM_TYPE_JSON                  = "json"
 )
 
 func (t ClaimType) String() string {
 	return string(t)
 }
 
+// IsSupported reports whether the type is known. Empty type is supported as string.
+func (t ClaimType) IsSupported() bool {
+	switch t {
+	case "", CLAIM_TYPE_STRING, CLAIM_TYPE_STRING_LIST, CLAIM_TYPE_NUMBER, CLAIM_TYPE_NUMBER_LIST, CLAIM_TYPE_BOOLEAN, CLAIM_TYPE_JSON:
+		return true
+	}
+	return false
+}
+
 func (t *ClaimType) UnmarshalText(text []byte) error {
-	switch ClaimType(string(text)) {
-	case CLAIM_TYPE_STRING, "":
-		*t = CLAIM_TYPE_STRING
-	case CLAIM_TYPE_STRING_LIST, CLAIM_TYPE_NUMBER, CLAIM_TYPE_NUMBER_LIST:
-		*t = ClaimType(string(text))
-	default:
+	typ := ClaimType(string(text))
+	if !typ.IsSupported() {
 		return fmt.Errorf("unsupported claim type: %#v", string(text))
 	}
+	if typ == "" {
+		typ = CLAIM_TYPE_STRING
+	}
+	*t = typ
 	return nil
 }
 
-func parseNumberList(values []string) []float64 {
-	result := make([]float64, len(values))
-	for i, v := range values {
-		result[i], _ = strconv.ParseFloat(v, 64)
+// Errors about malformed attribute values.
+// They don't include the value itself, because attributes may contain personal information that shouldn't be logged.
+var (
+	InvalidNumberError  = errors.New("invalid number")
+	InvalidBooleanError = errors.New("invalid boolean")
+	InvalidJSONError    = errors.New("invalid JSON")
+)
+
+// parseNumber parses s as int64 if it is an integer, otherwise as float64.
+func parseNumber(s string) (interface{}, error) {
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i, nil
 	}
-	return result
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return nil, InvalidNumberError
+	}
+	return f, nil
 }
 
-func (t ClaimType) Convert(values []string) interface{} {
+// parseNumberList parses each value as float64.
+// Malformed values are skipped, and the error about the first one is returned with the other values.
+func parseNumberList(values []string) ([]float64, error) {
+	var err error
+	result := make([]float64, 0, len(values))
+	for _, v := range values {
+		f, e := strconv.ParseFloat(v, 64)
+		if e != nil {
+			if err == nil {
+				err = InvalidNumberError
+			}
+			continue
+		}
+		result = append(result, f)
+	}
+	return result, err
+}
+
+// parseBoolean parses s in the way LDAP does, that is "TRUE" or "FALSE".
+// "1" and "0" are also accepted because some directories store boolean as integer.
+func parseBoolean(s string) (bool, error) {
+	switch strings.ToUpper(s) {
+	case "TRUE", "1":
+		return true, nil
+	case "FALSE", "0":
+		return false, nil
+	}
+	return false, InvalidBooleanError
+}
+
+// parseJSON parses the first value as JSON.
+// It returns nil without error if there is no value.
+func parseJSON(values []string) (interface{}, error) {
+	if len(values) == 0 || values[0] == "" {
+		return nil, nil
+	}
+	var result interface{}
+	if err := json.Unmarshal([]byte(values[0]), &result); err != nil {
+		return nil, InvalidJSONError
+	}
+	return result, nil
+}
+
+// Parse converts attribute values to the claim value of the type.
+//
+// Number, boolean, and json returns nil if there is no value, or the value is malformed.
+// []number skips malformed values.
+// The error tells the type of the malformed value but not the value itself, so the caller can log it safely.
+func (t ClaimType) Parse(values []string) (interface{}, error) {
 	switch t {
 	case CLAIM_TYPE_STRING:
 		if len(values) == 0 {
-			return ""
+			return "", nil
 		} else {
-			return values[0]
+			return values[0], nil
 		}
 	case CLAIM_TYPE_STRING_LIST:
-		return values
+		return values, nil
 
 	case CLAIM_TYPE_NUMBER:
-		if len(values) == 0 {
-			return float64(0)
-		} else {
-			result, _ := strconv.ParseFloat(values[0], 64)
-			return result
+		if len(values) == 0 || values[0] == "" {
+			return nil, nil
 		}
+		return parseNumber(values[0])
 	case CLAIM_TYPE_NUMBER_LIST:
 		return parseNumberList(values)
 
+	case CLAIM_TYPE_BOOLEAN:
+		if len(values) == 0 || values[0] == "" {
+			return nil, nil
+		}
+		b, err := parseBoolean(values[0])
+		if err != nil {
+			return nil, err
+		}
+		return b, nil
+
+	case CLAIM_TYPE_JSON:
+		result, err := parseJSON(values)
+		if err != nil {
+			return nil, err
+		}
+		return result, nil
+
 	default:
-		return nil
+		return nil, nil
+	}
+}
+
+// Convert converts attribute values to the claim value of the type, ignoring malformed values.
+func (t ClaimType) Convert(values []string) interface{} {
+	result, _ := t.Parse(values)
+	return result
+}
+
+// Sources returns attribute names that the claim value can be taken from, in order of priority.
+// It returns the attributes that the template refers if Template is set.
+func (c ClaimConfig) Sources() []string {
+	if c.Template.IsSet() {
+		return c.Template.Attributes()
 	}
+	return append([]string{c.Attribute}, c.Fallback...)
 }
 
-func MappingClaims(attrs map[string][]string, maps map[string]ClaimConfig) map[string]interface{} {
+func hasValue(values []string) bool {
+	for _, v := range values {
+		if v != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// pick returns the values of the first source attribute that has a non-empty value after Select.
+// It returns the values of Attribute if no source has value.
+func (c ClaimConfig) pick(attrs map[string][]string) (values, selected []string, ok bool) {
+	values, ok = attrs[c.Attribute]
+	selected = c.Select(values)
+	if hasValue(selected) {
+		return values, selected, ok
+	}
+
+	for _, name := range c.Fallback {
+		if vs, found := attrs[name]; found {
+			if s := c.Select(vs); hasValue(s) {
+				return vs, s, true
+			}
+		}
+	}
+
+	return values, selected, ok
+}
+
+// Select filters attribute values by Prefix and Match.
+// Prefix is removed from selected values, and values are replaced by the first capture group of Match if it has.
+func (c ClaimConfig) Select(values []string) []string {
+	if c.Prefix == "" && !c.Match.IsSet() {
+		return values
+	}
+
+	var result []string
+	for _, v := range values {
+		if c.Prefix != "" {
+			if !strings.HasPrefix(v, c.Prefix) {
+				continue
+			}
+			v = strings.TrimPrefix(v, c.Prefix)
+		}
+		if c.Match.IsSet() {
+			var ok bool
+			if v, ok = c.Match.Extract(v); !ok {
+				continue
+			}
+		}
+		result = append(result, v)
+	}
+	return result
+}
+
+// Convert converts attribute values to the claim value.
+// The values are joined into a string if Separator is set, otherwise converted as Type.
+// Type is treated as string if omitted.
+func (c ClaimConfig) Convert(values []string) interface{} {
+	result, _ := c.parse(values)
+	return result
+}
+
+// parse is the same as Convert, but also returns the error about malformed values.
+func (c ClaimConfig) parse(values []string) (interface{}, error) {
+	if c.Separator != "" {
+		return strings.Join(values, c.Separator), nil
+	}
+	if c.Type == "" {
+		return CLAIM_TYPE_STRING.Parse(values)
+	}
+	return c.Type.Parse(values)
+}
+
+// render makes the claim value by the template.
+func (c ClaimConfig) render(attrs map[string][]string) (value interface{}, ok bool) {
+	rendered, err := c.Template.Execute(attrs)
+	if err != nil {
+		log.Warn().
+			Str("claim", c.Claim).
+			Str("template", c.Template.String()).
+			Err(err).
+			Msg("failed to render claim template; the claim is omitted")
+		return nil, false
+	}
+
+	if rendered == "" {
+		if c.Default == "" {
+			return nil, false
+		}
+		rendered = c.Default
+	}
+
+	v, err := c.parse([]string{rendered})
+	if err != nil {
+		log.Warn().
+			Str("claim", c.Claim).
+			Str("template", c.Template.String()).
+			Str("type", c.Type.String()).
+			Err(err).
+			Msg("failed to parse rendered claim template; the malformed value is skipped")
+	}
+	return v, v != nil
+}
+
+// MappingClaims converts attributes to claims.
+// If the attribute is empty, the first non-empty attribute in Fallback is used instead.
+// Default of the claim is used if all of them are absent or empty, or no value is selected.
+// The claim is omitted if no value is selected and it has no default.
+// The claim of number, boolean, or json type is also omitted if the value is empty or malformed.
+//
+// If the claim has Template, the rendered string is used as the value instead of the attribute.
+// Default is used if it renders empty, and the claim is omitted if it has no default or the template fails.
+func MappingClaims(attrs map[string][]string, maps map[string][]ClaimConfig) map[string]interface{} {
 	result := make(map[string]interface{})
 
-	for name, values := range attrs {
-		conf := maps[name]
-		result[conf.Claim] = conf.Type.Convert(values)
+	for _, confs := range maps {
+		for _, conf := range confs {
+			if conf.Template.IsSet() {
+				if v, ok := conf.render(attrs); ok {
+					result[conf.Claim] = v
+				}
+				continue
+			}
+
+			values, selected, ok := conf.pick(attrs)
+			if !hasValue(selected) && conf.Default != "" {
+				result[conf.Claim] = conf.Convert([]string{conf.Default})
+			} else if ok && (len(selected) > 0 || len(values) == 0) {
+				v, err := conf.parse(selected)
+				if err != nil {
+					log.Warn().
+						Str("claim", conf.Claim).
+						Str("attribute", conf.Attribute).
+						Str("type", conf.Type.String()).
+						Err(err).
+						Msg("failed to parse attribute value; the malformed value is skipped")
+				}
+				if v != nil {
+					result[conf.Claim] = v
+				}
+			}
+		}
 	}
 
 	return result
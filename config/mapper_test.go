@@ -1,7 +1,9 @@
 package config_test
 
 import (
+	"fmt"
 	"reflect"
+	"sync"
 	"testing"
 
 	"github.com/macrat/lauth/config"
@@ -17,10 +19,21 @@ func TestClaimType(t *testing.T) {
 		{"", "", []string{"hello", "world"}, "hello"},
 		{"string", "", []string{"hello", "world"}, "hello"},
 		{"[]string", "", []string{"hello", "world"}, []string{"hello", "world"}},
-		{"number", "", []string{"hello", "world"}, float64(0)},
-		{"[]number", "", []string{"hello", "world"}, []float64{0, 0}},
+		{"number", "", []string{"hello", "world"}, nil},
+		{"[]number", "", []string{"hello", "world"}, []float64{}},
 		{"number", "", []string{"12.34", "56.78"}, float64(12.34)},
+		{"number", "", []string{"42"}, int64(42)},
+		{"number", "", []string{}, nil},
 		{"[]number", "", []string{"12.34", "56.78"}, []float64{12.34, 56.78}},
+		{"boolean", "", []string{"TRUE"}, true},
+		{"boolean", "", []string{"false"}, false},
+		{"boolean", "", []string{"1"}, true},
+		{"boolean", "", []string{"0"}, false},
+		{"boolean", "", []string{"yes"}, nil},
+		{"boolean", "", []string{}, nil},
+		{"json", "", []string{`{"a": [1, "b"]}`, "[]"}, map[string]interface{}{"a": []interface{}{float64(1), "b"}}},
+		{"json", "", []string{"not json"}, nil},
+		{"json", "", []string{}, nil},
 
 		{
 			Type:       "hoge",
@@ -53,10 +66,47 @@ func TestClaimType(t *testing.T) {
 	}
 }
 
+func TestClaimType_ParseError(t *testing.T) {
+	tests := []struct {
+		Type   config.ClaimType
+		Expect error
+	}{
+		{config.CLAIM_TYPE_NUMBER, config.InvalidNumberError},
+		{config.CLAIM_TYPE_NUMBER_LIST, config.InvalidNumberError},
+		{config.CLAIM_TYPE_BOOLEAN, config.InvalidBooleanError},
+		{config.CLAIM_TYPE_JSON, config.InvalidJSONError},
+	}
+
+	for _, tt := range tests {
+		_, err := tt.Type.Parse([]string{"secret-value"})
+		if err != tt.Expect {
+			t.Errorf("%s: expected %v but got %v", tt.Type, tt.Expect, err)
+		}
+	}
+}
+
+func TestClaimConfig_Convert(t *testing.T) {
+	tests := []struct {
+		Config config.ClaimConfig
+		Expect interface{}
+	}{
+		{config.ClaimConfig{Type: config.CLAIM_TYPE_STRING_LIST}, []string{"hello", "world"}},
+		{config.ClaimConfig{Type: config.CLAIM_TYPE_STRING_LIST, Separator: " "}, "hello world"},
+		{config.ClaimConfig{Type: config.CLAIM_TYPE_STRING, Separator: ","}, "hello,world"},
+	}
+
+	for _, tt := range tests {
+		got := tt.Config.Convert([]string{"hello", "world"})
+		if !reflect.DeepEqual(tt.Expect, got) {
+			t.Errorf("%#v: expected %#v but got %#v", tt.Config, tt.Expect, got)
+		}
+	}
+}
+
 func TestMappingClaims(t *testing.T) {
 	tests := []struct {
 		Attrs  map[string][]string
-		Maps   map[string]config.ClaimConfig
+		Maps   map[string][]config.ClaimConfig
 		Expect map[string]interface{}
 	}{
 		{
@@ -66,27 +116,27 @@ func TestMappingClaims(t *testing.T) {
 				"baz_attr": nil,
 				"qux_attr": {"qux1", "qux2"},
 			},
-			Maps: map[string]config.ClaimConfig{
-				"foo_attr": {
+			Maps: map[string][]config.ClaimConfig{
+				"foo_attr": {{
 					Claim:     "foo_claim",
 					Attribute: "foo_attr",
 					Type:      config.CLAIM_TYPE_STRING_LIST,
-				},
-				"bar_attr": {
+				}},
+				"bar_attr": {{
 					Claim:     "bar_claim",
 					Attribute: "bar_attr",
 					Type:      config.CLAIM_TYPE_STRING,
-				},
-				"baz_attr": {
+				}},
+				"baz_attr": {{
 					Claim:     "baz_claim",
 					Attribute: "baz_attr",
 					Type:      config.CLAIM_TYPE_STRING,
-				},
-				"qux_attr": {
+				}},
+				"qux_attr": {{
 					Claim:     "qux_claim",
 					Attribute: "qux_attr",
 					Type:      config.CLAIM_TYPE_STRING,
-				},
+				}},
 			},
 			Expect: map[string]interface{}{
 				"foo_claim": []string{"foo1", "foo2"},
@@ -103,39 +153,166 @@ func TestMappingClaims(t *testing.T) {
 				"strs_attr": {"1ab", "cd2", "3"},
 				"nil_attr":  nil,
 			},
-			Maps: map[string]config.ClaimConfig{
-				"num_attr": {
+			Maps: map[string][]config.ClaimConfig{
+				"num_attr": {{
 					Claim:     "num_claim",
 					Attribute: "num_attr",
 					Type:      config.CLAIM_TYPE_NUMBER,
-				},
-				"nums_attr": {
+				}},
+				"nums_attr": {{
 					Claim:     "nums_claim",
 					Attribute: "nums_attr",
 					Type:      config.CLAIM_TYPE_NUMBER_LIST,
-				},
-				"str_attr": {
+				}},
+				"str_attr": {{
 					Claim:     "str_claim",
 					Attribute: "str_attr",
 					Type:      config.CLAIM_TYPE_NUMBER,
-				},
-				"strs_attr": {
+				}},
+				"strs_attr": {{
 					Claim:     "strs_claim",
 					Attribute: "strs_attr",
 					Type:      config.CLAIM_TYPE_NUMBER_LIST,
-				},
-				"nil_attr": {
+				}},
+				"nil_attr": {{
 					Claim:     "nil_claim",
 					Attribute: "nil_attr",
 					Type:      config.CLAIM_TYPE_NUMBER,
-				},
+				}},
 			},
 			Expect: map[string]interface{}{
-				"num_claim":  float64(123),
+				"num_claim":  int64(123),
 				"nums_claim": []float64{1.2, 3},
-				"str_claim":  float64(0),
-				"strs_claim": []float64{0, 0, 3},
-				"nil_claim":  float64(0),
+				"strs_claim": []float64{3},
+			},
+		},
+		{
+			Attrs: map[string][]string{
+				"present_attr": {"ja"},
+				"empty_attr":   nil,
+			},
+			Maps: map[string][]config.ClaimConfig{
+				"present_attr": {{
+					Claim:     "present_claim",
+					Attribute: "present_attr",
+					Type:      config.CLAIM_TYPE_STRING,
+					Default:   "en",
+				}},
+				"empty_attr": {{
+					Claim:     "empty_claim",
+					Attribute: "empty_attr",
+					Type:      config.CLAIM_TYPE_STRING,
+					Default:   "en",
+				}},
+				"missing_attr": {{
+					Claim:     "missing_claim",
+					Attribute: "missing_attr",
+					Type:      config.CLAIM_TYPE_NUMBER,
+					Default:   "42",
+				}, {
+					Claim:     "missing_list_claim",
+					Attribute: "missing_attr",
+					Type:      config.CLAIM_TYPE_STRING_LIST,
+					Default:   "42",
+				}},
+				"no_default_attr": {{
+					Claim:     "no_default_claim",
+					Attribute: "no_default_attr",
+					Type:      config.CLAIM_TYPE_STRING,
+				}},
+			},
+			Expect: map[string]interface{}{
+				"present_claim":      "ja",
+				"empty_claim":        "en",
+				"missing_claim":      int64(42),
+				"missing_list_claim": []string{"42"},
+			},
+		},
+		{
+			Attrs: map[string][]string{
+				"displayName":    {""},
+				"cn":             nil,
+				"sAMAccountName": {"macrat"},
+				"mail":           {"macrat@example.com"},
+				"proxyAddresses": {"smtp:alias@example.com", "SMTP:primary@example.com"},
+				"employeeNumber": {"42"},
+			},
+			Maps: map[string][]config.ClaimConfig{
+				"displayName": {{
+					Claim:     "name",
+					Attribute: "displayName",
+					Fallback:  []string{"cn", "sAMAccountName"},
+				}, {
+					Claim:     "nickname",
+					Attribute: "displayName",
+					Fallback:  []string{"cn", "missing"},
+					Default:   "anonymous",
+				}, {
+					Claim:     "no_fallback_name",
+					Attribute: "displayName",
+				}},
+				"mail": {{
+					Claim:     "email",
+					Attribute: "mail",
+					Fallback:  []string{"sAMAccountName"},
+				}},
+				"missing": {{
+					Claim:     "primary_email",
+					Attribute: "missing",
+					Fallback:  []string{"proxyAddresses", "mail"},
+					Prefix:    "SMTP:",
+				}, {
+					Claim:     "employee_number",
+					Attribute: "missing",
+					Fallback:  []string{"employeeNumber"},
+					Type:      config.CLAIM_TYPE_NUMBER,
+				}},
+			},
+			Expect: map[string]interface{}{
+				"name":             "macrat",
+				"nickname":         "anonymous",
+				"no_fallback_name": "",
+				"email":            "macrat@example.com",
+				"primary_email":    "primary@example.com",
+				"employee_number":  int64(42),
+			},
+		},
+		{
+			Attrs: map[string][]string{
+				"proxyAddresses": {"smtp:alias@example.com", "SMTP:primary@example.com", "X400:c=US;a= ;p=Example", "smtp:other@example.com"},
+				"otherAddresses": {"smtp:alias@example.com"},
+			},
+			Maps: map[string][]config.ClaimConfig{
+				"proxyAddresses": {{
+					Claim:     "email",
+					Attribute: "proxyAddresses",
+					Prefix:    "SMTP:",
+				}, {
+					Claim:     "aliases",
+					Attribute: "proxyAddresses",
+					Type:      config.CLAIM_TYPE_STRING_LIST,
+					Match:     config.MustCompileRegexp("^smtp:(.*)$"),
+				}, {
+					Claim:     "x400",
+					Attribute: "proxyAddresses",
+					Match:     config.MustCompileRegexp("^X400:"),
+				}},
+				"otherAddresses": {{
+					Claim:     "other_email",
+					Attribute: "otherAddresses",
+					Prefix:    "SMTP:",
+				}, {
+					Claim:     "fallback_email",
+					Attribute: "otherAddresses",
+					Prefix:    "SMTP:",
+					Default:   "nobody@example.com",
+				}},
+			},
+			Expect: map[string]interface{}{
+				"email":          "primary@example.com",
+				"aliases":        []string{"alias@example.com", "other@example.com"},
+				"x400":           "X400:",
+				"fallback_email": "nobody@example.com",
 			},
 		},
 	}
@@ -147,3 +324,155 @@ func TestMappingClaims(t *testing.T) {
 		}
 	}
 }
+
+func TestMappingClaims_JSON(t *testing.T) {
+	attrs := map[string][]string{
+		"preferences": {`{"theme": "dark", "languages": ["ja", "en"]}`},
+		"roles":       {`["admin", "user"]`},
+		"broken":      {`{"theme": `},
+		"empty":       {""},
+	}
+	maps := map[string][]config.ClaimConfig{
+		"preferences": {{Claim: "preferences", Attribute: "preferences", Type: config.CLAIM_TYPE_JSON}},
+		"roles":       {{Claim: "roles", Attribute: "roles", Type: config.CLAIM_TYPE_JSON}},
+		"broken":      {{Claim: "broken", Attribute: "broken", Type: config.CLAIM_TYPE_JSON}},
+		"empty":       {{Claim: "empty", Attribute: "empty", Type: config.CLAIM_TYPE_JSON}},
+		"missing":     {{Claim: "missing", Attribute: "missing", Type: config.CLAIM_TYPE_JSON, Default: `{"theme": "light"}`}},
+	}
+
+	expect := map[string]interface{}{
+		"preferences": map[string]interface{}{
+			"theme":     "dark",
+			"languages": []interface{}{"ja", "en"},
+		},
+		"roles":   []interface{}{"admin", "user"},
+		"missing": map[string]interface{}{"theme": "light"},
+	}
+
+	got := config.MappingClaims(attrs, maps)
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected claims:\nexpected: %#v\n but got: %#v", expect, got)
+	}
+}
+
+func TestMappingClaims_Boolean(t *testing.T) {
+	attrs := map[string][]string{
+		"enabled":  {"TRUE"},
+		"locked":   {"0"},
+		"broken":   {"maybe"},
+		"empty":    {""},
+		"nickname": {"macrat"},
+	}
+	maps := map[string][]config.ClaimConfig{
+		"enabled":  {{Claim: "enabled", Attribute: "enabled", Type: config.CLAIM_TYPE_BOOLEAN}},
+		"locked":   {{Claim: "locked", Attribute: "locked", Type: config.CLAIM_TYPE_BOOLEAN}},
+		"broken":   {{Claim: "broken", Attribute: "broken", Type: config.CLAIM_TYPE_BOOLEAN}},
+		"empty":    {{Claim: "empty", Attribute: "empty", Type: config.CLAIM_TYPE_BOOLEAN}},
+		"nickname": {{Claim: "nickname_is_number", Attribute: "nickname", Type: config.CLAIM_TYPE_NUMBER}},
+		"missing":  {{Claim: "missing", Attribute: "missing", Type: config.CLAIM_TYPE_BOOLEAN, Default: "FALSE"}},
+	}
+
+	expect := map[string]interface{}{
+		"enabled": true,
+		"locked":  false,
+		"missing": false,
+	}
+
+	got := config.MappingClaims(attrs, maps)
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected claims:\nexpected: %#v\n but got: %#v", expect, got)
+	}
+}
+
+func TestMappingClaims_Template(t *testing.T) {
+	attrs := map[string][]string{
+		"sAMAccountName": {"MacRat"},
+		"memberOf":       {"admin", "user"},
+		"employeeNumber": {"42"},
+	}
+	maps := map[string][]config.ClaimConfig{
+		"": {
+			{Claim: "preferred_username", Template: config.MustCompileClaimTemplate("{{ lower .sAMAccountName }}")},
+			{Claim: "shout", Template: config.MustCompileClaimTemplate("{{ upper .sAMAccountName }}!")},
+			{Claim: "groups", Template: config.MustCompileClaimTemplate(`{{ attr "memberOf" | join "," }}`)},
+			{Claim: "employee_id", Template: config.MustCompileClaimTemplate("E{{ .employeeNumber }}")},
+			{Claim: "employee_number", Template: config.MustCompileClaimTemplate("{{ .employeeNumber }}"), Type: config.CLAIM_TYPE_NUMBER},
+			{Claim: "email", Template: config.MustCompileClaimTemplate("{{ .mail }}")},
+			{Claim: "locale", Template: config.MustCompileClaimTemplate("{{ .preferredLanguage }}"), Default: "en"},
+			{Claim: "broken", Template: config.MustCompileClaimTemplate("{{ index .sAMAccountName 100 }}")},
+		},
+	}
+
+	expect := map[string]interface{}{
+		"preferred_username": "macrat",
+		"shout":              "MACRAT!",
+		"groups":             "admin,user",
+		"employee_id":        "E42",
+		"employee_number":    int64(42),
+		"locale":             "en",
+	}
+
+	got := config.MappingClaims(attrs, maps)
+	if !reflect.DeepEqual(got, expect) {
+		t.Errorf("unexpected claims:\nexpected: %#v\n but got: %#v", expect, got)
+	}
+}
+
+func TestClaimTemplate_Attributes(t *testing.T) {
+	tests := []struct {
+		Template string
+		Expect   []string
+	}{
+		{"{{ .uid }}@example.com", []string{"uid"}},
+		{`{{ if .mail }}{{ .mail }}{{ else }}{{ .uid }}{{ end }}`, []string{"mail", "uid"}},
+		{`{{ attr "memberOf" | join " " }}`, []string{"memberOf"}},
+		{"static", nil},
+	}
+
+	for _, tt := range tests {
+		got := config.MustCompileClaimTemplate(tt.Template).Attributes()
+		if !reflect.DeepEqual(got, tt.Expect) {
+			t.Errorf("%s: expected %#v but got %#v", tt.Template, tt.Expect, got)
+		}
+	}
+}
+
+func TestClaimTemplate_Execute(t *testing.T) {
+	tests := []struct {
+		Template string
+		Attrs    map[string][]string
+		Expect   string
+	}{
+		{"{{ .uid }}@example.com", map[string][]string{"uid": {"macrat", "other"}}, "macrat@example.com"},
+		{"[{{ .uid }}]", map[string][]string{}, "[]"},
+		{`{{ attr "memberOf" | join "," }}`, map[string][]string{"memberOf": {"a", "b"}}, "a,b"},
+		{`{{ "memberOf" | attr | join "," }}`, map[string][]string{"memberOf": {"a", "b"}}, "a,b"},
+		{`{{ range attr "memberOf" }}<{{ . }}>{{ end }}`, map[string][]string{"memberOf": {"a", "b"}}, "<a><b>"},
+		{`{{ join "," (attr "memberOf") }}`, map[string][]string{}, ""},
+	}
+
+	for _, tt := range tests {
+		got, err := config.MustCompileClaimTemplate(tt.Template).Execute(tt.Attrs)
+		if err != nil {
+			t.Errorf("%s: failed to execute: %s", tt.Template, err)
+		} else if got != tt.Expect {
+			t.Errorf("%s: expected %#v but got %#v", tt.Template, tt.Expect, got)
+		}
+	}
+
+	tmpl := config.MustCompileClaimTemplate(`{{ .uid }}:{{ attr "memberOf" | join "," }}`)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+
+			uid := fmt.Sprint("user", i)
+			got, err := tmpl.Execute(map[string][]string{"uid": {uid}, "memberOf": {uid + "-group"}})
+			if expect := uid + ":" + uid + "-group"; err != nil || got != expect {
+				t.Errorf("concurrent execution: expected %#v but got %#v (%v)", expect, got, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -1,12 +1,24 @@
 package config
 
 import (
+	"net/url"
+	"path"
+	"strings"
+
 	"github.com/gobwas/glob"
 )
 
+// globMeta is characters that have special meaning in glob patterns.
+const globMeta = `*?[]{}\`
+
 type Pattern struct {
 	matcher glob.Glob
 	pattern string
+
+	// origin and pathMatcher are for MatchURI.
+	// They are set only if the pattern has no wildcard in the scheme and the host.
+	origin      string
+	pathMatcher glob.Glob
 }
 
 func (p Pattern) MarshalText() ([]byte, error) {
@@ -21,10 +33,37 @@ func (p *Pattern) UnmarshalText(text []byte) error {
 
 	(*p).pattern = string(text)
 	(*p).matcher = pat
+	(*p).origin, (*p).pathMatcher = compilePathPattern(string(text))
 
 	return nil
 }
 
+// compilePathPattern splits the pattern into the origin and the path, and compiles the path as a glob.
+// It returns nil matcher if the scheme or the host has a wildcard.
+func compilePathPattern(pattern string) (string, glob.Glob) {
+	i := strings.Index(pattern, "://")
+	if i <= 0 {
+		return "", nil
+	}
+
+	rest := pattern[i+len("://"):]
+	slash := strings.Index(rest, "/")
+	if slash < 0 {
+		return "", nil
+	}
+
+	origin := pattern[:i+len("://")+slash]
+	if strings.ContainsAny(origin, globMeta) {
+		return "", nil
+	}
+
+	matcher, err := glob.Compile(rest[slash:], '/')
+	if err != nil {
+		return "", nil
+	}
+	return strings.ToLower(origin), matcher
+}
+
 func (p Pattern) String() string {
 	return p.pattern
 }
@@ -33,6 +72,57 @@ func (p Pattern) Match(url string) bool {
 	return p.matcher.Match(url)
 }
 
+// PathWildcardOnly reports whether the pattern has wildcards only in the path, so that it can be used by MatchURI.
+func (p Pattern) PathWildcardOnly() bool {
+	return p.pathMatcher != nil
+}
+
+// MatchURI matches the URI by the structure of URL, for redirect_uri.
+//
+// The scheme and the host are compared exactly, and wildcards work only in the path and the query.
+// The path is normalized before matching, so "/app/../admin" never matches to "/app/**".
+// URIs that have userinfo or fragment are always rejected.
+// Backslashes in the path are rejected as well, because some browsers treat them as "/" and it would bypass the normalization.
+func (p Pattern) MatchURI(uri string) bool {
+	if p.pathMatcher == nil {
+		return false
+	}
+
+	u, err := url.Parse(uri)
+	if err != nil || !u.IsAbs() || u.Opaque != "" || u.User != nil || u.Fragment != "" || strings.Contains(uri, "#") {
+		return false
+	}
+	if strings.Contains(u.Path, "\\") {
+		return false
+	}
+
+	if strings.ToLower(u.Scheme+"://"+u.Host) != p.origin {
+		return false
+	}
+
+	return p.pathMatcher.Match(normalizePath(u.Path) + querySuffix(u))
+}
+
+// normalizePath resolves "." and ".." in the path.
+func normalizePath(p string) string {
+	if p == "" {
+		return "/"
+	}
+
+	cleaned := path.Clean("/" + p)
+	if strings.HasSuffix(p, "/") && cleaned != "/" {
+		cleaned += "/"
+	}
+	return cleaned
+}
+
+func querySuffix(u *url.URL) string {
+	if u.RawQuery == "" && !u.ForceQuery {
+		return ""
+	}
+	return "?" + u.RawQuery
+}
+
 type PatternSet []Pattern
 
 func (ps PatternSet) Match(url string) bool {
@@ -43,3 +133,13 @@ func (ps PatternSet) Match(url string) bool {
 	}
 	return false
 }
+
+// MatchURI checks the URI by Pattern.MatchURI of each pattern.
+func (ps PatternSet) MatchURI(uri string) bool {
+	for _, p := range ps {
+		if p.MatchURI(uri) {
+			return true
+		}
+	}
+	return false
+}
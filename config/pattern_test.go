@@ -55,3 +55,83 @@ func TestPattern(t *testing.T) {
 		}
 	}
 }
+
+func TestPattern_MatchURI(t *testing.T) {
+	tests := []struct {
+		Pattern string
+		Input   string
+		Match   bool
+	}{
+		{"https://example.com/app/*", "https://example.com/app/callback", true},
+		{"https://example.com/app/*", "https://EXAMPLE.com/app/callback", true},
+		{"https://example.com/app/**", "https://example.com/app/callback/oidc", true},
+		{"https://example.com/app/callback", "https://example.com/app/callback?from=login", false},
+		{"https://example.com/app/callback?*", "https://example.com/app/callback?from=login", true},
+		{"https://example.com/app/**", "https://example.com/app/./callback", true},
+
+		// Path traversal.
+		{"https://example.com/app/**", "https://example.com/app/../admin", false},
+		{"https://example.com/app/**", "https://example.com/app/%2e%2e/admin", false},
+		{"https://example.com/app/**", "https://example.com/app/callback/../../admin/callback", false},
+		{"https://example.com/app/*", "https://example.com/app/x/../callback", true},
+		{"https://example.com/app/*", "https://example.com/app/x/..", false},
+		{"https://example.com/app/**", `https://example.com/app/x\..\..\admin`, false},
+		{"https://example.com/app/**", "https://example.com/app/%5c..%5c..%5cadmin", false},
+		{"https://example.com/app/**", "https://example.com/app/..%5cadmin", false},
+
+		// Host confusion.
+		{"https://example.com/app/*", "https://evil.com/../app/callback", false},
+		{"https://example.com/app/*", "https://example.com@evil.com/app/callback", false},
+		{"https://example.com/app/*", "https://user@example.com/app/callback", false},
+		{"https://example.com/app/*", "https://example.com.evil.com/app/callback", false},
+		{"https://example.com/app/*", "https://example.com:8443/app/callback", false},
+		{"https://example.com/app/*", "http://example.com/app/callback", false},
+		{"https://example.com/app/*", "https://example.com/app/callback#fragment", false},
+		{"https://example.com/app/*", "//example.com/app/callback", false},
+
+		// Wildcards in the scheme or the host never match.
+		{"http*://example.com/app/*", "https://example.com/app/callback", false},
+		{"https://*.example.com/app/*", "https://www.example.com/app/callback", false},
+		{"https://example.com*", "https://example.com.evil.com/", false},
+	}
+
+	for _, tt := range tests {
+		p := &config.Pattern{}
+
+		if err := p.UnmarshalText([]byte(tt.Pattern)); err != nil {
+			t.Errorf("failed to parse pattern %#v: %s", tt.Pattern, err)
+			continue
+		}
+
+		if p.MatchURI(tt.Input) != tt.Match {
+			t.Errorf("%s with %s: expected match=%v", tt.Input, tt.Pattern, tt.Match)
+		}
+	}
+}
+
+func TestPattern_PathWildcardOnly(t *testing.T) {
+	tests := []struct {
+		Pattern string
+		Expect  bool
+	}{
+		{"https://example.com/app/**", true},
+		{"https://example.com:8443/callback", true},
+		{"http*://example.com/app/*", false},
+		{"https://*.example.com/app/*", false},
+		{"https://example.com*", false},
+		{"/app/callback", false},
+	}
+
+	for _, tt := range tests {
+		p := &config.Pattern{}
+
+		if err := p.UnmarshalText([]byte(tt.Pattern)); err != nil {
+			t.Errorf("failed to parse pattern %#v: %s", tt.Pattern, err)
+			continue
+		}
+
+		if p.PathWildcardOnly() != tt.Expect {
+			t.Errorf("%s: expected %v", tt.Pattern, tt.Expect)
+		}
+	}
+}
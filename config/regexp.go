@@ -0,0 +1,57 @@
+package config
+
+import (
+	"regexp"
+)
+
+type Regexp struct {
+	re *regexp.Regexp
+}
+
+func MustCompileRegexp(pattern string) Regexp {
+	return Regexp{regexp.MustCompile(pattern)}
+}
+
+func (r Regexp) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+func (r *Regexp) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		r.re = nil
+		return nil
+	}
+
+	re, err := regexp.Compile(string(text))
+	if err != nil {
+		return err
+	}
+	r.re = re
+
+	return nil
+}
+
+func (r Regexp) String() string {
+	if r.re == nil {
+		return ""
+	}
+	return r.re.String()
+}
+
+// IsSet reports whether the regular expression is configured.
+func (r Regexp) IsSet() bool {
+	return r.re != nil
+}
+
+// Extract returns the first capture group if the expression has it, or the whole matched string.
+// ok is false if value doesn't match.
+func (r Regexp) Extract(value string) (extracted string, ok bool) {
+	m := r.re.FindStringSubmatch(value)
+	if m == nil {
+		return "", false
+	}
+	if len(m) > 1 {
+		return m[1], true
+	}
+	return m[0], true
+}
@@ -0,0 +1,59 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// startupOptions are fields of Config that are used only on startup, such as for listening, routing, or connecting to LDAP.
+// Changes of them don't take effect by reloading.
+var startupOptions = []string{
+	"Issuer",
+	"IssuerHosts",
+	"Listen",
+	"ShutdownTimeout",
+	"ReadyTimeout",
+	"SignKey",
+	"ClientKeyCache",
+	"AudienceArray",
+	"JTIFormat",
+	"JTILength",
+	"TLS",
+	"LDAP",
+	"Endpoints",
+	"Tenants",
+	"Admin",
+	"Audit",
+	"Metrics",
+	"Templates",
+	"ErrorURI",
+	"DebugTokenPath",
+}
+
+// KeepStartupOptions overwrites options that are used only on startup by the values of prev.
+// It returns config keys of the options that were changed from prev, so the caller can tell they need restart.
+func (c *Config) KeepStartupOptions(prev *Config) []string {
+	var changed []string
+
+	cur := reflect.ValueOf(c).Elem()
+	old := reflect.ValueOf(prev).Elem()
+	typ := cur.Type()
+
+	for _, name := range startupOptions {
+		f, _ := typ.FieldByName(name)
+		if reflect.DeepEqual(cur.FieldByIndex(f.Index).Interface(), old.FieldByIndex(f.Index).Interface()) {
+			continue
+		}
+
+		changed = append(changed, strings.Split(f.Tag.Get("toml"), ",")[0])
+		cur.FieldByIndex(f.Index).Set(old.FieldByIndex(f.Index))
+	}
+
+	// SignKeyOverlap is nested in Expire, but the sign key reloader keeps using the config on startup.
+	if c.Expire.SignKeyOverlap != prev.Expire.SignKeyOverlap {
+		changed = append(changed, "expire.sign_key_overlap")
+		c.Expire.SignKeyOverlap = prev.Expire.SignKeyOverlap
+	}
+
+	return changed
+}
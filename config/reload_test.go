@@ -0,0 +1,59 @@
+package config_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/config"
+)
+
+func TestConfig_KeepStartupOptions(t *testing.T) {
+	prev := &config.Config{
+		Issuer:  &config.URL{Scheme: "https", Host: "auth.example.com"},
+		SignKey: "/etc/lauth/key.pem",
+		Expire: config.ExpireConfig{
+			Token:          config.Duration(time.Hour),
+			SignKeyOverlap: config.Duration(24 * time.Hour),
+		},
+		Clients: config.ClientConfigSet{
+			"old_client": {Name: "Old Client"},
+		},
+	}
+
+	next := &config.Config{
+		Issuer:    &config.URL{Scheme: "https", Host: "another.example.com"},
+		SignKey:   "/etc/lauth/key.pem",
+		JTIFormat: config.JTI_FORMAT_RANDOM,
+		JTILength: 32,
+		Expire: config.ExpireConfig{
+			Token:          config.Duration(2 * time.Hour),
+			SignKeyOverlap: config.Duration(time.Hour),
+		},
+		Clients: config.ClientConfigSet{
+			"new_client": {Name: "New Client"},
+		},
+	}
+
+	changed := next.KeepStartupOptions(prev)
+	if !reflect.DeepEqual(changed, []string{"issuer", "jti_format", "jti_length", "expire.sign_key_overlap"}) {
+		t.Errorf("unexpected changed options: %#v", changed)
+	}
+
+	if next.Issuer.String() != "https://auth.example.com" {
+		t.Errorf("issuer should be kept: %s", next.Issuer)
+	}
+	if next.JTIFormat != "" || next.JTILength != 0 {
+		t.Errorf("jti_format and jti_length should be kept: %#v %d", next.JTIFormat, next.JTILength)
+	}
+	if next.Expire.SignKeyOverlap != prev.Expire.SignKeyOverlap {
+		t.Errorf("sign_key_overlap should be kept: %s", next.Expire.SignKeyOverlap)
+	}
+
+	if next.Expire.Token != config.Duration(2*time.Hour) {
+		t.Errorf("expire.token should be updated: %s", next.Expire.Token)
+	}
+	if _, ok := next.Clients["new_client"]; !ok {
+		t.Errorf("clients should be updated: %#v", next.Clients)
+	}
+}
@@ -1,47 +1,154 @@
 package config
 
+import (
+	"sort"
+)
+
 func (sc ScopeConfig) ScopeNames() []string {
-	var ss []string
+	ss := make([]string, 0, len(sc))
 	for scope := range sc {
 		ss = append(ss, scope)
 	}
 	return ss
 }
 
+// AllClaims returns deduplicated and sorted names of all claims that any scope can produce.
 func (sc ScopeConfig) AllClaims() []string {
-	var claims []string
+	n := 0
+	for _, scope := range sc {
+		n += len(scope.Claims)
+	}
+
+	found := make(map[string]bool, n)
+	claims := make([]string, 0, n)
 	for _, scope := range sc {
-		for _, claim := range scope {
-			claims = append(claims, claim.Claim)
+		for _, claim := range scope.Claims {
+			if !found[claim.Claim] {
+				found[claim.Claim] = true
+				claims = append(claims, claim.Claim)
+			}
 		}
 	}
+	sort.Strings(claims)
 	return claims
 }
 
+func (sc ScopeConfig) countClaims(scopes []string) int {
+	n := 0
+	for _, scopeName := range scopes {
+		n += len(sc[scopeName].Claims)
+	}
+	return n
+}
+
+// AttributesFor returns deduplicated attribute names that needed for the scopes.
 func (sc ScopeConfig) AttributesFor(scopes []string) []string {
-	var claims []string
+	n := sc.countClaims(scopes)
+	found := make(map[string]bool, n)
+	attrs := make([]string, 0, n)
 
 	for _, scopeName := range scopes {
 		if scope, ok := sc[scopeName]; ok {
-			for _, x := range scope {
-				claims = append(claims, x.Attribute)
+			for _, x := range scope.Claims {
+				for _, attr := range x.Sources() {
+					if !found[attr] {
+						found[attr] = true
+						attrs = append(attrs, attr)
+					}
+				}
 			}
 		}
 	}
 
-	return claims
+	return attrs
 }
 
-func (sc ScopeConfig) ClaimMapFor(scopes []string) map[string]ClaimConfig {
-	claims := make(map[string]ClaimConfig)
+// ClaimMapFor returns map of attribute name to claims for the scopes.
+// An attribute can be mapped to multiple claims, but the same claim appears only once per attribute.
+func (sc ScopeConfig) ClaimMapFor(scopes []string) map[string][]ClaimConfig {
+	claims := make(map[string][]ClaimConfig, sc.countClaims(scopes))
 
 	for _, scopeName := range scopes {
 		if scope, ok := sc[scopeName]; ok {
-			for _, x := range scope {
-				claims[x.Attribute] = x
+			for _, x := range scope.Claims {
+				if !hasClaim(claims[x.Attribute], x.Claim) {
+					claims[x.Attribute] = append(claims[x.Attribute], x)
+				}
 			}
 		}
 	}
 
 	return claims
 }
+
+// ScopesForClaims returns scopes that produce the named claims, choosing from the candidates in order.
+// Each claim is taken from the first candidate that produces it, and claims that no candidate produces are ignored.
+func (sc ScopeConfig) ScopesForClaims(candidates, names []string) []string {
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	var scopes []string
+	for _, scopeName := range candidates {
+		scope, ok := sc[scopeName]
+		if !ok {
+			continue
+		}
+
+		found := false
+		for _, x := range scope.Claims {
+			if wanted[x.Claim] {
+				wanted[x.Claim] = false
+				found = true
+			}
+		}
+		if found {
+			scopes = append(scopes, scopeName)
+		}
+	}
+
+	return scopes
+}
+
+func hasClaim(claims []ClaimConfig, name string) bool {
+	for _, c := range claims {
+		if c.Claim == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ScopeDetail is a scope information for displaying on the consent page.
+type ScopeDetail struct {
+	Name        string
+	Title       string
+	Description string
+	Icon        string
+	Optional    bool
+	Preselected bool
+}
+
+// DetailsFor returns details of the scopes for displaying on the consent page.
+// The Title will be the scope name if it is not configured.
+// Scopes that not configured in this ScopeConfig are also included with only the name.
+func (sc ScopeConfig) DetailsFor(scopes []string) []ScopeDetail {
+	details := make([]ScopeDetail, 0, len(scopes))
+	for _, name := range scopes {
+		scope := sc[name]
+		detail := ScopeDetail{
+			Name:        name,
+			Title:       scope.Title,
+			Description: scope.Description,
+			Icon:        scope.Icon,
+			Optional:    scope.Optional,
+			Preselected: scope.Preselected,
+		}
+		if detail.Title == "" {
+			detail.Title = name
+		}
+		details = append(details, detail)
+	}
+	return details
+}
@@ -1,6 +1,7 @@
 package config_test
 
 import (
+	"fmt"
 	"reflect"
 	"sort"
 	"testing"
@@ -16,13 +17,13 @@ func SameStringSet(xs []string, ys []string) bool {
 
 func TestScopeConfig(t *testing.T) {
 	conf := config.ScopeConfig{
-		"profile": {
+		"profile": {Claims: []config.ClaimConfig{
 			{Claim: "name", Attribute: "DisplayName", Type: "string"},
 			{Claim: "given_name", Attribute: "GivenName", Type: "string"},
-		},
-		"email": {
+		}},
+		"email": {Claims: []config.ClaimConfig{
 			{Claim: "email", Attribute: "mail", Type: "string"},
-		},
+		}},
 	}
 
 	ss := conf.ScopeNames()
@@ -46,11 +47,157 @@ func TestScopeConfig(t *testing.T) {
 	}
 
 	maps := conf.ClaimMapFor([]string{"profile", "email"})
-	if !reflect.DeepEqual(maps, map[string]config.ClaimConfig{
-		"DisplayName": {Claim: "name", Attribute: "DisplayName", Type: "string"},
-		"GivenName":   {Claim: "given_name", Attribute: "GivenName", Type: "string"},
-		"mail":        {Claim: "email", Attribute: "mail", Type: "string"},
+	if !reflect.DeepEqual(maps, map[string][]config.ClaimConfig{
+		"DisplayName": {{Claim: "name", Attribute: "DisplayName", Type: "string"}},
+		"GivenName":   {{Claim: "given_name", Attribute: "GivenName", Type: "string"}},
+		"mail":        {{Claim: "email", Attribute: "mail", Type: "string"}},
 	}) {
 		t.Errorf("ClaimMapFor returns unexpected value: %#v", maps)
 	}
+
+	conf["profile"].Claims[0].Fallback = []string{"cn", "mail"}
+	ss = conf.AttributesFor([]string{"profile", "email"})
+	if !SameStringSet(ss, []string{"mail", "DisplayName", "GivenName", "cn"}) {
+		t.Errorf("AttributesFor returns unexpected value with fallback: %#v", ss)
+	}
+
+	if ss = conf.AttributesFor([]string{}); len(ss) != 0 {
+		t.Errorf("AttributesFor returns unexpected value for empty scopes: %#v", ss)
+	}
+
+	if maps = conf.ClaimMapFor([]string{}); len(maps) != 0 {
+		t.Errorf("ClaimMapFor returns unexpected value for empty scopes: %#v", maps)
+	}
+}
+
+func TestScopeConfig_ScopesForClaims(t *testing.T) {
+	conf := config.ScopeConfig{
+		"profile": {Claims: []config.ClaimConfig{
+			{Claim: "name", Attribute: "displayName", Type: "string"},
+			{Claim: "email", Attribute: "userPrincipalName", Type: "string"},
+		}},
+		"email": {Claims: []config.ClaimConfig{
+			{Claim: "email", Attribute: "mail", Type: "string"},
+		}},
+		"phone": {Claims: []config.ClaimConfig{
+			{Claim: "phone_number", Attribute: "telephoneNumber", Type: "string"},
+		}},
+	}
+
+	tests := []struct {
+		Candidates []string
+		Names      []string
+		Expect     []string
+	}{
+		{[]string{"email", "phone", "profile"}, []string{"email", "unknown"}, []string{"email"}},
+		{[]string{"profile", "email"}, []string{"email", "name"}, []string{"profile"}},
+		{[]string{"email", "profile"}, []string{"email", "name"}, []string{"email", "profile"}},
+		{[]string{"email", "unknown"}, []string{"phone_number"}, nil},
+		{[]string{"profile"}, nil, nil},
+	}
+
+	for _, tt := range tests {
+		if scopes := conf.ScopesForClaims(tt.Candidates, tt.Names); !reflect.DeepEqual(scopes, tt.Expect) {
+			t.Errorf("ScopesForClaims(%#v, %#v) returns unexpected value: %#v", tt.Candidates, tt.Names, scopes)
+		}
+	}
+}
+
+func TestScopeConfig_Overlapping(t *testing.T) {
+	conf := config.ScopeConfig{
+		"profile": {Claims: []config.ClaimConfig{
+			{Claim: "name", Attribute: "displayName", Type: "string"},
+			{Claim: "preferred_username", Attribute: "mail", Type: "string"},
+		}},
+		"email": {Claims: []config.ClaimConfig{
+			{Claim: "email", Attribute: "mail", Type: "string"},
+			{Claim: "name", Attribute: "displayName", Type: "string"},
+		}},
+	}
+
+	attrs := conf.AttributesFor([]string{"profile", "email"})
+	if !SameStringSet(attrs, []string{"displayName", "mail"}) {
+		t.Errorf("AttributesFor returns unexpected value: %#v", attrs)
+	}
+
+	maps := conf.ClaimMapFor([]string{"profile", "email"})
+	if !reflect.DeepEqual(maps, map[string][]config.ClaimConfig{
+		"displayName": {
+			{Claim: "name", Attribute: "displayName", Type: "string"},
+		},
+		"mail": {
+			{Claim: "preferred_username", Attribute: "mail", Type: "string"},
+			{Claim: "email", Attribute: "mail", Type: "string"},
+		},
+	}) {
+		t.Errorf("ClaimMapFor returns unexpected value: %#v", maps)
+	}
+
+	claims := config.MappingClaims(map[string][]string{
+		"displayName": {"John Smith"},
+		"mail":        {"john@example.com"},
+	}, maps)
+	if !reflect.DeepEqual(claims, map[string]interface{}{
+		"name":               "John Smith",
+		"preferred_username": "john@example.com",
+		"email":              "john@example.com",
+	}) {
+		t.Errorf("MappingClaims returns unexpected value: %#v", claims)
+	}
+}
+
+func TestScopeConfig_DetailsFor(t *testing.T) {
+	conf := config.ScopeConfig{
+		"profile": {
+			Title:       "Profile",
+			Description: "Your name.",
+			Icon:        "https://example.com/profile.png",
+		},
+		"email": {},
+	}
+
+	details := conf.DetailsFor([]string{"email", "profile", "unknown"})
+	if !reflect.DeepEqual(details, []config.ScopeDetail{
+		{Name: "email", Title: "email"},
+		{Name: "profile", Title: "Profile", Description: "Your name.", Icon: "https://example.com/profile.png"},
+		{Name: "unknown", Title: "unknown"},
+	}) {
+		t.Errorf("DetailsFor returns unexpected value: %#v", details)
+	}
+}
+
+func makeLargeScopeConfig(numScopes, numClaims int) config.ScopeConfig {
+	conf := make(config.ScopeConfig, numScopes)
+	for i := 0; i < numScopes; i++ {
+		claims := make([]config.ClaimConfig, numClaims)
+		for j := range claims {
+			claims[j] = config.ClaimConfig{
+				Claim:     fmt.Sprintf("claim_%d_%d", i, j),
+				Attribute: fmt.Sprintf("attr%d_%d", i, j),
+				Type:      "string",
+			}
+		}
+		conf[fmt.Sprintf("scope%d", i)] = config.Scope{Claims: claims}
+	}
+	return conf
+}
+
+func BenchmarkScopeConfig_AttributesFor(b *testing.B) {
+	conf := makeLargeScopeConfig(1000, 10)
+	scopes := []string{"openid", "scope1", "scope10", "scope100", "scope999"}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		conf.AttributesFor(scopes)
+	}
+}
+
+func BenchmarkScopeConfig_ClaimMapFor(b *testing.B) {
+	conf := makeLargeScopeConfig(1000, 10)
+	scopes := []string{"openid", "scope1", "scope10", "scope100", "scope999"}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		conf.ClaimMapFor(scopes)
+	}
 }
@@ -0,0 +1,199 @@
+package config
+
+import (
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+// claimTemplateFuncs are helper functions that can be used in ClaimTemplate.
+var claimTemplateFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"join": func(sep string, values []string) string {
+		return strings.Join(values, sep)
+	},
+	// attr is called as `attr $ "name"`, because bindAttributeValues passes the root data to it.
+	"attr": func(data map[string]interface{}, name string) []string {
+		all, _ := data[allValuesKey].(map[string][]string)
+		return all[name]
+	},
+}
+
+// allValuesKey is the key of the template data that holds all values of the attributes for `attr`.
+// It is empty, so it can't be referred as `.name` in the template.
+const allValuesKey = ""
+
+// ClaimTemplate is a text/template to make a claim value from LDAP attributes.
+//
+// In the template, `.name` is the first value of the attribute, and `attr "name"` is all values of it.
+// Missing attributes are empty.
+type ClaimTemplate struct {
+	text  string
+	tmpl  *template.Template
+	attrs []string
+}
+
+func MustCompileClaimTemplate(text string) ClaimTemplate {
+	var t ClaimTemplate
+	if err := t.UnmarshalText([]byte(text)); err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func (t ClaimTemplate) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *ClaimTemplate) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*t = ClaimTemplate{}
+		return nil
+	}
+
+	tmpl, err := template.New("claim").Funcs(claimTemplateFuncs).Option("missingkey=zero").Parse(string(text))
+	if err != nil {
+		return err
+	}
+
+	t.text = string(text)
+	t.attrs = templateAttributes(tmpl)
+	t.tmpl = bindAttributeValues(tmpl)
+
+	return nil
+}
+
+func (t ClaimTemplate) String() string {
+	return t.text
+}
+
+// IsSet reports whether the template is configured.
+func (t ClaimTemplate) IsSet() bool {
+	return t.tmpl != nil
+}
+
+// Attributes returns names of attributes that the template refers.
+func (t ClaimTemplate) Attributes() []string {
+	return t.attrs
+}
+
+// Execute renders the template with the attributes.
+// The template is shared by all requests, so it is not modified here.
+func (t ClaimTemplate) Execute(attrs map[string][]string) (string, error) {
+	data := make(map[string]interface{}, len(t.attrs)+len(attrs)+1)
+	for _, name := range t.attrs {
+		data[name] = ""
+	}
+	for name, values := range attrs {
+		if len(values) > 0 {
+			data[name] = values[0]
+		}
+	}
+	data[allValuesKey] = attrs
+
+	var buf strings.Builder
+	if err := t.tmpl.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// templateAttributes collects attribute names that referred as `.name` or `attr "name"` in the template.
+func templateAttributes(tmpl *template.Template) []string {
+	found := make(map[string]bool)
+	var attrs []string
+	add := func(name string) {
+		if !found[name] {
+			found[name] = true
+			attrs = append(attrs, name)
+		}
+	}
+
+	walkTemplate(tmpl, func(node parse.Node) {
+		switch n := node.(type) {
+		case *parse.CommandNode:
+			if isAttrCall(n) && len(n.Args) == 2 {
+				if s, ok := n.Args[1].(*parse.StringNode); ok {
+					add(s.Text)
+				}
+			}
+		case *parse.FieldNode:
+			add(n.Ident[0])
+		}
+	})
+
+	return attrs
+}
+
+// bindAttributeValues rewrites `attr "name"` in the template to `attr $ "name"`, to let attr read all values from the root data.
+// It is done once on loading, so executions can share the template without cloning it.
+func bindAttributeValues(tmpl *template.Template) *template.Template {
+	walkTemplate(tmpl, func(node parse.Node) {
+		if n, ok := node.(*parse.CommandNode); ok && isAttrCall(n) {
+			root := &parse.VariableNode{NodeType: parse.NodeVariable, Pos: n.Args[0].Position(), Ident: []string{"$"}}
+			n.Args = append([]parse.Node{n.Args[0], root}, n.Args[1:]...)
+		}
+	})
+	return tmpl
+}
+
+// isAttrCall reports whether the command is `attr "name"`, or `attr` that takes the name from the pipeline.
+func isAttrCall(cmd *parse.CommandNode) bool {
+	if len(cmd.Args) == 0 || len(cmd.Args) > 2 {
+		return false
+	}
+	ident, ok := cmd.Args[0].(*parse.IdentifierNode)
+	return ok && ident.Ident == "attr"
+}
+
+// walkTemplate calls f for each node in all templates of tmpl.
+func walkTemplate(tmpl *template.Template, f func(parse.Node)) {
+	var walk func(node parse.Node)
+	walk = func(node parse.Node) {
+		f(node)
+
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, x := range n.Nodes {
+				walk(x)
+			}
+		case *parse.ActionNode:
+			walk(n.Pipe)
+		case *parse.IfNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.RangeNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.WithNode:
+			walk(n.Pipe)
+			walk(n.List)
+			walk(n.ElseList)
+		case *parse.TemplateNode:
+			walk(n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				walk(cmd)
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(arg)
+			}
+		}
+	}
+
+	for _, t := range tmpl.Templates() {
+		if t.Tree != nil {
+			walk(t.Root)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"net/url"
+	"strings"
 )
 
 type URL url.URL
@@ -21,6 +22,37 @@ func (u *URL) Hostname() string {
 	return u.URL().Hostname()
 }
 
+// Normalize returns the URL string in the normalized form for comparison.
+//
+// The scheme and host are lower-cased, the default port of the scheme is removed, and trailing slashes of the path are trimmed.
+func (u *URL) Normalize() string {
+	if u == nil {
+		return ""
+	}
+
+	n := *u.URL()
+	n.Scheme = strings.ToLower(n.Scheme)
+	n.Host = strings.ToLower(n.Host)
+	if (n.Scheme == "http" && n.Port() == "80") || (n.Scheme == "https" && n.Port() == "443") {
+		n.Host = n.Hostname()
+		if strings.Contains(n.Host, ":") {
+			n.Host = "[" + n.Host + "]"
+		}
+	}
+	n.Path = strings.TrimRight(n.Path, "/")
+	n.RawPath = ""
+	return n.String()
+}
+
+// Equivalent reports whether the raw URL string points the same as this URL after normalized.
+func (u *URL) Equivalent(raw string) bool {
+	other := new(URL)
+	if err := other.UnmarshalText([]byte(raw)); err != nil {
+		return false
+	}
+	return other.Normalize() == u.Normalize()
+}
+
 func (u *URL) UnmarshalText(text []byte) error {
 	parsed, err := url.Parse(string(text))
 	if err != nil {
@@ -0,0 +1,43 @@
+package config_test
+
+import (
+	"testing"
+
+	"github.com/macrat/lauth/config"
+)
+
+func TestURL_Equivalent(t *testing.T) {
+	tests := []struct {
+		Base   string
+		Input  string
+		Expect bool
+	}{
+		{"https://example.com", "https://example.com", true},
+		{"https://example.com", "https://example.com/", true},
+		{"https://example.com/", "https://example.com", true},
+		{"https://example.com", "https://example.com:443", true},
+		{"https://example.com", "HTTPS://Example.COM/", true},
+		{"http://example.com:80/path/to", "http://example.com/path/to/", true},
+		{"http://[::1]:80", "http://[::1]", true},
+		{"https://example.com:8443", "https://example.com:8443/", true},
+
+		{"https://example.com", "http://example.com", false},
+		{"https://example.com", "https://example.com:80", false},
+		{"https://example.com", "https://another.example.com", false},
+		{"https://example.com/path", "https://example.com/another", false},
+		{"https://example.com/path", "https://example.com/PATH", false},
+		{"https://example.com", "", false},
+		{"https://example.com", "%%invalid", false},
+	}
+
+	for _, tt := range tests {
+		base := new(config.URL)
+		if err := base.UnmarshalText([]byte(tt.Base)); err != nil {
+			t.Fatalf("failed to parse %#v: %s", tt.Base, err)
+		}
+
+		if result := base.Equivalent(tt.Input); result != tt.Expect {
+			t.Errorf("%#v.Equivalent(%#v) = %v but expected %v", tt.Base, tt.Input, result, tt.Expect)
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package main_test
+
+import (
+	"testing"
+
+	"github.com/macrat/lauth"
+	"github.com/macrat/lauth/config"
+)
+
+func TestValidateDebugOptions(t *testing.T) {
+	tests := []struct {
+		Path  string
+		Debug bool
+		Error bool
+	}{
+		{"", false, false},
+		{"", true, false},
+		{"/debug/token", true, false},
+		{"/debug/token", false, true},
+	}
+
+	for _, tt := range tests {
+		err := main.ValidateDebugOptions(&config.Config{DebugTokenPath: tt.Path}, tt.Debug)
+		if tt.Error && err == nil {
+			t.Errorf("path=%#v debug=%v: expected error but got nil", tt.Path, tt.Debug)
+		} else if !tt.Error && err != nil {
+			t.Errorf("path=%#v debug=%v: unexpected error: %s", tt.Path, tt.Debug, err)
+		}
+	}
+}
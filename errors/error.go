@@ -3,15 +3,25 @@ package errors
 import (
 	"net/http"
 	"net/url"
+	"time"
 )
 
 type Error struct {
 	Err          error    `json:"-"`
 	RedirectURI  *url.URL `json:"-"`
 	ResponseType string   `json:"-"`
+	ResponseMode string   `json:"-"`
 	State        string   `json:"state,omitempty"`
+	HasState     bool     `json:"-"`
+	Issuer       string   `json:"-"`
 	Reason       Reason   `json:"error"`
 	Description  string   `json:"error_description,omitempty"`
+	URI          string   `json:"error_uri,omitempty"`
+
+	RetryAfter time.Duration `json:"-"`
+
+	// Scope is the scope that the resource requires, for insufficient_scope error.
+	Scope string `json:"-"`
 }
 
 func (e *Error) Unwrap() error {
@@ -33,7 +43,11 @@ func (e *Error) StatusCode() int {
 	switch e.Reason {
 	case ServerError:
 		return http.StatusInternalServerError
+	case TemporarilyUnavailable:
+		return http.StatusServiceUnavailable
 	case InvalidToken:
+		return http.StatusUnauthorized
+	case InsufficientScope:
 		return http.StatusForbidden
 	case MethodNotAllowed:
 		return http.StatusMethodNotAllowed
@@ -4,11 +4,15 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 func SendHTML(c *gin.Context, e *Error) {
+	setURI(c, e)
 	c.HTML(e.StatusCode(), "error.tmpl", gin.H{
 		"error": e,
 	})
@@ -21,27 +25,106 @@ func SendRedirect(c *gin.Context, e *Error) {
 	}
 
 	resp := make(url.Values)
-	if e.State != "" {
+	if e.State != "" || e.HasState {
 		resp.Set("state", e.State)
 	}
+	if e.Issuer != "" {
+		resp.Set("iss", e.Issuer)
+	}
 
+	setURI(c, e)
 	resp.Set("error", string(e.Reason))
 	if e.Description != "" {
 		resp.Set("error_description", e.Description)
 	}
+	if e.URI != "" {
+		resp.Set("error_uri", e.URI)
+	}
 
-	if e.ResponseType != "code" && e.ResponseType != "" {
-		e.RedirectURI.Fragment = resp.Encode()
-	} else {
-		e.RedirectURI.RawQuery = resp.Encode()
+	fragment := e.ResponseType != "code" && e.ResponseType != ""
+	switch e.ResponseMode {
+	case "query":
+		fragment = false
+	case "fragment":
+		fragment = true
+	case "form_post":
+		SendFormPost(c, e.RedirectURI, resp)
+		return
 	}
+
+	SetRedirectParams(e.RedirectURI, resp, fragment)
 	c.Redirect(http.StatusFound, e.RedirectURI.String())
 }
 
+// SendFormPost sends a page that posts params to the URI automatically, as the OAuth 2.0 Form Post Response Mode.
+func SendFormPost(c *gin.Context, uri *url.URL, params url.Values) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Pragma", "no-cache")
+	c.HTML(http.StatusOK, "form_post.tmpl", gin.H{
+		"action": uri.String(),
+		"params": params,
+	})
+}
+
+// SetRedirectParams sets params into the fragment or the query of the redirect URI.
+// The params are encoded only once, so clients get the values byte-for-byte.
+//
+// In the query, the params are appended to the original query of the redirect URI.
+// The original query is kept as it is registered, except for the parameters that the params override.
+func SetRedirectParams(u *url.URL, params url.Values, fragment bool) {
+	if fragment {
+		u.RawFragment = params.Encode()
+		u.Fragment, _ = url.PathUnescape(u.RawFragment)
+		return
+	}
+
+	var kept []string
+	for _, raw := range strings.Split(u.RawQuery, "&") {
+		if raw == "" {
+			continue
+		}
+		key := raw
+		if i := strings.IndexByte(key, '='); i >= 0 {
+			key = key[:i]
+		}
+		if k, err := url.QueryUnescape(key); err == nil {
+			key = k
+		}
+		if _, ok := params[key]; !ok {
+			kept = append(kept, raw)
+		}
+	}
+	if encoded := params.Encode(); encoded != "" {
+		kept = append(kept, encoded)
+	}
+	u.RawQuery = strings.Join(kept, "&")
+}
+
 func SendJSON(c *gin.Context, e *Error) {
-	if e.Reason == InvalidToken {
+	setURI(c, e)
+	switch e.Reason {
+	case InvalidToken:
 		c.Header("WWW-Authenticate", fmt.Sprintf("Bearer error=\"invalid_token\",error_description=%#v", e.Description))
+	case InsufficientScope:
+		c.Header("WWW-Authenticate", fmt.Sprintf("Bearer error=\"insufficient_scope\",error_description=%#v,scope=%#v", e.Description, e.Scope))
+	}
+	if e.RetryAfter > 0 {
+		c.Header("Retry-After", strconv.FormatInt(int64(e.RetryAfter/time.Second), 10))
 	}
 
 	c.JSON(e.StatusCode(), e)
 }
+
+// SendTokenError sends error response for token endpoint.
+//
+// It responds 401 with WWW-Authenticate header if client authentication was failed with Authorization header, as RFC 6749 section 5.2 requires.
+func SendTokenError(c *gin.Context, e *Error) {
+	if e.Reason == InvalidClient && c.GetHeader("Authorization") != "" {
+		setURI(c, e)
+		c.Header("WWW-Authenticate", `Basic realm="lauth"`)
+		c.JSON(http.StatusUnauthorized, e)
+		return
+	}
+
+	SendJSON(c, e)
+}
@@ -1,10 +1,13 @@
 package errors_test
 
 import (
+	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/gin-gonic/gin"
@@ -98,6 +101,24 @@ func TestSendRedirect(t *testing.T) {
 			Query:    testutil.MustParseQuery("error=something_wrong"),
 			Fragment: url.Values{},
 		},
+		{
+			Msg: &errors.Error{
+				RedirectURI:  testutil.MustParseURL("http://localhost:3000/redirect?tenant=x"),
+				ResponseType: "code",
+				Reason:       "something_wrong",
+			},
+			Query:    testutil.MustParseQuery("tenant=x&error=something_wrong"),
+			Fragment: url.Values{},
+		},
+		{
+			Msg: &errors.Error{
+				RedirectURI:  testutil.MustParseURL("http://localhost:3000/redirect?tenant=x"),
+				ResponseType: "token",
+				Reason:       "something_wrong",
+			},
+			Query:    testutil.MustParseQuery("tenant=x"),
+			Fragment: testutil.MustParseQuery("error=something_wrong"),
+		},
 		{
 			Msg: &errors.Error{
 				RedirectURI:  testutil.MustParseURL("http://localhost:3000/redirect"),
@@ -107,6 +128,26 @@ func TestSendRedirect(t *testing.T) {
 			Query:    url.Values{},
 			Fragment: testutil.MustParseQuery("error=something_wrong"),
 		},
+		{
+			Msg: &errors.Error{
+				RedirectURI:  testutil.MustParseURL("http://localhost:3000/redirect"),
+				ResponseType: "code",
+				HasState:     true,
+				Reason:       "something_wrong",
+			},
+			Query:    url.Values{"state": {""}, "error": {"something_wrong"}},
+			Fragment: url.Values{},
+		},
+		{
+			Msg: &errors.Error{
+				RedirectURI:  testutil.MustParseURL("http://localhost:3000/redirect"),
+				ResponseType: "token",
+				State:        "a&b=c %/+#",
+				Reason:       "something_wrong",
+			},
+			Query:    url.Values{},
+			Fragment: url.Values{"state": {"a&b=c %/+#"}, "error": {"something_wrong"}},
+		},
 	}
 
 	for i, tt := range tests {
@@ -133,7 +174,7 @@ func TestSendRedirect(t *testing.T) {
 				t.Errorf("%d: unexpected redirect query: %#v", i, location.String())
 			}
 
-			fragment, err := url.ParseQuery(location.Fragment)
+			fragment, err := url.ParseQuery(location.EscapedFragment())
 			if err != nil {
 				t.Errorf("%d: failed to parse fragment: %s", i, err)
 			}
@@ -143,3 +184,195 @@ func TestSendRedirect(t *testing.T) {
 		}
 	}
 }
+
+func TestSendTokenError(t *testing.T) {
+	tests := []struct {
+		Reason          errors.Reason
+		Authorization   string
+		Code            int
+		WWWAuthenticate string
+	}{
+		{errors.InvalidRequest, "", http.StatusBadRequest, ""},
+		{errors.InvalidClient, "", http.StatusBadRequest, ""},
+		{errors.InvalidClient, "Basic dXNlcjpwYXNz", http.StatusUnauthorized, `Basic realm="lauth"`},
+		{errors.InvalidGrant, "Basic dXNlcjpwYXNz", http.StatusBadRequest, ""},
+		{errors.UnauthorizedClient, "", http.StatusBadRequest, ""},
+		{errors.UnsupportedGrantType, "", http.StatusBadRequest, ""},
+		{errors.InvalidScope, "", http.StatusBadRequest, ""},
+		{errors.ServerError, "", http.StatusInternalServerError, ""},
+	}
+
+	for _, tt := range tests {
+		router := testutil.MakeTestRouter()
+		router.POST("/token", func(c *gin.Context) {
+			errors.SendTokenError(c, &errors.Error{Reason: tt.Reason})
+		})
+
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("POST", "http://example.com/token", nil)
+		if tt.Authorization != "" {
+			r.Header.Set("Authorization", tt.Authorization)
+		}
+		router.ServeHTTP(w, r)
+
+		if w.Code != tt.Code {
+			t.Errorf("%s: unexpected status code: %d", tt.Reason, w.Code)
+		}
+		if h := w.Header().Get("WWW-Authenticate"); h != tt.WWWAuthenticate {
+			t.Errorf("%s: unexpected WWW-Authenticate header: %#v", tt.Reason, h)
+		}
+		if !strings.Contains(w.Body.String(), `"error":"`+string(tt.Reason)+`"`) {
+			t.Errorf("%s: unexpected body: %s", tt.Reason, w.Body.String())
+		}
+	}
+}
+
+func TestSendJSON(t *testing.T) {
+	tests := []struct {
+		Reason errors.Reason
+		Code   int
+	}{
+		{errors.AccessDenied, http.StatusBadRequest},
+		{errors.ConsentRequired, http.StatusBadRequest},
+		{errors.InteractionRequired, http.StatusBadRequest},
+		{errors.InvalidClient, http.StatusBadRequest},
+		{errors.InvalidGrant, http.StatusBadRequest},
+		{errors.InvalidRequest, http.StatusBadRequest},
+		{errors.InvalidRequestObject, http.StatusBadRequest},
+		{errors.InvalidRequestURI, http.StatusBadRequest},
+		{errors.InvalidScope, http.StatusBadRequest},
+		{errors.InvalidToken, http.StatusUnauthorized},
+		{errors.LoginRequired, http.StatusBadRequest},
+		{errors.ServerError, http.StatusInternalServerError},
+		{errors.TemporarilyUnavailable, http.StatusServiceUnavailable},
+		{errors.UnauthorizedClient, http.StatusBadRequest},
+		{errors.UnmetAuthentication, http.StatusBadRequest},
+		{errors.UnsupportedGrantType, http.StatusBadRequest},
+		{errors.UnsupportedResponseType, http.StatusBadRequest},
+		{errors.InsufficientScope, http.StatusForbidden},
+		{errors.MethodNotAllowed, http.StatusMethodNotAllowed},
+		{errors.PageNotFound, http.StatusNotFound},
+	}
+
+	for _, withURI := range []bool{false, true} {
+		router := testutil.MakeTestRouter()
+		if withURI {
+			router.Use(errors.URIMiddleware("https://example.com/errors#{error}"))
+		}
+
+		for _, tt := range tests {
+			name := fmt.Sprintf("%s/uri=%v", tt.Reason, withURI)
+			path := "/" + string(tt.Reason)
+
+			reason := tt.Reason
+			router.GET(path, func(c *gin.Context) {
+				errors.SendJSON(c, &errors.Error{
+					Err:         fmt.Errorf("internal detail"),
+					Reason:      reason,
+					Description: "something wrong",
+				})
+			})
+
+			w := httptest.NewRecorder()
+			r, _ := http.NewRequest("GET", path, nil)
+			router.ServeHTTP(w, r)
+
+			if w.Code != tt.Code {
+				t.Errorf("%s: unexpected status code: %d", name, w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/json; charset=utf-8" {
+				t.Errorf("%s: unexpected content-type: %s", name, ct)
+			}
+			if auth := w.Header().Get("WWW-Authenticate"); tt.Code == http.StatusUnauthorized && !strings.HasPrefix(auth, "Bearer error=\"invalid_token\"") {
+				t.Errorf("%s: unexpected WWW-Authenticate header: %s", name, auth)
+			}
+
+			var body map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Errorf("%s: failed to parse body: %s", name, err)
+				continue
+			}
+
+			expect := map[string]string{
+				"error":             string(tt.Reason),
+				"error_description": "something wrong",
+			}
+			if withURI {
+				expect["error_uri"] = "https://example.com/errors#" + string(tt.Reason)
+			}
+			if !reflect.DeepEqual(body, expect) {
+				t.Errorf("%s: unexpected body: %s", name, w.Body.String())
+			}
+		}
+	}
+}
+
+func TestSendRedirect_ErrorURI(t *testing.T) {
+	router := testutil.MakeTestRouter()
+	router.Use(errors.URIMiddleware("https://example.com/errors/{error}.html"))
+	router.GET("/", func(c *gin.Context) {
+		errors.SendRedirect(c, &errors.Error{
+			RedirectURI:  testutil.MustParseURL("http://localhost:3000/redirect"),
+			ResponseType: "code",
+			Reason:       errors.AccessDenied,
+		})
+	})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/", nil)
+	router.ServeHTTP(w, r)
+
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("failed to parse redirect url: %s", err)
+	}
+	if uri := location.Query().Get("error_uri"); uri != "https://example.com/errors/access_denied.html" {
+		t.Errorf("unexpected error_uri: %#v", uri)
+	}
+}
+
+func TestSendJSON_InsufficientScope(t *testing.T) {
+	router := testutil.MakeTestRouter()
+	router.GET("/", func(c *gin.Context) {
+		errors.SendJSON(c, &errors.Error{
+			Reason:      errors.InsufficientScope,
+			Description: "openid scope is required",
+			Scope:       "openid profile",
+		})
+	})
+
+	w := httptest.NewRecorder()
+	r, _ := http.NewRequest("GET", "/", nil)
+	router.ServeHTTP(w, r)
+
+	if w.Code != http.StatusForbidden {
+		t.Errorf("unexpected status code: %d", w.Code)
+	}
+	if h := w.Header().Get("WWW-Authenticate"); h != `Bearer error="insufficient_scope",error_description="openid scope is required",scope="openid profile"` {
+		t.Errorf("unexpected WWW-Authenticate header: %#v", h)
+	}
+}
+
+func TestSetRedirectParams(t *testing.T) {
+	tests := []struct {
+		URI      string
+		Params   url.Values
+		Fragment bool
+		Expect   string
+	}{
+		{"http://localhost/cb", url.Values{"code": {"abc"}}, false, "http://localhost/cb?code=abc"},
+		{"http://localhost/cb?z=1&a=2", url.Values{"code": {"abc"}}, false, "http://localhost/cb?z=1&a=2&code=abc"},
+		{"http://localhost/cb?path=%2Fhome&q=a+b", url.Values{"code": {"abc"}}, false, "http://localhost/cb?path=%2Fhome&q=a+b&code=abc"},
+		{"http://localhost/cb?flag&x=1", url.Values{"code": {"abc"}}, false, "http://localhost/cb?flag&x=1&code=abc"},
+		{"http://localhost/cb?state=old&x=1", url.Values{"state": {"new"}}, false, "http://localhost/cb?x=1&state=new"},
+		{"http://localhost/cb?z=1&a=2", url.Values{"code": {"abc"}}, true, "http://localhost/cb?z=1&a=2#code=abc"},
+	}
+
+	for _, tt := range tests {
+		u := testutil.MustParseURL(tt.URI)
+		errors.SetRedirectParams(u, tt.Params, tt.Fragment)
+		if u.String() != tt.Expect {
+			t.Errorf("%s: unexpected redirect URI: expected %s but got %s", tt.URI, tt.Expect, u)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package errors
 var (
 	// OpenID errors
 	AccessDenied            Reason = "access_denied"
+	ConsentRequired         Reason = "consent_required"
 	InteractionRequired     Reason = "interaction_required"
 	InvalidClient           Reason = "invalid_client"
 	InvalidGrant            Reason = "invalid_grant"
@@ -15,9 +16,13 @@ var (
 	ServerError             Reason = "server_error"
 	TemporarilyUnavailable  Reason = "temporarily_unavailable"
 	UnauthorizedClient      Reason = "unauthorized_client"
+	UnmetAuthentication     Reason = "unmet_authentication_requirements"
 	UnsupportedGrantType    Reason = "unsupported_grant_type"
 	UnsupportedResponseType Reason = "unsupported_response_type"
 
+	// Bearer token errors (RFC 6750)
+	InsufficientScope Reason = "insufficient_scope"
+
 	// original errors
 	MethodNotAllowed Reason = "method_not_allowed"
 	PageNotFound     Reason = "page_not_found"
@@ -0,0 +1,29 @@
+package errors
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	errorURIKey = "lauth_error_uri"
+)
+
+// URIMiddleware makes error responses include error_uri that points a human-readable page about the error.
+// "{error}" in the template is replaced with the error code.
+func URIMiddleware(template string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(errorURIKey, template)
+	}
+}
+
+// setURI sets error_uri of e by the template that set by URIMiddleware, unless e already has it.
+func setURI(c *gin.Context, e *Error) {
+	if e.URI != "" {
+		return
+	}
+	if template := c.GetString(errorURIKey); template != "" {
+		e.URI = strings.ReplaceAll(template, "{error}", string(e.Reason))
+	}
+}
@@ -104,7 +104,13 @@ func GenClient(conf GenClientConfig) (string, error) {
 	fmt.Fprintf(buf, "# Please set this if need access userinfo endpoint by script that runs on browser.\n")
 	fmt.Fprintf(buf, "#cors_origin = [\"https://example.com\"]\n")
 	fmt.Fprintf(buf, "\n")
-	fmt.Fprintf(buf, "# URIs for redirect after login or logout.\n")
+	fmt.Fprintf(buf, "# Client authentication method to use on the token endpoint.\n")
+	fmt.Fprintf(buf, "# Please set \"client_secret_basic\", \"client_secret_post\", \"client_secret_jwt\", or \"private_key_jwt\" if need restrict it.\n")
+	fmt.Fprintf(buf, "# client_secret_jwt uses assertion_secret, and private_key_jwt uses jwks, jwks_uri, or request_key for verifying client assertion.\n")
+	fmt.Fprintf(buf, "#token_endpoint_auth_method = \"client_secret_basic\"\n")
+	fmt.Fprintf(buf, "\n")
+	fmt.Fprintf(buf, "# URIs for redirect after login.\n")
+	fmt.Fprintf(buf, "# They are also used for redirect after logout unless set post_logout_redirect_uris.\n")
 	fmt.Fprintf(buf, "redirect_uri = [\n")
 	for _, u := range conf.URIs {
 		fmt.Fprintf(buf, "  %s,\n", quoteString(u))
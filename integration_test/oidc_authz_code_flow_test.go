@@ -35,7 +35,7 @@ func TestOIDCAuthzCodeFlow(t *testing.T) {
 		Scopes:       []string{oidc.ScopeOpenID, "phone"},
 	}
 
-	authURL, err := url.Parse(oauth2config.AuthCodeURL("this is state"))
+	authURL, err := url.Parse(oauth2config.AuthCodeURL("this is state", oidc.Nonce("this is nonce")))
 	if err != nil {
 		t.Fatalf("failed to mage auth code URL: %s", err)
 	}
@@ -84,6 +84,10 @@ func TestOIDCAuthzCodeFlow(t *testing.T) {
 	} else if idToken, err := verifier.Verify(context.TODO(), rawIDToken); err != nil {
 		t.Errorf("failed to verify id_token: %s", err)
 	} else {
+		if idToken.Nonce != "this is nonce" {
+			t.Errorf("unexpected id_token nonce: %#v", idToken.Nonce)
+		}
+
 		var claims struct {
 			Subject string `json:"sub"`
 		}
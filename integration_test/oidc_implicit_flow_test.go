@@ -21,7 +21,7 @@ func TestOIDCImplicitFlow(t *testing.T) {
 		"redirect_uri":  {"http://implicit-client.example.com/callback"},
 		"client_id":     {clientID},
 		"nonce":         {nonce},
-		"scope":         {"phone"},
+		"scope":         {"openid phone"},
 	})
 	if resp.Code != http.StatusOK {
 		t.Fatalf("unexpected status code: %d", resp.Code)
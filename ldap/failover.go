@@ -0,0 +1,97 @@
+package ldap
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// Upstream is a Connector to one of redundant LDAP servers.
+// Name is used in errors and health checks, typically the URL of the server.
+type Upstream struct {
+	Name      string
+	Connector Connector
+}
+
+// FailoverError is the error of FailoverConnector when could not connect to any upstream.
+type FailoverError struct {
+	Names  []string
+	Errors []error
+}
+
+func (e *FailoverError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = fmt.Sprintf("%s: %s", e.Names[i], err)
+	}
+	return "failed to connect to all LDAP servers: " + strings.Join(msgs, "; ")
+}
+
+// unavailable reports whether any upstream is unavailable now, so it may be recovered by retry later.
+func (e *FailoverError) unavailable() bool {
+	for _, err := range e.Errors {
+		if IsUnavailable(err) {
+			return true
+		}
+	}
+	return false
+}
+
+// FailoverConnector connects to the first upstream that succeeded to connect and bind, in order.
+//
+// Each Connect tries from the first upstream again, so it fails back once the primary server recovered.
+// The timeout for each upstream should be set in the upstream Connector, like LDAPConfig.ConnectTimeout of SimpleConnector.
+type FailoverConnector struct {
+	Upstreams []Upstream
+
+	mu      sync.RWMutex
+	current string
+}
+
+func NewFailoverConnector(upstreams ...Upstream) *FailoverConnector {
+	return &FailoverConnector{
+		Upstreams: upstreams,
+	}
+}
+
+func (f *FailoverConnector) Connect() (Session, error) {
+	fe := &FailoverError{}
+
+	for _, u := range f.Upstreams {
+		sess, err := u.Connector.Connect()
+		if err == nil {
+			f.setCurrent(u.Name)
+			return sess, nil
+		}
+		fe.Names = append(fe.Names, u.Name)
+		fe.Errors = append(fe.Errors, err)
+	}
+
+	f.setCurrent("")
+	return nil, fe
+}
+
+func (f *FailoverConnector) setCurrent(name string) {
+	f.mu.Lock()
+	f.current = name
+	f.mu.Unlock()
+}
+
+// Current returns the name of the upstream that connected last time.
+// It returns an empty string if the last Connect failed, no Connect has done yet, or f is nil.
+func (f *FailoverConnector) Current() string {
+	if f == nil {
+		return ""
+	}
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.current
+}
+
+func isFailoverUnavailable(err error) bool {
+	var fe *FailoverError
+	return errors.As(err, &fe) && fe.unavailable()
+}
@@ -0,0 +1,80 @@
+package ldap_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/macrat/lauth/ldap"
+)
+
+type failoverTestConnector struct {
+	err      error
+	connects int
+}
+
+func (c *failoverTestConnector) Connect() (ldap.Session, error) {
+	c.connects++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &poolTestSession{}, nil
+}
+
+func TestFailoverConnector(t *testing.T) {
+	primary := &failoverTestConnector{}
+	secondary := &failoverTestConnector{}
+	failover := ldap.NewFailoverConnector(
+		ldap.Upstream{Name: "ldap://primary", Connector: primary},
+		ldap.Upstream{Name: "ldap://secondary", Connector: secondary},
+	)
+
+	if failover.Current() != "" {
+		t.Errorf("unexpected current upstream before connect: %#v", failover.Current())
+	}
+
+	if _, err := failover.Connect(); err != nil {
+		t.Fatalf("failed to connect: %s", err)
+	}
+	if failover.Current() != "ldap://primary" || secondary.connects != 0 {
+		t.Errorf("expected to use primary but current is %#v and secondary connected %d times", failover.Current(), secondary.connects)
+	}
+
+	primary.err = goldap.NewError(goldap.ErrorNetwork, errors.New("connection refused"))
+	if _, err := failover.Connect(); err != nil {
+		t.Fatalf("failed to connect: %s", err)
+	}
+	if failover.Current() != "ldap://secondary" {
+		t.Errorf("expected to fail over to secondary but current is %#v", failover.Current())
+	}
+
+	primary.err = nil
+	if _, err := failover.Connect(); err != nil {
+		t.Fatalf("failed to connect: %s", err)
+	}
+	if failover.Current() != "ldap://primary" {
+		t.Errorf("expected to fail back to primary but current is %#v", failover.Current())
+	}
+
+	primary.err = goldap.NewError(goldap.ErrorNetwork, errors.New("connection refused"))
+	secondary.err = goldap.NewError(goldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+	_, err := failover.Connect()
+	if err == nil {
+		t.Fatalf("expected error but succeeded")
+	}
+	if failover.Current() != "" {
+		t.Errorf("unexpected current upstream after failed: %#v", failover.Current())
+	}
+	if !strings.Contains(err.Error(), "ldap://primary: ") || !strings.Contains(err.Error(), "ldap://secondary: ") {
+		t.Errorf("error should include errors of all upstreams: %s", err)
+	}
+	if !ldap.IsUnavailable(err) {
+		t.Errorf("error should be unavailable if any upstream is unavailable: %s", err)
+	}
+
+	primary.err = goldap.NewError(goldap.LDAPResultInvalidCredentials, errors.New("invalid credentials"))
+	if _, err = failover.Connect(); ldap.IsUnavailable(err) {
+		t.Errorf("error should not be unavailable if all upstreams rejected: %s", err)
+	}
+}
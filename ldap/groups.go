@@ -0,0 +1,40 @@
+package ldap
+
+import (
+	"strings"
+)
+
+// ExpandGroups resolves transitive group membership by walking parent groups that got by parentsOf.
+//
+// It returns groups and all of their ancestors without duplication, in order of closer ones first.
+// It walks at most depth levels from groups, to avoid runaway queries on deeply nested or cyclic groups.
+func ExpandGroups(groups []string, depth int, parentsOf func(dn string) ([]string, error)) ([]string, error) {
+	seen := make(map[string]bool)
+	var result []string
+	add := func(dns []string) (added []string) {
+		for _, dn := range dns {
+			key := strings.ToLower(dn)
+			if !seen[key] {
+				seen[key] = true
+				result = append(result, dn)
+				added = append(added, dn)
+			}
+		}
+		return added
+	}
+
+	frontier := add(groups)
+	for level := 0; level < depth && len(frontier) > 0; level++ {
+		var next []string
+		for _, dn := range frontier {
+			parents, err := parentsOf(dn)
+			if err != nil {
+				return nil, err
+			}
+			next = append(next, add(parents)...)
+		}
+		frontier = next
+	}
+
+	return result, nil
+}
@@ -0,0 +1,91 @@
+package ldap_test
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/macrat/lauth/ldap"
+)
+
+func TestExpandGroups(t *testing.T) {
+	parents := map[string][]string{
+		"CN=dev,DC=example":       {"CN=engineers,DC=example"},
+		"CN=engineers,DC=example": {"CN=staff,DC=example"},
+		"CN=staff,DC=example":     {"CN=everyone,DC=example"},
+		"CN=ops,DC=example":       {"cn=ENGINEERS,dc=example"},
+		"CN=loop-a,DC=example":    {"CN=loop-b,DC=example"},
+		"CN=loop-b,DC=example":    {"CN=loop-a,DC=example"},
+	}
+	queries := 0
+	parentsOf := func(dn string) ([]string, error) {
+		queries++
+		if dn == "CN=broken,DC=example" {
+			return nil, errors.New("something wrong")
+		}
+		return parents[dn], nil
+	}
+
+	tests := []struct {
+		Groups  []string
+		Depth   int
+		Expect  []string
+		Queries int
+	}{
+		{
+			Groups:  []string{"CN=dev,DC=example"},
+			Depth:   0,
+			Expect:  []string{"CN=dev,DC=example"},
+			Queries: 0,
+		},
+		{
+			Groups:  []string{"CN=dev,DC=example"},
+			Depth:   2,
+			Expect:  []string{"CN=dev,DC=example", "CN=engineers,DC=example", "CN=staff,DC=example"},
+			Queries: 2,
+		},
+		{
+			Groups:  []string{"CN=dev,DC=example"},
+			Depth:   10,
+			Expect:  []string{"CN=dev,DC=example", "CN=engineers,DC=example", "CN=staff,DC=example", "CN=everyone,DC=example"},
+			Queries: 4,
+		},
+		{
+			Groups:  []string{"CN=dev,DC=example", "CN=ops,DC=example"},
+			Depth:   1,
+			Expect:  []string{"CN=dev,DC=example", "CN=ops,DC=example", "CN=engineers,DC=example"},
+			Queries: 2,
+		},
+		{
+			Groups:  []string{"CN=loop-a,DC=example"},
+			Depth:   100,
+			Expect:  []string{"CN=loop-a,DC=example", "CN=loop-b,DC=example"},
+			Queries: 2,
+		},
+		{
+			Groups:  nil,
+			Depth:   3,
+			Expect:  nil,
+			Queries: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		queries = 0
+		result, err := ldap.ExpandGroups(tt.Groups, tt.Depth, parentsOf)
+		if err != nil {
+			t.Errorf("%v depth=%d: unexpected error: %s", tt.Groups, tt.Depth, err)
+			continue
+		}
+		if !reflect.DeepEqual(result, tt.Expect) {
+			t.Errorf("%v depth=%d: unexpected result: %v", tt.Groups, tt.Depth, result)
+		}
+		if queries != tt.Queries {
+			t.Errorf("%v depth=%d: expected %d queries but got %d", tt.Groups, tt.Depth, tt.Queries, queries)
+		}
+	}
+
+	if _, err := ldap.ExpandGroups([]string{"CN=broken,DC=example"}, 1, parentsOf); err == nil {
+		t.Errorf("expected error if failed to get parent groups")
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"crypto/tls"
 	"fmt"
 	"io"
+	"net"
+	"strings"
 
 	"github.com/go-ldap/ldap/v3"
 	"github.com/macrat/lauth/config"
@@ -14,6 +16,22 @@ var (
 	MultipleUsersFoundError = fmt.Errorf("multiple users was found")
 )
 
+// IsUnavailable reports whether the error means the LDAP server is unavailable now.
+// It is false for errors caused by the request, such as incorrect password or not found user.
+func IsUnavailable(err error) bool {
+	if isFailoverUnavailable(err) {
+		return true
+	}
+	return ldap.IsErrorAnyOf(
+		err,
+		ldap.ErrorNetwork,
+		ldap.LDAPResultBusy,
+		ldap.LDAPResultUnavailable,
+		ldap.LDAPResultServerDown,
+		ldap.LDAPResultTimeout,
+	)
+}
+
 type Connector interface {
 	Connect() (Session, error)
 }
@@ -27,39 +45,85 @@ type Session interface {
 
 type SimpleConnector struct {
 	Config *config.LDAPConfig
+
+	// Server is the address of LDAP server to connect, instead of Config.Server.
+	// It is used to connect to the failover servers with the same credentials.
+	Server *config.URL
+
+	// TLS is the configuration for ldaps:// and StartTLS, that made by NewTLSConfig.
+	// The certificate is verified by the system CAs if nil.
+	TLS *tls.Config
 }
 
+// tlsConfig returns TLS configuration for the server, that has the hostname of server as ServerName if not set.
+// Config.TLSServerName is used only for the primary server, because the failover servers have their own names.
+func (c SimpleConnector) tlsConfig(server *config.URL) *tls.Config {
+	conf := &tls.Config{}
+	if c.TLS != nil {
+		conf = c.TLS.Clone()
+	}
+	if c.Server == nil && c.Config.TLSServerName != "" {
+		conf.ServerName = c.Config.TLSServerName
+	}
+	if conf.ServerName == "" {
+		conf.ServerName = server.Hostname()
+	}
+	return conf
+}
+
+// Connect connects to the LDAP server and binds as the service user.
+//
+// The connection is encrypted from the start if the server URL is ldaps://.
+// Otherwise, it issues StartTLS before binding unless Config.DisableTLS, and fails if the server refused StartTLS.
 func (c SimpleConnector) Connect() (Session, error) {
-	conn, err := ldap.DialURL(c.Config.Server.String())
-	if err != nil {
-		return nil, err
+	server := c.Server
+	if server == nil {
+		server = c.Config.Server
 	}
+	tlsConf := c.tlsConfig(server)
 
-	err = conn.Bind(c.Config.User, c.Config.Password)
+	opts := []ldap.DialOpt{ldap.DialWithTLSConfig(tlsConf)}
+	if c.Config.ConnectTimeout > 0 {
+		opts = append(opts, ldap.DialWithDialer(&net.Dialer{Timeout: c.Config.ConnectTimeout.Duration()}))
+	}
+
+	conn, err := ldap.DialURL(server.String(), opts...)
 	if err != nil {
-		conn.Close()
 		return nil, err
 	}
 
-	if c.Config.Server.Scheme != "ldaps" && !c.Config.DisableTLS {
-		err = conn.StartTLS(&tls.Config{InsecureSkipVerify: true})
+	if server.Scheme != "ldaps" && !c.Config.DisableTLS {
+		err = conn.StartTLS(tlsConf)
 		if err != nil {
 			conn.Close()
 			return nil, err
 		}
 	}
 
+	err = conn.Bind(c.Config.User, c.Config.Password)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
 	return &SimpleSession{
-		conn:        conn,
-		IDAttribute: c.Config.IDAttribute,
-		BaseDN:      c.Config.BaseDN,
+		conn:             conn,
+		IDAttribute:      c.Config.IDAttribute,
+		BaseDN:           c.Config.BaseDN,
+		NestedGroupDepth: c.Config.NestedGroupDepth,
+		user:             c.Config.User,
+		password:         c.Config.Password,
 	}, nil
 }
 
 type SimpleSession struct {
-	conn        *ldap.Conn
-	IDAttribute string
-	BaseDN      string
+	conn             *ldap.Conn
+	IDAttribute      string
+	BaseDN           string
+	NestedGroupDepth int
+
+	user     string
+	password string
 }
 
 func (c *SimpleSession) Close() error {
@@ -67,6 +131,14 @@ func (c *SimpleSession) Close() error {
 	return nil
 }
 
+// Reset binds as the service user again, after LoginTest has bound as the end-user.
+func (c *SimpleSession) Reset() error {
+	if c.conn.IsClosing() {
+		return ldap.NewError(ldap.ErrorNetwork, fmt.Errorf("connection closed"))
+	}
+	return c.conn.Bind(c.user, c.password)
+}
+
 func (c *SimpleSession) searchUser(username string, attributes []string) (*ldap.Entry, error) {
 	req := ldap.NewSearchRequest(
 		c.BaseDN,
@@ -105,7 +177,13 @@ func (c *SimpleSession) LoginTest(username, password string) error {
 }
 
 func (c *SimpleSession) GetUserAttributes(username string, attributes []string) (map[string][]string, error) {
-	user, err := c.searchUser(username, attributes)
+	search := attributes
+	if len(search) == 0 {
+		// Empty attribute list means all attributes in LDAP, and "1.1" means no attributes. (RFC 4511 section 4.5.1.8)
+		search = []string{"1.1"}
+	}
+
+	user, err := c.searchUser(username, search)
 	if err != nil {
 		return nil, err
 	}
@@ -114,7 +192,42 @@ func (c *SimpleSession) GetUserAttributes(username string, attributes []string)
 
 	for _, attr := range attributes {
 		result[attr] = user.GetAttributeValues(attr)
+
+		if c.NestedGroupDepth > 0 && strings.EqualFold(attr, "memberOf") {
+			result[attr], err = ExpandGroups(result[attr], c.NestedGroupDepth, c.parentGroups)
+			if err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	return result, nil
 }
+
+// parentGroups returns DNs of groups that the group of dn directly belongs to.
+func (c *SimpleSession) parentGroups(dn string) ([]string, error) {
+	req := ldap.NewSearchRequest(
+		dn,
+		ldap.ScopeBaseObject,
+		ldap.NeverDerefAliases,
+		1, // size limit
+		0, // time limit
+		false,
+		"(objectClass=*)",
+		[]string{"memberOf"},
+		nil,
+	)
+
+	res, err := c.conn.Search(req)
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject) {
+		// The group may be out of the visible tree for the service user.
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if len(res.Entries) == 0 {
+		return nil, nil
+	}
+	return res.Entries[0].GetAttributeValues("memberOf"), nil
+}
@@ -0,0 +1,178 @@
+package ldap
+
+import (
+	"sync"
+	"time"
+)
+
+// Resetter is a Session that can be restored to the state just after connected.
+// PooledConnector resets sessions that used for LoginTest before reusing, because LoginTest binds as the user.
+type Resetter interface {
+	Reset() error
+}
+
+type idleSession struct {
+	session Session
+	since   time.Time
+}
+
+// PooledConnector keeps sessions of Connector after closed, to reuse them for later requests.
+//
+// Size is the maximum number of idle sessions to keep; it doesn't limit the number of sessions in use.
+// Idle sessions are dropped after IdleTimeout, or never if IdleTimeout is 0.
+// A reused session is replaced by a new one transparently if the LDAP server has closed it.
+type PooledConnector struct {
+	Connector   Connector
+	Size        int
+	IdleTimeout time.Duration
+
+	mu     sync.Mutex
+	idle   []idleSession
+	closed bool
+}
+
+func NewPooledConnector(connector Connector, size int, idleTimeout time.Duration) *PooledConnector {
+	return &PooledConnector{
+		Connector:   connector,
+		Size:        size,
+		IdleTimeout: idleTimeout,
+	}
+}
+
+// take returns the most recently used idle session, or nil if there is no usable one.
+func (p *PooledConnector) take() Session {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for len(p.idle) > 0 {
+		last := p.idle[len(p.idle)-1]
+		p.idle = p.idle[:len(p.idle)-1]
+
+		if p.IdleTimeout > 0 && time.Since(last.since) >= p.IdleTimeout {
+			last.session.Close()
+			continue
+		}
+		return last.session
+	}
+	return nil
+}
+
+func (p *PooledConnector) put(sess Session) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.closed || len(p.idle) >= p.Size {
+		sess.Close()
+		return
+	}
+	p.idle = append(p.idle, idleSession{session: sess, since: time.Now()})
+}
+
+// Connect returns an idle session if there is, otherwise connects new session.
+// Closing the returned session puts it back to the pool.
+func (p *PooledConnector) Connect() (Session, error) {
+	if sess := p.take(); sess != nil {
+		return &pooledSession{pool: p, session: sess, reused: true}, nil
+	}
+
+	sess, err := p.Connector.Connect()
+	if err != nil {
+		return nil, err
+	}
+	return &pooledSession{pool: p, session: sess}, nil
+}
+
+// Idle returns the number of idle sessions in the pool.
+func (p *PooledConnector) Idle() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return len(p.idle)
+}
+
+// Close closes all idle sessions.
+// Sessions in use are closed when they are put back, instead of being pooled.
+func (p *PooledConnector) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	for _, s := range p.idle {
+		s.session.Close()
+	}
+	p.idle = nil
+	return nil
+}
+
+type pooledSession struct {
+	pool    *PooledConnector
+	session Session
+	reused  bool
+	dirty   bool
+	broken  bool
+	closed  bool
+}
+
+// do calls f with the underlying session.
+// If the reused session seems closed by the server, it connects again and retries once.
+func (s *pooledSession) do(f func(Session) error) error {
+	err := f(s.session)
+
+	if err != nil && s.reused && IsUnavailable(err) {
+		s.session.Close()
+		s.reused = false
+		s.dirty = false
+
+		sess, connErr := s.pool.Connector.Connect()
+		if connErr != nil {
+			s.session = nil
+			s.broken = true
+			return connErr
+		}
+		s.session = sess
+		err = f(s.session)
+	}
+
+	if err != nil && IsUnavailable(err) {
+		s.broken = true
+	}
+	return err
+}
+
+func (s *pooledSession) LoginTest(username, password string) error {
+	return s.do(func(sess Session) error {
+		s.dirty = true
+		return sess.LoginTest(username, password)
+	})
+}
+
+func (s *pooledSession) GetUserAttributes(username string, attributes []string) (map[string][]string, error) {
+	var result map[string][]string
+	err := s.do(func(sess Session) (err error) {
+		result, err = sess.GetUserAttributes(username, attributes)
+		return err
+	})
+	return result, err
+}
+
+// Close puts the session back to the pool.
+// Broken sessions, and sessions that used for LoginTest but can't be reset, are closed instead.
+func (s *pooledSession) Close() error {
+	if s.closed || s.session == nil {
+		return nil
+	}
+	s.closed = true
+
+	if s.broken {
+		return s.session.Close()
+	}
+	if s.dirty {
+		r, ok := s.session.(Resetter)
+		if !ok || r.Reset() != nil {
+			return s.session.Close()
+		}
+	}
+
+	s.pool.put(s.session)
+	return nil
+}
@@ -0,0 +1,206 @@
+package ldap_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/macrat/lauth/ldap"
+)
+
+type poolTestSession struct {
+	id       int
+	closed   bool
+	resets   int
+	failNext error
+}
+
+func (s *poolTestSession) Close() error {
+	s.closed = true
+	return nil
+}
+
+func (s *poolTestSession) LoginTest(username, password string) error {
+	if password != "correct" {
+		return errors.New("invalid credentials")
+	}
+	return nil
+}
+
+func (s *poolTestSession) GetUserAttributes(username string, attributes []string) (map[string][]string, error) {
+	if err := s.failNext; err != nil {
+		s.failNext = nil
+		return nil, err
+	}
+	return map[string][]string{"session": {string(rune('0' + s.id))}}, nil
+}
+
+type resettableSession struct {
+	*poolTestSession
+}
+
+func (s resettableSession) Reset() error {
+	s.resets++
+	return nil
+}
+
+type poolTestConnector struct {
+	sessions   []*poolTestSession
+	resettable bool
+}
+
+func (c *poolTestConnector) Connect() (ldap.Session, error) {
+	sess := &poolTestSession{id: len(c.sessions)}
+	c.sessions = append(c.sessions, sess)
+	if c.resettable {
+		return resettableSession{sess}, nil
+	}
+	return sess, nil
+}
+
+func TestPooledConnector(t *testing.T) {
+	connector := &poolTestConnector{}
+	pool := ldap.NewPooledConnector(connector, 2, 0)
+
+	s1, _ := pool.Connect()
+	s2, _ := pool.Connect()
+	s3, _ := pool.Connect()
+	if len(connector.sessions) != 3 {
+		t.Fatalf("expected 3 connections but got %d", len(connector.sessions))
+	}
+
+	s1.Close()
+	s2.Close()
+	s3.Close()
+	s3.Close()
+	if pool.Idle() != 2 {
+		t.Errorf("expected 2 idle sessions but got %d", pool.Idle())
+	}
+	if connector.sessions[0].closed || connector.sessions[1].closed || !connector.sessions[2].closed {
+		t.Errorf("sessions over the pool size should be closed")
+	}
+
+	sess, _ := pool.Connect()
+	if attrs, err := sess.GetUserAttributes("macrat", nil); err != nil {
+		t.Errorf("failed to get attributes: %s", err)
+	} else if attrs["session"][0] != "1" {
+		t.Errorf("expected the most recently used session is reused but got session %s", attrs["session"][0])
+	}
+	if len(connector.sessions) != 3 {
+		t.Errorf("expected no new connection but got %d connections", len(connector.sessions))
+	}
+	sess.Close()
+
+	pool.Close()
+	if pool.Idle() != 0 || !connector.sessions[0].closed || !connector.sessions[1].closed {
+		t.Errorf("idle sessions should be closed when pool is closed")
+	}
+}
+
+func TestPooledConnector_CloseWhileInUse(t *testing.T) {
+	connector := &poolTestConnector{}
+	pool := ldap.NewPooledConnector(connector, 2, 0)
+
+	sess, _ := pool.Connect()
+	pool.Close()
+	sess.Close()
+
+	if pool.Idle() != 0 {
+		t.Errorf("expected no idle session after closed but got %d", pool.Idle())
+	}
+	if !connector.sessions[0].closed {
+		t.Errorf("session that put back after the pool is closed should be closed")
+	}
+}
+
+func TestPooledConnector_IdleTimeout(t *testing.T) {
+	connector := &poolTestConnector{}
+	pool := ldap.NewPooledConnector(connector, 1, 50*time.Millisecond)
+
+	sess, _ := pool.Connect()
+	sess.Close()
+
+	time.Sleep(100 * time.Millisecond)
+
+	sess, _ = pool.Connect()
+	defer sess.Close()
+
+	if len(connector.sessions) != 2 {
+		t.Errorf("expected new connection after idle timeout but got %d connections", len(connector.sessions))
+	}
+	if !connector.sessions[0].closed {
+		t.Errorf("expired session should be closed")
+	}
+}
+
+func TestPooledConnector_LoginTest(t *testing.T) {
+	tests := []struct {
+		Name       string
+		Resettable bool
+		Pooled     bool
+	}{
+		{"resettable", true, true},
+		{"not resettable", false, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			connector := &poolTestConnector{resettable: tt.Resettable}
+			pool := ldap.NewPooledConnector(connector, 1, 0)
+
+			sess, _ := pool.Connect()
+			if err := sess.LoginTest("macrat", "correct"); err != nil {
+				t.Fatalf("failed to login: %s", err)
+			}
+			sess.Close()
+
+			if (pool.Idle() == 1) != tt.Pooled {
+				t.Errorf("unexpected number of idle sessions: %d", pool.Idle())
+			}
+			if connector.sessions[0].closed == tt.Pooled {
+				t.Errorf("unexpected closed state: %v", connector.sessions[0].closed)
+			}
+			if tt.Resettable && connector.sessions[0].resets != 1 {
+				t.Errorf("session should be reset once but reset %d times", connector.sessions[0].resets)
+			}
+		})
+	}
+}
+
+func TestPooledConnector_Reconnect(t *testing.T) {
+	connector := &poolTestConnector{}
+	pool := ldap.NewPooledConnector(connector, 1, 0)
+
+	sess, _ := pool.Connect()
+	sess.Close()
+
+	connector.sessions[0].failNext = goldap.NewError(goldap.ErrorNetwork, errors.New("connection closed"))
+
+	sess, _ = pool.Connect()
+	attrs, err := sess.GetUserAttributes("macrat", nil)
+	if err != nil {
+		t.Fatalf("expected reconnect transparently but got error: %s", err)
+	}
+	if attrs["session"][0] != "1" {
+		t.Errorf("expected the new session is used but got session %s", attrs["session"][0])
+	}
+	if !connector.sessions[0].closed {
+		t.Errorf("broken session should be closed")
+	}
+	sess.Close()
+
+	if pool.Idle() != 1 {
+		t.Errorf("the new session should be pooled but got %d idle sessions", pool.Idle())
+	}
+
+	sess, _ = pool.Connect()
+	connector.sessions[1].failNext = errors.New("some error")
+	if _, err := sess.GetUserAttributes("macrat", nil); err == nil {
+		t.Errorf("expected error but succeeded")
+	}
+	if len(connector.sessions) != 2 {
+		t.Errorf("should not reconnect for errors other than unavailable")
+	}
+	sess.Close()
+}
@@ -0,0 +1,33 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/macrat/lauth/config"
+)
+
+// NewTLSConfig makes TLS configuration for ldaps:// and StartTLS from the --ldap-tls-* options.
+// It is shared by all servers, so --ldap-tls-server-name is not included. SimpleConnector applies it only for the primary server.
+func NewTLSConfig(conf *config.LDAPConfig) (*tls.Config, error) {
+	tlsConf := &tls.Config{
+		InsecureSkipVerify: conf.TLSSkipVerify,
+	}
+
+	if conf.TLSCA != "" {
+		raw, err := os.ReadFile(conf.TLSCA)
+		if err != nil {
+			return nil, err
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(raw) {
+			return nil, fmt.Errorf("no certificate found in %s", conf.TLSCA)
+		}
+		tlsConf.RootCAs = pool
+	}
+
+	return tlsConf, nil
+}
@@ -0,0 +1,44 @@
+package ldap
+
+import (
+	"crypto/tls"
+	"testing"
+
+	"github.com/macrat/lauth/config"
+)
+
+func TestSimpleConnector_tlsConfig(t *testing.T) {
+	primary := new(config.URL)
+	if err := primary.UnmarshalText([]byte("ldaps://primary.example.com")); err != nil {
+		t.Fatalf("failed to parse URL: %s", err)
+	}
+	failover := new(config.URL)
+	if err := failover.UnmarshalText([]byte("ldaps://failover.example.com")); err != nil {
+		t.Fatalf("failed to parse URL: %s", err)
+	}
+
+	tests := []struct {
+		Name       string
+		ServerName string
+		Server     *config.URL
+		Expect     string
+	}{
+		{"primary", "", nil, "primary.example.com"},
+		{"primary with server name", "ldap.example.com", nil, "ldap.example.com"},
+		{"failover", "", failover, "failover.example.com"},
+		{"failover with server name", "ldap.example.com", failover, "failover.example.com"},
+	}
+
+	for _, tt := range tests {
+		conf := &config.LDAPConfig{Server: primary, TLSServerName: tt.ServerName}
+		connector := SimpleConnector{Config: conf, Server: tt.Server, TLS: &tls.Config{}}
+
+		server := tt.Server
+		if server == nil {
+			server = primary
+		}
+		if name := connector.tlsConfig(server).ServerName; name != tt.Expect {
+			t.Errorf("%s: expected server name %#v but got %#v", tt.Name, tt.Expect, name)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package ldap_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	goldap "github.com/go-ldap/ldap/v3"
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/ldap"
+)
+
+func writeTestCA(t *testing.T, path string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now(),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %s", err)
+	}
+
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert}), 0600); err != nil {
+		t.Fatalf("failed to write certificate: %s", err)
+	}
+}
+
+func TestNewTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	writeTestCA(t, caFile)
+	notPEM := filepath.Join(dir, "not-pem.txt")
+	if err := os.WriteFile(notPEM, []byte("hello"), 0600); err != nil {
+		t.Fatalf("failed to write file: %s", err)
+	}
+
+	conf, err := ldap.NewTLSConfig(&config.LDAPConfig{})
+	if err != nil {
+		t.Fatalf("failed to make TLS config: %s", err)
+	}
+	if conf.RootCAs != nil || conf.ServerName != "" || conf.InsecureSkipVerify {
+		t.Errorf("unexpected default TLS config: %#v", conf)
+	}
+
+	conf, err = ldap.NewTLSConfig(&config.LDAPConfig{
+		TLSCA:         caFile,
+		TLSServerName: "ldap.example.com",
+	})
+	if err != nil {
+		t.Fatalf("failed to make TLS config: %s", err)
+	}
+	if conf.RootCAs == nil {
+		t.Errorf("CA certificate was not loaded")
+	}
+	if conf.ServerName != "" {
+		t.Errorf("server name should be applied by connector but set in shared config: %#v", conf.ServerName)
+	}
+
+	if _, err := ldap.NewTLSConfig(&config.LDAPConfig{TLSCA: filepath.Join(dir, "not-found.pem")}); err == nil {
+		t.Errorf("expected error for not found CA file")
+	}
+	if _, err := ldap.NewTLSConfig(&config.LDAPConfig{TLSCA: notPEM}); err == nil {
+		t.Errorf("expected error for CA file that has no certificate")
+	}
+}
+
+// refuseStartTLS serves one connection that responds protocolError to the first request, and reports the application tag of the request.
+func refuseStartTLS(listener net.Listener, requests chan<- ber.Tag) {
+	conn, err := listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	packet, err := ber.ReadPacket(conn)
+	if err != nil || len(packet.Children) < 2 {
+		close(requests)
+		return
+	}
+	requests <- packet.Children[1].Tag
+
+	resp := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	resp.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, packet.Children[0].Value, "MessageID"))
+	ext := ber.Encode(ber.ClassApplication, ber.TypeConstructed, goldap.ApplicationExtendedResponse, nil, "Extended Response")
+	ext.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, goldap.LDAPResultProtocolError, "resultCode"))
+	ext.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	ext.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "StartTLS is not supported", "diagnosticMessage"))
+	resp.AppendChild(ext)
+	conn.Write(resp.Bytes())
+}
+
+func TestSimpleConnector_StartTLSRefused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+	defer listener.Close()
+
+	requests := make(chan ber.Tag, 1)
+	go refuseStartTLS(listener, requests)
+
+	server := new(config.URL)
+	if err := server.UnmarshalText([]byte("ldap://" + listener.Addr().String())); err != nil {
+		t.Fatalf("failed to parse URL: %s", err)
+	}
+	connector := ldap.SimpleConnector{
+		Config: &config.LDAPConfig{
+			Server:         server,
+			User:           "CN=admin,DC=example,DC=local",
+			Password:       "secret",
+			ConnectTimeout: config.Duration(time.Second),
+		},
+	}
+
+	if sess, err := connector.Connect(); err == nil {
+		sess.Close()
+		t.Fatalf("expected to fail if the server refused StartTLS")
+	}
+
+	if tag, ok := <-requests; !ok {
+		t.Errorf("the server didn't receive any request")
+	} else if tag != goldap.ApplicationExtendedRequest {
+		t.Errorf("the first request should be StartTLS before binding but got application tag %d", tag)
+	}
+}
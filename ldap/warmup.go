@@ -0,0 +1,49 @@
+package ldap
+
+import (
+	"context"
+)
+
+// WarmUp connects and binds to the LDAP server n times in parallel, to find errors of the configuration or network before serving.
+//
+// It returns the number of succeeded connections.
+// It fails only if no connection succeeded until the context is done.
+// The connections are closed soon, or kept for reusing if the connector is PooledConnector.
+func WarmUp(ctx context.Context, connector Connector, n int) (int, error) {
+	results := make(chan error, n)
+	for i := 0; i < n; i++ {
+		go func() {
+			sess, err := connector.Connect()
+			if err == nil {
+				sess.Close()
+			}
+			results <- err
+		}()
+	}
+
+	succeeded := 0
+	var lastErr error
+	for i := 0; i < n; i++ {
+		select {
+		case err := <-results:
+			if err != nil {
+				lastErr = err
+			} else {
+				succeeded++
+			}
+		case <-ctx.Done():
+			if succeeded > 0 {
+				return succeeded, nil
+			}
+			if lastErr != nil {
+				return 0, lastErr
+			}
+			return 0, ctx.Err()
+		}
+	}
+
+	if succeeded == 0 {
+		return 0, lastErr
+	}
+	return succeeded, nil
+}
@@ -0,0 +1,85 @@
+package ldap_test
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/ldap"
+)
+
+type dummySession struct {
+	ldap.Session
+}
+
+func (s dummySession) Close() error {
+	return nil
+}
+
+type dummyConnector struct {
+	succeeds int32
+	delay    time.Duration
+}
+
+func (c *dummyConnector) Connect() (ldap.Session, error) {
+	time.Sleep(c.delay)
+	if atomic.AddInt32(&c.succeeds, -1) >= 0 {
+		return dummySession{}, nil
+	}
+	return nil, errors.New("failed to connect")
+}
+
+func TestWarmUp(t *testing.T) {
+	tests := []struct {
+		Name      string
+		Connector ldap.Connector
+		Succeeded int
+		Error     bool
+	}{
+		{"all succeeded", &dummyConnector{succeeds: 3}, 3, false},
+		{"partially succeeded", &dummyConnector{succeeds: 1}, 1, false},
+		{"all failed", &dummyConnector{succeeds: 0}, 0, true},
+		{"timeout", &dummyConnector{succeeds: 3, delay: time.Minute}, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.Name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+
+			n, err := ldap.WarmUp(ctx, tt.Connector, 3)
+			if n != tt.Succeeded {
+				t.Errorf("expected %d connections succeeded but got %d", tt.Succeeded, n)
+			}
+			if (err != nil) != tt.Error {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestWarmUp_Unreachable(t *testing.T) {
+	connector := ldap.SimpleConnector{
+		Config: &config.LDAPConfig{
+			Server: &config.URL{Scheme: "ldap", Host: "127.0.0.1:1"},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	n, err := ldap.WarmUp(ctx, connector, 2)
+	if err == nil {
+		t.Fatalf("expected error but succeeded %d connections", n)
+	}
+	if !ldap.IsUnavailable(err) && err != context.DeadlineExceeded {
+		t.Errorf("unexpected error: %s", err)
+	}
+	if time.Since(start) > 6*time.Second {
+		t.Errorf("warm-up should fail until timeout but took %s", time.Since(start))
+	}
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"sync"
+
+	"github.com/rs/zerolog"
+)
+
+// AccessLogLevels is levels of access logs for successful requests, keyed by the endpoint name like "token".
+// Failed requests are always logged at error level regardless of it, so lowering the level never hides errors.
+//
+// AccessLogLevels is safe to use from multiple goroutines.
+type AccessLogLevels struct {
+	mu     sync.RWMutex
+	levels map[string]zerolog.Level
+}
+
+var (
+	// DefaultAccessLogLevels is used by the endpoints to decide the level of access logs.
+	DefaultAccessLogLevels = &AccessLogLevels{}
+)
+
+// Set replaces levels of all endpoints.
+// Endpoints that not included in levels are logged at info level.
+func (l *AccessLogLevels) Set(levels map[string]zerolog.Level) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.levels = levels
+}
+
+// Level returns the level of access logs for successful requests to the endpoint.
+func (l *AccessLogLevels) Level(endpoint string) zerolog.Level {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	if level, ok := l.levels[endpoint]; ok {
+		return level
+	}
+	return zerolog.InfoLevel
+}
+
+// ParseAccessLogLevels parses levels like {"token": "debug"} for AccessLogLevels.Set.
+func ParseAccessLogLevels(levels map[string]string) (map[string]zerolog.Level, error) {
+	result := make(map[string]zerolog.Level, len(levels))
+	for endpoint, s := range levels {
+		if s == "disabled" {
+			// zerolog.ParseLevel doesn't know the name of zerolog.Disabled.
+			result[endpoint] = zerolog.Disabled
+			continue
+		}
+		level, err := zerolog.ParseLevel(s)
+		if err != nil {
+			return nil, err
+		}
+		result[endpoint] = level
+	}
+	return result, nil
+}
@@ -0,0 +1,110 @@
+package metrics_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/metrics"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestAccessLogLevels(t *testing.T) {
+	levels, err := metrics.ParseAccessLogLevels(map[string]string{
+		"token":    "debug",
+		"userinfo": "disabled",
+	})
+	if err != nil {
+		t.Fatalf("failed to parse levels: %s", err)
+	}
+
+	var l metrics.AccessLogLevels
+	l.Set(levels)
+
+	tests := []struct {
+		Endpoint string
+		Level    zerolog.Level
+	}{
+		{"authz", zerolog.InfoLevel},
+		{"token", zerolog.DebugLevel},
+		{"userinfo", zerolog.Disabled},
+		{"introspect", zerolog.InfoLevel},
+	}
+
+	for _, tt := range tests {
+		if level := l.Level(tt.Endpoint); level != tt.Level {
+			t.Errorf("unexpected level of %s: expected %s but got %s", tt.Endpoint, tt.Level, level)
+		}
+	}
+
+	if _, err := metrics.ParseAccessLogLevels(map[string]string{"token": "verbose"}); err == nil {
+		t.Errorf("expected error for unknown level but got nil")
+	}
+}
+
+func TestContext_Close_AccessLogLevel(t *testing.T) {
+	var buf bytes.Buffer
+	origLogger, origLevel := log.Logger, zerolog.GlobalLevel()
+	log.Logger = zerolog.New(&buf)
+	zerolog.SetGlobalLevel(zerolog.TraceLevel)
+	defer func() {
+		log.Logger = origLogger
+		zerolog.SetGlobalLevel(origLevel)
+		metrics.DefaultAccessLogLevels.Set(nil)
+	}()
+
+	metrics.DefaultAccessLogLevels.Set(map[string]zerolog.Level{
+		"token":    zerolog.DebugLevel,
+		"userinfo": zerolog.Disabled,
+	})
+
+	tests := []struct {
+		Endpoint *metrics.EndpointMetrics
+		Error    bool
+		Level    string
+	}{
+		{metrics.Authz, false, "info"},
+		{metrics.Token, false, "debug"},
+		{metrics.Token, true, "error"},
+		{metrics.Userinfo, false, ""},
+		{metrics.Userinfo, true, "error"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/error=%v", tt.Endpoint.Name, tt.Error), func(t *testing.T) {
+			buf.Reset()
+
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/", nil)
+
+			report := tt.Endpoint.Start(c)
+			if tt.Error {
+				report.SetError(fmt.Errorf("something wrong"))
+			} else {
+				report.Success()
+			}
+			report.Close()
+
+			if tt.Level == "" {
+				if buf.Len() != 0 {
+					t.Fatalf("expected no log but got: %s", buf.String())
+				}
+				return
+			}
+
+			var entry struct {
+				Level string `json:"level"`
+			}
+			if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+				t.Fatalf("failed to parse log: %s: %s", err, buf.String())
+			}
+			if entry.Level != tt.Level {
+				t.Errorf("expected level %s but got %s", tt.Level, entry.Level)
+			}
+		})
+	}
+}
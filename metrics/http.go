@@ -68,6 +68,10 @@ func Middleware(handler http.Handler) http.Handler {
 		}))
 		defer timer.ObserveDuration()
 
+		path := r.URL.Path
+		inFlight.Start(path)
+		defer inFlight.Done(path)
+
 		handler.ServeHTTP(rc, r)
 	})
 }
@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"sync"
+)
+
+type inFlightCounter struct {
+	sync.Mutex
+
+	counts map[string]int
+}
+
+var inFlight = &inFlightCounter{counts: make(map[string]int)}
+
+func (c *inFlightCounter) Start(path string) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.counts[path]++
+}
+
+func (c *inFlightCounter) Done(path string) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.counts[path]--
+	if c.counts[path] <= 0 {
+		delete(c.counts, path)
+	}
+}
+
+// InFlightRequests returns number of requests that still processing for each path.
+func InFlightRequests() map[string]int {
+	inFlight.Lock()
+	defer inFlight.Unlock()
+
+	result := make(map[string]int, len(inFlight.counts))
+	for path, count := range inFlight.counts {
+		result[path] = count
+	}
+	return result
+}
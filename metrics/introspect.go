@@ -0,0 +1,21 @@
+package metrics
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	Introspect = NewEndpointMetrics(
+		"introspect",
+		[]string{"client_id", "active"},
+		[]string{"client_id"},
+	)
+)
+
+func init() {
+	Introspect.MustRegister()
+}
+
+func StartIntrospect(c *gin.Context) *Context {
+	return Introspect.Start(c)
+}
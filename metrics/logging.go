@@ -12,6 +12,7 @@ type LogContext struct {
 	Method      string
 	Path        string
 	Remote      string
+	RequestID   string
 	Err         error
 	Error       string
 	Description string
@@ -21,9 +22,10 @@ type LogContext struct {
 
 func StartLogging(ctx *gin.Context) *LogContext {
 	c := &LogContext{
-		Method: ctx.Request.Method,
-		Path:   ctx.Request.URL.Path,
-		Remote: ctx.ClientIP(),
+		Method:    ctx.Request.Method,
+		Path:      ctx.Request.URL.Path,
+		Remote:    ctx.ClientIP(),
+		RequestID: RequestID(ctx),
 	}
 	c.timer = prometheus.NewTimer(c)
 
@@ -34,6 +36,9 @@ func (c *LogContext) writeLog(e *zerolog.Event) *zerolog.Event {
 	e.Str("method", c.Method)
 	e.Str("path", c.Path)
 	e.Str("remote_addr", c.Remote)
+	if c.RequestID != "" {
+		e.Str("request_id", c.RequestID)
+	}
 
 	if c.Error != "" {
 		e.Err(c.Err)
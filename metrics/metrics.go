@@ -5,6 +5,7 @@ import (
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/macrat/lauth/audit"
 	"github.com/macrat/lauth/errors"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -59,13 +60,17 @@ func (em *EndpointMetrics) MustRegister() {
 }
 
 type Context struct {
-	Error   error
-	Metrics *EndpointMetrics
-	Labels  prometheus.Labels
-	Method  string
-	Path    string
-	Remote  string
-	timer   *prometheus.Timer
+	Error     error
+	Metrics   *EndpointMetrics
+	Labels    prometheus.Labels
+	Method    string
+	Path      string
+	Remote    string
+	RequestID string
+	timer     *prometheus.Timer
+
+	auditLogger *audit.Logger
+	auditAction audit.Action
 }
 
 func (em *EndpointMetrics) Start(ctx *gin.Context) *Context {
@@ -74,11 +79,12 @@ func (em *EndpointMetrics) Start(ctx *gin.Context) *Context {
 		ls[l] = ""
 	}
 	c := &Context{
-		Metrics: em,
-		Labels:  ls,
-		Method:  ctx.Request.Method,
-		Path:    ctx.Request.URL.Path,
-		Remote:  ctx.ClientIP(),
+		Metrics:   em,
+		Labels:    ls,
+		Method:    ctx.Request.Method,
+		Path:      ctx.Request.URL.Path,
+		Remote:    ctx.ClientIP(),
+		RequestID: RequestID(ctx),
 	}
 	c.timer = prometheus.NewTimer(c)
 	return c
@@ -99,6 +105,44 @@ func (c *Context) SetError(err error) {
 	}
 }
 
+// Audit makes an audit event of action when the context closed.
+// Calling again replaces the action.
+func (c *Context) Audit(logger *audit.Logger, action audit.Action) {
+	c.auditLogger = logger
+	c.auditAction = action
+}
+
+func (c *Context) emitAudit() {
+	if c.auditLogger == nil || c.auditAction == "" {
+		return
+	}
+
+	// Failed login shows the login page again, so the status can be "continue" even if failed.
+	var result string
+	switch {
+	case c.Labels["error"] != "":
+		result = audit.RESULT_FAILURE
+	case c.Labels["status"] == "success":
+		result = audit.RESULT_SUCCESS
+	default:
+		return
+	}
+
+	err := c.auditLogger.Emit(audit.Event{
+		Action:     c.auditAction,
+		Result:     result,
+		Subject:    c.Labels["username"],
+		ClientID:   c.Labels["client_id"],
+		RemoteAddr: c.Remote,
+		RequestID:  c.RequestID,
+		Scope:      c.Labels["scope"],
+		Error:      c.Labels["error"],
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("failed to write audit event")
+	}
+}
+
 // Success is succeed process and done.
 func (c *Context) Success() {
 	c.Labels["status"] = "success"
@@ -137,6 +181,9 @@ func (c *Context) writeLog(e *zerolog.Event) *zerolog.Event {
 	e.Str("path", c.Path)
 	e.Str("remote_addr", c.Remote)
 	e.Str("endpoint", c.Metrics.Name)
+	if c.RequestID != "" {
+		e.Str("request_id", c.RequestID)
+	}
 
 	for _, l := range c.Metrics.Labels {
 		if l != "method" && c.Labels[l] != "" {
@@ -160,6 +207,8 @@ func (c *Context) Close() error {
 		}
 	}
 	c.Metrics.Count.With(c.Labels).Inc()
+	c.emitAudit()
+	DefaultSummary.Add(c.Metrics.Name + "." + c.Labels["status"])
 	duration := c.timer.ObserveDuration()
 	c.timer = nil
 
@@ -167,8 +216,8 @@ func (c *Context) Close() error {
 		c.writeLog(log.Error()).
 			Float64("latency_seconds", duration.Seconds()).
 			Send()
-	} else {
-		c.writeLog(log.Info()).
+	} else if e := log.WithLevel(DefaultAccessLogLevels.Level(c.Metrics.Name)); e != nil {
+		c.writeLog(e).
 			Float64("latency_seconds", duration.Seconds()).
 			Send()
 	}
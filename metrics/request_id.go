@@ -0,0 +1,47 @@
+package metrics
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	requestIDKey = "lauth_request_id"
+)
+
+func isValidRequestID(id string) bool {
+	if len(id) == 0 || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+func generateRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// RequestIDMiddleware takes request ID from X-Request-ID header or generates new one, and echoes it by X-Request-ID header of the response.
+func RequestIDMiddleware(c *gin.Context) {
+	id := c.GetHeader("X-Request-ID")
+	if !isValidRequestID(id) {
+		id = generateRequestID()
+	}
+
+	c.Set(requestIDKey, id)
+	c.Header("X-Request-ID", id)
+}
+
+// RequestID returns request ID that set by RequestIDMiddleware.
+// It returns empty string if RequestIDMiddleware is not used.
+func RequestID(c *gin.Context) string {
+	return c.GetString(requestIDKey)
+}
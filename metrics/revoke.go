@@ -0,0 +1,21 @@
+package metrics
+
+import (
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	Revoke = NewEndpointMetrics(
+		"revoke",
+		[]string{"client_id", "username", "token_type"},
+		[]string{"client_id"},
+	)
+)
+
+func init() {
+	Revoke.MustRegister()
+}
+
+func StartRevoke(c *gin.Context) *Context {
+	return Revoke.Start(c)
+}
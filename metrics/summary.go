@@ -0,0 +1,85 @@
+package metrics
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Summary aggregates counts of requests in a time window.
+// It is for operators who don't have any Prometheus, and the aggregated counts are flushed to log periodically by Run.
+//
+// Summary is safe to use from multiple goroutines.
+type Summary struct {
+	mu     sync.Mutex
+	counts map[string]int64
+	since  time.Time
+}
+
+func NewSummary() *Summary {
+	return &Summary{
+		counts: make(map[string]int64),
+		since:  time.Now(),
+	}
+}
+
+var (
+	// DefaultSummary counts all requests that processed by the endpoints, keyed by endpoint and status like "token.success".
+	DefaultSummary = NewSummary()
+)
+
+// Add increments count of the key in the current window.
+func (s *Summary) Add(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.counts[key]++
+}
+
+// Flush returns counts in the current window and its duration, and starts a new window.
+func (s *Summary) Flush() (map[string]int64, time.Duration) {
+	now := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts, since := s.counts, s.since
+	s.counts = make(map[string]int64, len(counts))
+	s.since = now
+
+	return counts, now.Sub(since)
+}
+
+func (s *Summary) writeLog() {
+	counts, window := s.Flush()
+
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	e := log.Info().Float64("window_seconds", window.Seconds())
+	for _, k := range keys {
+		e.Int64(k, counts[k])
+	}
+	e.Msg("summary of requests")
+}
+
+// Run flushes summary to log every interval until ctx is canceled.
+func (s *Summary) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.writeLog()
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package metrics_test
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/metrics"
+)
+
+func TestSummary(t *testing.T) {
+	s := metrics.NewSummary()
+
+	const workers = 10
+	const requests = 1000
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < requests; j++ {
+				s.Add("token.success")
+				if j%2 == 0 {
+					s.Add("token.client_error")
+				}
+			}
+		}()
+	}
+
+	total := make(map[string]int64)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				counts, _ := s.Flush()
+				for k, v := range counts {
+					total[k] += v
+				}
+			}
+		}
+	}()
+
+	wg.Wait()
+	done <- struct{}{}
+
+	counts, window := s.Flush()
+	for k, v := range counts {
+		total[k] += v
+	}
+
+	if total["token.success"] != workers*requests {
+		t.Errorf("unexpected count of token.success: %d", total["token.success"])
+	}
+	if total["token.client_error"] != workers*requests/2 {
+		t.Errorf("unexpected count of token.client_error: %d", total["token.client_error"])
+	}
+	if window < 0 {
+		t.Errorf("unexpected window: %s", window)
+	}
+
+	if counts, _ := s.Flush(); len(counts) != 0 {
+		t.Errorf("counts should be reset after flush but got %#v", counts)
+	}
+}
+
+func TestSummary_Run(t *testing.T) {
+	s := metrics.NewSummary()
+	s.Add("authz.success")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		s.Run(ctx, 10*time.Millisecond)
+		close(stopped)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatalf("Run didn't stop after canceled")
+	}
+
+	if counts, _ := s.Flush(); len(counts) != 0 {
+		t.Errorf("counts should be flushed by Run but got %#v", counts)
+	}
+}
@@ -3,8 +3,10 @@ package page_test
 import (
 	"net/http"
 	"net/url"
+	"strings"
 	"testing"
 
+	"github.com/macrat/lauth/config"
 	"github.com/macrat/lauth/testutil"
 )
 
@@ -38,7 +40,7 @@ func TestLoginForm_value_passing(t *testing.T) {
 
 	if request, ok := inputs["request"]; !ok {
 		t.Errorf("request is missing in form")
-	} else if claims, err := env.API.TokenManager.ParseRequestObject(request, ""); err != nil {
+	} else if claims, err := env.API.TokenManager.ParseRequestObject(request, "", ""); err != nil {
 		t.Errorf("failed to parse request object: %s", err)
 	} else if err = claims.Validate(env.API.Config.Issuer.String(), env.API.Config.Issuer); err != nil {
 		t.Errorf("failed to validate request object: %s", err)
@@ -71,3 +73,71 @@ func TestLoginForm_value_passing(t *testing.T) {
 		t.Errorf("password is missing in form")
 	}
 }
+
+func TestLoginForm_scopes(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.Scopes = config.ScopeConfig{
+		"profile": {
+			Title:       "Your Profile",
+			Description: "Name and family name.",
+			Icon:        "https://example.com/profile.png",
+			Claims:      config.DefaultScopes["profile"].Claims,
+		},
+		"email": config.DefaultScopes["email"],
+	}
+
+	resp := env.Get("/authz", "", url.Values{
+		"response_type": {"code"},
+		"client_id":     {"some_client_id"},
+		"redirect_uri":  {"http://some-client.example.com/callback"},
+		"scope":         {"openid profile email"},
+	})
+	if resp.Code != http.StatusOK {
+		t.Log(string(resp.Body.Bytes()))
+		t.Fatalf("failed to render login page (status code = %d)", resp.Code)
+	}
+
+	body := string(resp.Body.Bytes())
+	for _, expect := range []string{
+		`<li data-scope="email"><span>email</span></li>`,
+		`<li data-scope="profile"><img src="https://example.com/profile.png" alt="" /> <span>Your Profile</span>: <span>Name and family name.</span></li>`,
+	} {
+		if !strings.Contains(body, expect) {
+			t.Errorf("expected %#v in login page but not found", expect)
+		}
+	}
+	if strings.Contains(body, `data-scope="openid"`) {
+		t.Errorf("openid scope should not be shown in login page")
+	}
+}
+
+func TestLoginForm_optionalScopes(t *testing.T) {
+	env := testutil.NewAPITestEnvironment(t)
+	env.API.Config.Scopes = config.ScopeConfig{
+		"profile": {Optional: true, Claims: config.DefaultScopes["profile"].Claims},
+		"email":   {Optional: true, Preselected: true, Claims: config.DefaultScopes["email"].Claims},
+		"phone":   config.DefaultScopes["phone"],
+	}
+
+	resp := env.Get("/authz", "", url.Values{
+		"response_type": {"code"},
+		"client_id":     {"some_client_id"},
+		"redirect_uri":  {"http://some-client.example.com/callback"},
+		"scope":         {"openid profile email phone"},
+	})
+	if resp.Code != http.StatusOK {
+		t.Log(string(resp.Body.Bytes()))
+		t.Fatalf("failed to render login page (status code = %d)", resp.Code)
+	}
+
+	body := string(resp.Body.Bytes())
+	for _, expect := range []string{
+		`<li data-scope="profile"><input type="checkbox" name="optional_scope" value="profile" form="login-form" aria-label="grant profile" /> <span>profile</span></li>`,
+		`<li data-scope="email"><input type="checkbox" name="optional_scope" value="email" form="login-form" aria-label="grant email" checked /> <span>email</span></li>`,
+		`<li data-scope="phone"><span>phone</span></li>`,
+	} {
+		if !strings.Contains(body, expect) {
+			t.Errorf("expected %#v in login page but not found", expect)
+		}
+	}
+}
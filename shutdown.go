@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/macrat/lauth/metrics"
+	"github.com/rs/zerolog/log"
+)
+
+var (
+	ErrForcedShutdown = errors.New("requests did not drain before shutdown timeout")
+)
+
+// ShutdownServer stops server gracefully.
+// If in-flight requests don't finish in timeout, it force closes connections and returns ErrForcedShutdown.
+func ShutdownServer(server *http.Server, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := server.Shutdown(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+
+	for path, count := range metrics.InFlightRequests() {
+		log.Error().
+			Str("path", path).
+			Int("in_flight", count).
+			Msg("request did not finish before shutdown timeout")
+	}
+
+	if err := server.Close(); err != nil {
+		log.Error().Err(err).Msg("failed to close connections")
+	}
+
+	return ErrForcedShutdown
+}
+
+func shutdownOnSignal(server *http.Server, timeout time.Duration, result chan<- error) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGINT, syscall.SIGTERM)
+
+	sig := <-ch
+	signal.Stop(ch)
+
+	log.Info().Str("signal", sig.String()).Dur("timeout", timeout).Msg("shutting down")
+
+	result <- ShutdownServer(server, timeout)
+}
@@ -0,0 +1,87 @@
+package main_test
+
+import (
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth"
+	"github.com/macrat/lauth/metrics"
+)
+
+func startServer(t *testing.T, handler http.Handler) (*http.Server, string) {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %s", err)
+	}
+
+	server := &http.Server{Handler: metrics.Middleware(handler)}
+	go server.Serve(listener)
+
+	return server, "http://" + listener.Addr().String()
+}
+
+func TestShutdownServer(t *testing.T) {
+	server, url := startServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	resp, err := http.Get(url + "/fast")
+	if err != nil {
+		t.Fatalf("failed to request: %s", err)
+	}
+	resp.Body.Close()
+
+	if err := main.ShutdownServer(server, time.Second); err != nil {
+		t.Errorf("failed to shutdown: %s", err)
+	}
+}
+
+func TestShutdownServer_StuckRequest(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+
+	server, url := startServer(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+	}))
+
+	requestErr := make(chan error, 1)
+	go func() {
+		resp, err := http.Get(url + "/stuck")
+		if err == nil {
+			resp.Body.Close()
+		}
+		requestErr <- err
+	}()
+	<-started
+
+	if n := metrics.InFlightRequests()["/stuck"]; n != 1 {
+		t.Errorf("unexpected number of in-flight requests: %d", n)
+	}
+
+	timeout := 100 * time.Millisecond
+	begin := time.Now()
+	err := main.ShutdownServer(server, timeout)
+	elapsed := time.Since(begin)
+
+	if err != main.ErrForcedShutdown {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if elapsed < timeout {
+		t.Errorf("forced close before timeout: %s", elapsed)
+	}
+
+	select {
+	case err := <-requestErr:
+		if err == nil {
+			t.Errorf("stuck request expected to be failed but succeed")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("stuck request is not closed")
+	}
+}
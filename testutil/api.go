@@ -20,6 +20,7 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/macrat/lauth/api"
 	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/metrics"
 	"github.com/rs/zerolog"
 )
 
@@ -45,6 +46,7 @@ func FindAvailTCPPort() int {
 func MakeTestRouter() *gin.Engine {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
+	router.Use(metrics.RequestIDMiddleware)
 	router.LoadHTMLGlob("../page/html/*.tmpl")
 
 	return router
@@ -93,6 +95,9 @@ func NewAPITestEnvironment(t *testing.T) *APITestEnvironment {
 		Connector:    LDAP,
 		Config:       MakeConfig(),
 		TokenManager: tokenManager,
+		Nonces:       api.NewNonceStore(),
+		Codes:        api.NewCodeStore(),
+		Maintenance:  &api.Maintenance{},
 	}
 	api.SetRoutes(router)
 	api.SetErrorRoutes(router)
@@ -190,7 +195,7 @@ func (env *APITestEnvironment) RedirectTest(t *testing.T, method, endpoint strin
 					t.Fatalf("failed to parse Location header: %s", err)
 				}
 
-				fragment, err := url.ParseQuery(loc.Fragment)
+				fragment, err := url.ParseQuery(loc.EscapedFragment())
 				if err != nil {
 					t.Errorf("failed to parse Location fragment: %s", err)
 				}
@@ -283,7 +288,7 @@ func (env *APITestEnvironment) Start(t *testing.T) (stop func()) {
 	go func() {
 		err := env.Run(ctx)
 		if err != nil {
-			t.Fatalf("failed on test server: %s", err)
+			t.Errorf("failed on test server: %s", err)
 		}
 	}()
 	time.Sleep(100 * time.Millisecond)
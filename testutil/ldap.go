@@ -3,6 +3,7 @@ package testutil
 import (
 	"fmt"
 
+	goldap "github.com/go-ldap/ldap/v3"
 	"github.com/macrat/lauth/ldap"
 )
 
@@ -16,6 +17,7 @@ var (
 				"sn":              {"shida"},
 				"mail":            {"m@crat.jp"},
 				"telephoneNumber": {"000-1234-5678"},
+				"entitlements":    {"admin", "billing"},
 			},
 		},
 		"j.smith": DummyUserInfo{
@@ -68,3 +70,10 @@ func (c DummyLDAP) GetUserAttributes(username string, attributes []string) (map[
 	}
 	return result, nil
 }
+
+// UnavailableLDAP is a connector that behaves as if the LDAP server is down.
+type UnavailableLDAP struct{}
+
+func (c UnavailableLDAP) Connect() (ldap.Session, error) {
+	return nil, goldap.NewError(goldap.ErrorNetwork, fmt.Errorf("connection refused"))
+}
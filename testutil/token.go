@@ -2,10 +2,15 @@ package testutil
 
 import (
 	"bytes"
+	"crypto/ecdsa"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
 	"encoding/pem"
+	"fmt"
+	"math/big"
 	"testing"
 
 	"github.com/macrat/lauth/token"
@@ -61,7 +66,7 @@ func MakeTokenManager() (token.Manager, error) {
 	return token.NewManagerFromFile(buf)
 }
 
-func MakeRequestObject(t *testing.T, values map[string]interface{}, key string) string {
+func MakeRequestObject(t testing.TB, values map[string]interface{}, key string) string {
 	pri, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(key))
 	if err != nil {
 		t.Fatalf("failed to prepare key for signing to request object: %s", err)
@@ -75,10 +80,55 @@ func MakeRequestObject(t *testing.T, values map[string]interface{}, key string)
 	return result
 }
 
-func SomeClientRequestObject(t *testing.T, values map[string]interface{}) string {
+func SomeClientRequestObject(t testing.TB, values map[string]interface{}) string {
 	return MakeRequestObject(t, values, SomeClientPrivateKey)
 }
 
-func ImplicitClientRequestObject(t *testing.T, values map[string]interface{}) string {
+func ImplicitClientRequestObject(t testing.TB, values map[string]interface{}) string {
 	return MakeRequestObject(t, values, ImplicitClientPrivateKey)
 }
+
+// MakeJWKSet makes a JWK Set in JSON from PEM of RSA public keys or *ecdsa.PublicKey.
+// The kid of each key is "key-" and the index.
+func MakeJWKSet(t testing.TB, keys ...interface{}) string {
+	t.Helper()
+
+	encode := func(i *big.Int) string {
+		return base64.RawURLEncoding.EncodeToString(i.Bytes())
+	}
+
+	var set token.JWKSet
+	for i, key := range keys {
+		switch k := key.(type) {
+		case string:
+			pub, err := jwt.ParseRSAPublicKeyFromPEM([]byte(k))
+			if err != nil {
+				t.Fatalf("failed to parse public key: %s", err)
+			}
+			set.Keys = append(set.Keys, token.JWK{
+				KeyID:   fmt.Sprintf("key-%d", i),
+				Use:     "sig",
+				KeyType: "RSA",
+				N:       encode(pub.N),
+				E:       encode(big.NewInt(int64(pub.E))),
+			})
+		case *ecdsa.PublicKey:
+			set.Keys = append(set.Keys, token.JWK{
+				KeyID:   fmt.Sprintf("key-%d", i),
+				Use:     "sig",
+				KeyType: "EC",
+				Curve:   k.Curve.Params().Name,
+				X:       encode(k.X),
+				Y:       encode(k.Y),
+			})
+		default:
+			t.Fatalf("unsupported key type: %T", key)
+		}
+	}
+
+	raw, err := json.Marshal(set)
+	if err != nil {
+		t.Fatalf("failed to encode JWK Set: %s", err)
+	}
+	return string(raw)
+}
@@ -12,6 +12,18 @@ type AccessTokenClaims struct {
 
 	AuthorizedParties []string `json:"azp,omitempty"`
 	Scope             string   `json:"scope,omitempty"`
+	RequestID         string   `json:"rid,omitempty"`
+
+	// Claims is the userinfo member of the claims parameter, to respond individually requested claims from the userinfo endpoint.
+	Claims ClaimRequests `json:"claims,omitempty"`
+
+	// GrantID is the ID of the authorization grant that issued the token with a refresh token.
+	// The token is invalidated when the refresh token of the same grant is revoked. (RFC 7009 2.1)
+	GrantID string `json:"gid,omitempty"`
+
+	// ClientCredentials is true if the token is issued by the client_credentials grant.
+	// Such token is for the client itself and not for any user, so the subject is the client_id.
+	ClientCredentials bool `json:"client_credentials,omitempty"`
 }
 
 func (claims AccessTokenClaims) Validate(issuer *config.URL) error {
@@ -26,28 +38,66 @@ func (claims AccessTokenClaims) Validate(issuer *config.URL) error {
 	return nil
 }
 
-func (m Manager) CreateAccessToken(issuer *config.URL, subject, clientID, scope string, authTime time.Time, expiresIn time.Duration) (string, error) {
+// CreateAccessToken creates a new access token.
+// The requestID will be included as rid claim if it is not empty.
+func (m Manager) CreateAccessToken(issuer *config.URL, subject, clientID, scope, requestID string, auth Authentication, expiresIn time.Duration) (string, error) {
+	return m.CreateAccessTokenWithClaims(issuer, subject, clientID, scope, requestID, "", nil, auth, expiresIn)
+}
+
+// CreateAccessTokenWithClaims creates a new access token that carries claims requested for the userinfo.
+// The grantID should be the same as the refresh token issued by the same grant, or empty if no refresh token.
+func (m Manager) CreateAccessTokenWithClaims(issuer *config.URL, subject, clientID, scope, requestID, grantID string, claims ClaimRequests, auth Authentication, expiresIn time.Duration) (string, error) {
 	return m.create(AccessTokenClaims{
 		OIDCClaims: OIDCClaims{
 			StandardClaims: jwt.StandardClaims{
 				Issuer:    issuer.String(),
 				Subject:   subject,
-				Audience:  issuer.String(),
 				ExpiresAt: time.Now().Add(expiresIn).Unix(),
 				IssuedAt:  time.Now().Unix(),
+				Id:        m.newJTI(),
+			},
+			Audience: Audience{issuer.String()},
+			Type:     "ACCESS_TOKEN",
+			AuthTime: auth.Time.Unix(),
+			ACR:      auth.ACR,
+			AMR:      auth.AMR,
+		},
+		AuthorizedParties: []string{clientID},
+		Scope:             scope,
+		RequestID:         requestID,
+		Claims:            claims,
+		GrantID:           grantID,
+	})
+}
+
+// CreateClientAccessToken creates a new access token for the client itself by the client_credentials grant.
+func (m Manager) CreateClientAccessToken(issuer *config.URL, clientID, scope, requestID string, expiresIn time.Duration) (string, error) {
+	return m.create(AccessTokenClaims{
+		OIDCClaims: OIDCClaims{
+			StandardClaims: jwt.StandardClaims{
+				Issuer:    issuer.String(),
+				Subject:   clientID,
+				ExpiresAt: time.Now().Add(expiresIn).Unix(),
+				IssuedAt:  time.Now().Unix(),
+				Id:        m.newJTI(),
 			},
+			Audience: Audience{issuer.String()},
 			Type:     "ACCESS_TOKEN",
-			AuthTime: authTime.Unix(),
 		},
 		AuthorizedParties: []string{clientID},
 		Scope:             scope,
+		RequestID:         requestID,
+		ClientCredentials: true,
 	})
 }
 
 func (m Manager) ParseAccessToken(token string) (AccessTokenClaims, error) {
 	var claims AccessTokenClaims
-	if _, err := m.parse(token, "", &claims); err != nil {
+	if _, err := m.parse(token, "", "", &claims); err != nil {
 		return AccessTokenClaims{}, err
 	}
+	if m.IsRevoked(claims.Id) || (claims.GrantID != "" && m.IsRevoked(claims.GrantID)) {
+		return AccessTokenClaims{}, TokenRevokedError
+	}
 	return claims, nil
 }
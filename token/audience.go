@@ -0,0 +1,74 @@
+package token
+
+import (
+	"encoding/json"
+
+	"gopkg.in/dgrijalva/jwt-go.v3"
+)
+
+// Audience is the aud claim of JWT.
+//
+// It is encoded as a string if it has single audience, or as an array if it has multiple audiences.
+// Both forms are accepted on decoding.
+type Audience []string
+
+func (aud Audience) Includes(audience string) bool {
+	for _, a := range aud {
+		if a == audience {
+			return true
+		}
+	}
+	return false
+}
+
+func (aud Audience) MarshalJSON() ([]byte, error) {
+	if len(aud) == 1 {
+		return json.Marshal(aud[0])
+	}
+	return json.Marshal([]string(aud))
+}
+
+func (aud *Audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*aud = Audience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(data, &multiple); err != nil {
+		return err
+	}
+	*aud = Audience(multiple)
+	return nil
+}
+
+// arrayAudienceClaims encodes the aud claim of the wrapped claims as an array even if it has single audience.
+// Some strict verifiers accept only this form.
+type arrayAudienceClaims struct {
+	jwt.Claims
+}
+
+func (claims arrayAudienceClaims) MarshalJSON() ([]byte, error) {
+	raw, err := json.Marshal(claims.Claims)
+	if err != nil {
+		return nil, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return nil, err
+	}
+
+	if rawAud, ok := fields["aud"]; ok {
+		var aud Audience
+		if err := json.Unmarshal(rawAud, &aud); err != nil {
+			return nil, err
+		}
+		if fields["aud"], err = json.Marshal([]string(aud)); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(fields)
+}
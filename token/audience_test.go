@@ -0,0 +1,119 @@
+package token_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/testutil"
+	"github.com/macrat/lauth/token"
+	"gopkg.in/dgrijalva/jwt-go.v3"
+)
+
+func TestAudience(t *testing.T) {
+	tests := []struct {
+		Audience token.Audience
+		JSON     string
+	}{
+		{token.Audience{"something"}, `"something"`},
+		{token.Audience{"something", "another"}, `["something","another"]`},
+	}
+
+	for _, tt := range tests {
+		encoded, err := json.Marshal(tt.Audience)
+		if err != nil {
+			t.Errorf("%v: failed to marshal: %s", tt.Audience, err)
+			continue
+		}
+		if string(encoded) != tt.JSON {
+			t.Errorf("%v: unexpected JSON: expected %s but got %s", tt.Audience, tt.JSON, encoded)
+		}
+
+		var decoded token.Audience
+		if err := json.Unmarshal([]byte(tt.JSON), &decoded); err != nil {
+			t.Errorf("%s: failed to unmarshal: %s", tt.JSON, err)
+		} else if !reflect.DeepEqual(decoded, tt.Audience) {
+			t.Errorf("%s: unexpected decoded value: %v", tt.JSON, decoded)
+		}
+	}
+
+	var decoded token.Audience
+	if err := json.Unmarshal([]byte(`["something"]`), &decoded); err != nil {
+		t.Errorf("failed to unmarshal array of single audience: %s", err)
+	} else if !reflect.DeepEqual(decoded, token.Audience{"something"}) {
+		t.Errorf("unexpected decoded value: %v", decoded)
+	}
+
+	if err := json.Unmarshal([]byte(`123`), &decoded); err == nil {
+		t.Errorf("expected error for number but succeed")
+	}
+
+	if !(token.Audience{"something", "another"}).Includes("another") {
+		t.Errorf("another should be included")
+	}
+	if (token.Audience{"something"}).Includes("another") {
+		t.Errorf("another should not be included")
+	}
+}
+
+func TestManager_WithAudienceArray(t *testing.T) {
+	manager, err := testutil.MakeTokenManager()
+	if err != nil {
+		t.Fatalf("failed to generate TokenManager: %s", err)
+	}
+
+	issuer := &config.URL{Scheme: "http", Host: "localhost:8000"}
+
+	tests := []struct {
+		Manager  token.Manager
+		Expected interface{}
+	}{
+		{manager, "some_client_id"},
+		{manager.WithAudienceArray(true), []interface{}{"some_client_id"}},
+	}
+
+	for _, tt := range tests {
+		idToken, err := tt.Manager.CreateIDToken(issuer, "someone", "some_client_id", "", "", "", nil, token.Authentication{Time: time.Now()}, 10*time.Minute)
+		if err != nil {
+			t.Fatalf("failed to create id_token: %s", err)
+		}
+
+		var raw jwt.MapClaims
+		if _, _, err := new(jwt.Parser).ParseUnverified(idToken, &raw); err != nil {
+			t.Fatalf("failed to decode id_token: %s", err)
+		}
+		if !reflect.DeepEqual(raw["aud"], tt.Expected) {
+			t.Errorf("unexpected aud: expected %#v but got %#v", tt.Expected, raw["aud"])
+		}
+
+		claims, err := tt.Manager.ParseIDToken(idToken)
+		if err != nil {
+			t.Fatalf("failed to parse id_token: %s", err)
+		}
+		if err := claims.Validate(issuer, "some_client_id"); err != nil {
+			t.Errorf("failed to validate id_token: %s", err)
+		}
+
+		accessToken, err := tt.Manager.CreateAccessToken(issuer, "someone", "some_client_id", "openid", "", token.Authentication{Time: time.Now()}, 10*time.Minute)
+		if err != nil {
+			t.Fatalf("failed to create access_token: %s", err)
+		}
+		if access, err := tt.Manager.ParseAccessToken(accessToken); err != nil {
+			t.Errorf("failed to parse access_token: %s", err)
+		} else if err := access.Validate(issuer); err != nil {
+			t.Errorf("failed to validate access_token: %s", err)
+		}
+
+		request, err := tt.Manager.CreateRequestObject(issuer, "someone", token.RequestObjectClaims{ClientID: "some_client_id"}, time.Now().Add(10*time.Minute))
+		if err != nil {
+			t.Fatalf("failed to create request object: %s", err)
+		}
+		if claims, err := tt.Manager.ParseRequestObject(request, "", ""); err != nil {
+			t.Errorf("failed to parse request object: %s", err)
+		} else if err := claims.Validate(issuer.String(), issuer); err != nil {
+			t.Errorf("failed to validate request object: %s", err)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package token
+
+import (
+	"encoding/json"
+)
+
+// ClaimRequest is a request for an individual claim in the claims parameter of OpenID Connect.
+//
+// The Essential is only informational, because the spec says that the server should not fail even if an essential claim can't be returned.
+type ClaimRequest struct {
+	Essential bool          `json:"essential,omitempty"`
+	Value     interface{}   `json:"value,omitempty"`
+	Values    []interface{} `json:"values,omitempty"`
+}
+
+// Match reports whether the value satisfies the requested value or values.
+// Any value matches if neither value nor values is requested.
+func (r *ClaimRequest) Match(value interface{}) bool {
+	if r == nil || (r.Value == nil && len(r.Values) == 0) {
+		return true
+	}
+
+	actual, err := json.Marshal(value)
+	if err != nil {
+		return false
+	}
+
+	candidates := r.Values
+	if r.Value != nil {
+		candidates = append([]interface{}{r.Value}, candidates...)
+	}
+	for _, c := range candidates {
+		if expected, err := json.Marshal(c); err == nil && string(expected) == string(actual) {
+			return true
+		}
+	}
+	return false
+}
+
+// ClaimRequests is a map of claim name to the request, for the userinfo or the id_token.
+// The request can be nil if the client requests the claim in the default manner.
+type ClaimRequests map[string]*ClaimRequest
+
+// Names returns names of the requested claims.
+func (rs ClaimRequests) Names() []string {
+	names := make([]string, 0, len(rs))
+	for name := range rs {
+		names = append(names, name)
+	}
+	return names
+}
+
+// Filter removes claims that don't satisfy the requested value or values from the claims.
+// The sub claim is never removed.
+func (rs ClaimRequests) Filter(claims map[string]interface{}) {
+	for name, r := range rs {
+		if v, ok := claims[name]; ok && name != "sub" && !r.Match(v) {
+			delete(claims, name)
+		}
+	}
+}
+
+// ClaimsRequest is the claims parameter of OpenID Connect.
+type ClaimsRequest struct {
+	Userinfo ClaimRequests `json:"userinfo,omitempty"`
+	IDToken  ClaimRequests `json:"id_token,omitempty"`
+}
+
+// ParseClaimsRequest parses the claims parameter.
+// It returns nil without error if the parameter is empty.
+//
+// The maxSize and maxMembers limit bytes of the parameter and the number of requested claims, same as CheckLimits.
+// The size is checked before parsing, so a huge parameter doesn't consume resources.
+func ParseClaimsRequest(raw string, maxSize, maxMembers int) (*ClaimsRequest, error) {
+	if raw == "" {
+		return nil, nil
+	}
+	if maxSize > 0 && len(raw) > maxSize {
+		return nil, ClaimsRequestTooLargeError
+	}
+
+	var req ClaimsRequest
+	if err := json.Unmarshal([]byte(raw), &req); err != nil {
+		return nil, err
+	}
+	if err := req.CheckLimits(0, maxMembers); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// Len returns the number of requested claims for the userinfo and the id_token.
+func (r *ClaimsRequest) Len() int {
+	if r == nil {
+		return 0
+	}
+	return len(r.Userinfo) + len(r.IDToken)
+}
+
+// AllowSubject reports whether the subject satisfies the value or values of the sub claim that requested for the id_token or the userinfo.
+// Filter never removes the sub claim, so the authorization endpoint must check this instead, as OpenID Connect Core 1.0 section 5.5.1 requires.
+func (r *ClaimsRequest) AllowSubject(subject string) bool {
+	if r == nil {
+		return true
+	}
+	return r.IDToken["sub"].Match(subject) && r.Userinfo["sub"].Match(subject)
+}
+
+// CheckLimits checks the size in JSON and the number of requested claims.
+// Each limit is disabled if it is 0.
+//
+// The claims are carried by code and tokens, so the limits keep them small.
+func (r *ClaimsRequest) CheckLimits(maxSize, maxMembers int) error {
+	if r == nil {
+		return nil
+	}
+	if maxMembers > 0 && r.Len() > maxMembers {
+		return TooManyClaimsRequestedError
+	}
+	if maxSize > 0 {
+		raw, err := json.Marshal(r)
+		if err != nil {
+			return err
+		}
+		if len(raw) > maxSize {
+			return ClaimsRequestTooLargeError
+		}
+	}
+	return nil
+}
+
+// normalize returns a copy of the requests that replaced the empty requests by nil, because both mean the default manner.
+func (rs ClaimRequests) normalize() ClaimRequests {
+	if len(rs) == 0 {
+		return nil
+	}
+	normalized := make(ClaimRequests, len(rs))
+	for name, r := range rs {
+		if r != nil && (r.Essential || r.Value != nil || len(r.Values) > 0) {
+			normalized[name] = r
+		} else {
+			normalized[name] = nil
+		}
+	}
+	return normalized
+}
+
+// Equal reports whether two requests are the same after normalized.
+// The values are compared in JSON, so it doesn't matter how they were decoded, like float64 or json.Number.
+func (r *ClaimsRequest) Equal(other *ClaimsRequest) bool {
+	a, err := json.Marshal(ClaimsRequest{Userinfo: r.ForUserinfo().normalize(), IDToken: r.ForIDToken().normalize()})
+	if err != nil {
+		return false
+	}
+	b, err := json.Marshal(ClaimsRequest{Userinfo: other.ForUserinfo().normalize(), IDToken: other.ForIDToken().normalize()})
+	if err != nil {
+		return false
+	}
+	return string(a) == string(b)
+}
+
+// ForUserinfo returns requests for the userinfo, or nil if the receiver is nil.
+func (r *ClaimsRequest) ForUserinfo() ClaimRequests {
+	if r == nil {
+		return nil
+	}
+	return r.Userinfo
+}
+
+// ForIDToken returns requests for the id_token, or nil if the receiver is nil.
+func (r *ClaimsRequest) ForIDToken() ClaimRequests {
+	if r == nil {
+		return nil
+	}
+	return r.IDToken
+}
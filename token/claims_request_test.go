@@ -0,0 +1,203 @@
+package token_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/macrat/lauth/token"
+)
+
+func TestParseClaimsRequest(t *testing.T) {
+	tests := []struct {
+		Raw    string
+		Expect *token.ClaimsRequest
+		Error  bool
+	}{
+		{Raw: "", Expect: nil},
+		{Raw: "{}", Expect: &token.ClaimsRequest{}},
+		{
+			Raw: `{"userinfo": {"email": null, "name": {"essential": true}}, "id_token": {"groups": {"value": "admin"}, "locale": {"values": ["en", "ja"]}}}`,
+			Expect: &token.ClaimsRequest{
+				Userinfo: token.ClaimRequests{
+					"email": nil,
+					"name":  {Essential: true},
+				},
+				IDToken: token.ClaimRequests{
+					"groups": {Value: "admin"},
+					"locale": {Values: []interface{}{"en", "ja"}},
+				},
+			},
+		},
+		{Raw: `{"userinfo": {"email": null}, "unknown": 1}`, Expect: &token.ClaimsRequest{Userinfo: token.ClaimRequests{"email": nil}}},
+		{Raw: `{"userinfo": `, Error: true},
+		{Raw: `["userinfo"]`, Error: true},
+		{Raw: `{"userinfo": ["email"]}`, Error: true},
+		{Raw: `{"id_token": {"email": true}}`, Error: true},
+		{Raw: `{"id_token": {"email": {"essential": "yes"}}}`, Error: true},
+		{Raw: `{"id_token": {"email": {"values": "foo"}}}`, Error: true},
+	}
+
+	for _, tt := range tests {
+		req, err := token.ParseClaimsRequest(tt.Raw, 0, 0)
+		if tt.Error {
+			if err == nil {
+				t.Errorf("%s: expected error but got nil", tt.Raw)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %s", tt.Raw, err)
+		} else if !reflect.DeepEqual(req, tt.Expect) {
+			t.Errorf("%s: unexpected result: %#v", tt.Raw, req)
+		}
+	}
+}
+
+func TestParseClaimsRequest_Limits(t *testing.T) {
+	raw := `{"userinfo": {"email": null}, "id_token": {"email": null, "name": {"essential": true}}}`
+
+	tests := []struct {
+		MaxSize    int
+		MaxMembers int
+		Error      error
+	}{
+		{0, 0, nil},
+		{len(raw), 3, nil},
+		{len(raw) - 1, 0, token.ClaimsRequestTooLargeError},
+		{0, 2, token.TooManyClaimsRequestedError},
+	}
+
+	for _, tt := range tests {
+		_, err := token.ParseClaimsRequest(raw, tt.MaxSize, tt.MaxMembers)
+		if err != tt.Error {
+			t.Errorf("size=%d members=%d: expected error %v but got %v", tt.MaxSize, tt.MaxMembers, tt.Error, err)
+		}
+	}
+}
+
+func TestClaimsRequest_Equal(t *testing.T) {
+	tests := []struct {
+		A, B   *token.ClaimsRequest
+		Expect bool
+	}{
+		{nil, nil, true},
+		{nil, &token.ClaimsRequest{}, true},
+		{
+			&token.ClaimsRequest{IDToken: token.ClaimRequests{"age": {Value: float64(20)}}},
+			&token.ClaimsRequest{IDToken: token.ClaimRequests{"age": {Value: json.Number("20")}}},
+			true,
+		},
+		{
+			&token.ClaimsRequest{Userinfo: token.ClaimRequests{"email": nil}},
+			&token.ClaimsRequest{Userinfo: token.ClaimRequests{"email": {}}},
+			true,
+		},
+		{
+			&token.ClaimsRequest{Userinfo: token.ClaimRequests{"email": nil}},
+			&token.ClaimsRequest{IDToken: token.ClaimRequests{"email": nil}},
+			false,
+		},
+		{
+			&token.ClaimsRequest{IDToken: token.ClaimRequests{"email": nil}},
+			&token.ClaimsRequest{IDToken: token.ClaimRequests{"email": {Essential: true}}},
+			false,
+		},
+	}
+
+	for i, tt := range tests {
+		if got := tt.A.Equal(tt.B); got != tt.Expect {
+			t.Errorf("%d: expected %v but got %v", i, tt.Expect, got)
+		}
+	}
+}
+
+func TestClaimsRequest_AllowSubject(t *testing.T) {
+	tests := []struct {
+		Request *token.ClaimsRequest
+		Expect  bool
+	}{
+		{nil, true},
+		{&token.ClaimsRequest{IDToken: token.ClaimRequests{"sub": nil}}, true},
+		{&token.ClaimsRequest{IDToken: token.ClaimRequests{"sub": {Value: "macrat"}}}, true},
+		{&token.ClaimsRequest{IDToken: token.ClaimRequests{"sub": {Value: "someone"}}}, false},
+		{&token.ClaimsRequest{Userinfo: token.ClaimRequests{"sub": {Values: []interface{}{"someone", "macrat"}}}}, true},
+		{&token.ClaimsRequest{Userinfo: token.ClaimRequests{"sub": {Value: "someone"}}}, false},
+		{
+			&token.ClaimsRequest{
+				IDToken:  token.ClaimRequests{"sub": {Value: "macrat"}},
+				Userinfo: token.ClaimRequests{"sub": {Value: "someone"}},
+			},
+			false,
+		},
+	}
+
+	for i, tt := range tests {
+		if got := tt.Request.AllowSubject("macrat"); got != tt.Expect {
+			t.Errorf("%d: expected %v but got %v", i, tt.Expect, got)
+		}
+	}
+}
+
+func TestClaimRequest_Match(t *testing.T) {
+	tests := []struct {
+		Request *token.ClaimRequest
+		Value   interface{}
+		Expect  bool
+	}{
+		{nil, "anything", true},
+		{&token.ClaimRequest{Essential: true}, "anything", true},
+		{&token.ClaimRequest{Value: "en"}, "en", true},
+		{&token.ClaimRequest{Value: "en"}, "ja", false},
+		{&token.ClaimRequest{Values: []interface{}{"en", "ja"}}, "ja", true},
+		{&token.ClaimRequest{Values: []interface{}{"en", "ja"}}, "fr", false},
+		{&token.ClaimRequest{Value: float64(42)}, int64(42), true},
+		{&token.ClaimRequest{Value: true}, false, false},
+		{&token.ClaimRequest{Value: []interface{}{"a", "b"}}, []string{"a", "b"}, true},
+	}
+
+	for _, tt := range tests {
+		if got := tt.Request.Match(tt.Value); got != tt.Expect {
+			t.Errorf("%#v.Match(%#v): expected %v but got %v", tt.Request, tt.Value, tt.Expect, got)
+		}
+	}
+}
+
+func TestClaimRequests_Filter(t *testing.T) {
+	requests := token.ClaimRequests{
+		"sub":    {Value: "someone"},
+		"email":  nil,
+		"locale": {Values: []interface{}{"en", "ja"}},
+		"groups": {Value: "admin"},
+	}
+	claims := map[string]interface{}{
+		"sub":    "macrat",
+		"email":  "m@crat.jp",
+		"locale": "ja",
+		"groups": "users",
+		"name":   "SHIDA Yuuma",
+	}
+
+	requests.Filter(claims)
+
+	expect := map[string]interface{}{
+		"sub":    "macrat",
+		"email":  "m@crat.jp",
+		"locale": "ja",
+		"name":   "SHIDA Yuuma",
+	}
+	if !reflect.DeepEqual(claims, expect) {
+		t.Errorf("unexpected claims: %#v", claims)
+	}
+
+	var none token.ClaimRequests
+	none.Filter(claims)
+	if !reflect.DeepEqual(claims, expect) {
+		t.Errorf("nil requests should not change claims: %#v", claims)
+	}
+
+	var req *token.ClaimsRequest
+	if req.ForUserinfo() != nil || req.ForIDToken() != nil {
+		t.Errorf("nil claims request should return nil requests")
+	}
+}
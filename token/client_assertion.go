@@ -0,0 +1,134 @@
+package token
+
+import (
+	"time"
+
+	"gopkg.in/dgrijalva/jwt-go.v3"
+)
+
+const (
+	CLIENT_ASSERTION_TYPE_JWT_BEARER = "urn:ietf:params:oauth:client-assertion-type:jwt-bearer"
+
+	// MaxClientAssertionLifetime is the limit of exp of client_assertion from now.
+	// The jti is kept until exp to reject the reused assertion, so the client can't make it stay in memory for long.
+	MaxClientAssertionLifetime = time.Hour
+)
+
+type ClientAssertionClaims struct {
+	jwt.StandardClaims
+
+	Audience Audience `json:"aud,omitempty"`
+}
+
+func (claims ClientAssertionClaims) Validate(clientID, audience string) error {
+	if err := claims.StandardClaims.Valid(); err != nil {
+		return err
+	}
+
+	// Both are required to reject the reused assertion until it expires.
+	if claims.ExpiresAt == 0 {
+		return MissingExpirationError
+	}
+	if claims.Id == "" {
+		return MissingJTIError
+	}
+	if claims.ExpiresAt > time.Now().Add(MaxClientAssertionLifetime).Unix() {
+		return ExpirationTooFarError
+	}
+
+	if claims.Issuer != clientID {
+		return UnexpectedIssuerError
+	}
+
+	if claims.Subject != clientID {
+		return UnexpectedClientIDError
+	}
+
+	if !claims.Audience.Includes(audience) {
+		return UnexpectedAudienceError
+	}
+
+	return nil
+}
+
+func (m Manager) ParseClientAssertion(token, clientID, signKey string) (ClientAssertionClaims, error) {
+	if signKey == "" {
+		return ClientAssertionClaims{}, InvalidTokenError
+	}
+
+	var claims ClientAssertionClaims
+	if _, err := m.parse(token, clientID, signKey, &claims); err != nil {
+		return ClientAssertionClaims{}, err
+	}
+	return claims, nil
+}
+
+// ParseClientSecretAssertion parses client_assertion of client_secret_jwt, that is signed by HS256 with the shared secret.
+func (m Manager) ParseClientSecretAssertion(token, secret string) (ClientAssertionClaims, error) {
+	if secret == "" {
+		return ClientAssertionClaims{}, InvalidTokenError
+	}
+
+	var claims ClientAssertionClaims
+	_, err := parseWithKey(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		if err := verifyAlgorithm(t, jwt.SigningMethodHS256); err != nil {
+			return nil, err
+		}
+		return []byte(secret), nil
+	})
+	if err != nil {
+		return ClientAssertionClaims{}, err
+	}
+	return claims, nil
+}
+
+// ParseClientAssertionWithJWKS parses client_assertion of private_key_jwt by the JWK Set of the client.
+// The JWK Set is jwks itself, or fetched from jwksURI if jwks is empty.
+func (m Manager) ParseClientAssertionWithJWKS(token, jwks, jwksURI string) (ClientAssertionClaims, error) {
+	if jwks == "" && jwksURI == "" {
+		return ClientAssertionClaims{}, InvalidTokenError
+	}
+
+	if jwks != "" {
+		set, err := ParseJWKSet([]byte(jwks))
+		if err != nil {
+			return ClientAssertionClaims{}, err
+		}
+		return parseClientAssertionWithJWKSet(token, set)
+	}
+
+	set, err := m.clientJWKS.Get(jwksURI, false)
+	if err != nil {
+		return ClientAssertionClaims{}, err
+	}
+	claims, err := parseClientAssertionWithJWKSet(token, set)
+	if err == KeyNotFoundError {
+		// The client may have rotated its keys after cached.
+		if set, err = m.clientJWKS.Get(jwksURI, true); err != nil {
+			return ClientAssertionClaims{}, err
+		}
+		claims, err = parseClientAssertionWithJWKSet(token, set)
+	}
+	return claims, err
+}
+
+// ClientAssertionAlgorithm returns the alg header of client_assertion without verification.
+// It is only for telling client_secret_jwt from private_key_jwt; please verify it by the parser for the method.
+func ClientAssertionAlgorithm(token string) string {
+	parsed, _, err := new(jwt.Parser).ParseUnverified(token, &ClientAssertionClaims{})
+	if err != nil {
+		return ""
+	}
+	alg, _ := parsed.Header["alg"].(string)
+	return alg
+}
+
+// ClientAssertionSubject returns the sub claim of client_assertion without verification.
+// It is only for looking up the client; please verify it by ParseClientAssertion.
+func ClientAssertionSubject(token string) string {
+	var claims ClientAssertionClaims
+	if _, _, err := new(jwt.Parser).ParseUnverified(token, &claims); err != nil {
+		return ""
+	}
+	return claims.Subject
+}
@@ -0,0 +1,260 @@
+package token_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/testutil"
+	"github.com/macrat/lauth/token"
+	"gopkg.in/dgrijalva/jwt-go.v3"
+)
+
+func TestClientAssertion(t *testing.T) {
+	tokenManager, err := testutil.MakeTokenManager()
+	if err != nil {
+		t.Fatalf("failed to generate TokenManager: %s", err)
+	}
+
+	assertion := testutil.SomeClientRequestObject(t, map[string]interface{}{
+		"iss": "some_client_id",
+		"sub": "some_client_id",
+		"aud": "http://localhost:8000/token",
+		"exp": time.Now().Add(10 * time.Minute).Unix(),
+		"jti": "some-assertion-id",
+	})
+
+	if sub := token.ClientAssertionSubject(assertion); sub != "some_client_id" {
+		t.Errorf("unexpected subject: %#v", sub)
+	}
+
+	if _, err := tokenManager.ParseClientAssertion(assertion, "", ""); err == nil {
+		t.Errorf("expected failure if parse without client key but success")
+	}
+
+	if _, err := tokenManager.ParseClientAssertion(assertion, "some_client_id", testutil.ImplicitClientPublicKey); err == nil {
+		t.Errorf("expected failure if parse with another client key but success")
+	}
+
+	claims, err := tokenManager.ParseClientAssertion(assertion, "some_client_id", testutil.SomeClientPublicKey)
+	if err != nil {
+		t.Fatalf("failed to parse client assertion: %s", err)
+	}
+
+	if err = claims.Validate("some_client_id", "http://localhost:8000/token"); err != nil {
+		t.Errorf("failed to validate client assertion: %s", err)
+	}
+
+	if err = claims.Validate("another_client_id", "http://localhost:8000/token"); err != token.UnexpectedIssuerError {
+		t.Errorf("unexpected error for incorrect client: %v", err)
+	}
+
+	if err = claims.Validate("some_client_id", "http://another.example.com/token"); err != token.UnexpectedAudienceError {
+		t.Errorf("unexpected error for incorrect audience: %v", err)
+	}
+}
+
+func TestClientAssertionClaims_Validate(t *testing.T) {
+	valid := token.ClientAssertionClaims{
+		StandardClaims: jwt.StandardClaims{
+			Issuer:    "some_client_id",
+			Subject:   "some_client_id",
+			ExpiresAt: time.Now().Add(10 * time.Minute).Unix(),
+			Id:        "some-assertion-id",
+		},
+		Audience: token.Audience{"http://localhost:8000/token"},
+	}
+
+	noExp := valid
+	noExp.ExpiresAt = 0
+
+	noJTI := valid
+	noJTI.Id = ""
+
+	farExp := valid
+	farExp.ExpiresAt = time.Now().Add(token.MaxClientAssertionLifetime + time.Minute).Unix()
+
+	tests := []struct {
+		Name   string
+		Claims token.ClientAssertionClaims
+		Err    error
+	}{
+		{"valid", valid, nil},
+		{"without exp", noExp, token.MissingExpirationError},
+		{"without jti", noJTI, token.MissingJTIError},
+		{"too far exp", farExp, token.ExpirationTooFarError},
+	}
+
+	for _, tt := range tests {
+		if err := tt.Claims.Validate("some_client_id", "http://localhost:8000/token"); err != tt.Err {
+			t.Errorf("%s: expected error %v but got %v", tt.Name, tt.Err, err)
+		}
+	}
+}
+
+func TestClientSecretAssertion(t *testing.T) {
+	tokenManager, err := testutil.MakeTokenManager()
+	if err != nil {
+		t.Fatalf("failed to generate TokenManager: %s", err)
+	}
+
+	const secret = "this is a shared secret for client_secret_jwt"
+
+	sign := func(method jwt.SigningMethod, key interface{}) string {
+		assertion, err := jwt.NewWithClaims(method, jwt.MapClaims{
+			"iss": "some_client_id",
+			"sub": "some_client_id",
+			"aud": "http://localhost:8000/token",
+			"exp": time.Now().Add(10 * time.Minute).Unix(),
+			"jti": "some-assertion-id",
+		}).SignedString(key)
+		if err != nil {
+			t.Fatalf("failed to sign assertion: %s", err)
+		}
+		return assertion
+	}
+
+	assertion := sign(jwt.SigningMethodHS256, []byte(secret))
+
+	if alg := token.ClientAssertionAlgorithm(assertion); alg != "HS256" {
+		t.Errorf("unexpected algorithm: %#v", alg)
+	}
+
+	claims, err := tokenManager.ParseClientSecretAssertion(assertion, secret)
+	if err != nil {
+		t.Fatalf("failed to parse client assertion: %s", err)
+	}
+	if err = claims.Validate("some_client_id", "http://localhost:8000/token"); err != nil {
+		t.Errorf("failed to validate client assertion: %s", err)
+	}
+
+	if _, err := tokenManager.ParseClientSecretAssertion(assertion, "another secret for client_secret_jwt"); err == nil {
+		t.Errorf("expected failure if parse with another secret but success")
+	}
+
+	if _, err := tokenManager.ParseClientSecretAssertion(assertion, ""); err == nil {
+		t.Errorf("expected failure if parse without secret but success")
+	}
+
+	if _, err := tokenManager.ParseClientSecretAssertion(sign(jwt.SigningMethodHS512, []byte(secret)), secret); err != token.UnexpectedAlgorithmError {
+		t.Errorf("expected unexpected algorithm error for HS512 but got %v", err)
+	}
+
+	rsaAssertion := testutil.SomeClientRequestObject(t, map[string]interface{}{
+		"iss": "some_client_id",
+		"sub": "some_client_id",
+		"aud": "http://localhost:8000/token",
+		"exp": time.Now().Add(10 * time.Minute).Unix(),
+		"jti": "some-assertion-id",
+	})
+	if _, err := tokenManager.ParseClientSecretAssertion(rsaAssertion, testutil.SomeClientPublicKey); err != token.UnexpectedAlgorithmError {
+		t.Errorf("expected unexpected algorithm error for RS256 but got %v", err)
+	}
+}
+
+func TestClientAssertionWithJWKS(t *testing.T) {
+	tokenManager, err := testutil.MakeTokenManager()
+	if err != nil {
+		t.Fatalf("failed to generate TokenManager: %s", err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate EC key: %s", err)
+	}
+
+	claims := jwt.MapClaims{
+		"iss": "some_client_id",
+		"sub": "some_client_id",
+		"aud": "http://localhost:8000/token",
+		"exp": time.Now().Add(10 * time.Minute).Unix(),
+		"jti": "some-assertion-id",
+	}
+
+	rsaAssertion := testutil.SomeClientRequestObject(t, claims)
+	ecAssertion, err := jwt.NewWithClaims(jwt.SigningMethodES256, claims).SignedString(ecKey)
+	if err != nil {
+		t.Fatalf("failed to sign assertion: %s", err)
+	}
+
+	tests := []struct {
+		Name      string
+		Assertion string
+		JWKS      string
+		OK        bool
+	}{
+		{"RSA", rsaAssertion, testutil.MakeJWKSet(t, testutil.SomeClientPublicKey), true},
+		{"EC", ecAssertion, testutil.MakeJWKSet(t, testutil.ImplicitClientPublicKey, &ecKey.PublicKey), true},
+		{"another RSA key", rsaAssertion, testutil.MakeJWKSet(t, testutil.ImplicitClientPublicKey), false},
+		{"no EC key", ecAssertion, testutil.MakeJWKSet(t, testutil.SomeClientPublicKey), false},
+		{"empty", rsaAssertion, `{"keys": []}`, false},
+	}
+
+	for _, tt := range tests {
+		_, err := tokenManager.ParseClientAssertionWithJWKS(tt.Assertion, tt.JWKS, "")
+		if tt.OK && err != nil {
+			t.Errorf("%s: failed to parse client assertion: %s", tt.Name, err)
+		}
+		if !tt.OK && err == nil {
+			t.Errorf("%s: expected failure but success", tt.Name)
+		}
+	}
+}
+
+func TestClientAssertionWithJWKS_URI(t *testing.T) {
+	tokenManager, err := testutil.MakeTokenManager()
+	if err != nil {
+		t.Fatalf("failed to generate TokenManager: %s", err)
+	}
+
+	var jwks atomic.Value
+	jwks.Store(testutil.MakeJWKSet(t, testutil.SomeClientPublicKey))
+	var fetched int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetched, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(jwks.Load().(string)))
+	}))
+	defer server.Close()
+
+	claims := map[string]interface{}{
+		"iss": "some_client_id",
+		"sub": "some_client_id",
+		"aud": "http://localhost:8000/token",
+		"exp": time.Now().Add(10 * time.Minute).Unix(),
+		"jti": "some-assertion-id",
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := tokenManager.ParseClientAssertionWithJWKS(testutil.SomeClientRequestObject(t, claims), "", server.URL); err != nil {
+			t.Fatalf("failed to parse client assertion: %s", err)
+		}
+	}
+	if n := atomic.LoadInt32(&fetched); n != 1 {
+		t.Errorf("expected JWK Set is fetched only once but fetched %d times", n)
+	}
+
+	// Unknown key doesn't make requests to jwks_uri for a while after fetched.
+	jwks.Store(testutil.MakeJWKSet(t, testutil.ImplicitClientPublicKey))
+	if _, err := tokenManager.ParseClientAssertionWithJWKS(testutil.ImplicitClientRequestObject(t, claims), "", server.URL); err != token.KeyNotFoundError {
+		t.Errorf("expected key not found error but got %v", err)
+	}
+	if n := atomic.LoadInt32(&fetched); n != 1 {
+		t.Errorf("expected JWK Set is not fetched again soon but fetched %d times", n)
+	}
+
+	// The rotated key can be used after the cache dropped.
+	tokenManager.InvalidateClientKeys()
+	if _, err := tokenManager.ParseClientAssertionWithJWKS(testutil.ImplicitClientRequestObject(t, claims), "", server.URL); err != nil {
+		t.Errorf("failed to parse client assertion after key rotation: %s", err)
+	}
+	if _, err := tokenManager.ParseClientAssertionWithJWKS(testutil.SomeClientRequestObject(t, claims), "", server.URL); err != token.KeyNotFoundError {
+		t.Errorf("expected key not found error for the retired key but got %v", err)
+	}
+}
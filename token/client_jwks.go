@@ -0,0 +1,171 @@
+package token
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"gopkg.in/dgrijalva/jwt-go.v3"
+)
+
+const (
+	// ClientJWKSCacheTTL is how long a JWK Set that fetched from jwks_uri is used.
+	ClientJWKSCacheTTL = 10 * time.Minute
+
+	// clientJWKSRefreshInterval limits fetching again for unknown kid, to prevent making requests to jwks_uri for each invalid token.
+	clientJWKSRefreshInterval = 1 * time.Minute
+
+	// maxJWKSSize is the limit of the response size of jwks_uri.
+	maxJWKSSize = 1024 * 1024
+)
+
+// JWKSet is a set of JWK, in the format of jwks_uri.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+func ParseJWKSet(raw []byte) (JWKSet, error) {
+	var set JWKSet
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return JWKSet{}, err
+	}
+	return set, nil
+}
+
+// verifyKey returns the public key if the key can verify the token, by the kid header and the algorithm.
+// Keys for encryption, or that can't be decoded, are never used.
+func (k JWK) verifyKey(t *jwt.Token) (interface{}, error) {
+	if k.Use != "" && k.Use != "sig" {
+		return nil, KeyNotFoundError
+	}
+	if kid, _ := t.Header["kid"].(string); kid != "" && k.KeyID != kid {
+		return nil, KeyNotFoundError
+	}
+	if k.Algorithm != "" && (t.Method == nil || k.Algorithm != t.Method.Alg()) {
+		return nil, KeyNotFoundError
+	}
+
+	public, err := k.PublicKey()
+	if err != nil {
+		return nil, KeyNotFoundError
+	}
+	if err := verifyAlgorithm(t, signingMethod(public)); err != nil {
+		return nil, KeyNotFoundError
+	}
+	return public, nil
+}
+
+// parseClientAssertionWithJWKSet tries the keys in the set that match to the token.
+// It returns KeyNotFoundError if no key can verify the signature, for example if the client rotated its keys.
+func parseClientAssertionWithJWKSet(token string, set JWKSet) (ClientAssertionClaims, error) {
+	for _, k := range set.Keys {
+		var claims ClientAssertionClaims
+		_, err := parseWithKey(token, &claims, k.verifyKey)
+		if err == nil {
+			return claims, nil
+		}
+
+		if e, ok := err.(*jwt.ValidationError); err == KeyNotFoundError || (ok && e.Errors&jwt.ValidationErrorSignatureInvalid != 0) {
+			continue
+		}
+		return ClientAssertionClaims{}, err
+	}
+	return ClientAssertionClaims{}, KeyNotFoundError
+}
+
+// cachedJWKS is a JWK Set of a jwks_uri.
+// It has its own lock, so fetching from a slow jwks_uri doesn't block other clients, and concurrent requests for the same uri fetch only once.
+type cachedJWKS struct {
+	sync.Mutex
+
+	set       JWKSet
+	fetchedAt time.Time
+}
+
+// ClientJWKSCache fetches JWK Sets from jwks_uri of clients and keeps them for ClientJWKSCacheTTL.
+type ClientJWKSCache struct {
+	sync.Mutex
+
+	client  *http.Client
+	entries map[string]*cachedJWKS
+}
+
+func NewClientJWKSCache() *ClientJWKSCache {
+	return &ClientJWKSCache{
+		client:  &http.Client{Timeout: 10 * time.Second},
+		entries: make(map[string]*cachedJWKS),
+	}
+}
+
+// entry returns the cache entry for the uri, creating it if not exists.
+func (c *ClientJWKSCache) entry(uri string) *cachedJWKS {
+	c.Lock()
+	defer c.Unlock()
+
+	e, ok := c.entries[uri]
+	if !ok {
+		e = &cachedJWKS{}
+		c.entries[uri] = e
+	}
+	return e
+}
+
+// Get returns the JWK Set on the uri.
+// If refresh is true, it fetches again unless fetched recently, because the client may have rotated its keys.
+// It fetches each time if the cache is nil.
+func (c *ClientJWKSCache) Get(uri string, refresh bool) (JWKSet, error) {
+	if c == nil {
+		return fetchJWKSet(http.DefaultClient, uri)
+	}
+
+	e := c.entry(uri)
+	e.Lock()
+	defer e.Unlock()
+
+	if !e.fetchedAt.IsZero() {
+		age := time.Since(e.fetchedAt)
+		if age < clientJWKSRefreshInterval || (!refresh && age < ClientJWKSCacheTTL) {
+			return e.set, nil
+		}
+	}
+
+	set, err := fetchJWKSet(c.client, uri)
+	if err != nil {
+		return JWKSet{}, err
+	}
+	e.set = set
+	e.fetchedAt = time.Now()
+	return set, nil
+}
+
+// Invalidate drops all cached JWK Sets.
+func (c *ClientJWKSCache) Invalidate() {
+	if c == nil {
+		return
+	}
+
+	c.Lock()
+	c.entries = make(map[string]*cachedJWKS)
+	c.Unlock()
+}
+
+func fetchJWKSet(client *http.Client, uri string) (JWKSet, error) {
+	resp, err := client.Get(uri)
+	if err != nil {
+		return JWKSet{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return JWKSet{}, fmt.Errorf("failed to fetch JWK Set: %s responded %s", uri, resp.Status)
+	}
+
+	raw, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+	if err != nil {
+		return JWKSet{}, err
+	}
+	return ParseJWKSet(raw)
+}
@@ -0,0 +1,67 @@
+package token_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/testutil"
+	"github.com/macrat/lauth/token"
+)
+
+func TestClientJWKSCache_Concurrent(t *testing.T) {
+	jwks := testutil.MakeJWKSet(t, testutil.SomeClientPublicKey)
+
+	entered := make(chan struct{}, 10)
+	release := make(chan struct{})
+	var slowFetched int32
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&slowFetched, 1)
+		entered <- struct{}{}
+		<-release
+		w.Write([]byte(jwks))
+	}))
+	defer slow.Close()
+
+	fast := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(jwks))
+	}))
+	defer fast.Close()
+
+	cache := token.NewClientJWKSCache()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := cache.Get(slow.URL, false); err != nil {
+				t.Errorf("failed to get JWK Set from slow server: %s", err)
+			}
+		}()
+	}
+	<-entered
+
+	done := make(chan struct{})
+	go func() {
+		if _, err := cache.Get(fast.URL, false); err != nil {
+			t.Errorf("failed to get JWK Set from fast server: %s", err)
+		}
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Errorf("fetching from the slow server blocks another jwks_uri")
+	}
+
+	close(release)
+	wg.Wait()
+
+	if n := atomic.LoadInt32(&slowFetched); n != 1 {
+		t.Errorf("expected concurrent requests fetch JWK Set only once but fetched %d times", n)
+	}
+}
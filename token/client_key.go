@@ -0,0 +1,78 @@
+package token
+
+import (
+	"crypto/rsa"
+	"sync"
+
+	"gopkg.in/dgrijalva/jwt-go.v3"
+)
+
+type cachedClientKey struct {
+	pem string
+	key *rsa.PublicKey
+}
+
+// ClientKeyCache keeps parsed public keys of clients, keyed by client_id.
+//
+// The cached key is used only while the PEM of the client is the same as when cached,
+// so the changed key is never used even before invalidation.
+type ClientKeyCache struct {
+	sync.RWMutex
+
+	keys map[string]cachedClientKey
+}
+
+func NewClientKeyCache() *ClientKeyCache {
+	return &ClientKeyCache{
+		keys: make(map[string]cachedClientKey),
+	}
+}
+
+// Get returns the parsed public key of the client.
+// It parses the PEM each time if the cache is nil.
+func (c *ClientKeyCache) Get(clientID, pem string) (*rsa.PublicKey, error) {
+	if c == nil {
+		return jwt.ParseRSAPublicKeyFromPEM([]byte(pem))
+	}
+
+	c.RLock()
+	cached, ok := c.keys[clientID]
+	c.RUnlock()
+	if ok && cached.pem == pem {
+		return cached.key, nil
+	}
+
+	key, err := jwt.ParseRSAPublicKeyFromPEM([]byte(pem))
+	if err != nil {
+		return nil, err
+	}
+
+	c.Lock()
+	c.keys[clientID] = cachedClientKey{pem: pem, key: key}
+	c.Unlock()
+
+	return key, nil
+}
+
+// Len returns the number of cached keys.
+func (c *ClientKeyCache) Len() int {
+	if c == nil {
+		return 0
+	}
+
+	c.RLock()
+	defer c.RUnlock()
+
+	return len(c.keys)
+}
+
+// Invalidate drops all cached keys.
+func (c *ClientKeyCache) Invalidate() {
+	if c == nil {
+		return
+	}
+
+	c.Lock()
+	c.keys = make(map[string]cachedClientKey)
+	c.Unlock()
+}
@@ -0,0 +1,122 @@
+package token_test
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/testutil"
+	"github.com/macrat/lauth/token"
+)
+
+func TestClientKeyCache(t *testing.T) {
+	cache := token.NewClientKeyCache()
+
+	key, err := cache.Get("some_client_id", testutil.SomeClientPublicKey)
+	if err != nil {
+		t.Fatalf("failed to parse key: %s", err)
+	}
+	if cache.Len() != 1 {
+		t.Errorf("unexpected number of cached keys: %d", cache.Len())
+	}
+
+	if cached, err := cache.Get("some_client_id", testutil.SomeClientPublicKey); err != nil {
+		t.Errorf("failed to get cached key: %s", err)
+	} else if cached != key {
+		t.Errorf("expected cached key but parsed again")
+	}
+
+	if changed, err := cache.Get("some_client_id", testutil.ImplicitClientPublicKey); err != nil {
+		t.Errorf("failed to parse changed key: %s", err)
+	} else if changed.Equal(key) {
+		t.Errorf("expected changed key but got the old key")
+	}
+
+	if _, err := cache.Get("another_client_id", "invalid key"); err == nil {
+		t.Errorf("expected error for invalid key but succeed")
+	}
+	if cache.Len() != 1 {
+		t.Errorf("invalid key should not be cached but cached %d keys", cache.Len())
+	}
+
+	cache.Invalidate()
+	if cache.Len() != 0 {
+		t.Errorf("unexpected number of cached keys after invalidate: %d", cache.Len())
+	}
+
+	var disabled *token.ClientKeyCache
+	if _, err := disabled.Get("some_client_id", testutil.SomeClientPublicKey); err != nil {
+		t.Errorf("failed to parse key without cache: %s", err)
+	}
+}
+
+func TestManager_WithClientKeyCache(t *testing.T) {
+	manager, err := testutil.MakeTokenManager()
+	if err != nil {
+		t.Fatalf("failed to generate TokenManager: %s", err)
+	}
+	cache := token.NewClientKeyCache()
+	manager = manager.WithClientKeyCache(cache)
+
+	assertion := testutil.SomeClientRequestObject(t, map[string]interface{}{
+		"iss": "some_client_id",
+		"sub": "some_client_id",
+		"aud": "http://localhost:8000/token",
+		"exp": time.Now().Add(10 * time.Minute).Unix(),
+	})
+
+	if _, err := manager.ParseClientAssertion(assertion, "some_client_id", testutil.SomeClientPublicKey); err != nil {
+		t.Fatalf("failed to parse client assertion: %s", err)
+	}
+	if cache.Len() != 1 {
+		t.Fatalf("expected the client key is cached but %d keys cached", cache.Len())
+	}
+
+	newKey, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatalf("failed to generate new key: %s", err)
+	}
+	if err := manager.Rotate(newKey, time.Minute); err != nil {
+		t.Fatalf("failed to rotate key: %s", err)
+	}
+	if cache.Len() != 0 {
+		t.Errorf("expected cache is invalidated by reloading but %d keys still cached", cache.Len())
+	}
+
+	if _, err := manager.ParseClientAssertion(assertion, "some_client_id", testutil.SomeClientPublicKey); err != nil {
+		t.Errorf("failed to parse client assertion after reload: %s", err)
+	}
+}
+
+func BenchmarkManager_ParseClientAssertion(b *testing.B) {
+	manager, err := testutil.MakeTokenManager()
+	if err != nil {
+		b.Fatalf("failed to generate TokenManager: %s", err)
+	}
+
+	assertion := testutil.SomeClientRequestObject(b, map[string]interface{}{
+		"iss": "some_client_id",
+		"sub": "some_client_id",
+		"aud": "http://localhost:8000/token",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+
+	tests := []struct {
+		Name    string
+		Manager token.Manager
+	}{
+		{"uncached", manager},
+		{"cached", manager.WithClientKeyCache(token.NewClientKeyCache())},
+	}
+
+	for _, tt := range tests {
+		b.Run(tt.Name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := tt.Manager.ParseClientAssertion(assertion, "some_client_id", testutil.SomeClientPublicKey); err != nil {
+					b.Fatalf("failed to parse client assertion: %s", err)
+				}
+			}
+		})
+	}
+}
@@ -15,6 +15,11 @@ type CodeClaims struct {
 	RedirectURI string `json:"redirect_uri"`
 	Nonce       string `json:"nonce,omitempty"`
 	Scope       string `json:"scope,omitempty"`
+
+	Claims *ClaimsRequest `json:"claims,omitempty"`
+
+	CodeChallenge       string `json:"code_challenge,omitempty"`
+	CodeChallengeMethod string `json:"code_challenge_method,omitempty"`
 }
 
 func (claims CodeClaims) Validate(issuer *config.URL) error {
@@ -33,23 +38,41 @@ func (claims CodeClaims) Validate(issuer *config.URL) error {
 	return nil
 }
 
-func (m Manager) CreateCode(issuer *config.URL, subject, clientID, redirectURI, scope, nonce string, authTime time.Time, expiresIn time.Duration) (string, error) {
+func (m Manager) CreateCode(issuer *config.URL, subject, clientID, redirectURI, scope, nonce string, auth Authentication, expiresIn time.Duration) (string, error) {
+	return m.CreateCodeWithChallenge(issuer, subject, clientID, redirectURI, scope, nonce, "", "", auth, expiresIn)
+}
+
+// CreateCodeWithChallenge creates code that bound to the code_challenge of PKCE (RFC 7636).
+// The code_verifier should be verified by CodeClaims.VerifyCodeVerifier when exchanging the code.
+func (m Manager) CreateCodeWithChallenge(issuer *config.URL, subject, clientID, redirectURI, scope, nonce, challenge, challengeMethod string, auth Authentication, expiresIn time.Duration) (string, error) {
+	return m.CreateCodeWithClaims(issuer, subject, clientID, redirectURI, scope, nonce, challenge, challengeMethod, nil, auth, expiresIn)
+}
+
+// CreateCodeWithClaims creates code that carries the claims parameter as well as the code_challenge.
+func (m Manager) CreateCodeWithClaims(issuer *config.URL, subject, clientID, redirectURI, scope, nonce, challenge, challengeMethod string, claims *ClaimsRequest, auth Authentication, expiresIn time.Duration) (string, error) {
 	plain, err := json.Marshal(CodeClaims{
 		OIDCClaims: OIDCClaims{
 			StandardClaims: jwt.StandardClaims{
 				Issuer:    issuer.String(),
 				Subject:   subject,
-				Audience:  issuer.String(),
 				ExpiresAt: time.Now().Add(expiresIn).Unix(),
 				IssuedAt:  time.Now().Unix(),
 			},
+			Audience: Audience{issuer.String()},
 			Type:     "CODE",
-			AuthTime: authTime.Unix(),
+			AuthTime: auth.Time.Unix(),
+			ACR:      auth.ACR,
+			AMR:      auth.AMR,
 		},
 		ClientID:    clientID,
 		RedirectURI: redirectURI,
 		Scope:       scope,
 		Nonce:       nonce,
+
+		Claims: claims,
+
+		CodeChallenge:       challenge,
+		CodeChallengeMethod: challengeMethod,
 	})
 	if err != nil {
 		return "", err
@@ -1,6 +1,9 @@
 package token
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
 	"errors"
@@ -12,8 +15,15 @@ var (
 	NotJWEError = errors.New("not a valid JWE data")
 )
 
-func (m Manager) encryptionKey() []byte {
-	hash := sha256.Sum256(x509.MarshalPKCS1PrivateKey(m.private))
+func encryptionKey(private crypto.Signer) []byte {
+	var raw []byte
+	switch k := private.(type) {
+	case *rsa.PrivateKey:
+		raw = x509.MarshalPKCS1PrivateKey(k)
+	case *ecdsa.PrivateKey:
+		raw, _ = x509.MarshalECPrivateKey(k)
+	}
+	hash := sha256.Sum256(raw)
 	return hash[:]
 }
 
@@ -22,7 +32,7 @@ func (m Manager) encrypt(plain []byte) (string, error) {
 		jose.A256GCM,
 		jose.Recipient{
 			Algorithm: jose.A256GCMKW,
-			Key:       m.encryptionKey(),
+			Key:       encryptionKey(m.current().private),
 		},
 		&jose.EncrypterOptions{
 			Compression: jose.DEFLATE,
@@ -52,9 +62,10 @@ func (m Manager) decrypt(jwe string) ([]byte, error) {
 		return nil, NotJWEError
 	}
 
-	dec, err := e.Decrypt(m.encryptionKey())
-	if err != nil {
-		return nil, err
+	for _, key := range m.current().verifyKeys() {
+		if dec, err := e.Decrypt(encryptionKey(key)); err == nil {
+			return dec, nil
+		}
 	}
-	return dec, nil
+	return nil, InvalidTokenError
 }
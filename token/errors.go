@@ -11,4 +11,23 @@ var (
 	UnexpectedAudienceError  = errors.New("unexpected audience")
 	UnexpectedTokenTypeError = errors.New("unexpected token type")
 	UnexpectedClientIDError  = errors.New("unexpected client_id")
+	UnexpectedAlgorithmError = errors.New("unexpected signing algorithm")
+	TokenRevokedError        = errors.New("token has already revoked")
+	MissingExpirationError   = errors.New("exp is required")
+	MissingJTIError          = errors.New("jti is required")
+	ExpirationTooFarError    = errors.New("exp is too far in the future")
+	KeyNotFoundError         = errors.New("no key found to verify the token")
+
+	NoKeyError          = errors.New("no private key found")
+	UnsupportedKeyError = errors.New("unsupported private key; only RSA and EC P-256, P-384, or P-521 keys are supported")
+	UnsupportedJWKError = errors.New("unsupported JWK; only RSA and EC P-256, P-384, or P-521 keys are supported")
+
+	CodeVerifierRequiredError   = errors.New("code_verifier is required")
+	UnexpectedCodeVerifierError = errors.New("code_verifier is sent but code_challenge was not")
+	InvalidCodeVerifierError    = errors.New("code_verifier is invalid format")
+	CodeVerifierMismatchError   = errors.New("code_verifier does not match to code_challenge")
+	UnsupportedChallengeError   = errors.New("unsupported code_challenge_method")
+
+	ClaimsRequestTooLargeError  = errors.New("claims is too large")
+	TooManyClaimsRequestedError = errors.New("too many claims are requested")
 )
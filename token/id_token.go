@@ -23,7 +23,12 @@ func (claims IDTokenClaims) MarshalJSON() ([]byte, error) {
 	c := make(jwt.MapClaims)
 
 	for k, v := range claims.ExtraClaims {
-		c[k] = v
+		switch k {
+		case "nonce", "c_hash", "at_hash", "acr", "amr":
+			// These claims must be set only by the fields, never by the extra claims.
+		default:
+			c[k] = v
+		}
 	}
 
 	c["exp"] = claims.ExpiresAt
@@ -34,7 +39,19 @@ func (claims IDTokenClaims) MarshalJSON() ([]byte, error) {
 	c["aud"] = claims.Audience
 
 	c["typ"] = claims.Type
-	c["auth_time"] = claims.AuthTime
+
+	// The id_token for the client itself has no authentication of user, so it has no auth_time.
+	if claims.AuthTime != 0 {
+		c["auth_time"] = claims.AuthTime
+	}
+
+	if claims.ACR != "" {
+		c["acr"] = claims.ACR
+	}
+
+	if len(claims.AMR) > 0 {
+		c["amr"] = claims.AMR
+	}
 
 	if claims.Nonce != "" {
 		c["nonce"] = claims.Nonce
@@ -67,7 +84,7 @@ func (claims *IDTokenClaims) UnmarshalJSON(data []byte) error {
 
 	for k := range c {
 		switch k {
-		case "exp", "iat", "iss", "sub", "aud", "typ", "auth_time", "nbt", "jti", "nonce", "c_hash", "at_hash":
+		case "exp", "iat", "iss", "sub", "aud", "typ", "auth_time", "acr", "amr", "nbt", "jti", "nonce", "c_hash", "at_hash":
 			delete(c, k)
 		}
 	}
@@ -88,28 +105,40 @@ func (claims IDTokenClaims) Validate(issuer *config.URL, audience string) error
 	return nil
 }
 
-func (m Manager) CreateIDToken(issuer *config.URL, subject, audience, nonce, code, accessToken string, extraClaims ExtraClaims, authTime time.Time, expiresIn time.Duration) (string, error) {
+func (m Manager) CreateIDToken(issuer *config.URL, subject, audience, nonce, code, accessToken string, extraClaims ExtraClaims, auth Authentication, expiresIn time.Duration) (string, error) {
+	// The hash algorithm of c_hash and at_hash depends on the signing algorithm, so decide the key first.
+	ks := m.current()
+	alg := signingMethod(ks.public).Alg()
+
 	codeHash := ""
 	if code != "" {
-		codeHash = TokenHash(code)
+		codeHash = TokenHashFor(alg, code)
 	}
 
 	accessTokenHash := ""
 	if accessToken != "" {
-		accessTokenHash = TokenHash(accessToken)
+		accessTokenHash = TokenHashFor(alg, accessToken)
+	}
+
+	// ID token for the client itself has no authentication of any user.
+	authTime := int64(0)
+	if !auth.Time.IsZero() {
+		authTime = auth.Time.Unix()
 	}
 
-	return m.create(IDTokenClaims{
+	return m.createWith(ks, IDTokenClaims{
 		OIDCClaims: OIDCClaims{
 			StandardClaims: jwt.StandardClaims{
 				Issuer:    issuer.String(),
 				Subject:   subject,
-				Audience:  audience,
 				ExpiresAt: time.Now().Add(expiresIn).Unix(),
 				IssuedAt:  time.Now().Unix(),
 			},
+			Audience: Audience{audience},
 			Type:     "ID_TOKEN",
-			AuthTime: authTime.Unix(),
+			AuthTime: authTime,
+			ACR:      auth.ACR,
+			AMR:      auth.AMR,
 		},
 		Nonce:           nonce,
 		CodeHash:        codeHash,
@@ -120,7 +149,7 @@ func (m Manager) CreateIDToken(issuer *config.URL, subject, audience, nonce, cod
 
 func (m Manager) ParseIDToken(token string) (IDTokenClaims, error) {
 	var claims IDTokenClaims
-	if _, err := m.parse(token, "", &claims); err != nil {
+	if _, err := m.parse(token, "", "", &claims); err != nil {
 		return IDTokenClaims{}, err
 	}
 	return claims, nil
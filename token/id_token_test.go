@@ -1,6 +1,12 @@
 package token_test
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
 	"testing"
 	"time"
 
@@ -17,8 +23,9 @@ func TestIDToken(t *testing.T) {
 
 	issuer := &config.URL{Scheme: "http", Host: "localhost:8000"}
 	audience := "something"
+	authTime := time.Now().Add(-time.Hour)
 
-	idToken, err := tokenManager.CreateIDToken(issuer, "someone", audience, "", "code", "token", nil, time.Now(), 10*time.Minute)
+	idToken, err := tokenManager.CreateIDToken(issuer, "someone", audience, "", "code", "token", nil, token.Authentication{Time: authTime}, 10*time.Minute)
 	if err != nil {
 		t.Fatalf("failed to generate token: %s", err)
 	}
@@ -44,6 +51,10 @@ func TestIDToken(t *testing.T) {
 		t.Errorf("unexpected error: %s", err)
 	}
 
+	if claims.AuthTime != authTime.Unix() {
+		t.Errorf("unexpected auth_time: expected %d but got %d", authTime.Unix(), claims.AuthTime)
+	}
+
 	if claims.CodeHash != token.TokenHash("code") {
 		t.Errorf("unexpected c_hash: %s", claims.CodeHash)
 	}
@@ -52,7 +63,7 @@ func TestIDToken(t *testing.T) {
 		t.Errorf("unexpected at_hash: %s", claims.AccessTokenHash)
 	}
 
-	idToken2, err := tokenManager.CreateIDToken(issuer, "someone", issuer.String(), "", "", "", nil, time.Now(), 10*time.Minute)
+	idToken2, err := tokenManager.CreateIDToken(issuer, "someone", issuer.String(), "", "", "", nil, token.Authentication{Time: time.Now()}, 10*time.Minute)
 	if err != nil {
 		t.Fatalf("failed to generate token: %s", err)
 	}
@@ -89,7 +100,7 @@ func TestIDToken_InvalidSign(t *testing.T) {
 
 	issuer := &config.URL{Scheme: "http", Host: "localhost:8000"}
 
-	token, err := tokenManager1.CreateIDToken(issuer, "someone", "something", "", "code", "token", nil, time.Now(), 10*time.Minute)
+	token, err := tokenManager1.CreateIDToken(issuer, "someone", "something", "", "code", "token", nil, token.Authentication{Time: time.Now()}, 10*time.Minute)
 	if err != nil {
 		t.Fatalf("failed to generate token: %s", err)
 	}
@@ -106,3 +117,91 @@ func TestIDToken_InvalidSign(t *testing.T) {
 		t.Fatalf("unexpected error: %s", err)
 	}
 }
+
+func TestIDToken_Nonce(t *testing.T) {
+	tests := []struct {
+		Name   string
+		Nonce  string
+		Extra  token.ExtraClaims
+		Expect interface{}
+	}{
+		{"without nonce", "", nil, nil},
+		{"with nonce", "this-is-nonce", nil, "this-is-nonce"},
+		{"extra claim can't fabricate", "", token.ExtraClaims{"nonce": "fake"}, nil},
+		{"extra claim can't overwrite", "this-is-nonce", token.ExtraClaims{"nonce": "fake"}, "this-is-nonce"},
+	}
+
+	for _, tt := range tests {
+		raw, err := json.Marshal(token.IDTokenClaims{
+			Nonce:       tt.Nonce,
+			ExtraClaims: tt.Extra,
+		})
+		if err != nil {
+			t.Fatalf("%s: failed to marshal claims: %s", tt.Name, err)
+		}
+
+		var claims map[string]interface{}
+		if err := json.Unmarshal(raw, &claims); err != nil {
+			t.Fatalf("%s: failed to unmarshal claims: %s", tt.Name, err)
+		}
+
+		if nonce, ok := claims["nonce"]; tt.Expect == nil && ok {
+			t.Errorf("%s: nonce should be absent but got %#v", tt.Name, nonce)
+		} else if nonce != tt.Expect {
+			t.Errorf("%s: unexpected nonce: %#v", tt.Name, nonce)
+		}
+	}
+}
+
+func TestIDToken_HashAlgorithm(t *testing.T) {
+	issuer := &config.URL{Scheme: "http", Host: "localhost:8000"}
+
+	tests := []struct {
+		Curve  elliptic.Curve
+		Alg    string
+		Length int
+	}{
+		{elliptic.P256(), "ES256", 22},
+		{elliptic.P384(), "ES384", 32},
+		{elliptic.P521(), "ES512", 43},
+	}
+
+	for _, tt := range tests {
+		key, err := ecdsa.GenerateKey(tt.Curve, rand.Reader)
+		if err != nil {
+			t.Fatalf("%s: failed to generate key: %s", tt.Alg, err)
+		}
+		manager, err := token.NewManager(key)
+		if err != nil {
+			t.Fatalf("%s: failed to create manager: %s", tt.Alg, err)
+		}
+
+		idToken, err := manager.CreateIDToken(issuer, "someone", "something", "", "code", "token", nil, token.Authentication{Time: time.Now()}, 10*time.Minute)
+		if err != nil {
+			t.Fatalf("%s: failed to generate token: %s", tt.Alg, err)
+		}
+
+		var header struct {
+			Alg string `json:"alg"`
+		}
+		rawHeader, _ := base64.RawURLEncoding.DecodeString(strings.Split(idToken, ".")[0])
+		if err := json.Unmarshal(rawHeader, &header); err != nil {
+			t.Fatalf("%s: failed to parse header: %s", tt.Alg, err)
+		}
+		if header.Alg != tt.Alg {
+			t.Errorf("%s: unexpected alg: %s", tt.Alg, header.Alg)
+		}
+
+		claims, err := manager.ParseIDToken(idToken)
+		if err != nil {
+			t.Fatalf("%s: failed to parse id_token: %s", tt.Alg, err)
+		}
+
+		if claims.CodeHash != token.TokenHashFor(tt.Alg, "code") || len(claims.CodeHash) != tt.Length {
+			t.Errorf("%s: unexpected c_hash: %s", tt.Alg, claims.CodeHash)
+		}
+		if claims.AccessTokenHash != token.TokenHashFor(tt.Alg, "token") || len(claims.AccessTokenHash) != tt.Length {
+			t.Errorf("%s: unexpected at_hash: %s", tt.Alg, claims.AccessTokenHash)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package token
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+
+	"github.com/google/uuid"
+	"github.com/macrat/lauth/config"
+)
+
+// WithJTIFormat returns a copy of the Manager that issues jti claim in the format.
+// The length is the number of characters of config.JTI_FORMAT_RANDOM, and it is raised to config.MinJTILength if shorter.
+// Unknown format is treated as config.JTI_FORMAT_UUID.
+func (m Manager) WithJTIFormat(format string, length int) Manager {
+	m.jtiFormat = format
+	m.jtiLength = length
+	return m
+}
+
+// newJTI generates an ID for jti claim.
+func (m Manager) newJTI() string {
+	if m.jtiFormat != config.JTI_FORMAT_RANDOM {
+		return uuid.New().String()
+	}
+
+	length := m.jtiLength
+	if length < config.MinJTILength {
+		length = config.MinJTILength
+	}
+
+	buf := make([]byte, (length*6+7)/8)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(buf)[:length]
+}
+
+// NewGrantID generates an ID to bind a refresh token and access tokens issued by the same grant.
+// It has the same format as jti, and shares the revocation list with it.
+func (m Manager) NewGrantID() string {
+	return m.newJTI()
+}
@@ -0,0 +1,67 @@
+package token_test
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/testutil"
+	"github.com/macrat/lauth/token"
+)
+
+func TestManager_WithJTIFormat(t *testing.T) {
+	base, err := testutil.MakeTokenManager()
+	if err != nil {
+		t.Fatalf("failed to generate TokenManager: %s", err)
+	}
+
+	issuer := &config.URL{Scheme: "http", Host: "localhost:8000"}
+
+	tests := []struct {
+		Format  string
+		Length  int
+		Pattern *regexp.Regexp
+	}{
+		{"", 0, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)},
+		{config.JTI_FORMAT_UUID, 0, regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)},
+		{config.JTI_FORMAT_RANDOM, 22, regexp.MustCompile(`^[A-Za-z0-9_-]{22}$`)},
+		{config.JTI_FORMAT_RANDOM, 43, regexp.MustCompile(`^[A-Za-z0-9_-]{43}$`)},
+		{config.JTI_FORMAT_RANDOM, 8, regexp.MustCompile(`^[A-Za-z0-9_-]{22}$`)},
+	}
+
+	for _, tt := range tests {
+		m := base.WithJTIFormat(tt.Format, tt.Length)
+		seen := make(map[string]bool)
+
+		for i := 0; i < 100; i++ {
+			accessToken, err := m.CreateAccessToken(issuer, "someone", "something", "openid", "", token.Authentication{Time: time.Now()}, 10*time.Minute)
+			if err != nil {
+				t.Fatalf("%s/%d: failed to generate access token: %s", tt.Format, tt.Length, err)
+			}
+			refreshToken, err := m.CreateRefreshToken(issuer, "someone", "something", "openid", "", token.Authentication{Time: time.Now()}, 10*time.Minute)
+			if err != nil {
+				t.Fatalf("%s/%d: failed to generate refresh token: %s", tt.Format, tt.Length, err)
+			}
+
+			access, err := m.ParseAccessToken(accessToken)
+			if err != nil {
+				t.Fatalf("%s/%d: failed to parse access token: %s", tt.Format, tt.Length, err)
+			}
+			refresh, err := m.ParseRefreshToken(refreshToken)
+			if err != nil {
+				t.Fatalf("%s/%d: failed to parse refresh token: %s", tt.Format, tt.Length, err)
+			}
+
+			for _, id := range []string{access.Id, refresh.Id} {
+				if !tt.Pattern.MatchString(id) {
+					t.Fatalf("%s/%d: unexpected format of jti: %s", tt.Format, tt.Length, id)
+				}
+				if seen[id] {
+					t.Fatalf("%s/%d: jti is duplicated: %s", tt.Format, tt.Length, id)
+				}
+				seen[id] = true
+			}
+		}
+	}
+}
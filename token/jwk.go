@@ -1,6 +1,9 @@
 package token
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -16,11 +19,66 @@ type JWK struct {
 	Use       string   `json:"use"`
 	Algorithm string   `json:"alg"`
 	KeyType   string   `json:"kty"`
-	E         string   `json:"e"`
-	N         string   `json:"n"`
+	Curve     string   `json:"crv,omitempty"`
+	E         string   `json:"e,omitempty"`
+	N         string   `json:"n,omitempty"`
+	X         string   `json:"x,omitempty"`
+	Y         string   `json:"y,omitempty"`
 	X509      []string `json:"x5c"`
 }
 
+// PublicKey decodes the public key of RSA or EC JWK.
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.KeyType {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if len(n) == 0 || len(e) == 0 || len(e) > 4 {
+			return nil, UnsupportedJWKError
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Curve {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, UnsupportedJWKError
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		pub := &ecdsa.PublicKey{
+			Curve: curve,
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !curve.IsOnCurve(pub.X, pub.Y) {
+			return nil, UnsupportedJWKError
+		}
+		return pub, nil
+	}
+	return nil, UnsupportedJWKError
+}
+
 func int2bytes(i int) []byte {
 	bs := make([]byte, 8)
 	binary.BigEndian.PutUint64(bs, uint64(i))
@@ -31,7 +89,7 @@ func int2bytes(i int) []byte {
 	return bs[skip:]
 }
 
-func makeCert(hostname string, public *rsa.PublicKey, private *rsa.PrivateKey) ([]byte, error) {
+func makeCert(hostname string, public crypto.PublicKey, private crypto.Signer) ([]byte, error) {
 	template := &x509.Certificate{
 		Issuer:       pkix.Name{CommonName: hostname},
 		Subject:      pkix.Name{CommonName: hostname},
@@ -49,22 +107,40 @@ func makeCert(hostname string, public *rsa.PublicKey, private *rsa.PrivateKey) (
 }
 
 func (m Manager) JWKs(hostname string) ([]JWK, error) {
-	cert, err := makeCert(hostname, m.public, m.private)
-	if err != nil {
-		return nil, err
-	}
+	var keys []JWK
 
-	return []JWK{
-		{
-			KeyID:     m.KeyID().String(),
+	for _, private := range m.current().verifyKeys() {
+		public := private.Public()
+
+		cert, err := makeCert(hostname, public, private)
+		if err != nil {
+			return nil, err
+		}
+
+		key := JWK{
+			KeyID:     keyID(public),
 			Use:       "sig",
-			Algorithm: "RS256",
-			KeyType:   "RSA",
-			E:         base64.RawURLEncoding.EncodeToString(int2bytes(m.public.E)),
-			N:         base64.RawURLEncoding.EncodeToString(m.public.N.Bytes()),
+			Algorithm: signingMethod(public).Alg(),
 			X509: []string{
 				base64.StdEncoding.EncodeToString(cert),
 			},
-		},
-	}, nil
+		}
+
+		switch pub := public.(type) {
+		case *rsa.PublicKey:
+			key.KeyType = "RSA"
+			key.E = base64.RawURLEncoding.EncodeToString(int2bytes(pub.E))
+			key.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+		case *ecdsa.PublicKey:
+			size := (pub.Curve.Params().BitSize + 7) / 8
+			key.KeyType = "EC"
+			key.Curve = pub.Curve.Params().Name
+			key.X = base64.RawURLEncoding.EncodeToString(pub.X.FillBytes(make([]byte, size)))
+			key.Y = base64.RawURLEncoding.EncodeToString(pub.Y.FillBytes(make([]byte, size)))
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
 }
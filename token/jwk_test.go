@@ -1,6 +1,9 @@
 package token_test
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
 	"encoding/base64"
@@ -62,7 +65,7 @@ func TestTokenManager_JWKs(t *testing.T) {
 		t.Errorf("public key that got by certificate is not equals original key\noriginal key: %#v\ncert key: %#v", manager.PublicKey(), cert.PublicKey)
 	}
 
-	idToken, err := manager.CreateIDToken(&config.URL{Scheme: "https", Host: "localhost"}, "someone", "something", "", "code", "token", nil, time.Now(), 10*time.Minute)
+	idToken, err := manager.CreateIDToken(&config.URL{Scheme: "https", Host: "localhost"}, "someone", "something", "", "code", "token", nil, token.Authentication{Time: time.Now()}, 10*time.Minute)
 	if err != nil {
 		t.Fatalf("failed to generate id_token: %s", err)
 	}
@@ -81,3 +84,64 @@ func TestTokenManager_JWKs(t *testing.T) {
 		return pri, nil
 	})
 }
+
+func TestTokenManager_JWKs_EC(t *testing.T) {
+	pri, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate EC private key: %s", err)
+	}
+
+	manager, err := token.NewManager(pri)
+	if err != nil {
+		t.Fatalf("failed to load test key: %s", err)
+	}
+
+	jwks, err := manager.JWKs("lauth.example.com")
+	if err != nil {
+		t.Fatalf("failed to generate JWKs: %s", err)
+	}
+	if len(jwks) != 1 {
+		t.Fatalf("unexpected number of keys: %d", len(jwks))
+	}
+	if jwks[0].KeyType != "EC" || jwks[0].Curve != "P-256" || jwks[0].Algorithm != "ES256" {
+		t.Errorf("unexpected key: %#v", jwks[0])
+	}
+	if jwks[0].E != "" || jwks[0].N != "" {
+		t.Errorf("EC key should not have RSA parameters: %#v", jwks[0])
+	}
+
+	if encJwks, err := json.Marshal(jwks[0]); err != nil {
+		t.Errorf("failed to marshal JWKs: %s", err)
+	} else {
+		decJwks := new(jose.JSONWebKey)
+		if err := decJwks.UnmarshalJSON(encJwks); err != nil {
+			t.Errorf("failed to unmarshal JWKs: %s", err)
+		} else if !decJwks.Valid() {
+			t.Errorf("unmarshalled JWKs is not valid")
+		} else if !decJwks.Key.(*ecdsa.PublicKey).Equal(manager.PublicKey()) {
+			t.Errorf("unmarshalled public key is not equals original key")
+		}
+	}
+
+	idToken, err := manager.CreateIDToken(&config.URL{Scheme: "https", Host: "localhost"}, "someone", "something", "", "code", "token", nil, token.Authentication{Time: time.Now()}, 10*time.Minute)
+	if err != nil {
+		t.Fatalf("failed to generate id_token: %s", err)
+	}
+
+	parsed, err := jwt.Parse(idToken, func(tok *jwt.Token) (interface{}, error) {
+		return &pri.PublicKey, nil
+	})
+	if err != nil {
+		t.Fatalf("failed to verify id_token by the public key: %s", err)
+	}
+	if parsed.Method.Alg() != "ES256" {
+		t.Errorf("unexpected algorithm: %s", parsed.Method.Alg())
+	}
+	if kid, _ := parsed.Header["kid"].(string); kid != jwks[0].KeyID {
+		t.Errorf("unexpected kid: %#v", parsed.Header["kid"])
+	}
+
+	if _, err := manager.ParseIDToken(idToken); err != nil {
+		t.Errorf("failed to parse id_token: %s", err)
+	}
+}
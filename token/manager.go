@@ -1,25 +1,155 @@
 package token
 
 import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"encoding/pem"
 	"io"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
 	"gopkg.in/dgrijalva/jwt-go.v3"
 )
 
+type retiredKey struct {
+	private   crypto.Signer
+	expiresAt time.Time
+}
+
+type keySet struct {
+	private   crypto.Signer
+	public    crypto.PublicKey
+	published []crypto.Signer
+	retired   []retiredKey
+	loadedAt  time.Time
+}
+
+// keyBytes returns the DER of the public key to derive the key ID.
+// RSA keys use PKCS #1, to keep the same key IDs as older versions.
+func keyBytes(public crypto.PublicKey) []byte {
+	if pub, ok := public.(*rsa.PublicKey); ok {
+		return x509.MarshalPKCS1PublicKey(pub)
+	}
+	b, _ := x509.MarshalPKIXPublicKey(public)
+	return b
+}
+
+func keyID(public crypto.PublicKey) string {
+	return uuid.NewSHA1(uuid.NameSpaceX500, keyBytes(public)).String()
+}
+
+// signingMethod returns the signing algorithm for the key; ES256, ES384, or ES512 by the curve of EC keys, otherwise RS256.
+func signingMethod(public crypto.PublicKey) jwt.SigningMethod {
+	if k, ok := public.(*ecdsa.PublicKey); ok {
+		switch k.Curve {
+		case elliptic.P384():
+			return jwt.SigningMethodES384
+		case elliptic.P521():
+			return jwt.SigningMethodES512
+		default:
+			return jwt.SigningMethodES256
+		}
+	}
+	return jwt.SigningMethodRS256
+}
+
+// validateKey checks if the key is usable for signing.
+// It accepts RSA keys and EC keys on P-256, P-384, or P-521, that are the curves of ES256, ES384, and ES512.
+func validateKey(private crypto.Signer) error {
+	switch k := private.(type) {
+	case *rsa.PrivateKey:
+		return k.Validate()
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() && k.Curve != elliptic.P384() && k.Curve != elliptic.P521() {
+			return UnsupportedKeyError
+		}
+		return nil
+	default:
+		return UnsupportedKeyError
+	}
+}
+
+// verifyKeys returns private keys that still usable for verification, in order of current key first.
+func (ks *keySet) verifyKeys() []crypto.Signer {
+	keys := append([]crypto.Signer{ks.private}, ks.published...)
+	now := time.Now()
+	for _, k := range ks.retired {
+		if now.Before(k.expiresAt) {
+			keys = append(keys, k.private)
+		}
+	}
+	return keys
+}
+
+func (ks *keySet) findPublicKey(kid string) (crypto.PublicKey, bool) {
+	for _, k := range ks.verifyKeys() {
+		pub := k.Public()
+		if keyID(pub) == kid {
+			return pub, true
+		}
+	}
+	return nil, false
+}
+
 type Manager struct {
-	private *rsa.PrivateKey
-	public  *rsa.PublicKey
+	keys          *atomic.Value
+	clientKeys    *ClientKeyCache
+	clientJWKS    *ClientJWKSCache
+	revoked       *RevocationList
+	audienceArray bool
+	jtiFormat     string
+	jtiLength     int
 }
 
-func NewManager(private *rsa.PrivateKey) (Manager, error) {
-	return Manager{
-		private: private,
-		public:  private.Public().(*rsa.PublicKey),
-	}, nil
+// NewManager makes Manager that signs tokens by the first key.
+// The rest keys are published in JWKs and used for verification, to prepare the next key or to keep the previous key.
+func NewManager(keys ...crypto.Signer) (Manager, error) {
+	ks, err := newKeySet(keys, time.Now())
+	if err != nil {
+		return Manager{}, err
+	}
+
+	m := Manager{
+		keys:       new(atomic.Value),
+		clientJWKS: NewClientJWKSCache(),
+		revoked:    NewRevocationList(),
+	}
+	m.keys.Store(ks)
+	return m, nil
+}
+
+func newKeySet(keys []crypto.Signer, now time.Time) (*keySet, error) {
+	if len(keys) == 0 {
+		return nil, NoKeyError
+	}
+
+	ks := &keySet{
+		private:  keys[0],
+		public:   keys[0].Public(),
+		loadedAt: now,
+	}
+
+	seen := make(map[string]bool)
+	for _, k := range keys {
+		if err := validateKey(k); err != nil {
+			return nil, err
+		}
+
+		kid := keyID(k.Public())
+		if !seen[kid] {
+			seen[kid] = true
+			if len(seen) > 1 {
+				ks.published = append(ks.published, k)
+			}
+		}
+	}
+
+	return ks, nil
 }
 
 func GenerateManager() (Manager, error) {
@@ -30,44 +160,254 @@ func GenerateManager() (Manager, error) {
 	return NewManager(pri)
 }
 
-func NewManagerFromFile(file io.Reader) (Manager, error) {
+func parsePrivateKey(block *pem.Block) (crypto.Signer, error) {
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		if signer, ok := key.(crypto.Signer); ok {
+			return signer, nil
+		}
+	}
+	return nil, UnsupportedKeyError
+}
+
+// readPrivateKeys reads all private keys in the PEM file, in order of the file.
+// Blocks that are not private keys, like EC PARAMETERS, are ignored.
+func readPrivateKeys(file io.Reader) ([]crypto.Signer, error) {
 	raw, err := io.ReadAll(file)
 	if err != nil {
-		return Manager{}, err
+		return nil, err
+	}
+
+	var keys []crypto.Signer
+	for {
+		var block *pem.Block
+		block, raw = pem.Decode(raw)
+		if block == nil {
+			break
+		}
+		if block.Type != "PRIVATE KEY" && block.Type != "RSA PRIVATE KEY" && block.Type != "EC PRIVATE KEY" {
+			continue
+		}
+
+		key, err := parsePrivateKey(block)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
 	}
 
-	pri, err := jwt.ParseRSAPrivateKeyFromPEM(raw)
+	if len(keys) == 0 {
+		return nil, NoKeyError
+	}
+	return keys, nil
+}
+
+// NewManagerFromFile makes Manager by the keys in the PEM file.
+// See also NewManager.
+func NewManagerFromFile(file io.Reader) (Manager, error) {
+	keys, err := readPrivateKeys(file)
 	if err != nil {
 		return Manager{}, err
 	}
 
-	return NewManager(pri)
+	return NewManager(keys...)
+}
+
+func (m Manager) current() *keySet {
+	return m.keys.Load().(*keySet)
+}
+
+// Rotate replaces the signing key by new key.
+// It is the same as RotateKeys with single key.
+func (m Manager) Rotate(private crypto.Signer, overlap time.Duration) error {
+	return m.RotateKeys([]crypto.Signer{private}, overlap)
+}
+
+// RotateKeys replaces the signing key by the first key, and the published keys by the rest keys.
+//
+// The previous keys are still used for verification until the overlap duration has passed,
+// so the tokens that signed before rotation keep valid.
+// The key set is swapped atomically; any request never sees a half loaded key set.
+// The cached public keys of clients are dropped too, so reloading by SIGHUP also refreshes them.
+func (m Manager) RotateKeys(keys []crypto.Signer, overlap time.Duration) error {
+	now := time.Now()
+
+	next, err := newKeySet(keys, now)
+	if err != nil {
+		return err
+	}
+
+	active := make(map[string]bool)
+	for _, k := range next.verifyKeys() {
+		active[keyID(k.Public())] = true
+	}
+
+	old := m.current()
+	if overlap > 0 {
+		for _, k := range append([]crypto.Signer{old.private}, old.published...) {
+			if kid := keyID(k.Public()); !active[kid] {
+				active[kid] = true
+				next.retired = append(next.retired, retiredKey{
+					private:   k,
+					expiresAt: now.Add(overlap),
+				})
+			}
+		}
+	}
+	for _, k := range old.retired {
+		if kid := keyID(k.private.Public()); now.Before(k.expiresAt) && !active[kid] {
+			active[kid] = true
+			next.retired = append(next.retired, k)
+		}
+	}
+
+	m.keys.Store(next)
+	m.InvalidateClientKeys()
+	return nil
+}
+
+// RotateFromFile loads and validates new keys from file, and then calls RotateKeys.
+// The current keys are kept if failed to load new keys.
+func (m Manager) RotateFromFile(file io.Reader, overlap time.Duration) error {
+	keys, err := readPrivateKeys(file)
+	if err != nil {
+		return err
+	}
+	return m.RotateKeys(keys, overlap)
+}
+
+// ModifiedAt returns the last time that the published keys changed.
+// It is the time of loading or rotating the key, or expiring the retired key.
+func (m Manager) ModifiedAt() time.Time {
+	ks := m.current()
+	modified := ks.loadedAt
+	now := time.Now()
+	for _, k := range ks.retired {
+		if k.expiresAt.After(modified) && !now.Before(k.expiresAt) {
+			modified = k.expiresAt
+		}
+	}
+	return modified
 }
 
-func (m Manager) PublicKey() *rsa.PublicKey {
-	return m.public
+func (m Manager) PublicKey() crypto.PublicKey {
+	return m.current().public
+}
+
+// SigningAlgorithms returns the algorithms of the published keys, in order of the current signing key first.
+func (m Manager) SigningAlgorithms() []string {
+	var algs []string
+	seen := make(map[string]bool)
+	for _, k := range m.current().verifyKeys() {
+		if alg := signingMethod(k.Public()).Alg(); !seen[alg] {
+			seen[alg] = true
+			algs = append(algs, alg)
+		}
+	}
+	return algs
+}
+
+// WithClientKeyCache returns a copy of Manager that uses the cache for parsing public keys of clients.
+func (m Manager) WithClientKeyCache(cache *ClientKeyCache) Manager {
+	m.clientKeys = cache
+	return m
+}
+
+// InvalidateClientKeys drops the cached public keys of clients, including JWK Sets that fetched from jwks_uri.
+func (m Manager) InvalidateClientKeys() {
+	m.clientKeys.Invalidate()
+	m.clientJWKS.Invalidate()
+}
+
+// WithAudienceArray returns a copy of Manager that encodes the aud claim as an array even if the token has single audience.
+func (m Manager) WithAudienceArray(enable bool) Manager {
+	m.audienceArray = enable
+	return m
+}
+
+// Revoke makes the token that has the ID (jti) invalid until it expires.
+func (m Manager) Revoke(id string, expiresAt time.Time) {
+	m.revoked.Revoke(id, expiresAt)
+}
+
+// IsRevoked checks if the token that has the ID (jti) is revoked.
+func (m Manager) IsRevoked(id string) bool {
+	return m.revoked.IsRevoked(id)
 }
 
 func (m Manager) KeyID() uuid.UUID {
-	return uuid.NewSHA1(uuid.NameSpaceX500, x509.MarshalPKCS1PublicKey(m.public))
+	return uuid.NewSHA1(uuid.NameSpaceX500, keyBytes(m.PublicKey()))
 }
 
 func (m Manager) create(claims jwt.Claims) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
-	token.Header["kid"] = m.KeyID().String()
-	return token.SignedString(m.private)
+	return m.createWith(m.current(), claims)
 }
 
-func (m Manager) parse(token string, signKey string, claims jwt.Claims) (*jwt.Token, error) {
-	parsed, err := jwt.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+// createWith signs the token by the key set, for the claims that depends on the signing algorithm like at_hash.
+func (m Manager) createWith(ks *keySet, claims jwt.Claims) (string, error) {
+	if m.audienceArray {
+		claims = arrayAudienceClaims{claims}
+	}
+
+	token := jwt.NewWithClaims(signingMethod(ks.public), claims)
+	token.Header["kid"] = keyID(ks.public)
+	return token.SignedString(ks.private)
+}
+
+// verifyAlgorithm pins signing algorithm to the expected one for the verification key.
+// It rejects tokens that uses alg:none or other algorithms like HS256 that signed by the public key.
+func verifyAlgorithm(t *jwt.Token, expected jwt.SigningMethod) error {
+	if t.Method == nil || t.Method.Alg() != expected.Alg() {
+		return UnexpectedAlgorithmError
+	}
+	return nil
+}
+
+// parse parses and verifies signed tokens by the keys of this Manager.
+// If signKey is set, the token is verified by it as the public key of the client.
+func (m Manager) parse(token, clientID, signKey string, claims jwt.Claims) (*jwt.Token, error) {
+	ks := m.current()
+
+	return parseWithKey(token, claims, func(t *jwt.Token) (interface{}, error) {
 		if signKey != "" {
-			return jwt.ParseRSAPublicKeyFromPEM([]byte(signKey))
+			if err := verifyAlgorithm(t, jwt.SigningMethodRS256); err != nil {
+				return nil, err
+			}
+			return m.clientKeys.Get(clientID, signKey)
+		}
+
+		public := ks.public
+		if kid, ok := t.Header["kid"].(string); ok {
+			if pub, ok := ks.findPublicKey(kid); ok {
+				public = pub
+			}
+		}
+		if err := verifyAlgorithm(t, signingMethod(public)); err != nil {
+			return nil, err
 		}
-		return m.public, nil
+		return public, nil
 	})
+}
+
+// parseWithKey is the only way to parse and verify signed tokens.
+// All tokens, including tokens issued by clients, are verified through this.
+// The keyFunc must check the algorithm of the token before returning the key.
+func parseWithKey(token string, claims jwt.Claims, keyFunc jwt.Keyfunc) (*jwt.Token, error) {
+	parsed, err := jwt.ParseWithClaims(token, claims, keyFunc)
 	if e, ok := err.(*jwt.ValidationError); ok && e.Errors == jwt.ValidationErrorExpired {
 		return nil, TokenExpiredError
 	}
+	if e, ok := err.(*jwt.ValidationError); ok && (e.Inner == UnexpectedAlgorithmError || e.Inner == KeyNotFoundError) {
+		return nil, e.Inner
+	}
 	if err != nil {
 		return nil, err
 	}
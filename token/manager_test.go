@@ -0,0 +1,354 @@
+package token_test
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/testutil"
+	"github.com/macrat/lauth/token"
+	"gopkg.in/dgrijalva/jwt-go.v3"
+)
+
+func TestManager_Rotate(t *testing.T) {
+	issuer := &config.URL{Scheme: "http", Host: "localhost:8000"}
+
+	manager, err := testutil.MakeTokenManager()
+	if err != nil {
+		t.Fatalf("failed to generate TokenManager: %s", err)
+	}
+
+	oldToken, err := manager.CreateAccessToken(issuer, "someone", "some_client_id", "openid", "", token.Authentication{Time: time.Now()}, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create access token: %s", err)
+	}
+	oldCode, err := manager.CreateCode(issuer, "someone", "some_client_id", "http://localhost", "openid", "", token.Authentication{Time: time.Now()}, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create code: %s", err)
+	}
+	oldKeyID := manager.KeyID()
+
+	newKey, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatalf("failed to generate new key: %s", err)
+	}
+	if err := manager.Rotate(newKey, 200*time.Millisecond); err != nil {
+		t.Fatalf("failed to rotate key: %s", err)
+	}
+
+	if manager.KeyID() == oldKeyID {
+		t.Errorf("key ID is not changed after rotation")
+	}
+	if keys, err := manager.JWKs("localhost"); err != nil {
+		t.Errorf("failed to get JWKs: %s", err)
+	} else if len(keys) != 2 {
+		t.Errorf("expected JWKs includes current and previous key but got %d keys", len(keys))
+	}
+
+	if _, err := manager.ParseAccessToken(oldToken); err != nil {
+		t.Errorf("failed to parse token that signed by previous key in overlap window: %s", err)
+	}
+	if _, err := manager.ParseCode(oldCode); err != nil {
+		t.Errorf("failed to parse code that encrypted by previous key in overlap window: %s", err)
+	}
+
+	time.Sleep(300 * time.Millisecond)
+
+	if _, err := manager.ParseAccessToken(oldToken); err == nil {
+		t.Errorf("expected failure to parse token that signed by previous key after overlap window but success")
+	}
+	if _, err := manager.ParseCode(oldCode); err == nil {
+		t.Errorf("expected failure to parse code that encrypted by previous key after overlap window but success")
+	}
+	if keys, err := manager.JWKs("localhost"); err != nil {
+		t.Errorf("failed to get JWKs: %s", err)
+	} else if len(keys) != 1 {
+		t.Errorf("expected JWKs includes only current key but got %d keys", len(keys))
+	}
+
+	currentKeyID := manager.KeyID()
+	if err := manager.RotateFromFile(bytes.NewReader([]byte("this is not a key")), time.Hour); err == nil {
+		t.Errorf("expected failure to rotate with invalid key but success")
+	}
+	if manager.KeyID() != currentKeyID {
+		t.Errorf("the key set was changed by failed rotation")
+	}
+}
+
+func TestManager_RotateConcurrently(t *testing.T) {
+	issuer := &config.URL{Scheme: "http", Host: "localhost:8000"}
+
+	manager, err := testutil.MakeTokenManager()
+	if err != nil {
+		t.Fatalf("failed to generate TokenManager: %s", err)
+	}
+
+	var keys [][]byte
+	for i := 0; i < 4; i++ {
+		pri, err := rsa.GenerateKey(rand.Reader, 512)
+		if err != nil {
+			t.Fatalf("failed to generate key: %s", err)
+		}
+		keys = append(keys, pem.EncodeToMemory(&pem.Block{
+			Type:  "RSA PRIVATE KEY",
+			Bytes: x509.MarshalPKCS1PrivateKey(pri),
+		}))
+	}
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				tok, err := manager.CreateAccessToken(issuer, "someone", "some_client_id", "openid", "", token.Authentication{Time: time.Now()}, time.Hour)
+				if err != nil {
+					t.Errorf("failed to create access token: %s", err)
+					return
+				}
+				if _, err := manager.ParseAccessToken(tok); err != nil {
+					t.Errorf("failed to parse access token: %s", err)
+					return
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 20; i++ {
+		if err := manager.RotateFromFile(bytes.NewReader(keys[i%len(keys)]), time.Minute); err != nil {
+			t.Errorf("failed to rotate key: %s", err)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	close(stop)
+	wg.Wait()
+}
+
+func TestManager_RejectUnexpectedAlgorithm(t *testing.T) {
+	manager, err := testutil.MakeTokenManager()
+	if err != nil {
+		t.Fatalf("failed to generate TokenManager: %s", err)
+	}
+
+	rawPublicKey, err := x509.MarshalPKIXPublicKey(manager.PublicKey())
+	if err != nil {
+		t.Fatalf("failed to marshal public key: %s", err)
+	}
+	managerPublicKey := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: rawPublicKey})
+
+	anotherKey, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	anotherECKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+
+	claims := jwt.MapClaims{
+		"iss": "some_client_id",
+		"sub": "some_client_id",
+		"aud": "http://localhost:8000",
+		"exp": time.Now().Add(10 * time.Minute).Unix(),
+		"typ": "ACCESS_TOKEN",
+	}
+	sign := func(method jwt.SigningMethod, key interface{}) string {
+		token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatalf("failed to sign token: %s", err)
+		}
+		return token
+	}
+
+	serverTokens := map[string]string{
+		"none":                  sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType),
+		"HS256 with public key": sign(jwt.SigningMethodHS256, managerPublicKey),
+		"HS256 with client key": sign(jwt.SigningMethodHS256, []byte(testutil.SomeClientPublicKey)),
+		"RS512":                 sign(jwt.SigningMethodRS512, anotherKey),
+		"ES256":                 sign(jwt.SigningMethodES256, anotherECKey),
+	}
+	clientTokens := map[string]string{
+		"none":                  serverTokens["none"],
+		"HS256 with client key": serverTokens["HS256 with client key"],
+		"RS512":                 serverTokens["RS512"],
+		"ES256":                 serverTokens["ES256"],
+	}
+
+	parsers := map[string]func(string) error{
+		"access_token": func(raw string) error {
+			_, err := manager.ParseAccessToken(raw)
+			return err
+		},
+		"id_token": func(raw string) error {
+			_, err := manager.ParseIDToken(raw)
+			return err
+		},
+		"refresh_token": func(raw string) error {
+			_, err := manager.ParseRefreshToken(raw)
+			return err
+		},
+		"sso_token": func(raw string) error {
+			_, err := manager.ParseSSOToken(raw)
+			return err
+		},
+	}
+	clientParsers := map[string]func(string) error{
+		"request_object": func(raw string) error {
+			_, err := manager.ParseRequestObject(raw, "some_client_id", testutil.SomeClientPublicKey)
+			return err
+		},
+		"client_assertion": func(raw string) error {
+			_, err := manager.ParseClientAssertion(raw, "some_client_id", testutil.SomeClientPublicKey)
+			return err
+		},
+	}
+
+	for parserName, parse := range parsers {
+		for tokenName, raw := range serverTokens {
+			if err := parse(raw); err != token.UnexpectedAlgorithmError {
+				t.Errorf("%s: %s: unexpected error: %v", parserName, tokenName, err)
+			}
+		}
+	}
+	for parserName, parse := range clientParsers {
+		for tokenName, raw := range clientTokens {
+			if err := parse(raw); err != token.UnexpectedAlgorithmError {
+				t.Errorf("%s: %s: unexpected error: %v", parserName, tokenName, err)
+			}
+		}
+	}
+}
+
+func TestManager_ModifiedAt(t *testing.T) {
+	manager, err := testutil.MakeTokenManager()
+	if err != nil {
+		t.Fatalf("failed to generate TokenManager: %s", err)
+	}
+
+	loaded := manager.ModifiedAt()
+	if loaded.IsZero() || loaded.After(time.Now()) {
+		t.Fatalf("unexpected modified time: %s", loaded)
+	}
+
+	newKey, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatalf("failed to generate new key: %s", err)
+	}
+	if err := manager.Rotate(newKey, 100*time.Millisecond); err != nil {
+		t.Fatalf("failed to rotate key: %s", err)
+	}
+
+	rotated := manager.ModifiedAt()
+	if !rotated.After(loaded) {
+		t.Errorf("modified time should be updated by rotation: %s -> %s", loaded, rotated)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+
+	if expired := manager.ModifiedAt(); !expired.After(rotated) {
+		t.Errorf("modified time should be updated when the retired key expired: %s -> %s", rotated, expired)
+	}
+}
+
+func TestNewManagerFromFile_MultipleKeys(t *testing.T) {
+	issuer := &config.URL{Scheme: "http", Host: "localhost:8000"}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 512)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+
+	rawEC, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %s", err)
+	}
+	buf := bytes.NewBuffer(nil)
+	pem.Encode(buf, &pem.Block{Type: "EC PARAMETERS", Bytes: []byte{0x06, 0x08, 0x2a, 0x86, 0x48, 0xce, 0x3d, 0x03, 0x01, 0x07}})
+	pem.Encode(buf, &pem.Block{Type: "PRIVATE KEY", Bytes: rawEC})
+	pem.Encode(buf, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(rsaKey)})
+
+	manager, err := token.NewManagerFromFile(buf)
+	if err != nil {
+		t.Fatalf("failed to load keys: %s", err)
+	}
+
+	if algs := manager.SigningAlgorithms(); !reflect.DeepEqual(algs, []string{"ES256", "RS256"}) {
+		t.Errorf("unexpected signing algorithms: %v", algs)
+	}
+	if keys, err := manager.JWKs("localhost"); err != nil {
+		t.Errorf("failed to get JWKs: %s", err)
+	} else if len(keys) != 2 || keys[0].Algorithm != "ES256" || keys[1].Algorithm != "RS256" {
+		t.Errorf("expected JWKs includes the signing key and the published key but got %#v", keys)
+	}
+
+	signed, err := manager.CreateAccessToken(issuer, "someone", "some_client_id", "openid", "", token.Authentication{Time: time.Now()}, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create access token: %s", err)
+	}
+	if parsed, _, err := new(jwt.Parser).ParseUnverified(signed, jwt.MapClaims{}); err != nil {
+		t.Errorf("failed to parse access token: %s", err)
+	} else if parsed.Method.Alg() != "ES256" {
+		t.Errorf("access token should be signed by the first key but got %s", parsed.Method.Alg())
+	}
+
+	rsaManager, err := token.NewManager(rsaKey)
+	if err != nil {
+		t.Fatalf("failed to make manager: %s", err)
+	}
+	published, err := rsaManager.CreateAccessToken(issuer, "someone", "some_client_id", "openid", "", token.Authentication{Time: time.Now()}, time.Hour)
+	if err != nil {
+		t.Fatalf("failed to create access token: %s", err)
+	}
+	if _, err := manager.ParseAccessToken(published); err != nil {
+		t.Errorf("failed to parse token that signed by the published key: %s", err)
+	}
+}
+
+func TestNewManagerFromFile_InvalidKeys(t *testing.T) {
+	p224, err := ecdsa.GenerateKey(elliptic.P224(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %s", err)
+	}
+	rawP224, err := x509.MarshalECPrivateKey(p224)
+	if err != nil {
+		t.Fatalf("failed to marshal key: %s", err)
+	}
+
+	tests := []struct {
+		Name  string
+		PEM   []byte
+		Error error
+	}{
+		{"empty", []byte{}, token.NoKeyError},
+		{"public key only", pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: []byte("dummy")}), token.NoKeyError},
+		{"P-224", pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: rawP224}), token.UnsupportedKeyError},
+	}
+
+	for _, tt := range tests {
+		if _, err := token.NewManagerFromFile(bytes.NewReader(tt.PEM)); err != tt.Error {
+			t.Errorf("%s: unexpected error: %v", tt.Name, err)
+		}
+	}
+}
@@ -1,6 +1,8 @@
 package token
 
 import (
+	"time"
+
 	"github.com/macrat/lauth/config"
 	"gopkg.in/dgrijalva/jwt-go.v3"
 )
@@ -8,8 +10,30 @@ import (
 type OIDCClaims struct {
 	jwt.StandardClaims
 
-	Type     string `json:"typ"`
-	AuthTime int64  `json:"auth_time,omitempty"`
+	Audience Audience `json:"aud,omitempty"`
+	Type     string   `json:"typ"`
+	AuthTime int64    `json:"auth_time,omitempty"`
+	ACR      string   `json:"acr,omitempty"`
+	AMR      []string `json:"amr,omitempty"`
+}
+
+// Authentication is how the user was authenticated.
+// It is carried from the code or the refresh token to tokens issued from them,
+// so the ID token, userinfo, and introspection report the same acr, amr, and auth_time.
+// ACR and AMR are omitted from tokens if empty.
+type Authentication struct {
+	Time time.Time
+	ACR  string
+	AMR  []string
+}
+
+// Authentication returns how the user was authenticated, to issue other tokens for the same authentication.
+func (claims OIDCClaims) Authentication() Authentication {
+	return Authentication{
+		Time: time.Unix(claims.AuthTime, 0),
+		ACR:  claims.ACR,
+		AMR:  claims.AMR,
+	}
 }
 
 func (claims OIDCClaims) Validate(issuer *config.URL, audience string) error {
@@ -17,11 +41,11 @@ func (claims OIDCClaims) Validate(issuer *config.URL, audience string) error {
 		return err
 	}
 
-	if claims.Issuer != issuer.String() {
+	if !issuer.Equivalent(claims.Issuer) {
 		return UnexpectedIssuerError
 	}
 
-	if claims.Audience != audience {
+	if !claims.Audience.Includes(audience) {
 		return UnexpectedAudienceError
 	}
 
@@ -23,9 +23,9 @@ func TestOIDCCLaims_Validate(t *testing.T) {
 				StandardClaims: jwt.StandardClaims{
 					Issuer:    "https://example.com",
 					Subject:   "someone",
-					Audience:  "something",
 					ExpiresAt: time.Now().Add(5 * time.Minute).Unix(),
 				},
+				Audience: token.Audience{"something"},
 			},
 			Issuer:   &config.URL{Scheme: "https", Host: "example.com"},
 			Audience: "something",
@@ -37,37 +37,79 @@ func TestOIDCCLaims_Validate(t *testing.T) {
 				StandardClaims: jwt.StandardClaims{
 					Issuer:    "https://example.com",
 					Subject:   "someone",
-					Audience:  "something",
 					ExpiresAt: time.Now().Add(5 * time.Minute).Unix(),
 				},
+				Audience: token.Audience{"something"},
 			},
 			Issuer:   &config.URL{Scheme: "https", Host: "invalid.example.com"},
 			Audience: "something",
 			Error:    "unexpected issuer",
 		},
+		{
+			Name: "equivalent issuer",
+			Claims: token.OIDCClaims{
+				StandardClaims: jwt.StandardClaims{
+					Issuer:    "HTTPS://Example.com:443/",
+					Subject:   "someone",
+					ExpiresAt: time.Now().Add(5 * time.Minute).Unix(),
+				},
+				Audience: token.Audience{"something"},
+			},
+			Issuer:   &config.URL{Scheme: "https", Host: "example.com"},
+			Audience: "something",
+			Error:    "",
+		},
+		{
+			Name: "different issuer path",
+			Claims: token.OIDCClaims{
+				StandardClaims: jwt.StandardClaims{
+					Issuer:    "https://example.com/another",
+					Subject:   "someone",
+					ExpiresAt: time.Now().Add(5 * time.Minute).Unix(),
+				},
+				Audience: token.Audience{"something"},
+			},
+			Issuer:   &config.URL{Scheme: "https", Host: "example.com", Path: "/path"},
+			Audience: "something",
+			Error:    "unexpected issuer",
+		},
 		{
 			Name: "incorrect audience",
 			Claims: token.OIDCClaims{
 				StandardClaims: jwt.StandardClaims{
 					Issuer:    "https://example.com",
 					Subject:   "someone",
-					Audience:  "something",
 					ExpiresAt: time.Now().Add(5 * time.Minute).Unix(),
 				},
+				Audience: token.Audience{"something"},
 			},
 			Issuer:   &config.URL{Scheme: "https", Host: "example.com"},
 			Audience: "another",
 			Error:    "unexpected audience",
 		},
+		{
+			Name: "multiple audiences",
+			Claims: token.OIDCClaims{
+				StandardClaims: jwt.StandardClaims{
+					Issuer:    "https://example.com",
+					Subject:   "someone",
+					ExpiresAt: time.Now().Add(5 * time.Minute).Unix(),
+				},
+				Audience: token.Audience{"another", "something"},
+			},
+			Issuer:   &config.URL{Scheme: "https", Host: "example.com"},
+			Audience: "something",
+			Error:    "",
+		},
 		{
 			Name: "expired",
 			Claims: token.OIDCClaims{
 				StandardClaims: jwt.StandardClaims{
 					Issuer:    "https://example.com",
 					Subject:   "someone",
-					Audience:  "something",
 					ExpiresAt: time.Now().Add(-5 * time.Minute).Unix(),
 				},
+				Audience: token.Audience{"something"},
 			},
 			Issuer:   &config.URL{Scheme: "https", Host: "example.com"},
 			Audience: "something",
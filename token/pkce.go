@@ -0,0 +1,66 @@
+package token
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+
+	"github.com/macrat/lauth/config"
+)
+
+// IsValidCodeVerifier reports whether the value has the format of code_verifier or code_challenge.
+// It must be 43 to 128 characters of [A-Za-z0-9-._~]. (RFC 7636 section 4.1)
+func IsValidCodeVerifier(value string) bool {
+	if len(value) < 43 || len(value) > 128 {
+		return false
+	}
+	for _, c := range value {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9':
+		case c == '-', c == '.', c == '_', c == '~':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// MakeCodeChallenge converts code_verifier to code_challenge by the method.
+func MakeCodeChallenge(verifier, method string) (string, error) {
+	switch method {
+	case config.CODE_CHALLENGE_METHOD_PLAIN, "":
+		return verifier, nil
+	case config.CODE_CHALLENGE_METHOD_S256:
+		hash := sha256.Sum256([]byte(verifier))
+		return base64.RawURLEncoding.EncodeToString(hash[:]), nil
+	default:
+		return "", UnsupportedChallengeError
+	}
+}
+
+// VerifyCodeVerifier checks code_verifier with the code_challenge that bound to this code.
+// The method is treated as plain if omitted. (RFC 7636 section 4.3)
+func (claims CodeClaims) VerifyCodeVerifier(verifier string) error {
+	if claims.CodeChallenge == "" {
+		if verifier != "" {
+			return UnexpectedCodeVerifierError
+		}
+		return nil
+	}
+
+	if verifier == "" {
+		return CodeVerifierRequiredError
+	}
+	if !IsValidCodeVerifier(verifier) {
+		return InvalidCodeVerifierError
+	}
+
+	challenge, err := MakeCodeChallenge(verifier, claims.CodeChallengeMethod)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(challenge), []byte(claims.CodeChallenge)) != 1 {
+		return CodeVerifierMismatchError
+	}
+	return nil
+}
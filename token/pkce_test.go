@@ -0,0 +1,101 @@
+package token_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/testutil"
+	"github.com/macrat/lauth/token"
+)
+
+func TestMakeCodeChallenge(t *testing.T) {
+	// The example in RFC 7636 appendix B.
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+	if challenge, err := token.MakeCodeChallenge(verifier, "S256"); err != nil {
+		t.Errorf("failed to make S256 challenge: %s", err)
+	} else if challenge != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("unexpected S256 challenge: %s", challenge)
+	}
+
+	if challenge, err := token.MakeCodeChallenge(verifier, "plain"); err != nil {
+		t.Errorf("failed to make plain challenge: %s", err)
+	} else if challenge != verifier {
+		t.Errorf("unexpected plain challenge: %s", challenge)
+	}
+
+	if _, err := token.MakeCodeChallenge(verifier, "S512"); err != token.UnsupportedChallengeError {
+		t.Errorf("unexpected error for unsupported method: %v", err)
+	}
+}
+
+func TestIsValidCodeVerifier(t *testing.T) {
+	tests := []struct {
+		Value string
+		OK    bool
+	}{
+		{"dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk", true},
+		{"abc.DEF-123_~" + strings.Repeat("x", 30), true},
+		{strings.Repeat("a", 128), true},
+		{strings.Repeat("a", 42), false},
+		{strings.Repeat("a", 129), false},
+		{strings.Repeat("a", 42) + "+", false},
+		{strings.Repeat("a", 42) + "=", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if ok := token.IsValidCodeVerifier(tt.Value); ok != tt.OK {
+			t.Errorf("%#v: expected %v but got %v", tt.Value, tt.OK, ok)
+		}
+	}
+}
+
+func TestCodeClaims_VerifyCodeVerifier(t *testing.T) {
+	tokenManager, err := testutil.MakeTokenManager()
+	if err != nil {
+		t.Fatalf("failed to generate TokenManager: %s", err)
+	}
+
+	issuer := &config.URL{Scheme: "http", Host: "localhost:8000"}
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+
+	tests := []struct {
+		Challenge string
+		Method    string
+		Verifier  string
+		Err       error
+	}{
+		{"", "", "", nil},
+		{"", "", verifier, token.UnexpectedCodeVerifierError},
+		{"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", "S256", verifier, nil},
+		{"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", "S256", "", token.CodeVerifierRequiredError},
+		{"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", "S256", verifier[1:] + "x", token.CodeVerifierMismatchError},
+		{"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", "S256", "too-short", token.InvalidCodeVerifierError},
+		{"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", "plain", verifier, token.CodeVerifierMismatchError},
+		{verifier, "plain", verifier, nil},
+		{verifier, "", verifier, nil},
+	}
+
+	for i, tt := range tests {
+		code, err := tokenManager.CreateCodeWithChallenge(issuer, "someone", "something", "http://something", "openid", "", tt.Challenge, tt.Method, token.Authentication{Time: time.Now()}, 10*time.Minute)
+		if err != nil {
+			t.Fatalf("%d: failed to generate code: %s", i, err)
+		}
+
+		claims, err := tokenManager.ParseCode(code)
+		if err != nil {
+			t.Fatalf("%d: failed to parse code: %s", i, err)
+		}
+
+		if claims.CodeChallenge != tt.Challenge || claims.CodeChallengeMethod != tt.Method {
+			t.Errorf("%d: unexpected challenge in code: %#v %#v", i, claims.CodeChallenge, claims.CodeChallengeMethod)
+		}
+
+		if err := claims.VerifyCodeVerifier(tt.Verifier); err != tt.Err {
+			t.Errorf("%d: expected error %v but got %v", i, tt.Err, err)
+		}
+	}
+}
@@ -13,6 +13,11 @@ type RefreshTokenClaims struct {
 	ClientID string `json:"client_id"`
 	Scope    string `json:"scope,omitempty"`
 	Nonce    string `json:"nonce,omitempty"`
+
+	Claims *ClaimsRequest `json:"claims,omitempty"`
+
+	// GrantID is the ID of the authorization grant, that is shared with access tokens issued by the same grant.
+	GrantID string `json:"gid,omitempty"`
 }
 
 func (claims RefreshTokenClaims) Validate(issuer *config.URL) error {
@@ -31,29 +36,43 @@ func (claims RefreshTokenClaims) Validate(issuer *config.URL) error {
 	return nil
 }
 
-func (m Manager) CreateRefreshToken(issuer *config.URL, subject, clientID, scope, nonce string, authTime time.Time, expiresIn time.Duration) (string, error) {
+func (m Manager) CreateRefreshToken(issuer *config.URL, subject, clientID, scope, nonce string, auth Authentication, expiresIn time.Duration) (string, error) {
+	return m.CreateRefreshTokenWithClaims(issuer, subject, clientID, scope, nonce, "", nil, auth, expiresIn)
+}
+
+// CreateRefreshTokenWithClaims creates a new refresh token that carries the claims parameter, to issue tokens with the same claims by refreshing.
+// The grantID is shared with access tokens issued by the same grant, to invalidate them when the refresh token is revoked.
+func (m Manager) CreateRefreshTokenWithClaims(issuer *config.URL, subject, clientID, scope, nonce, grantID string, claims *ClaimsRequest, auth Authentication, expiresIn time.Duration) (string, error) {
 	return m.create(RefreshTokenClaims{
 		OIDCClaims: OIDCClaims{
 			StandardClaims: jwt.StandardClaims{
 				Issuer:    issuer.String(),
 				Subject:   subject,
-				Audience:  issuer.String(),
 				ExpiresAt: time.Now().Add(expiresIn).Unix(),
 				IssuedAt:  time.Now().Unix(),
+				Id:        m.newJTI(),
 			},
+			Audience: Audience{issuer.String()},
 			Type:     "REFRESH_TOKEN",
-			AuthTime: authTime.Unix(),
+			AuthTime: auth.Time.Unix(),
+			ACR:      auth.ACR,
+			AMR:      auth.AMR,
 		},
 		ClientID: clientID,
 		Scope:    scope,
 		Nonce:    nonce,
+		Claims:   claims,
+		GrantID:  grantID,
 	})
 }
 
 func (m Manager) ParseRefreshToken(token string) (RefreshTokenClaims, error) {
 	var claims RefreshTokenClaims
-	if _, err := m.parse(token, "", &claims); err != nil {
+	if _, err := m.parse(token, "", "", &claims); err != nil {
 		return RefreshTokenClaims{}, err
 	}
+	if m.IsRevoked(claims.Id) {
+		return RefreshTokenClaims{}, TokenRevokedError
+	}
 	return claims, nil
 }
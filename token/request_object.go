@@ -10,15 +10,24 @@ import (
 type RequestObjectClaims struct {
 	jwt.StandardClaims
 
+	Audience Audience `json:"aud,omitempty"`
+
 	ResponseType string `json:"response_type,omitempty"`
+	ResponseMode string `json:"response_mode,omitempty"`
 	ClientID     string `json:"client_id,omitempty"`
 	RedirectURI  string `json:"redirect_uri,omitempty"`
 	Scope        string `json:"scope,omitempty"`
 	State        string `json:"state,omitempty"`
+	HasState     bool   `json:"has_state,omitempty"`
 	Nonce        string `json:"nonce,omitempty"`
 	MaxAge       int64  `json:"max_age,omitempty"`
 	Prompt       string `json:"prompt,omitempty"`
 	LoginHint    string `json:"login_hint,omitempty"`
+
+	Claims *ClaimsRequest `json:"claims,omitempty"`
+
+	CodeChallenge       string `json:"code_challenge,omitempty"`
+	CodeChallengeMethod string `json:"code_challenge_method,omitempty"`
 }
 
 func (claims RequestObjectClaims) Validate(issuer string, audience *config.URL) error {
@@ -30,26 +39,28 @@ func (claims RequestObjectClaims) Validate(issuer string, audience *config.URL)
 		return UnexpectedIssuerError
 	}
 
-	if claims.Audience != audience.String() {
-		return UnexpectedAudienceError
+	for _, aud := range claims.Audience {
+		if audience.Equivalent(aud) {
+			return nil
+		}
 	}
-
-	return nil
+	return UnexpectedAudienceError
 }
 
 func (m Manager) CreateRequestObject(issuer *config.URL, subject string, request RequestObjectClaims, expiresAt time.Time) (string, error) {
 	request.Issuer = issuer.String()
 	request.Subject = subject
-	request.Audience = issuer.String()
+	request.Audience = Audience{issuer.String()}
 	request.ExpiresAt = expiresAt.Unix()
 	request.IssuedAt = time.Now().Unix()
 
 	return m.create(request)
 }
 
-func (m Manager) ParseRequestObject(token string, signKey string) (RequestObjectClaims, error) {
+// ParseRequestObject parses request object that signed by the client, or by lauth itself if signKey is empty.
+func (m Manager) ParseRequestObject(token, clientID, signKey string) (RequestObjectClaims, error) {
 	var claims RequestObjectClaims
-	if _, err := m.parse(token, signKey, &claims); err != nil {
+	if _, err := m.parse(token, clientID, signKey, &claims); err != nil {
 		return RequestObjectClaims{}, err
 	}
 	return claims, nil
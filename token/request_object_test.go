@@ -24,11 +24,11 @@ func TestRequestToken(t *testing.T) {
 		"state":        "hello world",
 	})
 
-	if _, err := tokenManager.ParseRequestObject(request, testutil.ImplicitClientPublicKey); err == nil {
+	if _, err := tokenManager.ParseRequestObject(request, "some_client_id", testutil.ImplicitClientPublicKey); err == nil {
 		t.Errorf("expected failure if parse request with another client key but success")
 	}
 
-	claims, err := tokenManager.ParseRequestObject(request, testutil.SomeClientPublicKey)
+	claims, err := tokenManager.ParseRequestObject(request, "some_client_id", testutil.SomeClientPublicKey)
 	if err != nil {
 		t.Fatalf("failed to parse request object: %s", err)
 	}
@@ -74,11 +74,11 @@ func TestRequestToken_SelfIssue(t *testing.T) {
 		t.Fatalf("failed to generate request object: %s", err)
 	}
 
-	if _, err := tokenManager.ParseRequestObject(request, testutil.SomeClientPublicKey); err == nil {
+	if _, err := tokenManager.ParseRequestObject(request, "some_client_id", testutil.SomeClientPublicKey); err == nil {
 		t.Errorf("expected failure if parse request with another client key but success")
 	}
 
-	claims, err := tokenManager.ParseRequestObject(request, "")
+	claims, err := tokenManager.ParseRequestObject(request, "", "")
 	if err != nil {
 		t.Fatalf("failed to parse request object: %s", err)
 	}
@@ -118,7 +118,7 @@ func TestRequestToken_TimedOut(t *testing.T) {
 		t.Fatalf("failed to generate request object: %s", err)
 	}
 
-	_, err = tokenManager.ParseRequestObject(request, "")
+	_, err = tokenManager.ParseRequestObject(request, "", "")
 	if err == nil {
 		t.Errorf("expected error if expired request object but got nil")
 	}
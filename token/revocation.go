@@ -0,0 +1,69 @@
+package token
+
+import (
+	"sync"
+	"time"
+)
+
+// RevocationList keeps IDs (jti) of revoked tokens until the tokens expire.
+//
+// Expired entries are dropped when revoking another token,
+// so the list never grows more than the number of revoked and still alive tokens.
+type RevocationList struct {
+	sync.Mutex
+
+	entries map[string]time.Time
+}
+
+func NewRevocationList() *RevocationList {
+	return &RevocationList{
+		entries: make(map[string]time.Time),
+	}
+}
+
+// Revoke adds the token ID into the list until the expiresAt.
+func (l *RevocationList) Revoke(id string, expiresAt time.Time) {
+	if l == nil || id == "" {
+		return
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	l.collect(time.Now())
+	l.entries[id] = expiresAt
+}
+
+// IsRevoked checks if the token ID is revoked.
+func (l *RevocationList) IsRevoked(id string) bool {
+	if l == nil || id == "" {
+		return false
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	expiresAt, ok := l.entries[id]
+	return ok && time.Now().Before(expiresAt)
+}
+
+// Len returns the number of revoked tokens that not expired yet.
+func (l *RevocationList) Len() int {
+	if l == nil {
+		return 0
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	l.collect(time.Now())
+	return len(l.entries)
+}
+
+func (l *RevocationList) collect(now time.Time) {
+	for id, expiresAt := range l.entries {
+		if !now.Before(expiresAt) {
+			delete(l.entries, id)
+		}
+	}
+}
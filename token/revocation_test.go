@@ -0,0 +1,89 @@
+package token_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/macrat/lauth/config"
+	"github.com/macrat/lauth/testutil"
+	"github.com/macrat/lauth/token"
+)
+
+func TestRevocationList(t *testing.T) {
+	list := token.NewRevocationList()
+
+	list.Revoke("alive", time.Now().Add(10*time.Minute))
+	list.Revoke("expired", time.Now().Add(-10*time.Minute))
+	list.Revoke("", time.Now().Add(10*time.Minute))
+
+	if !list.IsRevoked("alive") {
+		t.Errorf("alive token should be revoked")
+	}
+	if list.IsRevoked("expired") {
+		t.Errorf("expired token should not be reported as revoked")
+	}
+	if list.IsRevoked("unknown") {
+		t.Errorf("unknown token should not be revoked")
+	}
+	if list.IsRevoked("") {
+		t.Errorf("token without ID should not be revoked")
+	}
+
+	if list.Len() != 1 {
+		t.Errorf("expired entries should be dropped but got %d entries", list.Len())
+	}
+
+	var disabled *token.RevocationList
+	disabled.Revoke("alive", time.Now().Add(10*time.Minute))
+	if disabled.IsRevoked("alive") {
+		t.Errorf("nil list should not revoke anything")
+	}
+}
+
+func TestManager_Revoke(t *testing.T) {
+	manager, err := testutil.MakeTokenManager()
+	if err != nil {
+		t.Fatalf("failed to generate TokenManager: %s", err)
+	}
+
+	issuer := &config.URL{Scheme: "http", Host: "localhost:8000"}
+
+	accessToken, err := manager.CreateAccessToken(issuer, "someone", "some_client_id", "openid", "", token.Authentication{Time: time.Now()}, 10*time.Minute)
+	if err != nil {
+		t.Fatalf("failed to create access token: %s", err)
+	}
+	refreshToken, err := manager.CreateRefreshToken(issuer, "someone", "some_client_id", "openid", "", token.Authentication{Time: time.Now()}, 10*time.Minute)
+	if err != nil {
+		t.Fatalf("failed to create refresh token: %s", err)
+	}
+
+	access, err := manager.ParseAccessToken(accessToken)
+	if err != nil {
+		t.Fatalf("failed to parse access token: %s", err)
+	}
+	if access.Id == "" {
+		t.Fatalf("access token should have jti")
+	}
+	refresh, err := manager.ParseRefreshToken(refreshToken)
+	if err != nil {
+		t.Fatalf("failed to parse refresh token: %s", err)
+	}
+	if refresh.Id == "" || refresh.Id == access.Id {
+		t.Fatalf("refresh token should have unique jti but got %#v", refresh.Id)
+	}
+
+	manager.Revoke(access.Id, time.Unix(access.ExpiresAt, 0))
+
+	if _, err := manager.ParseAccessToken(accessToken); err != token.TokenRevokedError {
+		t.Errorf("expected revoked error but got %v", err)
+	}
+	if _, err := manager.ParseRefreshToken(refreshToken); err != nil {
+		t.Errorf("refresh token should not be affected but got %s", err)
+	}
+
+	manager.Revoke(refresh.Id, time.Unix(refresh.ExpiresAt, 0))
+
+	if _, err := manager.ParseRefreshToken(refreshToken); err != token.TokenRevokedError {
+		t.Errorf("expected revoked error but got %v", err)
+	}
+}
@@ -28,6 +28,7 @@ func (azp AuthorizedParties) Append(rp string) AuthorizedParties {
 type SSOTokenClaims struct {
 	OIDCClaims
 
+	SessionID  string            `json:"sid,omitempty"`
 	Authorized AuthorizedParties `json:"azp,omitempty"`
 }
 
@@ -43,26 +44,27 @@ func (claims SSOTokenClaims) Validate(issuer *config.URL) error {
 	return nil
 }
 
-func (m Manager) CreateSSOToken(issuer *config.URL, subject string, authorized AuthorizedParties, authTime time.Time, expiresAt time.Time) (string, error) {
+func (m Manager) CreateSSOToken(issuer *config.URL, subject, sessionID string, authorized AuthorizedParties, authTime time.Time, expiresAt time.Time) (string, error) {
 	return m.create(SSOTokenClaims{
 		OIDCClaims: OIDCClaims{
 			StandardClaims: jwt.StandardClaims{
 				Issuer:    issuer.String(),
 				Subject:   subject,
-				Audience:  issuer.String(),
 				ExpiresAt: expiresAt.Unix(),
 				IssuedAt:  time.Now().Unix(),
 			},
+			Audience: Audience{issuer.String()},
 			Type:     "SSO_TOKEN",
 			AuthTime: authTime.Unix(),
 		},
+		SessionID:  sessionID,
 		Authorized: authorized,
 	})
 }
 
 func (m Manager) ParseSSOToken(token string) (SSOTokenClaims, error) {
 	var claims SSOTokenClaims
-	if _, err := m.parse(token, "", &claims); err != nil {
+	if _, err := m.parse(token, "", "", &claims); err != nil {
 		return SSOTokenClaims{}, err
 	}
 	return claims, nil
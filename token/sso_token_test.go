@@ -46,6 +46,7 @@ func TestSSOToken(t *testing.T) {
 	ssoToken, err := tokenManager.CreateSSOToken(
 		issuer,
 		"someone",
+		"some-session-id",
 		token.AuthorizedParties{"some_client_id"},
 		time.Now(),
 		time.Now().Add(10*time.Minute),
@@ -63,6 +64,10 @@ func TestSSOToken(t *testing.T) {
 		t.Errorf("failed to validate token: %s", err)
 	}
 
+	if claims.SessionID != "some-session-id" {
+		t.Errorf("unexpected session ID: %#v", claims.SessionID)
+	}
+
 	if err = claims.Validate(&config.URL{Host: "another-issuer"}); err == nil {
 		t.Errorf("must be failed if issuer is incorrect but success")
 	} else if err != token.UnexpectedIssuerError {
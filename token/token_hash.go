@@ -2,16 +2,39 @@ package token
 
 import (
 	"bytes"
-	"crypto/sha256"
+	"crypto"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
 	"encoding/base64"
+	"strings"
 )
 
+// hashFor returns the hash function that paired with the JWS algorithm, like SHA-384 for ES384.
+func hashFor(alg string) crypto.Hash {
+	switch {
+	case strings.HasSuffix(alg, "384"):
+		return crypto.SHA384
+	case strings.HasSuffix(alg, "512"):
+		return crypto.SHA512
+	default:
+		return crypto.SHA256
+	}
+}
+
+// TokenHash calculates at_hash or c_hash for the token, for the id_token that signed by RS256 or ES256.
 func TokenHash(token string) string {
-	hash := sha256.Sum256([]byte(token))
+	return TokenHashFor("RS256", token)
+}
+
+// TokenHashFor calculates at_hash or c_hash for the token, that is the left half of the hash paired with the signing algorithm alg.
+func TokenHashFor(alg, token string) string {
+	h := hashFor(alg).New()
+	h.Write([]byte(token))
+	hash := h.Sum(nil)
 
 	buf := bytes.NewBuffer([]byte{})
 	enc := base64.NewEncoder(base64.RawURLEncoding, buf)
-	enc.Write(hash[:128/8])
+	enc.Write(hash[:len(hash)/2])
 	enc.Close()
 
 	return string(buf.Bytes())
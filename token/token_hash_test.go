@@ -30,3 +30,26 @@ func TestTokenHash(t *testing.T) {
 		}
 	}
 }
+
+func TestTokenHashFor(t *testing.T) {
+	tests := []struct {
+		Alg    string
+		Length int
+	}{
+		{"RS256", 22},
+		{"ES256", 22},
+		{"ES384", 32},
+		{"ES512", 43},
+	}
+
+	for _, tt := range tests {
+		h := token.TokenHashFor(tt.Alg, "jHkWEdUXMU1BwAsC4vtUsZwnNvTIxEl0z9K3vx5KF0Y")
+		if len(h) != tt.Length {
+			t.Errorf("%s: expected %d characters but got %d: %s", tt.Alg, tt.Length, len(h), h)
+		}
+	}
+
+	if h := token.TokenHashFor("RS256", "jHkWEdUXMU1BwAsC4vtUsZwnNvTIxEl0z9K3vx5KF0Y"); h != "77QmUPtjPfzWtF2AnpK9RQ" {
+		t.Errorf("hash for RS256 should be the same as TokenHash but got %s", h)
+	}
+}